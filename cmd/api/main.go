@@ -1,12 +1,37 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"denisgodoroja/retask/internal/events"
+	"denisgodoroja/retask/internal/grpcservice"
+	"denisgodoroja/retask/internal/outbox"
 	"denisgodoroja/retask/internal/service"
+	"denisgodoroja/retask/internal/storage"
 	"denisgodoroja/retask/internal/storage/inmemory"
+	"denisgodoroja/retask/internal/storage/postgres"
+	"denisgodoroja/retask/internal/storage/sqlstore"
+	"denisgodoroja/retask/internal/storage/wal"
+	"denisgodoroja/retask/internal/tenant"
+	"denisgodoroja/retask/internal/webhook"
 	"denisgodoroja/retask/internal/webservice"
 )
 
@@ -17,17 +42,158 @@ func main() {
 		port = "8080" // Default for local development
 	}
 
-	// Create the In-Memory repository
-	repo := inmemory.NewInMemoryPackRepo()
+	// Get the gRPC port from environment variable
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090" // Default for local development
+	}
+
+	// Open the database when configured, MySQL or PostgreSQL but not both
+	if os.Getenv("DB_HOST") != "" && os.Getenv("POSTGRES_URL") != "" {
+		log.Fatalf("DB_HOST and POSTGRES_URL are both set, configure a single database")
+	}
+	db := openDB()
+	pool := openPostgres()
+
+	// Create the In-Memory repositories, one per tenant, keeping the packs, their
+	// catalog, schedule and outbox and the calculation history in the database
+	// when there is one
+	var repo storage.PackRepository
+	var catalog storage.CatalogRepository
+	var schedule storage.ScheduleRepository
+	var outboxRepo storage.Outbox
+	var history storage.CalculationRepository
+	switch {
+	case db != nil:
+		repo = sqlstore.NewPackRepo(db, sqlstore.MySQL)
+		catalog = sqlstore.NewCatalogRepo(db, sqlstore.MySQL)
+		schedule = sqlstore.NewScheduleRepo(db, sqlstore.MySQL)
+		outboxRepo = sqlstore.NewOutboxRepo(db, sqlstore.MySQL)
+		history = sqlstore.NewCalculationRepo(db, sqlstore.MySQL)
+	case pool != nil:
+		repo = postgres.NewPackRepo(pool)
+		catalog = postgres.NewCatalogRepo(pool)
+		schedule = postgres.NewScheduleRepo(pool)
+		outboxRepo = postgres.NewOutboxRepo(pool)
+		history = postgres.NewCalculationRepo(pool)
+	default:
+		log.Printf("Neither DB_HOST nor POSTGRES_URL is set, the calculation history is kept in memory")
+		repo = newPackRepo()
+		catalog, schedule = newSettingsRepos()
+		history = inmemory.NewInMemoryCalculationRepo()
+	}
+
+	webhooks := storage.NewTenantWebhookRepo(func(string) storage.WebhookRepository {
+		return inmemory.NewInMemoryWebhookRepo()
+	})
+
+	// Create the dispatcher notifying the webhooks of pack changes
+	dispatcherOpts := []webhook.Option{webhook.WithMaxAttempts(envInt("WEBHOOK_MAX_ATTEMPTS", webhook.DefaultMaxAttempts))}
+	if envBool("WEBHOOK_ALLOW_PRIVATE", false) {
+		dispatcherOpts = append(dispatcherOpts, webhook.WithPrivateDestinations())
+	}
+	dispatcher := webhook.NewDispatcher(dispatcherOpts...)
 
 	// Create the service layer
-	packService := service.NewPackService(repo)
+	serviceOpts := []service.Option{
+		service.WithMaxAmount(envInt("MAX_AMOUNT", 1_000_000_000)),
+		service.WithWorkBudget(envInt("WORK_BUDGET", 1_000_000)),
+		service.WithResultCache(envInt("CACHE_SIZE", 10_000), envDuration("CACHE_TTL", 10*time.Minute)),
+		service.WithCatalog(catalog),
+		service.WithSchedule(schedule),
+		service.WithWebhooks(webhooks, dispatcher),
+		service.WithHistory(history),
+	}
+	for tenantID, n := range envTenantInts("TENANT_MAX_AMOUNTS") {
+		serviceOpts = append(serviceOpts, service.WithTenantMaxAmount(tenantID, n))
+	}
+	if outboxRepo != nil {
+		// The pack changes are journaled in the outbox, relayed below
+		serviceOpts = append(serviceOpts, service.WithOutbox())
+	}
+	packService := service.NewPackService(repo, serviceOpts...)
+
+	// Stop on SIGINT or SIGTERM, such as sent by docker stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Relay the outbox events to the webhooks, until the shutdown
+	relayDone := make(chan struct{})
+	if outboxRepo != nil {
+		relay := outbox.NewRelay(outboxRepo,
+			func(ctx context.Context, e storage.OutboxEvent) error {
+				return deliverOutboxEvent(ctx, packService, e)
+			},
+			outbox.WithInterval(envDuration("OUTBOX_INTERVAL", outbox.DefaultInterval)),
+			outbox.WithMaxAttempts(envInt("OUTBOX_MAX_ATTEMPTS", outbox.DefaultMaxAttempts)),
+		)
+		go func() {
+			defer close(relayDone)
+			relay.Run(ctx)
+		}()
+	} else {
+		close(relayDone)
+	}
 
 	// Create the HTTP handler layer
-	handler := webservice.NewHandler(packService)
+	handler := webservice.NewHandler(packService,
+		webservice.WithCalculationTimeout(envDuration("CALCULATION_TIMEOUT", webservice.DefaultCalculationTimeout)),
+		webservice.WithMaxBodyBytes(int64(envInt("MAX_BODY_BYTES", webservice.DefaultMaxBodyBytes))),
+	)
 
-	// Create the router
-	router := webservice.NewRouter(handler)
+	// Identify the tenants the same way over HTTP and gRPC
+	var resolverOpts []tenant.ResolverOption
+	if ids := os.Getenv("TENANTS"); ids != "" {
+		resolverOpts = append(resolverOpts, tenant.WithAllowed(strings.Split(ids, ",")...))
+	}
+	if secret := os.Getenv("TENANT_TOKEN_SECRET"); secret != "" {
+		resolverOpts = append(resolverOpts, tenant.WithTokenSecret([]byte(secret)))
+	}
+	tenants := tenant.NewResolver(resolverOpts...)
+
+	// Only the proxies in TRUSTED_PROXIES may report the client address
+	proxies, err := webservice.ParseTrustedProxies(strings.Split(os.Getenv("TRUSTED_PROXIES"), ","))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Create the router, and the gRPC server sharing the same service layer and limits
+	routerOpts := []webservice.RouterOption{webservice.WithTrustedProxies(proxies)}
+	grpcOpts := []grpcservice.Option{
+		grpcservice.WithTenantResolver(tenants),
+		grpcservice.WithCalculationTimeout(envDuration("CALCULATION_TIMEOUT", webservice.DefaultCalculationTimeout)),
+	}
+	if rps := envFloat("RATE_LIMIT_RPS", 20); rps > 0 {
+		burst := envInt("RATE_LIMIT_BURST", 40)
+		routerOpts = append(routerOpts, webservice.WithRateLimit(rps, burst))
+		grpcOpts = append(grpcOpts, grpcservice.WithRateLimit(rps, burst))
+	}
+	if rps := envFloat("TENANT_RATE_LIMIT_RPS", 0); rps > 0 {
+		// Shared, so a tenant cannot double its rate by using both APIs
+		limiter := webservice.NewRateLimiter(rps, envInt("TENANT_RATE_LIMIT_BURST", 100))
+		routerOpts = append(routerOpts, webservice.WithTenantRateLimiter(limiter))
+		grpcOpts = append(grpcOpts, grpcservice.WithTenantRateLimiter(limiter))
+	}
+	routerOpts = append(routerOpts, webservice.WithTenantResolver(tenants))
+	if n := envInt("MAX_CONCURRENT_CALCULATIONS", 4*runtime.GOMAXPROCS(0)); n > 0 {
+		routerOpts = append(routerOpts, webservice.WithConcurrencyLimit(n))
+		grpcOpts = append(grpcOpts, grpcservice.WithConcurrencyLimit(n))
+	}
+	router := webservice.NewRouter(handler, routerOpts...)
+	grpcServer := grpcservice.NewGRPCServer(grpcservice.NewServer(packService, grpcOpts...))
+
+	lis, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		log.Fatalf("gRPC server failed to listen: %v", err)
+	}
+
+	go func() {
+		log.Printf("Starting gRPC server on localhost:%s", grpcPort)
+
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("gRPC server failed to start: %v", err)
+		}
+	}()
 
 	log.Printf("Starting Go backend server on http://localhost:%s", port)
 
@@ -35,9 +201,322 @@ func main() {
 		Addr:    ":" + port,
 		Handler: router,
 	}
+	// The event streams only end when their clients leave otherwise
+	srv.RegisterOnShutdown(handler.CloseStreams)
 
 	// Start listening for incoming HTTP requests
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Server failed to start: %v", err)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down, finishing the requests in flight")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	// Stop accepting requests and wait for the ones in flight
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down the HTTP server: %v", err)
+	}
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		grpcServer.Stop()
+	}
+
+	// Deliver the events of the last changes, then close the storage
+	<-relayDone
+	packService.Close()
+	packService.Events().Close()
+	dispatcher.Close()
+	if c, ok := repo.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("Failed to close the pack repository: %v", err)
+		}
+	}
+	if db != nil {
+		db.Close()
 	}
+	if pool != nil {
+		pool.Close()
+	}
+
+	log.Printf("Stopped")
+}
+
+// openDB opens and migrates the MySQL database when DB_HOST is set, returns nil otherwise.
+func openDB() *sql.DB {
+	host := os.Getenv("DB_HOST")
+	if host == "" {
+		return nil
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = host
+	cfg.User = os.Getenv("DB_USER")
+	cfg.Passwd = os.Getenv("DB_PASSWORD")
+	cfg.DBName = os.Getenv("DB_DATABASE")
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		log.Fatalf("Failed to open the database: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := sqlstore.Migrate(ctx, db, sqlstore.MySQL); err != nil {
+		log.Fatalf("Failed to migrate the database: %v", err)
+	}
+
+	return db
+}
+
+// openPostgres opens and migrates the PostgreSQL database of POSTGRES_URL when
+// set, returns nil otherwise.
+func openPostgres() *pgxpool.Pool {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := postgres.Open(ctx, url)
+	if err != nil {
+		log.Fatalf("Failed to open the PostgreSQL database: %v", err)
+	}
+
+	return pool
+}
+
+// newPackRepo creates the pack repository used without a database: the log at
+// PACK_WAL_PATH when set, otherwise the in-memory pack repositories of the tenants,
+// snapshotted to files in PACK_SNAPSHOT_DIR when set. The packs found in either are restored now.
+func newPackRepo() storage.PackRepository {
+	if path := os.Getenv("PACK_WAL_PATH"); path != "" {
+		repo, err := wal.Open(path,
+			wal.WithHistoryLimit(envInt("PACK_WAL_HISTORY", wal.DefaultHistoryLimit)),
+			wal.WithCompactInterval(envDuration("PACK_WAL_COMPACT_INTERVAL", time.Hour)),
+		)
+		if err != nil {
+			log.Fatalf("Failed to open the pack log: %v", err)
+		}
+		log.Printf("Replayed the pack log %s", path)
+		return repo
+	}
+
+	dir := os.Getenv("PACK_SNAPSHOT_DIR")
+	if dir == "" {
+		return storage.NewTenantPackRepo(func(string) storage.PackRepository {
+			return inmemory.NewInMemoryPackRepo()
+		})
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatalf("Failed to create the snapshot directory: %v", err)
+	}
+	opts := []inmemory.SnapshotOption{
+		inmemory.WithSnapshotInterval(envDuration("PACK_SNAPSHOT_INTERVAL", 0)),
+		inmemory.WithSnapshotOnChange(envBool("PACK_SNAPSHOT_ON_CHANGE", true)),
+	}
+
+	repo := storage.NewTenantPackRepo(func(id string) storage.PackRepository {
+		r, err := inmemory.NewSnapshotPackRepo(filepath.Join(dir, "packs-"+id+".json"), opts...)
+		if err != nil {
+			log.Printf("Failed to restore the packs of tenant %s, they are kept in memory only: %v", id, err)
+			return inmemory.NewInMemoryPackRepo()
+		}
+		return r
+	})
+
+	// Restore on boot rather than on the first request of every tenant
+	restored := restoreSnapshots(dir, "packs-", func(ctx context.Context) { repo.For(ctx) })
+	log.Printf("Restored the packs of %d tenants from %s", restored, dir)
+
+	return repo
+}
+
+// newSettingsRepos creates the catalog and schedule repositories used without a
+// database, one per tenant. They are snapshotted to files in PACK_SNAPSHOT_DIR
+// when set, or next to the log at PACK_WAL_PATH, and kept in memory otherwise.
+// The catalogs and schedules found are restored now.
+func newSettingsRepos() (*storage.TenantCatalogRepo, *storage.TenantScheduleRepo) {
+	dir := os.Getenv("PACK_SNAPSHOT_DIR")
+	if path := os.Getenv("PACK_WAL_PATH"); path != "" {
+		dir = filepath.Dir(path)
+	}
+	if dir == "" {
+		catalog := storage.NewTenantCatalogRepo(func(string) storage.CatalogRepository {
+			return inmemory.NewInMemoryCatalogRepo()
+		})
+		schedule := storage.NewTenantScheduleRepo(func(string) storage.ScheduleRepository {
+			return inmemory.NewInMemoryScheduleRepo()
+		})
+		return catalog, schedule
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatalf("Failed to create the snapshot directory: %v", err)
+	}
+
+	catalog := storage.NewTenantCatalogRepo(func(id string) storage.CatalogRepository {
+		r, err := inmemory.NewSnapshotCatalogRepo(filepath.Join(dir, "catalog-"+id+".json"))
+		if err != nil {
+			log.Printf("Failed to restore the catalog of tenant %s, it is kept in memory only: %v", id, err)
+			return inmemory.NewInMemoryCatalogRepo()
+		}
+		return r
+	})
+	schedule := storage.NewTenantScheduleRepo(func(id string) storage.ScheduleRepository {
+		r, err := inmemory.NewSnapshotScheduleRepo(filepath.Join(dir, "schedule-"+id+".json"))
+		if err != nil {
+			log.Printf("Failed to restore the schedule of tenant %s, it is kept in memory only: %v", id, err)
+			return inmemory.NewInMemoryScheduleRepo()
+		}
+		return r
+	})
+
+	catalogs := restoreSnapshots(dir, "catalog-", func(ctx context.Context) { catalog.For(ctx) })
+	schedules := restoreSnapshots(dir, "schedule-", func(ctx context.Context) { schedule.For(ctx) })
+	log.Printf("Restored the catalogs of %d tenants and the schedules of %d tenants from %s", catalogs, schedules, dir)
+
+	return catalog, schedule
+}
+
+// restoreSnapshots calls restore with the context of the tenant of every
+// snapshot file in dir named prefix, tenant ID and ".json", and returns their number.
+func restoreSnapshots(dir, prefix string, restore func(ctx context.Context)) int {
+	paths, err := filepath.Glob(filepath.Join(dir, prefix+"*.json"))
+	if err != nil {
+		log.Fatalf("Failed to list the snapshots: %v", err)
+	}
+
+	restored := 0
+	for _, path := range paths {
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".json")
+		if tenant.Validate(id) != nil {
+			continue
+		}
+		restore(tenant.NewContext(context.Background(), id))
+		restored++
+	}
+
+	return restored
+}
+
+// deliverOutboxEvent notifies the webhooks of a journaled pack change.
+// Redeliveries of the event share its ID, so receivers drop the duplicates.
+func deliverOutboxEvent(ctx context.Context, s *service.PackService, e storage.OutboxEvent) error {
+	if e.Type != storage.OutboxPackSizesChanged {
+		log.Printf("Skipping the outbox event %d of unknown type %q", e.ID, e.Type)
+		return nil
+	}
+
+	var payload storage.PackSizesChangedPayload
+	if err := json.Unmarshal(e.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	return s.NotifyWebhooks(tenant.NewContext(ctx, e.Tenant), fmt.Sprintf("outbox-%d", e.ID), events.PackSizesChanged{
+		Tenant: e.Tenant,
+		Sizes:  payload.Sizes,
+		At:     e.CreatedAt,
+	})
+}
+
+// envInt reads an integer environment variable, falling back to def when unset.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+
+	return n
+}
+
+// envTenantInts reads an environment variable of comma-separated tenant=integer pairs.
+func envTenantInts(key string) map[string]int {
+	values := map[string]int{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		id, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Fatalf("Invalid %s %q: want tenant=value", key, pair)
+		}
+		if err := tenant.Validate(id); err != nil {
+			log.Fatalf("Invalid %s %q: %v", key, pair, err)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid %s %q: %v", key, pair, err)
+		}
+		values[id] = n
+	}
+
+	return values
+}
+
+// envBool reads a boolean environment variable, falling back to def when unset.
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+
+	return b
+}
+
+// envFloat reads a float environment variable, falling back to def when unset.
+func envFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+
+	return f
+}
+
+// envDuration reads a duration environment variable, falling back to def when unset.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+
+	return d
 }
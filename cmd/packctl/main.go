@@ -0,0 +1,240 @@
+// Command packctl exports the pack configuration of a running API to a file
+// and imports it back, such as after the in-memory packs were reset.
+//
+// Usage:
+//
+//	packctl export [flags] [file]
+//	packctl import [flags] [-dry-run] file
+//
+// The format of the file, JSON, YAML or CSV, follows its extension unless set
+// with -format. Without a file, export writes to the standard output and import
+// reads the standard input.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"denisgodoroja/retask/internal/packconfig"
+	"denisgodoroja/retask/internal/webservice"
+)
+
+const usage = `Usage:
+  packctl export [flags] [file]
+  packctl import [flags] [-dry-run] file
+
+Run "packctl <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = runExport(args[1:], stdout, stderr)
+	case "import":
+		err = runImport(args[1:], stdin, stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "packctl: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "packctl: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// client calls the API of a tenant.
+type client struct {
+	server string
+	tenant string
+	token  string
+	http   *http.Client
+}
+
+// clientFlags registers the flags selecting the API and the tenant.
+func clientFlags(fs *flag.FlagSet) *client {
+	c := &client{http: &http.Client{Timeout: 30 * time.Second}}
+
+	server := os.Getenv("PACKCTL_SERVER")
+	if server == "" {
+		server = "http://localhost:8080"
+	}
+	fs.StringVar(&c.server, "server", server, "base URL of the API, $PACKCTL_SERVER")
+	fs.StringVar(&c.tenant, "tenant", "", "tenant ID sent in the "+webservice.TenantHeader+" header")
+	fs.StringVar(&c.token, "token", os.Getenv("PACKCTL_TOKEN"), "bearer token identifying the tenant, $PACKCTL_TOKEN")
+
+	return c
+}
+
+// do sends the request and returns the body of a 2xx response, or the error of the API.
+func (c *client) do(method, path, contentType string, body []byte) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(c.server, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.tenant != "" {
+		req.Header.Set(webservice.TenantHeader, c.tenant)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, nil, fmt.Errorf("%s: %s", resp.Status, apiErr.Error)
+		}
+		return nil, nil, errors.New(resp.Status)
+	}
+
+	return data, resp.Header, nil
+}
+
+// fileFormat returns the format set by the flag, of the file extension otherwise, JSON by default.
+func fileFormat(flagValue, path string) (packconfig.Format, error) {
+	switch {
+	case flagValue != "":
+		return packconfig.ParseFormat(flagValue)
+	case path != "" && path != "-":
+		return packconfig.FormatOfPath(path)
+	}
+
+	return packconfig.JSON, nil
+}
+
+// runExport writes the configuration document of the packs to a file.
+func runExport(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	c := clientFlags(fs)
+	formatFlag := fs.String("format", "", "json, yaml or csv, by default the extension of the file or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("export takes at most one file")
+	}
+
+	path := fs.Arg(0)
+	format, err := fileFormat(*formatFlag, path)
+	if err != nil {
+		return err
+	}
+
+	data, _, err := c.do(http.MethodGet, "/pack/sizes/export?format="+url.QueryEscape(string(format)), "", nil)
+	if err != nil {
+		return err
+	}
+
+	if path == "" || path == "-" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Exported the packs to %s\n", path)
+
+	return nil
+}
+
+// runImport replaces the packs with a configuration document, or only validates it with -dry-run.
+func runImport(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	c := clientFlags(fs)
+	formatFlag := fs.String("format", "", "json, yaml or csv, by default the extension of the file or json")
+	dryRun := fs.Bool("dry-run", false, "only validate the document, without changing the packs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("import takes at most one file")
+	}
+
+	path := fs.Arg(0)
+	format, err := fileFormat(*formatFlag, path)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if path == "" || path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Report syntax errors without a round trip, the API validates the packs
+	if _, err := packconfig.Decode(data, format); err != nil {
+		return err
+	}
+
+	query := "?format=" + url.QueryEscape(string(format))
+	if *dryRun {
+		query += "&dryRun=true"
+	}
+	body, _, err := c.do(http.MethodPost, "/pack/sizes/import"+query, format.ContentType(), data)
+	if err != nil {
+		return err
+	}
+
+	var resp webservice.ImportResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+
+	verb := "Imported"
+	if resp.DryRun {
+		verb = "Validated (dry run, nothing changed)"
+	}
+	fmt.Fprintf(stdout, "%s: %d packs, active sizes %v, unit %s\n", verb, len(resp.Packs), resp.Sizes, resp.Unit)
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"denisgodoroja/retask/internal/service"
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/inmemory"
+	"denisgodoroja/retask/internal/webservice"
+)
+
+// TestRun_ExportImport tests exporting the packs of a tenant and importing them into another.
+func TestRun_ExportImport(t *testing.T) {
+	repo := storage.NewTenantPackRepo(func(string) storage.PackRepository {
+		return inmemory.NewInMemoryPackRepo()
+	})
+	server := httptest.NewServer(webservice.NewRouter(webservice.NewHandler(service.NewPackService(repo))))
+	defer server.Close()
+
+	dir := t.TempDir()
+	runCmd := func(stdin string, args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(append(args[:1:1], append([]string{"-server", server.URL}, args[1:]...)...), strings.NewReader(stdin), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	path := filepath.Join(dir, "packs.yaml")
+	if code, _, stderr := runCmd("", "export", path); code != 0 {
+		t.Fatalf("export exited with %d: %s", code, stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() returned an unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "version: 1\n") || !strings.Contains(string(data), "  - size: 5000\n") {
+		t.Errorf("wrong export:\n%s", data)
+	}
+
+	testCases := []struct {
+		name       string
+		stdin      string
+		args       []string
+		wantCode   int
+		wantOutput string
+	}{
+		{
+			name: "Dry run", args: []string{"import", "-dry-run", path},
+			wantOutput: "Validated (dry run, nothing changed): 5 packs, active sizes [250 500 1000 2000 5000], unit pcs\n",
+		},
+		{
+			name: "Standard input", stdin: "size\n23\n31\n", args: []string{"import", "-format", "csv", "-tenant", "north"},
+			wantOutput: "Imported: 2 packs, active sizes [23 31], unit pcs\n",
+		},
+		{name: "Syntax error", stdin: "sizes: [23\n", args: []string{"import", "-format", "yaml"}, wantCode: 1},
+		{name: "Rejected by the API", stdin: `{"sizes": [0]}`, args: []string{"import"}, wantCode: 1},
+		{name: "Unknown extension", args: []string{"import", filepath.Join(dir, "packs.xml")}, wantCode: 1},
+		{name: "Unknown command", args: []string{"sync"}, wantCode: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := runCmd(tc.stdin, tc.args...)
+			if code != tc.wantCode {
+				t.Fatalf("exit code = %d, want %d: %s", code, tc.wantCode, stderr)
+			}
+			if stdout != tc.wantOutput {
+				t.Errorf("wrong output. got %q, want %q", stdout, tc.wantOutput)
+			}
+		})
+	}
+
+	// Only the imported tenant changed
+	code, stdout, _ := runCmd("", "export", "-format", "csv", "-tenant", "north")
+	if want := "size,label,sku,cost,weight,length,width,height,active\n23,,,,,,,,true\n31,,,,,,,,true\n"; code != 0 || stdout != want {
+		t.Errorf("export = %d, %q, want %q", code, stdout, want)
+	}
+	code, stdout, _ = runCmd("", "export", "-format", "csv")
+	if code != 0 || !strings.HasSuffix(stdout, "\n5000,,,,,,,,true\n") {
+		t.Errorf("export = %d, %q, want the default sizes", code, stdout)
+	}
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU_GetAdd(t *testing.T) {
+	c := NewLRU[string, int](2, 0)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get() found a key in an empty cache")
+	}
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// Touch "a" so "b" becomes the least recently used entry
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %v, %v, want 1, true", v, ok)
+	}
+
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) found the least recently used key after eviction")
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("Get(c) = %v, %v, want 3, true", v, ok)
+	}
+
+	want := Stats{Hits: 2, Misses: 2, Evictions: 1, Size: 2, Capacity: 2}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got := c.Stats().HitRatio(); got != 0.5 {
+		t.Errorf("HitRatio() = %v, want 0.5", got)
+	}
+}
+
+func TestLRU_TTL(t *testing.T) {
+	c := NewLRU[int, int](10, time.Minute)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Add(1, 100)
+
+	now = now.Add(59 * time.Second)
+	if _, ok := c.Get(1); !ok {
+		t.Error("Get() missed an entry before its TTL")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := c.Get(1); ok {
+		t.Error("Get() returned an expired entry")
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Errorf("expired entry was not removed, size = %d", size)
+	}
+}
+
+func TestLRU_Purge(t *testing.T) {
+	c := NewLRU[int, int](10, 0)
+	c.Add(1, 100)
+	c.Add(2, 200)
+
+	c.Purge()
+
+	if _, ok := c.Get(1); ok {
+		t.Error("Get() returned an entry after Purge()")
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Errorf("Stats().Size = %d after Purge(), want 0", size)
+	}
+}
@@ -0,0 +1,154 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ErrInvalidRange is returned when an analysis range is empty or not positive.
+var ErrInvalidRange = errors.New("invalid amount range")
+
+// Analysis describes the consequences of using a set of pack sizes.
+type Analysis struct {
+	// GCD is the greatest common divisor of the sizes. Every total is a multiple of it,
+	// so amounts are rounded up to it at least.
+	GCD int
+	// Redundant lists the sizes used by no optimal solution over the analysed
+	// range, sorted ascending. Removing them changes neither the excess nor the
+	// number of packs of any amount of the range.
+	Redundant []int
+	// PeriodicThreshold is the amount from which solutions are periodic (see Threshold).
+	PeriodicThreshold int
+
+	// From and To are the analysed amount range, both inclusive.
+	From int
+	To   int
+	// WorstExcess is the largest excess over the range, first reached at WorstExcessAmount.
+	WorstExcess       int
+	WorstExcessAmount int
+	// AverageExcess is the mean excess over the range.
+	AverageExcess float64
+}
+
+// Analyze reports the GCD, redundant sizes, periodic threshold and the excess
+// over the amounts from..to of a set of pack sizes. A zero to analyses one full
+// period past the threshold, which covers the worst case of every amount.
+// Both the solution table and the range count against the work budget.
+func Analyze(ctx context.Context, packSizes []int, from, to int, opts ...Option) (Analysis, error) {
+	sizes := normalize(packSizes)
+	if len(sizes) == 0 {
+		return Analysis{Redundant: []int{}}, nil
+	}
+
+	if from <= 0 {
+		from = 1
+	}
+
+	t, err := build(ctx, sizes, threshold(sizes)-1, opts)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	largest := sizes[0]
+	if to == 0 {
+		to = t.threshold + largest - 1
+	}
+	if to < from {
+		return Analysis{}, ErrInvalidRange
+	}
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.workBudget > 0 && to-from+1 > o.workBudget {
+		return Analysis{}, ErrWorkBudgetExceeded
+	}
+
+	a := Analysis{
+		GCD:               gcdOf(sizes),
+		PeriodicThreshold: t.threshold,
+		From:              from,
+		To:                to,
+	}
+
+	u := newUsage(t)
+	total := 0
+	for amount := from; amount <= to; amount++ {
+		if (amount-from)%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return Analysis{}, err
+			}
+		}
+
+		u.add(amount)
+		excess := t.excess(amount)
+		total += excess
+
+		if excess > a.WorstExcess {
+			a.WorstExcess = excess
+			a.WorstExcessAmount = amount
+		}
+	}
+	a.AverageExcess = float64(total) / float64(to-from+1)
+	a.Redundant = u.unused()
+
+	return a, nil
+}
+
+// excess returns the excess of the optimal solution for the amount.
+// Solutions are periodic beyond the threshold, and so is their excess.
+func (t *Table) excess(amount int) int {
+	if amount >= t.threshold {
+		largest := t.sizes[0]
+		amount -= ((amount-t.threshold)/largest + 1) * largest
+	}
+
+	return t.best[amount].totalSum - amount
+}
+
+// usage records the pack sizes used by the optimal solutions of a table.
+type usage struct {
+	t *Table
+	// used is indexed like the sizes of the table.
+	used []bool
+	// walked marks the amounts of the table whose solution was recorded.
+	walked []bool
+}
+
+// newUsage returns an empty usage of the sizes of the table.
+func newUsage(t *Table) *usage {
+	return &usage{t: t, used: make([]bool, len(t.sizes)), walked: make([]bool, len(t.best))}
+}
+
+// add records the sizes of the optimal solution for the amount. Every amount
+// of the table is walked once, so recording a range costs no more than the
+// range plus the table.
+func (u *usage) add(amount int) {
+	if amount >= u.t.threshold {
+		u.used[0] = true
+		largest := u.t.sizes[0]
+		amount -= ((amount-u.t.threshold)/largest + 1) * largest
+	}
+
+	for amount > 0 && !u.walked[amount] {
+		u.walked[amount] = true
+		e := u.t.best[amount]
+		u.used[e.last] = true
+		amount -= u.t.sizes[e.last]
+	}
+}
+
+// unused returns the sizes used by no recorded solution, sorted ascending.
+func (u *usage) unused() []int {
+	out := []int{}
+	for i, used := range u.used {
+		if !used {
+			out = append(out, u.t.sizes[i])
+		}
+	}
+	sort.Ints(out)
+
+	return out
+}
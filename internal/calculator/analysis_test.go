@@ -0,0 +1,109 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	fixtures := []struct {
+		name      string
+		packSizes []int
+		from      int
+		to        int
+		expected  Analysis
+	}{
+		{
+			name:      "No pack sizes",
+			packSizes: []int{},
+			expected:  Analysis{Redundant: []int{}},
+		},
+		{
+			name:      "Default range covers one period past the threshold",
+			packSizes: []int{250, 500, 1000},
+			expected: Analysis{
+				GCD:               250,
+				Redundant:         []int{},
+				PeriodicThreshold: 1501,
+				From:              1,
+				To:                2500,
+				WorstExcess:       249,
+				WorstExcessAmount: 1,
+				AverageExcess:     124.5,
+			},
+		},
+		{
+			name:      "Redundant size",
+			packSizes: []int{300, 500, 800},
+			from:      1,
+			to:        500,
+			expected: Analysis{
+				GCD:               100,
+				Redundant:         []int{800},
+				PeriodicThreshold: 3501,
+				From:              1,
+				To:                500,
+				WorstExcess:       299,
+				WorstExcessAmount: 1,
+				AverageExcess:     129.5,
+			},
+		},
+		{
+			name:      "Size used below the range only",
+			packSizes: []int{250, 500, 1000},
+			from:      1001,
+			to:        1250,
+			expected: Analysis{
+				GCD:               250,
+				Redundant:         []int{500},
+				PeriodicThreshold: 1501,
+				From:              1001,
+				To:                1250,
+				WorstExcess:       249,
+				WorstExcessAmount: 1001,
+				AverageExcess:     124.5,
+			},
+		},
+		{
+			name:      "Large GCD forces big excess",
+			packSizes: []int{4000, 2000},
+			from:      2001,
+			to:        2001,
+			expected: Analysis{
+				GCD:               2000,
+				Redundant:         []int{2000},
+				PeriodicThreshold: 4000,
+				From:              2001,
+				To:                2001,
+				WorstExcess:       1999,
+				WorstExcessAmount: 2001,
+				AverageExcess:     1999,
+			},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			got, err := Analyze(context.Background(), fixture.packSizes, fixture.from, fixture.to)
+			if err != nil {
+				t.Fatalf("Analyze() returned an unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, fixture.expected) {
+				t.Errorf("Analyze() = %+v, expected %+v", got, fixture.expected)
+			}
+		})
+	}
+}
+
+func TestAnalyze_Errors(t *testing.T) {
+	if _, err := Analyze(context.Background(), []int{3, 5}, 10, 5); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("Analyze() error = %v, want %v", err, ErrInvalidRange)
+	}
+
+	_, err := Analyze(context.Background(), []int{3, 5}, 1, 1_000_000, WithWorkBudget(1000))
+	if !errors.Is(err, ErrWorkBudgetExceeded) {
+		t.Errorf("Analyze() error = %v, want %v", err, ErrWorkBudgetExceeded)
+	}
+}
@@ -1,25 +1,162 @@
 package calculator
 
 import (
+	"context"
+	"errors"
+	"math"
 	"sort"
 )
 
-// represents a potential solution.
-type result struct {
-	packs    map[int]int
+// cancelCheckInterval defines how many solver steps are executed
+// between two checks of the context for cancellation.
+const cancelCheckInterval = 1024
+
+// ErrWorkBudgetExceeded is returned when a calculation needs more solver steps
+// than allowed by WithWorkBudget.
+var ErrWorkBudgetExceeded = errors.New("calculation exceeds the work budget")
+
+// ErrTableTooLarge is returned by NewTable when the table of the pack sizes
+// would hold more than MaxTableSize amounts, whatever the work budget.
+var ErrTableTooLarge = errors.New("precomputed table too large")
+
+// MaxTableSize is the most amounts a table built by NewTable holds, about
+// 100 MB of memory. Larger size sets are solved one amount at a time.
+const MaxTableSize = 1 << 22
+
+// options holds the optional calculation settings.
+type options struct {
+	// workBudget is the maximum number of solver steps, 0 means unlimited.
+	workBudget int
+
+	// The fit settings restrict the acceptable solutions, see fit.go.
+	exactOnly        bool
+	maxExcess        int
+	maxExcessPercent float64
+	underShip        bool
+
+	// rules restrict the packs of the solutions, see rules.go.
+	rules []Rule
+}
+
+// Option configures an optional calculation setting.
+type Option func(*options)
+
+// WithWorkBudget limits the number of sub-problems the solver may evaluate.
+// Every step allocates memory, so the budget bounds both time and memory.
+// A zero or negative value means unlimited.
+func WithWorkBudget(steps int) Option {
+	return func(o *options) {
+		o.workBudget = steps
+	}
+}
+
+// Calculate returns the optimal packs for the given amount, restricted by the
+// fit options (see WithExactOnly) and the rules (see WithRules). It stops and returns the context error as
+// soon as ctx is done.
+//
+// Only the amounts below the periodic threshold of the pack sizes are solved,
+// larger amounts are reduced to it by adding packs of the largest size (see Threshold).
+// The solutions of every amount up to the reduced one are tabulated, unless the
+// table would exceed the work budget or MaxTableSize: the amount is then solved
+// from the remaining amounts reachable from it only.
+func Calculate(ctx context.Context, amount int, packSizes []int, opts ...Option) (map[int]int, error) {
+	if amount <= 0 {
+		return map[int]int{}, nil
+	}
+
+	sizes := normalize(packSizes)
+	if len(sizes) == 0 {
+		return map[int]int{}, nil
+	}
+
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(o.rules) > 0 {
+		return calculateWithRules(ctx, amount, sizes, o)
+	}
+
+	// The table only needs to reach the amount itself or the last
+	// amount before the periodic threshold, whichever comes first.
+	// Larger tables are skipped for a search of the amount alone.
+	limit := min(amount, threshold(sizes)-1)
+	if limit >= MaxTableSize || (o.workBudget > 0 && limit+1 > o.workBudget) {
+		packs, err := calculateSparse(ctx, amount, sizes, o)
+		if err != nil {
+			return nil, err
+		}
+		if err := CheckFit(amount, packs, opts...); err != nil {
+			return nil, err
+		}
+
+		return packs, nil
+	}
+
+	t, err := build(ctx, sizes, limit, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Solve(ctx, amount, opts...)
+}
+
+// Threshold returns the amount from which solutions become periodic: for every
+// amount n >= Threshold(packSizes), an optimal solution for n is an optimal
+// solution for n - L plus one pack of the largest size L.
+//
+// Let g be the GCD of the sizes, a the smallest and S the second largest size.
+//   - Every multiple of g above the Frobenius number g*((a/g-1)(L/g-1)-1) is
+//     representable (Schur's bound), so for n - L beyond it the smallest
+//     representable total for n is exactly L above the one for n - L.
+//   - Among any L/g packs smaller than L some non-empty subset sums to a multiple
+//     of L (pigeonhole on prefix sums modulo L/g), and replacing it with packs of
+//     size L uses strictly fewer packs. An optimal solution therefore has at most
+//     L/g-1 smaller packs, summing to at most (L/g-1)*S, so every total above
+//     that contains a pack of size L.
+//
+// Together both facts make the minimal excess and the minimal pack count
+// for n equal to the ones for n - L, plus one pack of size L.
+func Threshold(packSizes []int) int {
+	sizes := normalize(packSizes)
+	if len(sizes) == 0 {
+		return 0
+	}
+
+	return threshold(sizes)
+}
+
+// threshold implements Threshold for normalized sizes, saturating at math.MaxInt.
+func threshold(sizes []int) int {
+	largest, smallest := sizes[0], sizes[len(sizes)-1]
+	g := gcdOf(sizes)
+
+	second := 0
+	if len(sizes) > 1 {
+		second = sizes[1]
+	}
+
+	// Beyond the Frobenius number, shifted by one largest pack
+	frobenius := satAdd(satMul(g, satMul(smallest/g-1, largest/g-1)), largest)
+	// Beyond the largest total of smaller packs in an optimal solution
+	smaller := satAdd(satMul(largest/g-1, second), 1)
+
+	return max(frobenius, smaller)
+}
+
+// entry is the optimal solution for a single amount of the table.
+type entry struct {
 	totalSum int
 	numPacks int
+	// last is the index of the pack size added to the solution of the
+	// remaining amount, or -1 for the empty solution.
+	last int
 }
 
-// returns true if 'r' is a better solution than 'other'
+// returns true if 'e' is a better solution than 'other'
 // based on the constraints: min excess first, then min packs.
-func (r result) isBetterThan(other result, target int) bool {
-	// If other has no packs and sum is 0 (empty or initial result), then r is better (if r is valid)
-	if other.totalSum == 0 && other.numPacks == 0 {
-		return true
-	}
-
-	rExcess := r.totalSum - target
+func (e entry) isBetterThan(other entry, target int) bool {
+	rExcess := e.totalSum - target
 	otherExcess := other.totalSum - target
 
 	// Priority 1: Minimal Excess
@@ -28,83 +165,171 @@ func (r result) isBetterThan(other result, target int) bool {
 	}
 
 	// Priority 2: Minimal Number of Packs
-	return r.numPacks < other.numPacks
+	return e.numPacks < other.numPacks
 }
 
-func Calculate(amount int, packSizes []int) map[int]int {
-	if amount <= 0 || len(packSizes) == 0 {
-		return map[int]int{}
+// Table holds the optimal solutions of every amount below the periodic
+// threshold of a set of pack sizes, answering any amount without solving.
+type Table struct {
+	// sizes are the distinct positive pack sizes, sorted descending.
+	sizes []int
+	// threshold is the amount from which solutions are periodic.
+	threshold int
+	// best holds the optimal solution for every amount up to len(best)-1.
+	best []entry
+}
+
+// NewTable precomputes the optimal solutions for the pack sizes up to their
+// periodic threshold. The table size is bounded by WithWorkBudget and by
+// MaxTableSize, even with an unlimited budget.
+func NewTable(ctx context.Context, packSizes []int, opts ...Option) (*Table, error) {
+	sizes := normalize(packSizes)
+	if len(sizes) == 0 {
+		return &Table{}, nil
+	}
+
+	limit := threshold(sizes) - 1
+	if limit >= MaxTableSize {
+		return nil, ErrTableTooLarge
 	}
 
-	// Sort pack sizes descending for better efficiency in recursion
-	sortedSizes := make([]int, len(packSizes))
-	copy(sortedSizes, packSizes)
-	sort.Sort(sort.Reverse(sort.IntSlice(sortedSizes)))
+	return build(ctx, sizes, limit, opts)
+}
+
+// Threshold returns the amount from which the table answers by reduction.
+func (t *Table) Threshold() int {
+	return t.threshold
+}
 
-	// Memoization cache to store optimal results for remaining amounts
-	memo := make(map[int]result)
+// Lookup returns the optimal packs for the given amount.
+// The amount must not exceed the limit the table was built for.
+func (t *Table) Lookup(amount int) map[int]int {
+	packs := map[int]int{}
+	if amount <= 0 || len(t.sizes) == 0 {
+		return packs
+	}
 
-	// Optimization: If the amount is significantly larger than the largest pack,
-	// we can pre-fill some packs of the smallest size to reduce recursion depth.
-	prefill := 0
-	if amount >= 100*sortedSizes[0] {
-		prefill = int(amount/sortedSizes[0]) - 20
-		amount -= prefill * sortedSizes[0]
+	// Reduce the amount below the threshold with packs of the largest size
+	if amount >= t.threshold {
+		largest := t.sizes[0]
+		extra := (amount-t.threshold)/largest + 1
+		packs[largest] = extra
+		amount -= extra * largest
 	}
 
-	finalRes := solve(amount, sortedSizes, memo)
-	if prefill > 0 {
-		finalRes.packs[sortedSizes[0]] += prefill
+	// Follow the chain of sizes added to reach the amount
+	for amount > 0 {
+		e := t.best[amount]
+		size := t.sizes[e.last]
+		packs[size]++
+		amount -= size
 	}
 
-	return finalRes.packs
+	return packs
 }
 
-// recursively finds the best combination for the target amount.
-func solve(target int, packSizes []int, memo map[int]result) result {
-	// Validate the target amount
-	if target <= 0 {
-		return result{packs: map[int]int{}, totalSum: 0, numPacks: 0}
+// build computes the optimal solutions for every amount up to limit.
+func build(ctx context.Context, sizes []int, limit int, opts []Option) (*Table, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	// Check memoization cache
-	if res, ok := memo[target]; ok {
-		return res
+	// Every amount of the table is one solver step
+	if limit == math.MaxInt || (o.workBudget > 0 && limit+1 > o.workBudget) {
+		return nil, ErrWorkBudgetExceeded
 	}
 
-	var bestRes result
+	t := &Table{
+		sizes:     sizes,
+		threshold: threshold(sizes),
+		best:      make([]entry, limit+1),
+	}
+	t.best[0] = entry{last: -1}
 
-	// Try every pack size
-	for _, p := range packSizes {
-		// 1. Recurse: see what happens if we use this pack
-		currentRes := solve(target-p, packSizes, memo)
+	for target := 1; target <= limit; target++ {
+		// Periodically check whether the caller is still interested in the result
+		if target%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		var bestRes entry
+
+		// Try every pack size, largest first, keeping the first of equal solutions
+		for i, p := range sizes {
+			// Remaining amounts at or below zero need no further packs
+			rest := t.best[max(target-p, 0)]
+
+			candidate := entry{
+				totalSum: rest.totalSum + p,
+				numPacks: rest.numPacks + 1,
+				last:     i,
+			}
 
-		// 2. Construct the new result from this recursion
-		newPacks := make(map[int]int)
-		for k, v := range currentRes.packs {
-			newPacks[k] = v
+			if i == 0 || candidate.isBetterThan(bestRes, target) {
+				bestRes = candidate
+			}
 		}
-		newPacks[p]++
 
-		candidate := result{
-			packs:    newPacks,
-			totalSum: currentRes.totalSum + p,
-			numPacks: currentRes.numPacks + 1,
+		t.best[target] = bestRes
+	}
+
+	return t, nil
+}
+
+// normalize returns the distinct positive pack sizes, sorted descending.
+func normalize(packSizes []int) []int {
+	sizes := make([]int, 0, len(packSizes))
+	for _, p := range packSizes {
+		if p > 0 {
+			sizes = append(sizes, p)
 		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
 
-		// 3. Compare with the best result found so far for this specific target
-		if candidate.isBetterThan(bestRes, target) {
-			bestRes = candidate
+	// Drop duplicates, keeping the order
+	out := sizes[:0]
+	for i, p := range sizes {
+		if i == 0 || p != sizes[i-1] {
+			out = append(out, p)
 		}
+	}
+
+	return out
+}
 
-		// Optimization: If we found a perfect match (excess 0) with 1 pack,
-		// it's impossible to beat for this specific recursion level, so break early.
-		if bestRes.totalSum == target && bestRes.numPacks == 1 {
-			break
+// gcdOf returns the greatest common divisor of the positive sizes.
+func gcdOf(sizes []int) int {
+	g := 0
+	for _, p := range sizes {
+		for p != 0 {
+			g, p = p, g%p
 		}
 	}
 
-	memo[target] = bestRes
+	return g
+}
+
+// satMul multiplies two non-negative ints, saturating at math.MaxInt.
+func satMul(a, b int) int {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	if a > math.MaxInt/b {
+		return math.MaxInt
+	}
+
+	return a * b
+}
+
+// satAdd adds two non-negative ints, saturating at math.MaxInt.
+func satAdd(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
 
-	return bestRes
+	return a + b
 }
@@ -1,6 +1,8 @@
 package calculator
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -86,10 +88,187 @@ func TestCalculate(t *testing.T) {
 
 	for _, fixture := range fixtures {
 		t.Run(fixture.name, func(t *testing.T) {
-			result := Calculate(fixture.amount, fixture.packSizes)
+			result, err := Calculate(context.Background(), fixture.amount, fixture.packSizes)
+			if err != nil {
+				t.Fatalf("Calculate() returned an unexpected error: %v", err)
+			}
 			if !reflect.DeepEqual(result, fixture.expected) {
 				t.Errorf("Calculate() = %v, expected %v", result, fixture.expected)
 			}
 		})
 	}
 }
+
+func TestCalculate_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Large enough to require many solver steps
+	_, err := Calculate(ctx, 50000, []int{997, 1000})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Calculate() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCalculate_WorkBudget(t *testing.T) {
+	// Enough budget for the whole calculation
+	got, err := Calculate(context.Background(), 1750, []int{250, 500, 1000}, WithWorkBudget(2000))
+	if err != nil {
+		t.Fatalf("Calculate() returned an unexpected error: %v", err)
+	}
+	if want := map[int]int{1000: 1, 500: 1, 250: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calculate() = %v, expected %v", got, want)
+	}
+
+	// Every remaining amount is a separate sub-problem here
+	_, err = Calculate(context.Background(), 50000, []int{997, 1000}, WithWorkBudget(100))
+	if !errors.Is(err, ErrWorkBudgetExceeded) {
+		t.Errorf("Calculate() error = %v, want %v", err, ErrWorkBudgetExceeded)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	fixtures := []struct {
+		name      string
+		packSizes []int
+		expected  int
+	}{
+		{name: "No pack sizes", packSizes: []int{}, expected: 0},
+		{name: "Single pack size", packSizes: []int{5}, expected: 5},
+		{name: "Default pack sizes", packSizes: []int{250, 500, 1000, 2000, 5000}, expected: 38001},
+		{name: "Co-prime pack sizes", packSizes: []int{53, 23, 31}, expected: 1613},
+		{name: "Duplicates and invalid sizes are ignored", packSizes: []int{0, 5, -3, 5}, expected: 5},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			if got := Threshold(fixture.packSizes); got != fixture.expected {
+				t.Errorf("Threshold() = %d, expected %d", got, fixture.expected)
+			}
+		})
+	}
+}
+
+// TestNewTable_TooLarge tests that the table size is capped without a work budget.
+func TestNewTable_TooLarge(t *testing.T) {
+	sizes := []int{1_000_003, 1_000_033}
+	if _, err := NewTable(context.Background(), sizes); !errors.Is(err, ErrTableTooLarge) {
+		t.Fatalf("NewTable(%v) error = %v, wantErr %v", sizes, err, ErrTableTooLarge)
+	}
+
+	// Single amounts are still solved
+	got, err := Calculate(context.Background(), 1_000_004, sizes)
+	if err != nil {
+		t.Fatalf("Calculate() returned an unexpected error: %v", err)
+	}
+	if want := map[int]int{1_000_033: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calculate() got = %v, want %v", got, want)
+	}
+}
+
+// TestTable_Lookup verifies the periodic reduction against solving every amount in full.
+func TestTable_Lookup(t *testing.T) {
+	fixtures := [][]int{
+		{250, 500, 1000},
+		{23, 31, 53},
+		{6, 9, 20},
+		{4, 10},
+		{7},
+	}
+
+	for _, packSizes := range fixtures {
+		table, err := NewTable(context.Background(), packSizes)
+		if err != nil {
+			t.Fatalf("NewTable(%v) returned an unexpected error: %v", packSizes, err)
+		}
+
+		limit := table.Threshold() + 3*packSizes[len(packSizes)-1] + 10
+		full, err := build(context.Background(), normalize(packSizes), limit, nil)
+		if err != nil {
+			t.Fatalf("build(%v) returned an unexpected error: %v", packSizes, err)
+		}
+
+		for amount := 1; amount <= limit; amount++ {
+			packs := table.Lookup(amount)
+
+			totalSum, numPacks := 0, 0
+			for size, count := range packs {
+				totalSum += size * count
+				numPacks += count
+			}
+
+			want := full.best[amount]
+			if totalSum != want.totalSum || numPacks != want.numPacks {
+				t.Fatalf("Lookup(%d) for %v = %v (sum %d, packs %d), expected sum %d, packs %d",
+					amount, packSizes, packs, totalSum, numPacks, want.totalSum, want.numPacks)
+			}
+		}
+	}
+}
+
+// TestCalculate_LargeCoprimeSizes tests that amounts whose table exceeds the
+// work budget are solved from the remaining amounts reachable from them.
+func TestCalculate_LargeCoprimeSizes(t *testing.T) {
+	fixtures := []struct {
+		name      string
+		amount    int
+		packSizes []int
+		opts      []Option
+		expected  map[int]int
+	}{
+		{name: "Below the threshold", amount: 5_000_000, packSizes: []int{4999, 5000}, expected: map[int]int{5000: 1000}},
+		{name: "Beyond the table size", amount: 500_000_000, packSizes: []int{999983, 999979}, expected: map[int]int{999979: 501}},
+		{name: "Under-ship", amount: 500_000_000, packSizes: []int{999983, 999979}, opts: []Option{WithUnderShip()}, expected: map[int]int{999983: 500}},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			opts := append([]Option{WithWorkBudget(1_000_000)}, fixture.opts...)
+			got, err := Calculate(context.Background(), fixture.amount, fixture.packSizes, opts...)
+			if err != nil {
+				t.Fatalf("Calculate() returned an unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, fixture.expected) {
+				t.Errorf("Calculate() = %v, expected %v", got, fixture.expected)
+			}
+		})
+	}
+}
+
+// TestCalculateSparse verifies the search of single amounts against the table.
+func TestCalculateSparse(t *testing.T) {
+	fixtures := [][]int{
+		{250, 500, 1000},
+		{23, 31, 53},
+		{6, 9, 20},
+		{4, 10},
+		{7},
+	}
+
+	for _, packSizes := range fixtures {
+		sizes := normalize(packSizes)
+		table, err := NewTable(context.Background(), sizes)
+		if err != nil {
+			t.Fatalf("NewTable(%v) returned an unexpected error: %v", packSizes, err)
+		}
+
+		for _, underShip := range []bool{false, true} {
+			o := options{underShip: underShip}
+			var opts []Option
+			if underShip {
+				opts = append(opts, WithUnderShip())
+			}
+
+			for amount := 1; amount <= table.Threshold()+2*sizes[0]; amount++ {
+				want, wantErr := table.Solve(context.Background(), amount, opts...)
+				got, err := calculateSparse(context.Background(), amount, sizes, o)
+				if !errors.Is(err, wantErr) {
+					t.Fatalf("calculateSparse(%d, %v, under-ship %v) error = %v, want %v", amount, packSizes, underShip, err, wantErr)
+				}
+				if !reflect.DeepEqual(got, want) && (len(got) > 0 || len(want) > 0) {
+					t.Fatalf("calculateSparse(%d, %v, under-ship %v) = %v, expected %v", amount, packSizes, underShip, got, want)
+				}
+			}
+		}
+	}
+}
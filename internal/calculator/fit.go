@@ -0,0 +1,118 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// ErrInfeasible is returned when no combination of packs satisfies the fit options.
+var ErrInfeasible = errors.New("no combination of packs satisfies the constraints")
+
+// WithExactOnly only accepts combinations totalling exactly the amount.
+func WithExactOnly() Option {
+	return func(o *options) {
+		o.exactOnly = true
+	}
+}
+
+// WithMaxExcess only accepts combinations exceeding the amount by at most n items.
+// A zero or negative value means unlimited.
+func WithMaxExcess(n int) Option {
+	return func(o *options) {
+		o.maxExcess = n
+	}
+}
+
+// WithMaxExcessPercent only accepts combinations exceeding the amount by at most
+// percent of it, rounded down. A zero or negative value means unlimited.
+func WithMaxExcessPercent(percent float64) Option {
+	return func(o *options) {
+		o.maxExcessPercent = percent
+	}
+}
+
+// WithUnderShip allows shipping less than the amount: the solution is the
+// largest total at or below the amount, with the fewest packs.
+func WithUnderShip() Option {
+	return func(o *options) {
+		o.underShip = true
+	}
+}
+
+// Solve returns the packs for the given amount restricted by the fit options,
+// or ErrInfeasible. The amount must not exceed the limit the table was built for.
+//
+// The optimal solution has the minimal excess, so it satisfies an excess limit
+// whenever any combination does and no other solution needs to be searched.
+func (t *Table) Solve(ctx context.Context, amount int, opts ...Option) (map[int]int, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if amount <= 0 || len(t.sizes) == 0 {
+		return map[int]int{}, nil
+	}
+
+	packs := map[int]int{}
+	if o.underShip {
+		// The largest reachable total at or below the amount has no excess
+		found := false
+		for n := amount; n > 0; n-- {
+			if (amount-n)%cancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+
+			if t.excess(n) == 0 {
+				packs, found = t.Lookup(n), true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrInfeasible
+		}
+	} else {
+		packs = t.Lookup(amount)
+	}
+
+	if err := CheckFit(amount, packs, opts...); err != nil {
+		return nil, err
+	}
+
+	return packs, nil
+}
+
+// CheckFit returns ErrInfeasible when the packs for the amount violate the fit options.
+// It lets callers validate solutions obtained elsewhere, such as from a cache.
+func CheckFit(amount int, packs map[int]int, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if amount <= 0 {
+		return nil
+	}
+
+	total := 0
+	for size, count := range packs {
+		total += size * count
+	}
+	excess := total - amount
+
+	switch {
+	case o.exactOnly && excess != 0:
+		return ErrInfeasible
+	case excess < 0 && !o.underShip:
+		return ErrInfeasible
+	case o.maxExcess > 0 && excess > o.maxExcess:
+		return ErrInfeasible
+	case o.maxExcessPercent > 0 && excess > int(math.Floor(float64(amount)*o.maxExcessPercent/100)):
+		return ErrInfeasible
+	}
+
+	return nil
+}
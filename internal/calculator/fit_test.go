@@ -0,0 +1,62 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCalculate_Fit(t *testing.T) {
+	sizes := []int{250, 500, 1000}
+
+	tests := []struct {
+		name    string
+		amount  int
+		sizes   []int
+		opts    []Option
+		want    map[int]int
+		wantErr error
+	}{
+		{name: "Exact only, exact fit", amount: 750, sizes: sizes, opts: []Option{WithExactOnly()}, want: map[int]int{250: 1, 500: 1}},
+		{name: "Exact only, no exact fit", amount: 251, sizes: sizes, opts: []Option{WithExactOnly()}, wantErr: ErrInfeasible},
+		{name: "Max excess, within", amount: 1200, sizes: sizes, opts: []Option{WithMaxExcess(50)}, want: map[int]int{1000: 1, 250: 1}},
+		{name: "Max excess, above", amount: 1201, sizes: sizes, opts: []Option{WithMaxExcess(48)}, wantErr: ErrInfeasible},
+		{name: "Max excess percent, within", amount: 1000, sizes: []int{300}, opts: []Option{WithMaxExcessPercent(20)}, want: map[int]int{300: 4}},
+		{name: "Max excess percent, above", amount: 1000, sizes: []int{300}, opts: []Option{WithMaxExcessPercent(10)}, wantErr: ErrInfeasible},
+		{name: "Under ship", amount: 1200, sizes: sizes, opts: []Option{WithUnderShip()}, want: map[int]int{1000: 1}},
+		{name: "Under ship, exact fit", amount: 1250, sizes: sizes, opts: []Option{WithUnderShip()}, want: map[int]int{1000: 1, 250: 1}},
+		{name: "Under ship, beyond the threshold", amount: 10_001, sizes: []int{6, 9}, opts: []Option{WithUnderShip()}, want: map[int]int{9: 1111}},
+		{name: "Under ship, below the smallest size", amount: 100, sizes: sizes, opts: []Option{WithUnderShip()}, wantErr: ErrInfeasible},
+		{name: "Under ship and exact only", amount: 1200, sizes: sizes, opts: []Option{WithUnderShip(), WithExactOnly()}, wantErr: ErrInfeasible},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Calculate(context.Background(), tt.amount, tt.sizes, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Calculate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Calculate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckFit(t *testing.T) {
+	packs := map[int]int{500: 1}
+
+	if err := CheckFit(400, packs, WithMaxExcess(100)); err != nil {
+		t.Errorf("CheckFit() error = %v, wantErr %v", err, nil)
+	}
+	if err := CheckFit(400, packs, WithMaxExcessPercent(20)); !errors.Is(err, ErrInfeasible) {
+		t.Errorf("CheckFit() error = %v, wantErr %v", err, ErrInfeasible)
+	}
+	// Shipping less than the amount is only acceptable when under-shipping
+	if err := CheckFit(600, packs); !errors.Is(err, ErrInfeasible) {
+		t.Errorf("CheckFit() error = %v, wantErr %v", err, ErrInfeasible)
+	}
+	if err := CheckFit(600, packs, WithUnderShip()); err != nil {
+		t.Errorf("CheckFit() error = %v, wantErr %v", err, nil)
+	}
+}
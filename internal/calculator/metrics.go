@@ -0,0 +1,64 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+)
+
+// Metrics aggregates the solutions of a set of pack sizes over many amounts.
+type Metrics struct {
+	// Orders is the number of evaluated amounts.
+	Orders int
+	// TotalExcess is the sum of the items shipped above every amount.
+	TotalExcess int
+	// TotalPacks is the sum of the packs shipped for every amount.
+	TotalPacks int
+}
+
+// Cost weighs the metrics with the cost of an excess item and of handling a pack.
+func (m Metrics) Cost(excessItemCost, packCost float64) float64 {
+	return float64(m.TotalExcess)*excessItemCost + float64(m.TotalPacks)*packCost
+}
+
+// Evaluate solves every amount with the pack sizes and aggregates the results.
+// The solution table is built once for all amounts when it fits the work budget
+// and MaxTableSize, otherwise every amount is solved on its own.
+func Evaluate(ctx context.Context, packSizes []int, amounts []int, opts ...Option) (Metrics, error) {
+	solve := func(amount int) (map[int]int, error) {
+		return Calculate(ctx, amount, packSizes, opts...)
+	}
+
+	t, err := NewTable(ctx, packSizes, opts...)
+	switch {
+	case err == nil:
+		solve = func(amount int) (map[int]int, error) {
+			return t.Lookup(amount), nil
+		}
+	case !errors.Is(err, ErrWorkBudgetExceeded) && !errors.Is(err, ErrTableTooLarge):
+		return Metrics{}, err
+	}
+
+	var m Metrics
+	for i, amount := range amounts {
+		if i%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return Metrics{}, err
+			}
+		}
+
+		packs, err := solve(amount)
+		if err != nil {
+			return Metrics{}, err
+		}
+
+		m.Orders++
+		totalSum := 0
+		for size, count := range packs {
+			totalSum += size * count
+			m.TotalPacks += count
+		}
+		m.TotalExcess += max(totalSum-amount, 0)
+	}
+
+	return m, nil
+}
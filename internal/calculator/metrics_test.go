@@ -0,0 +1,70 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	amounts := []int{1, 250, 251, 501, 12001}
+
+	fixtures := []struct {
+		name      string
+		packSizes []int
+		opts      []Option
+		expected  Metrics
+		wantErr   error
+	}{
+		{
+			name:      "Solution table",
+			packSizes: []int{250, 500, 1000},
+			// 1 -> 250, 250 -> 250, 251 -> 500, 501 -> 750, 12001 -> 12250
+			expected: Metrics{Orders: 5, TotalExcess: 249 + 0 + 249 + 249 + 249, TotalPacks: 1 + 1 + 1 + 2 + 13},
+		},
+		{
+			name:      "Table exceeds the work budget",
+			packSizes: []int{250, 500, 1000},
+			opts:      []Option{WithWorkBudget(1000)},
+			// Every amount is solved on its own
+			expected: Metrics{Orders: 5, TotalExcess: 249 + 0 + 249 + 249 + 249, TotalPacks: 1 + 1 + 1 + 2 + 13},
+		},
+		{
+			name:      "Amounts exceed the work budget",
+			packSizes: []int{250, 500, 1000},
+			opts:      []Option{WithWorkBudget(2)},
+			// Amount 501 needs the solutions of 501, 251 and 1
+			wantErr: ErrWorkBudgetExceeded,
+		},
+		{
+			name:      "Table too large",
+			packSizes: []int{4999, 5000},
+			// 1 -> 4999, 250 -> 4999, 251 -> 4999, 501 -> 4999, 12001 -> 14997
+			expected: Metrics{Orders: 5, TotalExcess: 4998 + 4749 + 4748 + 4498 + 2996, TotalPacks: 1 + 1 + 1 + 1 + 3},
+		},
+		{
+			name:      "No pack sizes",
+			packSizes: []int{},
+			expected:  Metrics{Orders: 5},
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			got, err := Evaluate(context.Background(), fixture.packSizes, amounts, fixture.opts...)
+			if !errors.Is(err, fixture.wantErr) {
+				t.Fatalf("Evaluate() error = %v, want %v", err, fixture.wantErr)
+			}
+			if got != fixture.expected {
+				t.Errorf("Evaluate() = %+v, expected %+v", got, fixture.expected)
+			}
+		})
+	}
+}
+
+func TestMetrics_Cost(t *testing.T) {
+	m := Metrics{Orders: 2, TotalExcess: 100, TotalPacks: 4}
+	if got := m.Cost(0.5, 2); got != 58 {
+		t.Errorf("Cost() = %v, expected 58", got)
+	}
+}
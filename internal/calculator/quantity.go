@@ -0,0 +1,231 @@
+package calculator
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// QuantityDecimals is the number of decimal places kept by a Quantity.
+const QuantityDecimals = 3
+
+// quantityScale is the number of fractional steps in one whole Quantity.
+const quantityScale = 1000
+
+var (
+	// ErrInvalidQuantity is returned when a quantity is malformed, has more than
+	// QuantityDecimals decimal places, or does not fit a Quantity.
+	ErrInvalidQuantity = errors.New("invalid quantity")
+	// ErrUnknownUnit is returned when a unit symbol is not supported.
+	ErrUnknownUnit = errors.New("unknown unit")
+	// ErrIncompatibleUnits is returned when converting between units of different dimensions.
+	ErrIncompatibleUnits = errors.New("incompatible units")
+)
+
+// Quantity is a fixed-point decimal amount with QuantityDecimals decimal places,
+// stored as an integer number of thousandths so that arithmetic stays exact.
+type Quantity int64
+
+// NewQuantity returns the quantity of n whole units.
+func NewQuantity(n int) Quantity {
+	return Quantity(n) * quantityScale
+}
+
+// ParseQuantity parses a decimal such as "12", "0.5" or "-1.125".
+// Exponents and more than QuantityDecimals decimal places are rejected
+// rather than rounded, so a parsed quantity is always the exact input.
+func ParseQuantity(s string) (Quantity, error) {
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || (hasFrac && frac == "") || len(frac) > QuantityDecimals {
+		return 0, ErrInvalidQuantity
+	}
+
+	// Pad the fraction to thousandths, "5" is 500 thousandths
+	digits := whole + frac + strings.Repeat("0", QuantityDecimals-len(frac))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidQuantity
+		}
+	}
+
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidQuantity
+	}
+	if neg {
+		n = -n
+	}
+
+	return Quantity(n), nil
+}
+
+// String formats the quantity as a decimal without trailing zeros.
+func (q Quantity) String() string {
+	sign := ""
+	n := uint64(q)
+	if q < 0 {
+		sign, n = "-", uint64(-q)
+	}
+
+	whole := strconv.FormatUint(n/quantityScale, 10)
+	frac := n % quantityScale
+	if frac == 0 {
+		return sign + whole
+	}
+
+	digits := strconv.FormatUint(frac+quantityScale, 10)[1:]
+	return sign + whole + "." + strings.TrimRight(digits, "0")
+}
+
+// Ceil returns the smallest whole number of units not below the quantity.
+func (q Quantity) Ceil() int {
+	n := int64(q) / quantityScale
+	if q > 0 && int64(q)%quantityScale != 0 {
+		n++
+	}
+
+	return int(n)
+}
+
+// Floor returns the largest whole number of units not above the quantity.
+func (q Quantity) Floor() int {
+	n := int64(q) / quantityScale
+	if q < 0 && int64(q)%quantityScale != 0 {
+		n--
+	}
+
+	return int(n)
+}
+
+// MarshalJSON encodes the quantity as a JSON number.
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number, keeping its exact decimal value.
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	// Like the standard types, null leaves the quantity unchanged
+	if string(data) == "null" {
+		return nil
+	}
+
+	parsed, err := ParseQuantity(string(data))
+	if err != nil {
+		return err
+	}
+
+	*q = parsed
+
+	return nil
+}
+
+// Dimension is the physical dimension measured by a unit.
+type Dimension int
+
+const (
+	// Count measures discrete items.
+	Count Dimension = iota
+	// Mass measures weight.
+	Mass
+	// Volume measures liquids.
+	Volume
+)
+
+// Unit is a unit of measure of a Dimension.
+type Unit struct {
+	// Symbol is the canonical symbol of the unit, such as "kg".
+	Symbol    string
+	Dimension Dimension
+
+	// factor is the size of the unit in the smallest unit of its dimension.
+	factor int64
+}
+
+var (
+	// Pieces counts individual items, the unit of catalogs without one.
+	Pieces = Unit{Symbol: "pcs", Dimension: Count, factor: 1}
+
+	Milligram = Unit{Symbol: "mg", Dimension: Mass, factor: 1}
+	Gram      = Unit{Symbol: "g", Dimension: Mass, factor: 1_000}
+	Kilogram  = Unit{Symbol: "kg", Dimension: Mass, factor: 1_000_000}
+
+	Millilitre = Unit{Symbol: "ml", Dimension: Volume, factor: 1}
+	Litre      = Unit{Symbol: "l", Dimension: Volume, factor: 1_000}
+)
+
+// units maps every accepted symbol to its unit.
+var units = map[string]Unit{
+	"pcs": Pieces,
+	"mg":  Milligram,
+	"g":   Gram,
+	"kg":  Kilogram,
+	"ml":  Millilitre,
+	"l":   Litre,
+}
+
+// ParseUnit returns the unit of a symbol, ignoring case. An empty symbol is Pieces.
+func ParseUnit(symbol string) (Unit, error) {
+	if symbol == "" {
+		return Pieces, nil
+	}
+
+	u, ok := units[strings.ToLower(symbol)]
+	if !ok {
+		return Unit{}, ErrUnknownUnit
+	}
+
+	return u, nil
+}
+
+// String returns the symbol of the unit.
+func (u Unit) String() string {
+	return u.Symbol
+}
+
+// Convert expresses the quantity, measured in from, in the unit to.
+// Digits below QuantityDecimals are rounded up, so a converted amount
+// never packs fewer items than ordered.
+func (q Quantity) Convert(from, to Unit) (Quantity, error) {
+	return q.convert(from, to, true)
+}
+
+// ConvertFloor is like Convert but rounds the digits below QuantityDecimals
+// down, so a converted amount never ships more than ordered when under-shipping.
+func (q Quantity) ConvertFloor(from, to Unit) (Quantity, error) {
+	return q.convert(from, to, false)
+}
+
+// convert expresses the quantity, measured in from, in the unit to, rounding
+// up or down to QuantityDecimals.
+func (q Quantity) convert(from, to Unit, up bool) (Quantity, error) {
+	if from.Dimension != to.Dimension {
+		return 0, ErrIncompatibleUnits
+	}
+	if from == to {
+		return q, nil
+	}
+
+	n := int64(q)
+	if n > math.MaxInt64/from.factor || n < math.MinInt64/from.factor {
+		return 0, ErrInvalidQuantity
+	}
+	n *= from.factor
+
+	out := n / to.factor
+	if n%to.factor != 0 {
+		if up && n > 0 {
+			out++
+		}
+		if !up && n < 0 {
+			out--
+		}
+	}
+
+	return Quantity(out), nil
+}
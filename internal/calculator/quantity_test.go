@@ -0,0 +1,170 @@
+package calculator
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Quantity
+		wantStr string
+		wantErr bool
+	}{
+		{in: "12", want: 12_000, wantStr: "12"},
+		{in: "0.5", want: 500, wantStr: "0.5"},
+		{in: "1.125", want: 1_125, wantStr: "1.125"},
+		{in: "-1.05", want: -1_050, wantStr: "-1.05"},
+		{in: "0.001", want: 1, wantStr: "0.001"},
+		{in: "1.2345", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: ".5", wantErr: true},
+		{in: "1.", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseQuantity(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuantity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseQuantity() = %d, want %d", got, tt.want)
+			}
+			if got.String() != tt.wantStr {
+				t.Errorf("String() = %q, want %q", got.String(), tt.wantStr)
+			}
+		})
+	}
+}
+
+func TestQuantity_Ceil(t *testing.T) {
+	tests := []struct {
+		q    Quantity
+		want int
+	}{
+		{q: NewQuantity(3), want: 3},
+		{q: 2_001, want: 3},
+		{q: 999, want: 1},
+		{q: -1_500, want: -1},
+		{q: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.q.Ceil(); got != tt.want {
+			t.Errorf("Quantity(%s).Ceil() = %d, want %d", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestQuantity_Floor(t *testing.T) {
+	tests := []struct {
+		q    Quantity
+		want int
+	}{
+		{q: NewQuantity(3), want: 3},
+		{q: 2_999, want: 2},
+		{q: -1_500, want: -2},
+		{q: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.q.Floor(); got != tt.want {
+			t.Errorf("Quantity(%s).Floor() = %d, want %d", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestQuantity_Convert(t *testing.T) {
+	tests := []struct {
+		name     string
+		q        string
+		from, to Unit
+		// floor converts with ConvertFloor.
+		floor   bool
+		want    string
+		wantErr error
+	}{
+		{name: "kg to g", q: "1.2", from: Kilogram, to: Gram, want: "1200"},
+		{name: "g to kg", q: "250", from: Gram, to: Kilogram, want: "0.25"},
+		{name: "ml to l rounds up", q: "0.5", from: Millilitre, to: Litre, want: "0.001"},
+		{name: "ml to l rounds down", q: "0.5", from: Millilitre, to: Litre, floor: true, want: "0"},
+		{name: "mg to g rounds down", q: "1249999.5", from: Milligram, to: Gram, floor: true, want: "1249.999"},
+		{name: "Negative mg to g rounds down", q: "-0.5", from: Milligram, to: Gram, floor: true, want: "-0.001"},
+		{name: "l to ml", q: "0.75", from: Litre, to: Millilitre, want: "750"},
+		{name: "Same unit", q: "7", from: Pieces, to: Pieces, want: "7"},
+		{name: "Incompatible", q: "1", from: Kilogram, to: Litre, wantErr: ErrIncompatibleUnits},
+		{name: "Overflow", q: "9223372036854775", from: Kilogram, to: Milligram, wantErr: ErrInvalidQuantity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuantity(tt.q)
+			if err != nil {
+				t.Fatalf("ParseQuantity() returned an unexpected error: %v", err)
+			}
+
+			convert := q.Convert
+			if tt.floor {
+				convert = q.ConvertFloor
+			}
+			got, err := convert(tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Convert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got.String() != tt.want {
+				t.Errorf("Convert() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Unit
+		wantErr bool
+	}{
+		{in: "", want: Pieces},
+		{in: "KG", want: Kilogram},
+		{in: "l", want: Litre},
+		{in: "lb", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseUnit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUnit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseUnit(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuantity_JSON(t *testing.T) {
+	var v struct {
+		Amount Quantity `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount":0.125}`), &v); err != nil {
+		t.Fatalf("Unmarshal() returned an unexpected error: %v", err)
+	}
+	if v.Amount != 125 {
+		t.Errorf("Unmarshal() amount = %d, want 125", v.Amount)
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() returned an unexpected error: %v", err)
+	}
+	if string(out) != `{"amount":0.125}` {
+		t.Errorf("Marshal() = %s, want %s", out, `{"amount":0.125}`)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount":1.0001}`), &v); err == nil {
+		t.Error("Unmarshal() accepted more than three decimal places")
+	}
+}
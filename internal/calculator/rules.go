@@ -0,0 +1,450 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRule is returned when a rule is malformed.
+var ErrInvalidRule = errors.New("invalid rule")
+
+// RuleKind identifies the constraint expressed by a Rule.
+type RuleKind string
+
+const (
+	// RuleMaxCount allows at most Count packs of Size.
+	RuleMaxCount RuleKind = "maxCount"
+	// RuleMinCount requires at least Count packs of Size whenever Size is used.
+	RuleMinCount RuleKind = "minCount"
+	// RuleRequired requires at least one pack of Size in every solution.
+	RuleRequired RuleKind = "required"
+	// RuleMinAmount only allows Size for amounts of at least Amount.
+	RuleMinAmount RuleKind = "minAmount"
+	// RuleForbidden forbids using all of Sizes in the same solution.
+	RuleForbidden RuleKind = "forbidden"
+)
+
+// Rule is an operations constraint on the packs of a solution.
+type Rule struct {
+	Kind   RuleKind
+	Size   int
+	Sizes  []int
+	Count  int
+	Amount int
+}
+
+// String describes the rule in plain words.
+func (r Rule) String() string {
+	switch r.Kind {
+	case RuleMaxCount:
+		return fmt.Sprintf("at most %d packs of %d", r.Count, r.Size)
+	case RuleMinCount:
+		return fmt.Sprintf("at least %d packs of %d when used", r.Count, r.Size)
+	case RuleRequired:
+		return fmt.Sprintf("packs of %d are required", r.Size)
+	case RuleMinAmount:
+		return fmt.Sprintf("packs of %d only for amounts of at least %d", r.Size, r.Amount)
+	case RuleForbidden:
+		sizes := make([]string, len(r.Sizes))
+		for i, size := range r.Sizes {
+			sizes[i] = strconv.Itoa(size)
+		}
+		return "packs of " + strings.Join(sizes, ", ") + " are never combined"
+	}
+
+	return string(r.Kind)
+}
+
+// Validate returns ErrInvalidRule when the rule is malformed.
+func (r Rule) Validate() error {
+	switch r.Kind {
+	case RuleMaxCount, RuleMinCount:
+		if r.Size <= 0 || r.Count < 0 {
+			return fmt.Errorf("%w: %s needs a positive size and a count", ErrInvalidRule, r.Kind)
+		}
+	case RuleRequired:
+		if r.Size <= 0 {
+			return fmt.Errorf("%w: %s needs a positive size", ErrInvalidRule, r.Kind)
+		}
+	case RuleMinAmount:
+		if r.Size <= 0 || r.Amount < 0 {
+			return fmt.Errorf("%w: %s needs a positive size and an amount", ErrInvalidRule, r.Kind)
+		}
+	case RuleForbidden:
+		if len(normalize(r.Sizes)) < 2 {
+			return fmt.Errorf("%w: %s needs at least two distinct sizes", ErrInvalidRule, r.Kind)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidRule, r.Kind)
+	}
+
+	return nil
+}
+
+// RuleError is returned when a calculation is infeasible because of a rule:
+// the calculation becomes feasible without it. It wraps ErrInfeasible.
+type RuleError struct {
+	Rule Rule
+}
+
+func (e *RuleError) Error() string {
+	return ErrInfeasible.Error() + ": " + e.Rule.String()
+}
+
+func (e *RuleError) Unwrap() error {
+	return ErrInfeasible
+}
+
+// WithRules restricts the solutions to the ones satisfying every rule.
+// Rules apply to sizes of the calculation only, rules on other sizes are ignored.
+func WithRules(rules ...Rule) Option {
+	return func(o *options) {
+		o.rules = append(o.rules, rules...)
+	}
+}
+
+// calculateWithRules solves the amount under the rules, reporting the rule
+// making the calculation infeasible when dropping a single rule is enough.
+func calculateWithRules(ctx context.Context, amount int, sizes []int, o options) (map[int]int, error) {
+	packs, err := solveWithRules(ctx, amount, sizes, o)
+	if !errors.Is(err, ErrInfeasible) {
+		return packs, err
+	}
+
+	for i, rule := range o.rules {
+		relaxed := o
+		relaxed.rules = append(append([]Rule{}, o.rules[:i]...), o.rules[i+1:]...)
+
+		if _, err := solveWithRules(ctx, amount, sizes, relaxed); err == nil {
+			return nil, &RuleError{Rule: rule}
+		} else if !errors.Is(err, ErrInfeasible) {
+			return nil, err
+		}
+	}
+
+	return nil, ErrInfeasible
+}
+
+// constrainedSize is a size whose number of packs is restricted by the rules.
+type constrainedSize struct {
+	size int
+	// counts are the allowed numbers of packs, ascending.
+	counts []int
+}
+
+// solveWithRules finds the best solution satisfying the rules and the fit options.
+//
+// Sizes restricted by a count, required or forbidden rule are enumerated, every
+// allowed number of packs of each, and the rest of the amount is solved with the
+// free sizes from their table. The objective is separable, so the best rest for
+// a fixed choice of constrained packs is the optimal solution of the rest.
+// Every enumerated choice counts against the work budget, like table entries.
+//
+// With L the largest free size, g the GCD of L and a smaller constrained size c,
+// L/g packs of c total as much as c/g packs of L, which are fewer. An optimal
+// solution therefore has fewer than L/g packs of c above its minimum, so the
+// enumeration does not grow with the amount. When the constrained packs are
+// bounded that way, large amounts are also reduced by packs of L first: beyond
+// the threshold of the free sizes plus the largest constrained total, the rest
+// of every choice is periodic in L (see Threshold).
+func solveWithRules(ctx context.Context, amount int, sizes []int, o options) (map[int]int, error) {
+	if amount <= 0 {
+		return map[int]int{}, nil
+	}
+
+	// Sizes below their minimum amount are not available at all
+	available := make(map[int]bool, len(sizes))
+	for _, size := range sizes {
+		available[size] = true
+	}
+	for _, r := range o.rules {
+		if r.Kind == RuleMinAmount && amount < r.Amount {
+			available[r.Size] = false
+		}
+	}
+
+	maxCount := make(map[int]int)
+	minCount := make(map[int]int)
+	required := make(map[int]bool)
+	isConstrained := make(map[int]bool)
+	var forbidden [][]int
+
+	for _, r := range o.rules {
+		switch r.Kind {
+		case RuleMaxCount:
+			if c, ok := maxCount[r.Size]; !ok || r.Count < c {
+				maxCount[r.Size] = r.Count
+			}
+			isConstrained[r.Size] = true
+		case RuleMinCount:
+			minCount[r.Size] = max(minCount[r.Size], r.Count)
+			isConstrained[r.Size] = true
+		case RuleRequired:
+			if !available[r.Size] {
+				return nil, ErrInfeasible
+			}
+			required[r.Size] = true
+			isConstrained[r.Size] = true
+		case RuleForbidden:
+			forbidden = append(forbidden, normalize(r.Sizes))
+			for _, size := range r.Sizes {
+				isConstrained[size] = true
+			}
+		}
+	}
+
+	var free, constrainedSizes []int
+	for _, size := range sizes {
+		if !available[size] {
+			continue
+		}
+		if isConstrained[size] {
+			constrainedSizes = append(constrainedSizes, size)
+		} else {
+			free = append(free, size)
+		}
+	}
+
+	// bound returns the most packs of the constrained size an optimal solution
+	// may have regardless of the amount, math.MaxInt when unbounded.
+	bound := func(size int) int {
+		hi := math.MaxInt
+		if len(free) > 0 && size < free[0] {
+			hi = max(minCount[size], 1) + free[0]/gcdOf([]int{size, free[0]}) - 1
+		}
+		if m, ok := maxCount[size]; ok {
+			hi = min(hi, m)
+		}
+		return hi
+	}
+
+	// Reduce a large amount by packs of the largest free size
+	reduced := 0
+	if len(free) > 0 {
+		largest := 0
+		for _, size := range constrainedSizes {
+			largest = satAdd(largest, satMul(bound(size), size))
+		}
+		if limit := satAdd(largest, threshold(free)); amount > limit {
+			reduced = (amount - limit) / free[0]
+			amount -= reduced * free[0]
+		}
+	}
+
+	var constrained []constrainedSize
+	combinations := 1
+	for _, size := range constrainedSizes {
+		c := constrainedSize{size: size}
+		if !required[size] {
+			c.counts = append(c.counts, 0)
+		}
+
+		// More packs than needed to cover the amount alone only add excess
+		lo := max(minCount[size], 1)
+		hi := min(max(lo, (amount+size-1)/size), bound(size))
+		if o.workBudget > 0 && hi-lo+1 > o.workBudget {
+			return nil, ErrWorkBudgetExceeded
+		}
+		for n := lo; n <= hi; n++ {
+			c.counts = append(c.counts, n)
+		}
+		if len(c.counts) == 0 {
+			return nil, ErrInfeasible
+		}
+
+		combinations = satMul(combinations, len(c.counts))
+		constrained = append(constrained, c)
+	}
+
+	// Every choice of constrained packs is a solver step
+	if combinations == math.MaxInt || (o.workBudget > 0 && combinations > o.workBudget) {
+		return nil, ErrWorkBudgetExceeded
+	}
+
+	// The free sizes solve the rest of the amount, within the budget left
+	var rest *Table
+	if len(free) > 0 {
+		budget := 0
+		if o.workBudget > 0 {
+			budget = max(o.workBudget-combinations, 1)
+		}
+
+		var err error
+		rest, err = build(ctx, free, min(amount, threshold(free)-1), []Option{WithWorkBudget(budget)})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &ruleSearch{
+		ctx:         ctx,
+		amount:      amount,
+		o:           o,
+		constrained: constrained,
+		forbidden:   forbidden,
+		rest:        rest,
+		counts:      make([]int, len(constrained)),
+	}
+	if err := s.enumerate(0, 0, 0); err != nil {
+		return nil, err
+	}
+	if s.best == nil {
+		return nil, ErrInfeasible
+	}
+	if reduced > 0 {
+		s.best[free[0]] += reduced
+		amount += reduced * free[0]
+	}
+
+	if err := CheckFit(amount, s.best, withoutRules(o)...); err != nil {
+		return nil, err
+	}
+
+	return s.best, nil
+}
+
+// withoutRules returns the fit options of o, as options.
+func withoutRules(o options) []Option {
+	return []Option{func(fit *options) {
+		*fit = o
+		fit.rules = nil
+	}}
+}
+
+// ruleSearch holds the state of the enumeration of the constrained packs.
+type ruleSearch struct {
+	ctx         context.Context
+	amount      int
+	o           options
+	constrained []constrainedSize
+	forbidden   [][]int
+	rest        *Table
+
+	// counts is the number of packs of every constrained size being tried.
+	counts []int
+	steps  int
+
+	best      map[int]int
+	bestScore [2]int
+}
+
+// step counts a solver step against the work budget, periodically checking
+// whether the caller is still interested in the result.
+func (s *ruleSearch) step() error {
+	s.steps++
+	if s.o.workBudget > 0 && s.steps > s.o.workBudget {
+		return ErrWorkBudgetExceeded
+	}
+	if s.steps%cancelCheckInterval == 0 {
+		return s.ctx.Err()
+	}
+
+	return nil
+}
+
+// enumerate tries every allowed number of packs of the constrained sizes from i on,
+// the packs of the previous ones summing to total in numPacks packs.
+func (s *ruleSearch) enumerate(i, total, numPacks int) error {
+	if i == len(s.constrained) {
+		if err := s.step(); err != nil {
+			return err
+		}
+
+		return s.evaluate(total, numPacks)
+	}
+
+	c := s.constrained[i]
+	for _, n := range c.counts {
+		s.counts[i] = n
+		if err := s.enumerate(i+1, satAdd(total, satMul(c.size, n)), numPacks+n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evaluate completes the current constrained packs with the best rest of the amount.
+func (s *ruleSearch) evaluate(total, numPacks int) error {
+	for _, sizes := range s.forbidden {
+		if s.usesAll(sizes) {
+			return nil
+		}
+	}
+
+	remaining := s.amount - total
+	restPacks := map[int]int{}
+	restTotal := 0
+
+	switch {
+	case remaining <= 0:
+		// The constrained packs already cover the amount
+		if s.o.underShip && remaining < 0 {
+			return nil
+		}
+	case s.rest == nil:
+		if !s.o.underShip {
+			return nil
+		}
+	case s.o.underShip:
+		// Every shorter rest tried is a solver step
+		for n := remaining; n > 0; n-- {
+			if s.rest.excess(n) == 0 {
+				restPacks, restTotal = s.rest.Lookup(n), n
+				break
+			}
+			if err := s.step(); err != nil {
+				return err
+			}
+		}
+	default:
+		restPacks = s.rest.Lookup(remaining)
+		restTotal = remaining + s.rest.excess(remaining)
+	}
+
+	for _, count := range restPacks {
+		numPacks += count
+	}
+
+	// Minimal excess, or shortfall when under-shipping, then minimal packs
+	gap := total + restTotal - s.amount
+	if s.o.underShip {
+		gap = -gap
+	}
+	score := [2]int{gap, numPacks}
+	if s.best != nil && (score[0] > s.bestScore[0] || (score[0] == s.bestScore[0] && score[1] >= s.bestScore[1])) {
+		return nil
+	}
+
+	best := restPacks
+	for i, c := range s.constrained {
+		if s.counts[i] > 0 {
+			best[c.size] += s.counts[i]
+		}
+	}
+	s.best, s.bestScore = best, score
+
+	return nil
+}
+
+// usesAll reports whether the current constrained packs use every one of the sizes.
+func (s *ruleSearch) usesAll(sizes []int) bool {
+	for _, size := range sizes {
+		used := false
+		for i, c := range s.constrained {
+			if c.size == size && s.counts[i] > 0 {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return false
+		}
+	}
+
+	return true
+}
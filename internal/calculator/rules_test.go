@@ -0,0 +1,139 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCalculate_Rules(t *testing.T) {
+	sizes := []int{250, 500, 1000}
+
+	tests := []struct {
+		name    string
+		amount  int
+		sizes   []int
+		opts    []Option
+		want    map[int]int
+		wantErr error
+	}{
+		{name: "Max count", amount: 1250, sizes: sizes, opts: []Option{WithRules(Rule{Kind: RuleMaxCount, Size: 1000, Count: 0})}, want: map[int]int{500: 2, 250: 1}},
+		{name: "Min amount, below", amount: 5000, sizes: sizes, opts: []Option{WithRules(Rule{Kind: RuleMinAmount, Size: 1000, Amount: 10_000})}, want: map[int]int{500: 10}},
+		{name: "Min amount, reached", amount: 10_000, sizes: sizes, opts: []Option{WithRules(Rule{Kind: RuleMinAmount, Size: 1000, Amount: 10_000})}, want: map[int]int{1000: 10}},
+		{name: "Required", amount: 1000, sizes: sizes, opts: []Option{WithRules(Rule{Kind: RuleRequired, Size: 250})}, want: map[int]int{500: 1, 250: 2}},
+		{name: "Min count", amount: 750, sizes: sizes, opts: []Option{WithRules(Rule{Kind: RuleMinCount, Size: 250, Count: 3})}, want: map[int]int{250: 3}},
+		{name: "Forbidden combination", amount: 750, sizes: sizes, opts: []Option{WithRules(Rule{Kind: RuleForbidden, Sizes: []int{250, 500}})}, want: map[int]int{250: 3}},
+		{name: "Rule on another size", amount: 750, sizes: sizes, opts: []Option{WithRules(Rule{Kind: RuleMaxCount, Size: 300, Count: 0})}, want: map[int]int{500: 1, 250: 1}},
+		{name: "Under ship", amount: 1200, sizes: sizes, opts: []Option{WithUnderShip(), WithRules(Rule{Kind: RuleMaxCount, Size: 1000, Count: 0})}, want: map[int]int{500: 2}},
+		{name: "Infeasible", amount: 750, sizes: []int{250, 1000}, opts: []Option{WithExactOnly(), WithRules(Rule{Kind: RuleMaxCount, Size: 250, Count: 2})}, wantErr: ErrInfeasible},
+		{name: "Work budget exceeded", amount: 1_000_000, sizes: []int{1, 1000}, opts: []Option{WithWorkBudget(1000), WithRules(Rule{Kind: RuleRequired, Size: 1})}, wantErr: ErrWorkBudgetExceeded},
+		{name: "Forbidden combination, large amount", amount: 1_000_250, sizes: []int{250, 500, 1000, 2000, 5000}, opts: []Option{WithWorkBudget(1_000_000), WithRules(Rule{Kind: RuleForbidden, Sizes: []int{250, 500}})}, want: map[int]int{5000: 200, 250: 1}},
+		{name: "Required, large amount", amount: 1_000_001, sizes: []int{7, 1000}, opts: []Option{WithWorkBudget(10_000), WithRules(Rule{Kind: RuleRequired, Size: 7})}, want: map[int]int{1000: 999, 7: 143}},
+		{name: "Under ship, work budget exceeded", amount: 1999, sizes: []int{3, 1000}, opts: []Option{WithUnderShip(), WithWorkBudget(10_000), WithRules(Rule{Kind: RuleMaxCount, Size: 3, Count: 300})}, wantErr: ErrWorkBudgetExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Calculate(context.Background(), tt.amount, tt.sizes, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Calculate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Calculate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCalculate_RulesLargeAmounts tests that bounding the constrained packs and
+// reducing the amount by the largest free size keeps the solutions optimal, against
+// every choice of packs of 3 and 5, completed with the fewest packs of 7.
+func TestCalculate_RulesLargeAmounts(t *testing.T) {
+	forbidden := WithRules(Rule{Kind: RuleForbidden, Sizes: []int{3, 5}})
+
+	for amount := 1; amount <= 500; amount++ {
+		wantScore := [2]int{-1, -1}
+		for n3 := 0; n3 <= amount/3+1; n3++ {
+			for n5 := 0; n5 <= amount/5+1; n5++ {
+				if n3 > 0 && n5 > 0 {
+					continue
+				}
+				n7 := max(0, (amount-3*n3-5*n5+6)/7)
+				score := [2]int{3*n3 + 5*n5 + 7*n7 - amount, n3 + n5 + n7}
+				if wantScore[0] < 0 || score[0] < wantScore[0] || (score[0] == wantScore[0] && score[1] < wantScore[1]) {
+					wantScore = score
+				}
+			}
+		}
+
+		got, err := Calculate(context.Background(), amount, []int{3, 5, 7}, forbidden)
+		if err != nil {
+			t.Fatalf("Calculate(%d) returned an unexpected error: %v", amount, err)
+		}
+		total, numPacks := 0, 0
+		for size, count := range got {
+			total += size * count
+			numPacks += count
+		}
+		if score := [2]int{total - amount, numPacks}; score != wantScore {
+			t.Errorf("Calculate(%d) = %v, excess and packs %v, want %v", amount, got, score, wantScore)
+		}
+	}
+}
+
+func TestCalculate_RuleError(t *testing.T) {
+	minAmount := Rule{Kind: RuleMinAmount, Size: 5000, Amount: 10_000}
+	maxCount := Rule{Kind: RuleMaxCount, Size: 250, Count: 4}
+
+	tests := []struct {
+		name   string
+		amount int
+		opts   []Option
+		want   *Rule
+	}{
+		{name: "Max count", amount: 1250, opts: []Option{WithExactOnly(), WithRules(minAmount, maxCount)}, want: &maxCount},
+		{name: "Required size below its min amount", amount: 500, opts: []Option{WithRules(minAmount, Rule{Kind: RuleRequired, Size: 5000})}, want: &minAmount},
+		// Dropping no single rule makes an exact fit possible
+		{name: "No single rule", amount: 1, opts: []Option{WithExactOnly(), WithRules(maxCount)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Calculate(context.Background(), tt.amount, []int{250, 5000}, tt.opts...)
+			if !errors.Is(err, ErrInfeasible) {
+				t.Fatalf("Calculate() error = %v, wantErr %v", err, ErrInfeasible)
+			}
+
+			var ruleErr *RuleError
+			if got := errors.As(err, &ruleErr); got != (tt.want != nil) {
+				t.Fatalf("Calculate() error = %v, want a rule error %v", err, got)
+			}
+			if tt.want != nil && !reflect.DeepEqual(ruleErr.Rule, *tt.want) {
+				t.Errorf("Calculate() rule = %v, want %v", ruleErr.Rule, *tt.want)
+			}
+		})
+	}
+}
+
+func TestRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr error
+	}{
+		{name: "Max count", rule: Rule{Kind: RuleMaxCount, Size: 250, Count: 4}},
+		{name: "Max count of zero", rule: Rule{Kind: RuleMaxCount, Size: 250}},
+		{name: "Negative count", rule: Rule{Kind: RuleMinCount, Size: 250, Count: -1}, wantErr: ErrInvalidRule},
+		{name: "Required without size", rule: Rule{Kind: RuleRequired}, wantErr: ErrInvalidRule},
+		{name: "Min amount", rule: Rule{Kind: RuleMinAmount, Size: 5000, Amount: 10_000}},
+		{name: "Forbidden", rule: Rule{Kind: RuleForbidden, Sizes: []int{250, 500}}},
+		{name: "Forbidden single size", rule: Rule{Kind: RuleForbidden, Sizes: []int{250, 250}}, wantErr: ErrInvalidRule},
+		{name: "Unknown kind", rule: Rule{Kind: "other", Size: 250}, wantErr: ErrInvalidRule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
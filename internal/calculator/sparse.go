@@ -0,0 +1,156 @@
+package calculator
+
+import "context"
+
+// sparseSolver solves a single amount by a memoized search over the remaining
+// amounts reachable from it, for amounts whose table would exceed the work
+// budget or MaxTableSize. Large pack sizes reach few remaining amounts, so it
+// solves amounts far beyond any table.
+type sparseSolver struct {
+	ctx   context.Context
+	sizes []int
+	o     options
+
+	// best holds the optimal solution of every solved remaining amount.
+	best map[int]entry
+	// steps counts the solved remaining amounts.
+	steps int
+}
+
+// calculateSparse returns the optimal packs for the amount, solving only the
+// remaining amounts reachable from it. With WithUnderShip it returns
+// ErrInfeasible when no pack fits in the amount.
+func calculateSparse(ctx context.Context, amount int, sizes []int, o options) (map[int]int, error) {
+	s := &sparseSolver{ctx: ctx, sizes: sizes, o: o, best: map[int]entry{}}
+
+	packs := map[int]int{}
+	target := amount
+	limit := threshold(sizes)
+	if o.underShip && target >= limit {
+		// Every total is a multiple of the GCD, and beyond the threshold every
+		// multiple is reachable, so it is the largest total at or below the amount
+		g := gcdOf(sizes)
+		target = target / g * g
+		if target >= limit {
+			s.o.underShip = false
+		}
+	}
+	if target >= limit {
+		// Reduce the amount below the threshold with packs of the largest size
+		largest := sizes[0]
+		extra := (target-limit)/largest + 1
+		packs[largest] = extra
+		target -= extra * largest
+	}
+
+	if err := s.solve(target); err != nil {
+		return nil, err
+	}
+
+	// Follow the chain of sizes added to reach the amount
+	for e := s.lookup(target); e.last >= 0; e = s.lookup(target) {
+		size := sizes[e.last]
+		packs[size]++
+		target -= size
+	}
+	if len(packs) == 0 {
+		return nil, ErrInfeasible
+	}
+
+	return packs, nil
+}
+
+// solve computes the optimal solution of the target and of every remaining
+// amount it depends on. The search keeps its own stack instead of recursing,
+// since small sizes make the chains of remaining amounts very long.
+func (s *sparseSolver) solve(target int) error {
+	stack := []int{target}
+	for len(stack) > 0 {
+		target := stack[len(stack)-1]
+		if _, ok := s.best[target]; ok || target <= 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		// Solve the remaining amounts first, they are always smaller
+		pending := false
+		for _, p := range s.sizes {
+			rest := target - p
+			if rest <= 0 {
+				continue
+			}
+			if _, ok := s.best[rest]; !ok {
+				stack = append(stack, rest)
+				pending = true
+			}
+		}
+		if pending {
+			continue
+		}
+
+		if err := s.step(); err != nil {
+			return err
+		}
+		s.best[target] = s.combine(target)
+		stack = stack[:len(stack)-1]
+	}
+
+	return nil
+}
+
+// combine returns the best solution for the target from the solutions of its
+// remaining amounts, largest size first, keeping the first of equal solutions.
+func (s *sparseSolver) combine(target int) entry {
+	if s.o.underShip {
+		// The largest total at or below the target, then the fewest packs
+		bestRes := entry{last: -1}
+		for i, p := range s.sizes {
+			if p > target {
+				continue
+			}
+
+			rest := s.lookup(target - p)
+			candidate := entry{totalSum: rest.totalSum + p, numPacks: rest.numPacks + 1, last: i}
+			if candidate.totalSum > bestRes.totalSum ||
+				(candidate.totalSum == bestRes.totalSum && candidate.numPacks < bestRes.numPacks) {
+				bestRes = candidate
+			}
+		}
+
+		return bestRes
+	}
+
+	var bestRes entry
+	for i, p := range s.sizes {
+		rest := s.lookup(target - p)
+		candidate := entry{totalSum: rest.totalSum + p, numPacks: rest.numPacks + 1, last: i}
+		if i == 0 || candidate.isBetterThan(bestRes, target) {
+			bestRes = candidate
+		}
+	}
+
+	return bestRes
+}
+
+// lookup returns the solution of a solved remaining amount, the empty
+// solution for the amounts at or below zero.
+func (s *sparseSolver) lookup(amount int) entry {
+	if amount <= 0 {
+		return entry{last: -1}
+	}
+
+	return s.best[amount]
+}
+
+// step charges one solver step to the work budget and periodically checks the context.
+func (s *sparseSolver) step() error {
+	s.steps++
+	if s.o.workBudget > 0 && s.steps > s.o.workBudget {
+		return ErrWorkBudgetExceeded
+	}
+	if s.steps%cancelCheckInterval == 0 {
+		return s.ctx.Err()
+	}
+
+	return nil
+}
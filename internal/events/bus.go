@@ -0,0 +1,294 @@
+// Package events is the in-process domain event bus of the service layer.
+//
+// Subscribers react to what the service did, such as replacing the packs or
+// calculating an amount, without the service knowing about them:
+//
+//   - Synchronous subscribers run in the publishing goroutine, in subscription
+//     order, before Publish returns. They suit quick reactions that must be
+//     done when the operation returns, like invalidating a cache.
+//   - Asynchronous subscribers run in a goroutine of their own and receive the
+//     events in publish order. They suit slow reactions, like calling another
+//     system, that must not delay the operation. An asynchronous subscriber
+//     lagging a full queue behind misses the events published meanwhile,
+//     which are reported, so it never blocks the publishers.
+//
+// A panicking subscriber is recovered and reported, it neither breaks the
+// publisher nor the other subscribers.
+package events
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// DefaultQueueSize is the number of events an asynchronous subscriber may lag
+// behind unless overridden.
+const DefaultQueueSize = 1024
+
+// PackSizesChanged is published after the packs of a tenant are replaced.
+// Subscribers must not modify its slices.
+type PackSizesChanged struct {
+	Tenant string
+	Packs  []storage.Pack
+	// Sizes are the active sizes of Packs, ascending.
+	Sizes []int
+	At    time.Time
+}
+
+// CalculationPerformed is published after a successful calculation.
+// Subscribers must not modify its packs.
+type CalculationPerformed struct {
+	Tenant    string
+	Requester string
+	Amount    int
+	Packs     map[int]int
+	// SizeVersion identifies the size set and rules the calculation used.
+	SizeVersion uint64
+	At          time.Time
+}
+
+// CalculationFailed is published after a calculation returned an error.
+type CalculationFailed struct {
+	Tenant    string
+	Requester string
+	Amount    int
+	Err       error
+	At        time.Time
+}
+
+// Bus dispatches the published events to the subscribers of their type.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[reflect.Type][]*subscriber
+	closed      bool
+
+	// publishMu orders the events queued to the asynchronous subscribers.
+	publishMu sync.Mutex
+	wg        sync.WaitGroup
+
+	queueSize  int
+	onPanic    func(event any, recovered any)
+	onOverflow func(event any)
+}
+
+type subscriber struct {
+	handle func(ctx context.Context, event any)
+	// queue holds the events of an asynchronous subscriber, nil for synchronous ones.
+	queue chan queued
+	// done is closed when an asynchronous subscriber is removed.
+	done chan struct{}
+}
+
+type queued struct {
+	ctx   context.Context
+	event any
+}
+
+// Option configures optional Bus settings.
+type Option func(*Bus)
+
+// WithQueueSize sets the number of events an asynchronous subscriber may lag
+// behind. The events published to a full queue are dropped for the subscriber.
+func WithQueueSize(n int) Option {
+	return func(b *Bus) {
+		b.queueSize = max(n, 1)
+	}
+}
+
+// WithPanicHandler reports the panics of the subscribers to f instead of the log.
+func WithPanicHandler(f func(event any, recovered any)) Option {
+	return func(b *Bus) {
+		b.onPanic = f
+	}
+}
+
+// WithOverflowHandler reports the events dropped for an asynchronous subscriber
+// with a full queue to f instead of the log.
+func WithOverflowHandler(f func(event any)) Option {
+	return func(b *Bus) {
+		b.onOverflow = f
+	}
+}
+
+// NewBus creates a bus without subscribers.
+func NewBus(opts ...Option) *Bus {
+	b := &Bus{
+		subscribers: make(map[reflect.Type][]*subscriber),
+		queueSize:   DefaultQueueSize,
+		onPanic: func(event any, recovered any) {
+			log.Printf("Event subscriber panicked handling %T: %v", event, recovered)
+		},
+		onOverflow: func(event any) {
+			log.Printf("Event subscriber queue full, dropping %T", event)
+		},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Subscribe calls h synchronously with every event of type E published on the bus.
+// It returns the function removing the subscription.
+func Subscribe[E any](b *Bus, h func(ctx context.Context, event E)) func() {
+	s := &subscriber{handle: typed(h)}
+
+	return b.add(reflect.TypeFor[E](), s)
+}
+
+// SubscribeAsync calls h in a goroutine of its own with every event of type E
+// published on the bus, in publish order. The context passed to h keeps the
+// values of the publisher's one but is never canceled. It returns the function
+// removing the subscription, the events queued but not handled yet are dropped.
+func SubscribeAsync[E any](b *Bus, h func(ctx context.Context, event E)) func() {
+	s := &subscriber{
+		handle: typed(h),
+		queue:  make(chan queued, b.queueSize),
+		done:   make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for {
+			select {
+			case q, ok := <-s.queue:
+				if !ok {
+					return
+				}
+				b.call(s, q.ctx, q.event)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return b.add(reflect.TypeFor[E](), s)
+}
+
+// typed adapts a handler of events of type E.
+func typed[E any](h func(ctx context.Context, event E)) func(ctx context.Context, event any) {
+	return func(ctx context.Context, event any) {
+		h(ctx, event.(E))
+	}
+}
+
+// add registers the subscriber of the events of type t.
+func (b *Bus) add(t reflect.Type, s *subscriber) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed && s.queue != nil {
+		// Nothing will ever be queued
+		close(s.queue)
+	}
+	b.subscribers[t] = append(b.subscribers[t], s)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.remove(t, s) })
+	}
+}
+
+// remove unregisters the subscriber, stopping it when asynchronous.
+func (b *Bus) remove(t reflect.Type, s *subscriber) {
+	b.mu.Lock()
+	subs := b.subscribers[t]
+	for i, sub := range subs {
+		if sub == s {
+			b.subscribers[t] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+
+	if s.done != nil {
+		close(s.done)
+	}
+}
+
+// Publish dispatches the event to the subscribers of its type: the synchronous
+// ones in subscription order, then it queues it to the asynchronous ones
+// without waiting: a subscriber whose queue is full misses the event.
+// Events published after Close are dropped.
+func (b *Bus) Publish(ctx context.Context, event any) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
+	}
+	subs := b.subscribers[reflect.TypeOf(event)]
+	b.mu.RUnlock()
+
+	var async []*subscriber
+	for _, s := range subs {
+		if s.queue == nil {
+			b.call(s, ctx, event)
+		} else {
+			async = append(async, s)
+		}
+	}
+	if len(async) == 0 {
+		return
+	}
+
+	// Queue under a single lock, so every subscriber sees the same order
+	b.publishMu.Lock()
+	defer b.publishMu.Unlock()
+
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+	if closed {
+		return
+	}
+
+	q := queued{ctx: context.WithoutCancel(ctx), event: event}
+	for _, s := range async {
+		select {
+		case <-s.done:
+			// Removed meanwhile
+		case s.queue <- q:
+		default:
+			b.onOverflow(event)
+		}
+	}
+}
+
+// Close stops accepting events and waits for the asynchronous subscribers to
+// handle the events already queued.
+func (b *Bus) Close() {
+	b.publishMu.Lock()
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, subs := range b.subscribers {
+			for _, s := range subs {
+				if s.queue != nil {
+					close(s.queue)
+				}
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.publishMu.Unlock()
+
+	b.wg.Wait()
+}
+
+// call runs the subscriber, recovering and reporting its panic.
+func (b *Bus) call(s *subscriber, ctx context.Context, event any) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.onPanic(event, r)
+		}
+	}()
+
+	s.handle(ctx, event)
+}
@@ -0,0 +1,217 @@
+package events
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testKey struct{}
+
+func TestBus_Subscribe(t *testing.T) {
+	b := NewBus()
+	defer b.Close()
+
+	var got []string
+	Subscribe(b, func(ctx context.Context, e PackSizesChanged) {
+		got = append(got, "first "+e.Tenant)
+	})
+	unsubscribe := Subscribe(b, func(ctx context.Context, e PackSizesChanged) {
+		got = append(got, "second "+e.Tenant)
+	})
+	Subscribe(b, func(ctx context.Context, e CalculationPerformed) {
+		got = append(got, "calculation "+e.Tenant)
+	})
+
+	// Synchronous subscribers are done when Publish returns, in subscription order
+	b.Publish(context.Background(), PackSizesChanged{Tenant: "north"})
+	if want := []string{"first north", "second north"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled events = %v, want %v", got, want)
+	}
+
+	got = nil
+	unsubscribe()
+	unsubscribe()
+	b.Publish(context.Background(), PackSizesChanged{Tenant: "south"})
+	b.Publish(context.Background(), CalculationFailed{Tenant: "south"})
+	if want := []string{"first south"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled events = %v, want %v", got, want)
+	}
+}
+
+func TestBus_SubscribeAsync(t *testing.T) {
+	b := NewBus(WithQueueSize(16))
+
+	var mu sync.Mutex
+	var got []int
+	var gotValue any
+	release := make(chan struct{})
+	SubscribeAsync(b, func(ctx context.Context, e CalculationPerformed) {
+		<-release
+
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, e.Amount)
+		gotValue = ctx.Value(testKey{})
+	})
+
+	// Publishing does not wait for the subscriber, nor for the publisher's context
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testKey{}, "value"))
+	for amount := 1; amount <= 10; amount++ {
+		if amount == 5 {
+			close(release)
+		}
+		b.Publish(ctx, CalculationPerformed{Amount: amount})
+	}
+	cancel()
+
+	// Close waits for the queued events
+	b.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled events = %v, want %v", got, want)
+	}
+	if gotValue != "value" {
+		t.Errorf("context value = %v, want %q", gotValue, "value")
+	}
+
+	// Events published after Close are dropped
+	b.Publish(context.Background(), CalculationPerformed{Amount: 11})
+	if len(got) != 10 {
+		t.Errorf("handled %d events, want 10", len(got))
+	}
+}
+
+// TestBus_Overflow tests that a stuck asynchronous subscriber misses the events
+// once its queue is full, without blocking the publisher nor the other subscribers.
+func TestBus_Overflow(t *testing.T) {
+	var mu sync.Mutex
+	dropped := 0
+	b := NewBus(WithQueueSize(2), WithOverflowHandler(func(event any) {
+		mu.Lock()
+		defer mu.Unlock()
+		dropped++
+	}))
+
+	release := make(chan struct{})
+	var stuck []int
+	SubscribeAsync(b, func(ctx context.Context, e CalculationPerformed) {
+		<-release
+		stuck = append(stuck, e.Amount)
+	})
+	var other []int
+	handled := make(chan struct{})
+	SubscribeAsync(b, func(ctx context.Context, e CalculationPerformed) {
+		other = append(other, e.Amount)
+		handled <- struct{}{}
+	})
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for amount := 1; amount <= 10; amount++ {
+			b.Publish(context.Background(), CalculationPerformed{Amount: amount})
+			<-handled
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish() blocked on the stuck subscriber")
+	}
+
+	close(release)
+	b.Close()
+
+	// The stuck subscriber holds at most one event and queues two more
+	if len(stuck) < 2 || len(stuck) > 3 || dropped != 10-len(stuck) {
+		t.Errorf("stuck subscriber handled %v and dropped %d events", stuck, dropped)
+	}
+	if want := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(other, want) {
+		t.Errorf("other subscriber handled %v, want %v", other, want)
+	}
+}
+
+// TestBus_Order tests that every asynchronous subscriber sees the events of
+// concurrent publishers in the same order.
+func TestBus_Order(t *testing.T) {
+	b := NewBus()
+
+	orders := make([][]int, 3)
+	for i := range orders {
+		SubscribeAsync(b, func(ctx context.Context, e CalculationPerformed) {
+			orders[i] = append(orders[i], e.Amount)
+		})
+	}
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				b.Publish(context.Background(), CalculationPerformed{Amount: p*100 + n})
+			}
+		}()
+	}
+	wg.Wait()
+	b.Close()
+
+	if len(orders[0]) != 200 {
+		t.Fatalf("handled %d events, want 200", len(orders[0]))
+	}
+	for i := 1; i < len(orders); i++ {
+		if !reflect.DeepEqual(orders[i], orders[0]) {
+			t.Errorf("subscriber %d saw another order than subscriber 0", i)
+		}
+	}
+}
+
+func TestBus_Panic(t *testing.T) {
+	var mu sync.Mutex
+	var panics []any
+	b := NewBus(WithPanicHandler(func(event any, recovered any) {
+		mu.Lock()
+		defer mu.Unlock()
+		panics = append(panics, recovered)
+	}))
+
+	var handled []string
+	Subscribe(b, func(ctx context.Context, e CalculationFailed) {
+		panic("sync")
+	})
+	Subscribe(b, func(ctx context.Context, e CalculationFailed) {
+		handled = append(handled, "sync")
+	})
+	done := make(chan struct{})
+	SubscribeAsync(b, func(ctx context.Context, e CalculationFailed) {
+		if e.Amount == 1 {
+			panic("async")
+		}
+		close(done)
+	})
+
+	b.Publish(context.Background(), CalculationFailed{Amount: 1})
+	b.Publish(context.Background(), CalculationFailed{Amount: 2})
+
+	// The panicking asynchronous subscriber keeps handling the next events
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the asynchronous subscriber stopped after a panic")
+	}
+	b.Close()
+
+	if want := []string{"sync", "sync"}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled events = %v, want %v", handled, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(panics) != 3 {
+		t.Errorf("reported panics = %v, want 3", panics)
+	}
+}
@@ -0,0 +1,589 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: pack/v1/pack.proto
+
+package packv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetPackSizesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPackSizesRequest) Reset() {
+	*x = GetPackSizesRequest{}
+	mi := &file_pack_v1_pack_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPackSizesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPackSizesRequest) ProtoMessage() {}
+
+func (x *GetPackSizesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPackSizesRequest.ProtoReflect.Descriptor instead.
+func (*GetPackSizesRequest) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{0}
+}
+
+type GetPackSizesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sizes         []int64                `protobuf:"varint,1,rep,packed,name=sizes,proto3" json:"sizes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPackSizesResponse) Reset() {
+	*x = GetPackSizesResponse{}
+	mi := &file_pack_v1_pack_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPackSizesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPackSizesResponse) ProtoMessage() {}
+
+func (x *GetPackSizesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPackSizesResponse.ProtoReflect.Descriptor instead.
+func (*GetPackSizesResponse) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetPackSizesResponse) GetSizes() []int64 {
+	if x != nil {
+		return x.Sizes
+	}
+	return nil
+}
+
+type SetPackSizesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sizes         []int64                `protobuf:"varint,1,rep,packed,name=sizes,proto3" json:"sizes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetPackSizesRequest) Reset() {
+	*x = SetPackSizesRequest{}
+	mi := &file_pack_v1_pack_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetPackSizesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPackSizesRequest) ProtoMessage() {}
+
+func (x *SetPackSizesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPackSizesRequest.ProtoReflect.Descriptor instead.
+func (*SetPackSizesRequest) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetPackSizesRequest) GetSizes() []int64 {
+	if x != nil {
+		return x.Sizes
+	}
+	return nil
+}
+
+type SetPackSizesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetPackSizesResponse) Reset() {
+	*x = SetPackSizesResponse{}
+	mi := &file_pack_v1_pack_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetPackSizesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPackSizesResponse) ProtoMessage() {}
+
+func (x *SetPackSizesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPackSizesResponse.ProtoReflect.Descriptor instead.
+func (*SetPackSizesResponse) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{3}
+}
+
+type CalculateRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Amount int64                  `protobuf:"varint,1,opt,name=amount,proto3" json:"amount,omitempty"`
+	// exact_only rejects any excess.
+	ExactOnly bool `protobuf:"varint,2,opt,name=exact_only,json=exactOnly,proto3" json:"exact_only,omitempty"`
+	// max_excess and max_excess_percent limit the excess, zero means unlimited.
+	MaxExcess        int64   `protobuf:"varint,3,opt,name=max_excess,json=maxExcess,proto3" json:"max_excess,omitempty"`
+	MaxExcessPercent float64 `protobuf:"fixed64,4,opt,name=max_excess_percent,json=maxExcessPercent,proto3" json:"max_excess_percent,omitempty"`
+	// under_ship ships the largest total at or below the amount instead.
+	UnderShip     bool `protobuf:"varint,5,opt,name=under_ship,json=underShip,proto3" json:"under_ship,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateRequest) Reset() {
+	*x = CalculateRequest{}
+	mi := &file_pack_v1_pack_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateRequest) ProtoMessage() {}
+
+func (x *CalculateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateRequest.ProtoReflect.Descriptor instead.
+func (*CalculateRequest) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CalculateRequest) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *CalculateRequest) GetExactOnly() bool {
+	if x != nil {
+		return x.ExactOnly
+	}
+	return false
+}
+
+func (x *CalculateRequest) GetMaxExcess() int64 {
+	if x != nil {
+		return x.MaxExcess
+	}
+	return 0
+}
+
+func (x *CalculateRequest) GetMaxExcessPercent() float64 {
+	if x != nil {
+		return x.MaxExcessPercent
+	}
+	return 0
+}
+
+func (x *CalculateRequest) GetUnderShip() bool {
+	if x != nil {
+		return x.UnderShip
+	}
+	return false
+}
+
+type CalculateResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Amount int64                  `protobuf:"varint,1,opt,name=amount,proto3" json:"amount,omitempty"`
+	// packs maps a pack size to the number of packs of that size.
+	Packs         map[int64]int64 `protobuf:"bytes,2,rep,name=packs,proto3" json:"packs,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateResponse) Reset() {
+	*x = CalculateResponse{}
+	mi := &file_pack_v1_pack_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateResponse) ProtoMessage() {}
+
+func (x *CalculateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateResponse.ProtoReflect.Descriptor instead.
+func (*CalculateResponse) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CalculateResponse) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *CalculateResponse) GetPacks() map[int64]int64 {
+	if x != nil {
+		return x.Packs
+	}
+	return nil
+}
+
+type CalculateBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Amount        int64                  `protobuf:"varint,1,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateBatchRequest) Reset() {
+	*x = CalculateBatchRequest{}
+	mi := &file_pack_v1_pack_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateBatchRequest) ProtoMessage() {}
+
+func (x *CalculateBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateBatchRequest.ProtoReflect.Descriptor instead.
+func (*CalculateBatchRequest) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CalculateBatchRequest) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+type CalculateBatchResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Amount int64                  `protobuf:"varint,1,opt,name=amount,proto3" json:"amount,omitempty"`
+	// packs is empty when the amount failed.
+	Packs map[int64]int64 `protobuf:"bytes,2,rep,name=packs,proto3" json:"packs,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// error is set when the amount could not be calculated.
+	Error         *CalculateError `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateBatchResponse) Reset() {
+	*x = CalculateBatchResponse{}
+	mi := &file_pack_v1_pack_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateBatchResponse) ProtoMessage() {}
+
+func (x *CalculateBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateBatchResponse.ProtoReflect.Descriptor instead.
+func (*CalculateBatchResponse) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CalculateBatchResponse) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *CalculateBatchResponse) GetPacks() map[int64]int64 {
+	if x != nil {
+		return x.Packs
+	}
+	return nil
+}
+
+func (x *CalculateBatchResponse) GetError() *CalculateError {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+// CalculateError is the failure of a single calculation of a batch.
+type CalculateError struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// code is the gRPC status code the Calculate RPC fails with for the amount.
+	Code          int32  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculateError) Reset() {
+	*x = CalculateError{}
+	mi := &file_pack_v1_pack_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateError) ProtoMessage() {}
+
+func (x *CalculateError) ProtoReflect() protoreflect.Message {
+	mi := &file_pack_v1_pack_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateError.ProtoReflect.Descriptor instead.
+func (*CalculateError) Descriptor() ([]byte, []int) {
+	return file_pack_v1_pack_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CalculateError) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *CalculateError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_pack_v1_pack_proto protoreflect.FileDescriptor
+
+const file_pack_v1_pack_proto_rawDesc = "" +
+	"\n" +
+	"\x12pack/v1/pack.proto\x12\apack.v1\"\x15\n" +
+	"\x13GetPackSizesRequest\",\n" +
+	"\x14GetPackSizesResponse\x12\x14\n" +
+	"\x05sizes\x18\x01 \x03(\x03R\x05sizes\"+\n" +
+	"\x13SetPackSizesRequest\x12\x14\n" +
+	"\x05sizes\x18\x01 \x03(\x03R\x05sizes\"\x16\n" +
+	"\x14SetPackSizesResponse\"\xb5\x01\n" +
+	"\x10CalculateRequest\x12\x16\n" +
+	"\x06amount\x18\x01 \x01(\x03R\x06amount\x12\x1d\n" +
+	"\n" +
+	"exact_only\x18\x02 \x01(\bR\texactOnly\x12\x1d\n" +
+	"\n" +
+	"max_excess\x18\x03 \x01(\x03R\tmaxExcess\x12,\n" +
+	"\x12max_excess_percent\x18\x04 \x01(\x01R\x10maxExcessPercent\x12\x1d\n" +
+	"\n" +
+	"under_ship\x18\x05 \x01(\bR\tunderShip\"\xa2\x01\n" +
+	"\x11CalculateResponse\x12\x16\n" +
+	"\x06amount\x18\x01 \x01(\x03R\x06amount\x12;\n" +
+	"\x05packs\x18\x02 \x03(\v2%.pack.v1.CalculateResponse.PacksEntryR\x05packs\x1a8\n" +
+	"\n" +
+	"PacksEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x03R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"/\n" +
+	"\x15CalculateBatchRequest\x12\x16\n" +
+	"\x06amount\x18\x01 \x01(\x03R\x06amount\"\xdb\x01\n" +
+	"\x16CalculateBatchResponse\x12\x16\n" +
+	"\x06amount\x18\x01 \x01(\x03R\x06amount\x12@\n" +
+	"\x05packs\x18\x02 \x03(\v2*.pack.v1.CalculateBatchResponse.PacksEntryR\x05packs\x12-\n" +
+	"\x05error\x18\x03 \x01(\v2\x17.pack.v1.CalculateErrorR\x05error\x1a8\n" +
+	"\n" +
+	"PacksEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x03R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\">\n" +
+	"\x0eCalculateError\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage2\xc2\x02\n" +
+	"\vPackService\x12K\n" +
+	"\fGetPackSizes\x12\x1c.pack.v1.GetPackSizesRequest\x1a\x1d.pack.v1.GetPackSizesResponse\x12K\n" +
+	"\fSetPackSizes\x12\x1c.pack.v1.SetPackSizesRequest\x1a\x1d.pack.v1.SetPackSizesResponse\x12B\n" +
+	"\tCalculate\x12\x19.pack.v1.CalculateRequest\x1a\x1a.pack.v1.CalculateResponse\x12U\n" +
+	"\x0eCalculateBatch\x12\x1e.pack.v1.CalculateBatchRequest\x1a\x1f.pack.v1.CalculateBatchResponse(\x010\x01B=Z;denisgodoroja/retask/internal/grpcservice/pb/pack/v1;packv1b\x06proto3"
+
+var (
+	file_pack_v1_pack_proto_rawDescOnce sync.Once
+	file_pack_v1_pack_proto_rawDescData []byte
+)
+
+func file_pack_v1_pack_proto_rawDescGZIP() []byte {
+	file_pack_v1_pack_proto_rawDescOnce.Do(func() {
+		file_pack_v1_pack_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pack_v1_pack_proto_rawDesc), len(file_pack_v1_pack_proto_rawDesc)))
+	})
+	return file_pack_v1_pack_proto_rawDescData
+}
+
+var file_pack_v1_pack_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_pack_v1_pack_proto_goTypes = []any{
+	(*GetPackSizesRequest)(nil),    // 0: pack.v1.GetPackSizesRequest
+	(*GetPackSizesResponse)(nil),   // 1: pack.v1.GetPackSizesResponse
+	(*SetPackSizesRequest)(nil),    // 2: pack.v1.SetPackSizesRequest
+	(*SetPackSizesResponse)(nil),   // 3: pack.v1.SetPackSizesResponse
+	(*CalculateRequest)(nil),       // 4: pack.v1.CalculateRequest
+	(*CalculateResponse)(nil),      // 5: pack.v1.CalculateResponse
+	(*CalculateBatchRequest)(nil),  // 6: pack.v1.CalculateBatchRequest
+	(*CalculateBatchResponse)(nil), // 7: pack.v1.CalculateBatchResponse
+	(*CalculateError)(nil),         // 8: pack.v1.CalculateError
+	nil,                            // 9: pack.v1.CalculateResponse.PacksEntry
+	nil,                            // 10: pack.v1.CalculateBatchResponse.PacksEntry
+}
+var file_pack_v1_pack_proto_depIdxs = []int32{
+	9,  // 0: pack.v1.CalculateResponse.packs:type_name -> pack.v1.CalculateResponse.PacksEntry
+	10, // 1: pack.v1.CalculateBatchResponse.packs:type_name -> pack.v1.CalculateBatchResponse.PacksEntry
+	8,  // 2: pack.v1.CalculateBatchResponse.error:type_name -> pack.v1.CalculateError
+	0,  // 3: pack.v1.PackService.GetPackSizes:input_type -> pack.v1.GetPackSizesRequest
+	2,  // 4: pack.v1.PackService.SetPackSizes:input_type -> pack.v1.SetPackSizesRequest
+	4,  // 5: pack.v1.PackService.Calculate:input_type -> pack.v1.CalculateRequest
+	6,  // 6: pack.v1.PackService.CalculateBatch:input_type -> pack.v1.CalculateBatchRequest
+	1,  // 7: pack.v1.PackService.GetPackSizes:output_type -> pack.v1.GetPackSizesResponse
+	3,  // 8: pack.v1.PackService.SetPackSizes:output_type -> pack.v1.SetPackSizesResponse
+	5,  // 9: pack.v1.PackService.Calculate:output_type -> pack.v1.CalculateResponse
+	7,  // 10: pack.v1.PackService.CalculateBatch:output_type -> pack.v1.CalculateBatchResponse
+	7,  // [7:11] is the sub-list for method output_type
+	3,  // [3:7] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_pack_v1_pack_proto_init() }
+func file_pack_v1_pack_proto_init() {
+	if File_pack_v1_pack_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pack_v1_pack_proto_rawDesc), len(file_pack_v1_pack_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pack_v1_pack_proto_goTypes,
+		DependencyIndexes: file_pack_v1_pack_proto_depIdxs,
+		MessageInfos:      file_pack_v1_pack_proto_msgTypes,
+	}.Build()
+	File_pack_v1_pack_proto = out.File
+	file_pack_v1_pack_proto_goTypes = nil
+	file_pack_v1_pack_proto_depIdxs = nil
+}
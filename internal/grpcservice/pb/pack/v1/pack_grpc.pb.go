@@ -0,0 +1,246 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: pack/v1/pack.proto
+
+package packv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PackService_GetPackSizes_FullMethodName   = "/pack.v1.PackService/GetPackSizes"
+	PackService_SetPackSizes_FullMethodName   = "/pack.v1.PackService/SetPackSizes"
+	PackService_Calculate_FullMethodName      = "/pack.v1.PackService/Calculate"
+	PackService_CalculateBatch_FullMethodName = "/pack.v1.PackService/CalculateBatch"
+)
+
+// PackServiceClient is the client API for PackService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PackService mirrors the REST API exposed by the webservice package.
+type PackServiceClient interface {
+	// GetPackSizes returns the currently configured pack sizes, sorted ascending.
+	GetPackSizes(ctx context.Context, in *GetPackSizesRequest, opts ...grpc.CallOption) (*GetPackSizesResponse, error)
+	// SetPackSizes replaces all configured pack sizes.
+	SetPackSizes(ctx context.Context, in *SetPackSizesRequest, opts ...grpc.CallOption) (*SetPackSizesResponse, error)
+	// Calculate returns the optimal packs for a single amount.
+	Calculate(ctx context.Context, in *CalculateRequest, opts ...grpc.CallOption) (*CalculateResponse, error)
+	// CalculateBatch calculates packs for every amount sent on the stream,
+	// answering each request in the order it was received. An amount that cannot
+	// be calculated is answered with its error, the stream goes on.
+	CalculateBatch(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CalculateBatchRequest, CalculateBatchResponse], error)
+}
+
+type packServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPackServiceClient(cc grpc.ClientConnInterface) PackServiceClient {
+	return &packServiceClient{cc}
+}
+
+func (c *packServiceClient) GetPackSizes(ctx context.Context, in *GetPackSizesRequest, opts ...grpc.CallOption) (*GetPackSizesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetPackSizesResponse)
+	err := c.cc.Invoke(ctx, PackService_GetPackSizes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packServiceClient) SetPackSizes(ctx context.Context, in *SetPackSizesRequest, opts ...grpc.CallOption) (*SetPackSizesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetPackSizesResponse)
+	err := c.cc.Invoke(ctx, PackService_SetPackSizes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packServiceClient) Calculate(ctx context.Context, in *CalculateRequest, opts ...grpc.CallOption) (*CalculateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CalculateResponse)
+	err := c.cc.Invoke(ctx, PackService_Calculate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packServiceClient) CalculateBatch(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CalculateBatchRequest, CalculateBatchResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PackService_ServiceDesc.Streams[0], PackService_CalculateBatch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CalculateBatchRequest, CalculateBatchResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PackService_CalculateBatchClient = grpc.BidiStreamingClient[CalculateBatchRequest, CalculateBatchResponse]
+
+// PackServiceServer is the server API for PackService service.
+// All implementations must embed UnimplementedPackServiceServer
+// for forward compatibility.
+//
+// PackService mirrors the REST API exposed by the webservice package.
+type PackServiceServer interface {
+	// GetPackSizes returns the currently configured pack sizes, sorted ascending.
+	GetPackSizes(context.Context, *GetPackSizesRequest) (*GetPackSizesResponse, error)
+	// SetPackSizes replaces all configured pack sizes.
+	SetPackSizes(context.Context, *SetPackSizesRequest) (*SetPackSizesResponse, error)
+	// Calculate returns the optimal packs for a single amount.
+	Calculate(context.Context, *CalculateRequest) (*CalculateResponse, error)
+	// CalculateBatch calculates packs for every amount sent on the stream,
+	// answering each request in the order it was received. An amount that cannot
+	// be calculated is answered with its error, the stream goes on.
+	CalculateBatch(grpc.BidiStreamingServer[CalculateBatchRequest, CalculateBatchResponse]) error
+	mustEmbedUnimplementedPackServiceServer()
+}
+
+// UnimplementedPackServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPackServiceServer struct{}
+
+func (UnimplementedPackServiceServer) GetPackSizes(context.Context, *GetPackSizesRequest) (*GetPackSizesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetPackSizes not implemented")
+}
+func (UnimplementedPackServiceServer) SetPackSizes(context.Context, *SetPackSizesRequest) (*SetPackSizesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetPackSizes not implemented")
+}
+func (UnimplementedPackServiceServer) Calculate(context.Context, *CalculateRequest) (*CalculateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Calculate not implemented")
+}
+func (UnimplementedPackServiceServer) CalculateBatch(grpc.BidiStreamingServer[CalculateBatchRequest, CalculateBatchResponse]) error {
+	return status.Error(codes.Unimplemented, "method CalculateBatch not implemented")
+}
+func (UnimplementedPackServiceServer) mustEmbedUnimplementedPackServiceServer() {}
+func (UnimplementedPackServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafePackServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PackServiceServer will
+// result in compilation errors.
+type UnsafePackServiceServer interface {
+	mustEmbedUnimplementedPackServiceServer()
+}
+
+func RegisterPackServiceServer(s grpc.ServiceRegistrar, srv PackServiceServer) {
+	// If the following call panics, it indicates UnimplementedPackServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PackService_ServiceDesc, srv)
+}
+
+func _PackService_GetPackSizes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPackSizesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackServiceServer).GetPackSizes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackService_GetPackSizes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackServiceServer).GetPackSizes(ctx, req.(*GetPackSizesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackService_SetPackSizes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPackSizesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackServiceServer).SetPackSizes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackService_SetPackSizes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackServiceServer).SetPackSizes(ctx, req.(*SetPackSizesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackService_Calculate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalculateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackServiceServer).Calculate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackService_Calculate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackServiceServer).Calculate(ctx, req.(*CalculateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackService_CalculateBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PackServiceServer).CalculateBatch(&grpc.GenericServerStream[CalculateBatchRequest, CalculateBatchResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PackService_CalculateBatchServer = grpc.BidiStreamingServer[CalculateBatchRequest, CalculateBatchResponse]
+
+// PackService_ServiceDesc is the grpc.ServiceDesc for PackService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PackService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pack.v1.PackService",
+	HandlerType: (*PackServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPackSizes",
+			Handler:    _PackService_GetPackSizes_Handler,
+		},
+		{
+			MethodName: "SetPackSizes",
+			Handler:    _PackService_SetPackSizes_Handler,
+		},
+		{
+			MethodName: "Calculate",
+			Handler:    _PackService_Calculate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CalculateBatch",
+			Handler:       _PackService_CalculateBatch_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pack/v1/pack.proto",
+}
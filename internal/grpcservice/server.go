@@ -0,0 +1,422 @@
+package grpcservice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"denisgodoroja/retask/internal/calculator"
+	packv1 "denisgodoroja/retask/internal/grpcservice/pb/pack/v1"
+	"denisgodoroja/retask/internal/optimizer"
+	"denisgodoroja/retask/internal/packconfig"
+	"denisgodoroja/retask/internal/service"
+	"denisgodoroja/retask/internal/shipping"
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+	"denisgodoroja/retask/internal/webservice"
+)
+
+// Server implements the generated packv1.PackServiceServer interface
+// on top of the same PackService used by the REST handlers.
+type Server struct {
+	packv1.UnimplementedPackServiceServer
+
+	service *service.PackService
+	// tenants identifies the tenant of every call.
+	tenants *tenant.Resolver
+	// rateLimiter limits the calls of every peer, nil for no limit.
+	rateLimiter *webservice.RateLimiter
+	// tenantRateLimiter limits the calls of every tenant, nil for no limit.
+	tenantRateLimiter *webservice.RateLimiter
+	// slots bounds the calculations running at the same time, nil for no limit.
+	slots chan struct{}
+	// calculationTimeout bounds every calculation, 0 for no deadline.
+	calculationTimeout time.Duration
+}
+
+// Option configures optional Server settings.
+type Option func(*Server)
+
+// WithTenantResolver identifies the tenant of every call with the resolver,
+// the same as the REST API, instead of trusting the x-tenant-id metadata.
+func WithTenantResolver(r *tenant.Resolver) Option {
+	return func(s *Server) {
+		s.tenants = r
+	}
+}
+
+// WithRateLimit limits the calls of every peer to rps per second, with bursts
+// of up to burst calls, the same as the REST API.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(s *Server) {
+		s.rateLimiter = webservice.NewRateLimiter(rps, burst)
+	}
+}
+
+// WithTenantRateLimiter limits the calls of every tenant with l, on top of the
+// per-peer rate limit. Sharing l with the REST router (see
+// webservice.WithTenantRateLimiter) limits the requests of a tenant over both APIs.
+func WithTenantRateLimiter(l *webservice.RateLimiter) Option {
+	return func(s *Server) {
+		s.tenantRateLimiter = l
+	}
+}
+
+// WithConcurrencyLimit bounds the number of calculations processed at the same time.
+// Calls above the limit fail with ResourceExhausted instead of queuing.
+func WithConcurrencyLimit(n int) Option {
+	return func(s *Server) {
+		s.slots = make(chan struct{}, n)
+	}
+}
+
+// WithCalculationTimeout sets the deadline of every calculation, of every amount
+// of a batch on its own, the same as the REST API. The default is
+// webservice.DefaultCalculationTimeout, a zero or negative value disables it.
+func WithCalculationTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.calculationTimeout = d
+	}
+}
+
+// NewServer creates a new gRPC Server with its dependencies.
+func NewServer(s *service.PackService, opts ...Option) *Server {
+	srv := &Server{
+		service:            s,
+		tenants:            tenant.NewResolver(),
+		calculationTimeout: webservice.DefaultCalculationTimeout,
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	return srv
+}
+
+// Request metadata keys identifying the tenant.
+const (
+	tenantMetadataKey        = "x-tenant-id"
+	authorizationMetadataKey = "authorization"
+)
+
+// NewGRPCServer creates a *grpc.Server with the PackService registered on it.
+// The tenant of every call is resolved from its x-tenant-id and authorization
+// metadata, see WithTenantResolver, and the calls are limited by WithRateLimit
+// and WithConcurrencyLimit.
+func NewGRPCServer(s *Server, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.tenantUnaryInterceptor, s.limitUnaryInterceptor),
+		grpc.ChainStreamInterceptor(s.tenantStreamInterceptor, s.limitStreamInterceptor),
+	)
+	grpcServer := grpc.NewServer(opts...)
+	packv1.RegisterPackServiceServer(grpcServer, s)
+
+	return grpcServer
+}
+
+// GetPackSizes handles the GetPackSizes RPC.
+func (s *Server) GetPackSizes(ctx context.Context, req *packv1.GetPackSizesRequest) (*packv1.GetPackSizesResponse, error) {
+	sizes, err := s.service.GetPackSizes(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &packv1.GetPackSizesResponse{Sizes: toInt64s(sizes)}, nil
+}
+
+// SetPackSizes handles the SetPackSizes RPC.
+func (s *Server) SetPackSizes(ctx context.Context, req *packv1.SetPackSizesRequest) (*packv1.SetPackSizesResponse, error) {
+	if err := s.service.SetPackSizes(ctx, toInts(req.GetSizes())); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &packv1.SetPackSizesResponse{}, nil
+}
+
+// Calculate handles the Calculate RPC.
+func (s *Server) Calculate(ctx context.Context, req *packv1.CalculateRequest) (*packv1.CalculateResponse, error) {
+	fit := service.Fit{
+		ExactOnly:        req.GetExactOnly(),
+		MaxExcess:        int(req.GetMaxExcess()),
+		MaxExcessPercent: req.GetMaxExcessPercent(),
+		UnderShip:        req.GetUnderShip(),
+	}
+
+	ctx, cancel := s.calculationContext(withRequester(ctx))
+	defer cancel()
+
+	packs, err := s.service.CalculateFit(ctx, int(req.GetAmount()), fit)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &packv1.CalculateResponse{Amount: req.GetAmount(), Packs: toInt64Map(packs)}, nil
+}
+
+// CalculateBatch handles the bidirectional CalculateBatch RPC.
+// Every received amount is answered with exactly one response, in order: its
+// packs, or the error the Calculate RPC would fail with. Only the end of the
+// stream itself ends the batch.
+func (s *Server) CalculateBatch(stream grpc.BidiStreamingServer[packv1.CalculateBatchRequest, packv1.CalculateBatchResponse]) error {
+	ctx := withRequester(stream.Context())
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp := &packv1.CalculateBatchResponse{Amount: req.GetAmount()}
+		packs, err := s.calculateBatchAmount(ctx, int(req.GetAmount()))
+
+		// A calculation timing out fails its amount only, the end of the stream all of them
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return toStatus(err)
+		case err != nil:
+			st := status.Convert(toStatus(err))
+			resp.Error = &packv1.CalculateError{Code: int32(st.Code()), Message: st.Message()}
+		default:
+			resp.Packs = toInt64Map(packs)
+		}
+
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// calculationContext derives the context of a calculation, bounded by the calculation deadline.
+func (s *Server) calculationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.calculationTimeout > 0 {
+		return context.WithTimeout(ctx, s.calculationTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// calculateBatchAmount calculates an amount of a batch within the calculation
+// deadline. Every amount counts as a call against the rate limits, so a single
+// stream cannot calculate faster than separate calls.
+func (s *Server) calculateBatchAmount(ctx context.Context, amount int) (map[int]int, error) {
+	if err := s.allow(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.calculationContext(ctx)
+	defer cancel()
+
+	return s.service.Calculate(ctx, amount)
+}
+
+// withTenant stores the tenant resolved from the call metadata in the context.
+// It fails with Unauthenticated for a missing or invalid token, PermissionDenied
+// for a tenant that is not allowed and InvalidArgument for an invalid tenant ID.
+func (s *Server) withTenant(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	id, err := s.tenants.Resolve(first(tenantMetadataKey), first(authorizationMetadataKey))
+	switch {
+	case errors.Is(err, tenant.ErrInvalidToken):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, tenant.ErrUnknown):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return tenant.NewContext(ctx, id), nil
+}
+
+// tenantUnaryInterceptor scopes unary calls to the tenant of their metadata.
+func (s *Server) tenantUnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.withTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// tenantStreamInterceptor scopes streaming calls to the tenant of their metadata.
+func (s *Server) tenantStreamInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.withTenant(ss.Context())
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &tenantStream{ServerStream: ss, ctx: ctx})
+}
+
+// tenantStream overrides the context of a server stream.
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context {
+	return s.ctx
+}
+
+// calculationMethods are the methods running calculations, bounded by WithConcurrencyLimit.
+var calculationMethods = map[string]bool{
+	packv1.PackService_Calculate_FullMethodName:      true,
+	packv1.PackService_CalculateBatch_FullMethodName: true,
+}
+
+// limitUnaryInterceptor applies the rate and concurrency limits to unary calls.
+func (s *Server) limitUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	release, err := s.acquire(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return handler(ctx, req)
+}
+
+// limitStreamInterceptor applies the rate and concurrency limits to streaming calls.
+// A stream holds its concurrency slot until it ends, and CalculateBatch charges
+// the rate limits again for every amount.
+func (s *Server) limitStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	release, err := s.acquire(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return handler(srv, ss)
+}
+
+// acquire admits a call to method, failing with ResourceExhausted when the peer
+// or the tenant is above its rate or all the calculation slots are busy. The
+// returned function releases the slot of the call.
+func (s *Server) acquire(ctx context.Context, method string) (func(), error) {
+	if err := s.allow(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.slots == nil || !calculationMethods[method] {
+		return func() {}, nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return func() { <-s.slots }, nil
+	default:
+		return nil, status.Error(codes.ResourceExhausted, "Too many concurrent requests")
+	}
+}
+
+// allow charges a call to the rate limits of the peer and the tenant of the
+// context, failing with ResourceExhausted above either rate.
+func (s *Server) allow(ctx context.Context) error {
+	if s.rateLimiter != nil && !s.rateLimiter.Allow(peerHost(ctx)) {
+		return status.Error(codes.ResourceExhausted, "Rate limit exceeded")
+	}
+	if s.tenantRateLimiter != nil && !s.tenantRateLimiter.Allow(tenant.FromContext(ctx)) {
+		return status.Error(codes.ResourceExhausted, "Rate limit exceeded")
+	}
+
+	return nil
+}
+
+// withRequester identifies the requester of the calculations by the peer host.
+func withRequester(ctx context.Context) context.Context {
+	host := peerHost(ctx)
+	if host == "" {
+		return ctx
+	}
+
+	return service.ContextWithRequester(ctx, host)
+}
+
+// peerHost returns the host of the peer of the call, empty when unknown.
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// toStatus maps an error returned by the service layer to a gRPC status error.
+// Status errors, such as the ones of the limits, are returned as they are.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	// The same classes of errors as the REST API (see webservice.respondWithServiceError)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, service.ErrAmountTooLarge), errors.Is(err, service.ErrInvalidPack),
+		errors.Is(err, calculator.ErrInvalidRange), errors.Is(err, service.ErrNoPackSizes), errors.Is(err, service.ErrNoAmounts),
+		errors.Is(err, optimizer.ErrNoDemand), errors.Is(err, optimizer.ErrInvalidConstraints),
+		errors.Is(err, calculator.ErrInvalidQuantity), errors.Is(err, calculator.ErrUnknownUnit), errors.Is(err, calculator.ErrIncompatibleUnits),
+		errors.Is(err, calculator.ErrInvalidRule), errors.Is(err, service.ErrInvalidSchedule), errors.Is(err, service.ErrInvalidAsOf), errors.Is(err, service.ErrInvalidWebhook),
+		errors.Is(err, packconfig.ErrInvalidDocument),
+		errors.Is(err, shipping.ErrNoContainerTypes), errors.Is(err, shipping.ErrInvalidItem), errors.Is(err, shipping.ErrItemTooLarge):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, calculator.ErrWorkBudgetExceeded), errors.Is(err, calculator.ErrTableTooLarge), errors.Is(err, shipping.ErrTooManyItems):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, calculator.ErrInfeasible), errors.Is(err, service.ErrChangeInEffect):
+		// Rule errors wrap ErrInfeasible
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrHistoryDisabled), errors.Is(err, service.ErrCatalogDisabled), errors.Is(err, service.ErrScheduleDisabled),
+		errors.Is(err, service.ErrWebhooksDisabled), errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func toInt64s(in []int) []int64 {
+	out := make([]int64, len(in))
+	for i, v := range in {
+		out[i] = int64(v)
+	}
+
+	return out
+}
+
+func toInts(in []int64) []int {
+	out := make([]int, len(in))
+	for i, v := range in {
+		out[i] = int(v)
+	}
+
+	return out
+}
+
+func toInt64Map(in map[int]int) map[int64]int64 {
+	out := make(map[int64]int64, len(in))
+	for k, v := range in {
+		out[int64(k)] = int64(v)
+	}
+
+	return out
+}
@@ -0,0 +1,629 @@
+package grpcservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"denisgodoroja/retask/internal/calculator"
+	packv1 "denisgodoroja/retask/internal/grpcservice/pb/pack/v1"
+	"denisgodoroja/retask/internal/service"
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+	"denisgodoroja/retask/internal/webservice"
+)
+
+// -- This is a mock *repository* --
+type mockPackRepository struct {
+	storage.PackRepository
+	FindAllFunc    func(ctx context.Context) ([]storage.Pack, error)
+	ReplaceAllFunc func(ctx context.Context, packs []storage.Pack) error
+}
+
+func (m *mockPackRepository) FindAll(ctx context.Context) ([]storage.Pack, error) {
+	return m.FindAllFunc(ctx)
+}
+func (m *mockPackRepository) ReplaceAll(ctx context.Context, packs []storage.Pack) error {
+	return m.ReplaceAllFunc(ctx, packs)
+}
+
+// setupTest starts a gRPC server on an in-memory bufconn listener
+// and returns a client connected to it together with the mock repo.
+func setupTest(t *testing.T, opts ...Option) (packv1.PackServiceClient, *mockPackRepository) {
+	t.Helper()
+
+	mockRepo := &mockPackRepository{}
+	grpcServer := NewGRPCServer(NewServer(service.NewPackService(mockRepo), opts...))
+
+	lis := bufconn.Listen(1024 * 1024)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return packv1.NewPackServiceClient(conn), mockRepo
+}
+
+func TestServer_GetPackSizes(t *testing.T) {
+	client, mockRepo := setupTest(t)
+
+	// Case 1: Success
+	t.Run("Success", func(t *testing.T) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(100, 200), nil
+		}
+
+		resp, err := client.GetPackSizes(context.Background(), &packv1.GetPackSizesRequest{})
+		if err != nil {
+			t.Fatalf("GetPackSizes() returned an unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(resp.GetSizes(), []int64{100, 200}) {
+			t.Errorf("wrong sizes. got %v, want %v", resp.GetSizes(), []int64{100, 200})
+		}
+	})
+
+	// Case 2: Service Error
+	t.Run("Service Error", func(t *testing.T) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return nil, errors.New("db broke")
+		}
+
+		_, err := client.GetPackSizes(context.Background(), &packv1.GetPackSizesRequest{})
+		if status.Code(err) != codes.Internal {
+			t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.Internal)
+		}
+	})
+}
+
+func TestServer_SetPackSizes(t *testing.T) {
+	client, mockRepo := setupTest(t)
+
+	// Case 1: Success
+	t.Run("Success", func(t *testing.T) {
+		mockRepo.ReplaceAllFunc = func(ctx context.Context, packs []storage.Pack) error {
+			if !reflect.DeepEqual(packs, storage.NewPacks(10, 20)) {
+				t.Error("ReplaceAll not called with correct args")
+			}
+			return nil
+		}
+
+		_, err := client.SetPackSizes(context.Background(), &packv1.SetPackSizesRequest{Sizes: []int64{10, 20}})
+		if err != nil {
+			t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+		}
+	})
+
+	// Case 2: Service Error
+	t.Run("Service Error", func(t *testing.T) {
+		mockRepo.ReplaceAllFunc = func(ctx context.Context, packs []storage.Pack) error {
+			return errors.New("db write failed")
+		}
+
+		_, err := client.SetPackSizes(context.Background(), &packv1.SetPackSizesRequest{Sizes: []int64{10, 20}})
+		if status.Code(err) != codes.Internal {
+			t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.Internal)
+		}
+	})
+
+	// Case 3: Invalid Sizes
+	t.Run("Invalid Sizes", func(t *testing.T) {
+		mockRepo.ReplaceAllFunc = func(ctx context.Context, packs []storage.Pack) error {
+			t.Error("ReplaceAll called with invalid sizes")
+			return nil
+		}
+
+		for _, sizes := range [][]int64{{10, 10}, {10, 0}, {-10}} {
+			_, err := client.SetPackSizes(context.Background(), &packv1.SetPackSizesRequest{Sizes: sizes})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("SetPackSizes(%v) code = %v, want %v", sizes, status.Code(err), codes.InvalidArgument)
+			}
+		}
+	})
+}
+
+func TestServer_Calculate(t *testing.T) {
+	client, mockRepo := setupTest(t)
+
+	// Case 1: Success
+	t.Run("Success", func(t *testing.T) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 500), nil
+		}
+
+		resp, err := client.Calculate(context.Background(), &packv1.CalculateRequest{Amount: 300})
+		if err != nil {
+			t.Fatalf("Calculate() returned an unexpected error: %v", err)
+		}
+
+		wantPacks := map[int64]int64{500: 1}
+		if !reflect.DeepEqual(resp.GetPacks(), wantPacks) {
+			t.Errorf("wrong packs. got %v, want %v", resp.GetPacks(), wantPacks)
+		}
+	})
+
+	// Case 2: Repo Error
+	t.Run("Repo Error", func(t *testing.T) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return nil, errors.New("repo died")
+		}
+
+		_, err := client.Calculate(context.Background(), &packv1.CalculateRequest{Amount: 300})
+		if status.Code(err) != codes.Internal {
+			t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.Internal)
+		}
+	})
+
+	// Case 3: Infeasible
+	t.Run("Infeasible", func(t *testing.T) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 500), nil
+		}
+
+		_, err := client.Calculate(context.Background(), &packv1.CalculateRequest{Amount: 300, ExactOnly: true})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.FailedPrecondition)
+		}
+	})
+
+	// Case 4: Under Ship
+	t.Run("Under Ship", func(t *testing.T) {
+		resp, err := client.Calculate(context.Background(), &packv1.CalculateRequest{Amount: 300, UnderShip: true})
+		if err != nil {
+			t.Fatalf("Calculate() returned an unexpected error: %v", err)
+		}
+
+		wantPacks := map[int64]int64{250: 1}
+		if !reflect.DeepEqual(resp.GetPacks(), wantPacks) {
+			t.Errorf("wrong packs. got %v, want %v", resp.GetPacks(), wantPacks)
+		}
+	})
+
+	// Case 5: Deadline Exceeded
+	t.Run("Deadline Exceeded", func(t *testing.T) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := client.Calculate(ctx, &packv1.CalculateRequest{Amount: 300})
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.DeadlineExceeded)
+		}
+	})
+}
+
+func TestServer_CalculateBatch(t *testing.T) {
+	client, mockRepo := setupTest(t)
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		return storage.NewPacks(250, 500, 1000), nil
+	}
+
+	stream, err := client.CalculateBatch(context.Background())
+	if err != nil {
+		t.Fatalf("CalculateBatch() returned an unexpected error: %v", err)
+	}
+
+	amounts := []int64{1, 251, 1750}
+	for _, amount := range amounts {
+		if err := stream.Send(&packv1.CalculateBatchRequest{Amount: amount}); err != nil {
+			t.Fatalf("Send() returned an unexpected error: %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend() returned an unexpected error: %v", err)
+	}
+
+	want := []map[int64]int64{
+		{250: 1},
+		{500: 1},
+		{1000: 1, 500: 1, 250: 1},
+	}
+
+	for i := 0; ; i++ {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			if i != len(want) {
+				t.Errorf("wrong number of responses. got %d, want %d", i, len(want))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv() returned an unexpected error: %v", err)
+		}
+		if resp.GetAmount() != amounts[i] {
+			t.Errorf("response %d has wrong amount. got %d, want %d", i, resp.GetAmount(), amounts[i])
+		}
+		if !reflect.DeepEqual(resp.GetPacks(), want[i]) {
+			t.Errorf("response %d has wrong packs. got %v, want %v", i, resp.GetPacks(), want[i])
+		}
+	}
+}
+
+// TestServer_CalculateBatch_Error tests that a failing amount is answered with
+// its error without ending the stream.
+func TestServer_CalculateBatch_Error(t *testing.T) {
+	client, mockRepo := setupTest(t)
+
+	var calls atomic.Int32
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		if calls.Add(1) == 2 {
+			return nil, errors.New("db read failed")
+		}
+		return storage.NewPacks(250, 500, 1000), nil
+	}
+
+	stream, err := client.CalculateBatch(context.Background())
+	if err != nil {
+		t.Fatalf("CalculateBatch() returned an unexpected error: %v", err)
+	}
+	for _, amount := range []int64{1, 251, 1750} {
+		if err := stream.Send(&packv1.CalculateBatchRequest{Amount: amount}); err != nil {
+			t.Fatalf("Send() returned an unexpected error: %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend() returned an unexpected error: %v", err)
+	}
+
+	var got []*packv1.CalculateBatchResponse
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv() returned an unexpected error: %v", err)
+		}
+		got = append(got, resp)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("wrong number of responses. got %d, want 3", len(got))
+	}
+	if got[0].GetError() != nil || !reflect.DeepEqual(got[0].GetPacks(), map[int64]int64{250: 1}) {
+		t.Errorf("response 0 = %v, want packs {250: 1}", got[0])
+	}
+	if e := got[1].GetError(); e == nil || codes.Code(e.GetCode()) != codes.Internal || len(got[1].GetPacks()) != 0 {
+		t.Errorf("response 1 = %v, want error code %v without packs", got[1], codes.Internal)
+	}
+	if got[2].GetError() != nil || !reflect.DeepEqual(got[2].GetPacks(), map[int64]int64{1000: 1, 500: 1, 250: 1}) {
+		t.Errorf("response 2 = %v, want packs {1000: 1, 500: 1, 250: 1}", got[2])
+	}
+}
+
+// TestServer_CalculateBatch_Timeout tests that every amount of a batch is
+// bounded by the calculation deadline on its own.
+func TestServer_CalculateBatch_Timeout(t *testing.T) {
+	client, mockRepo := setupTest(t, WithCalculationTimeout(10*time.Millisecond))
+
+	var calls atomic.Int32
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return storage.NewPacks(250), nil
+	}
+
+	// The stream itself has no deadline
+	stream, err := client.CalculateBatch(context.Background())
+	if err != nil {
+		t.Fatalf("CalculateBatch() returned an unexpected error: %v", err)
+	}
+	for _, amount := range []int64{1, 1} {
+		if err := stream.Send(&packv1.CalculateBatchRequest{Amount: amount}); err != nil {
+			t.Fatalf("Send() returned an unexpected error: %v", err)
+		}
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv() returned an unexpected error: %v", err)
+	}
+	if e := resp.GetError(); e == nil || codes.Code(e.GetCode()) != codes.DeadlineExceeded {
+		t.Errorf("response 0 = %v, want error code %v", resp, codes.DeadlineExceeded)
+	}
+
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv() returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(resp.GetPacks(), map[int64]int64{250: 1}) {
+		t.Errorf("response 1 = %v, want packs {250: 1}", resp)
+	}
+}
+
+func TestServer_Tenant(t *testing.T) {
+	client, mockRepo := setupTest(t)
+
+	var gotTenant string
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		gotTenant = tenant.FromContext(ctx)
+		return storage.NewPacks(100), nil
+	}
+
+	t.Run("Metadata", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "north")
+		if _, err := client.GetPackSizes(ctx, &packv1.GetPackSizesRequest{}); err != nil {
+			t.Fatalf("GetPackSizes() returned an unexpected error: %v", err)
+		}
+		if gotTenant != "north" {
+			t.Errorf("wrong tenant. got %q, want %q", gotTenant, "north")
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		if _, err := client.GetPackSizes(context.Background(), &packv1.GetPackSizesRequest{}); err != nil {
+			t.Fatalf("GetPackSizes() returned an unexpected error: %v", err)
+		}
+		if gotTenant != tenant.DefaultID {
+			t.Errorf("wrong tenant. got %q, want %q", gotTenant, tenant.DefaultID)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "no/slashes")
+		_, err := client.GetPackSizes(ctx, &packv1.GetPackSizesRequest{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.InvalidArgument)
+		}
+	})
+}
+
+// TestServer_TenantToken tests that the calls are scoped to the tenant of their
+// token, as over HTTP, when a token secret is configured.
+func TestServer_TenantToken(t *testing.T) {
+	resolver := tenant.NewResolver(tenant.WithTokenSecret([]byte("s3cret")), tenant.WithAllowed("north"))
+	client, mockRepo := setupTest(t, WithTenantResolver(resolver))
+
+	var gotTenant string
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		gotTenant = tenant.FromContext(ctx)
+		return storage.NewPacks(100), nil
+	}
+
+	bearer := func(secret, claims string) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+		payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(header + "." + payload))
+
+		return "Bearer " + header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	testCases := []struct {
+		name       string
+		md         []string
+		wantCode   codes.Code
+		wantTenant string
+	}{
+		{name: "Unauthenticated", md: []string{"x-tenant-id", "north"}, wantCode: codes.Unauthenticated},
+		{name: "Bad signature", md: []string{"authorization", bearer("other", `{"tenant":"north"}`)}, wantCode: codes.Unauthenticated},
+		{name: "Not allowed", md: []string{"authorization", bearer("s3cret", `{"tenant":"south"}`)}, wantCode: codes.PermissionDenied},
+		{name: "Token", md: []string{"x-tenant-id", "south", "authorization", bearer("s3cret", `{"tenant":"north"}`)}, wantCode: codes.OK, wantTenant: "north"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotTenant = ""
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tc.md...)
+
+			_, err := client.GetPackSizes(ctx, &packv1.GetPackSizesRequest{})
+			if status.Code(err) != tc.wantCode {
+				t.Errorf("GetPackSizes() code = %v, want %v", status.Code(err), tc.wantCode)
+			}
+			if gotTenant != tc.wantTenant {
+				t.Errorf("wrong tenant. got %q, want %q", gotTenant, tc.wantTenant)
+			}
+
+			// Streams are resolved the same way
+			stream, err := client.CalculateBatch(ctx)
+			if err != nil {
+				t.Fatalf("CalculateBatch() returned an unexpected error: %v", err)
+			}
+			stream.CloseSend()
+			if _, err := stream.Recv(); tc.wantCode != codes.OK && status.Code(err) != tc.wantCode {
+				t.Errorf("CalculateBatch() code = %v, want %v", status.Code(err), tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	client, mockRepo := setupTest(t, WithRateLimit(1, 2))
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		return storage.NewPacks(250, 500), nil
+	}
+
+	// The burst is available immediately
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetPackSizes(context.Background(), &packv1.GetPackSizesRequest{}); err != nil {
+			t.Fatalf("GetPackSizes() returned an unexpected error: %v", err)
+		}
+	}
+
+	_, err := client.GetPackSizes(context.Background(), &packv1.GetPackSizesRequest{})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.ResourceExhausted)
+	}
+
+	// Streams are limited too
+	stream, err := client.CalculateBatch(context.Background())
+	if err != nil {
+		t.Fatalf("CalculateBatch() returned an unexpected error: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.ResourceExhausted)
+	}
+}
+
+// TestServer_RateLimit_Batch tests that every amount of a batch is charged to the rate limit.
+func TestServer_RateLimit_Batch(t *testing.T) {
+	// Practically no refill: opening the stream and two amounts use the burst
+	client, mockRepo := setupTest(t, WithRateLimit(0.001, 3))
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		return storage.NewPacks(250), nil
+	}
+
+	stream, err := client.CalculateBatch(context.Background())
+	if err != nil {
+		t.Fatalf("CalculateBatch() returned an unexpected error: %v", err)
+	}
+	for _, amount := range []int64{1, 2, 3} {
+		if err := stream.Send(&packv1.CalculateBatchRequest{Amount: amount}); err != nil {
+			t.Fatalf("Send() returned an unexpected error: %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend() returned an unexpected error: %v", err)
+	}
+
+	wantCodes := []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted}
+	for i, want := range wantCodes {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() returned an unexpected error: %v", err)
+		}
+		if got := codes.Code(resp.GetError().GetCode()); got != want {
+			t.Errorf("response %d code = %v, want %v", i, got, want)
+		}
+	}
+	if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Recv() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestServer_TenantRateLimit(t *testing.T) {
+	// Practically no refill, so only the burst is available
+	limiter := webservice.NewRateLimiter(0.001, 2)
+	client, mockRepo := setupTest(t, WithTenantRateLimiter(limiter))
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		return storage.NewPacks(250, 500), nil
+	}
+
+	// The limiter is shared with the REST API, which already served south once
+	limiter.Allow("south")
+
+	call := func(id string) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", id)
+		_, err := client.GetPackSizes(ctx, &packv1.GetPackSizesRequest{})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call("north"); err != nil {
+			t.Fatalf("GetPackSizes() returned an unexpected error: %v", err)
+		}
+	}
+	if err := call("north"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.ResourceExhausted)
+	}
+
+	if err := call("south"); err != nil {
+		t.Fatalf("GetPackSizes() returned an unexpected error: %v", err)
+	}
+	if err := call("south"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.ResourceExhausted)
+	}
+}
+
+func TestServer_ConcurrencyLimit(t *testing.T) {
+	client, mockRepo := setupTest(t, WithConcurrencyLimit(1))
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		select {
+		case <-entered:
+		default:
+			close(entered)
+		}
+		<-release
+		return storage.NewPacks(250, 500), nil
+	}
+
+	// Occupy the only slot
+	done := make(chan error)
+	go func() {
+		_, err := client.Calculate(context.Background(), &packv1.CalculateRequest{Amount: 1})
+		done <- err
+	}()
+	<-entered
+
+	_, err := client.Calculate(context.Background(), &packv1.CalculateRequest{Amount: 1})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("wrong code. got %v, want %v", status.Code(err), codes.ResourceExhausted)
+	}
+
+	// Calls not running calculations are not limited
+	getDone := make(chan error)
+	go func() {
+		_, err := client.GetPackSizes(context.Background(), &packv1.GetPackSizesRequest{})
+		getDone <- err
+	}()
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Calculate() returned an unexpected error: %v", err)
+	}
+	if err := <-getDone; err != nil {
+		t.Errorf("GetPackSizes() returned an unexpected error: %v", err)
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{name: "Invalid pack", err: fmt.Errorf("%w: size 0", service.ErrInvalidPack), want: codes.InvalidArgument},
+		{name: "Invalid rule", err: calculator.ErrInvalidRule, want: codes.InvalidArgument},
+		{name: "Invalid quantity", err: calculator.ErrInvalidQuantity, want: codes.InvalidArgument},
+		{name: "Amount too large", err: service.ErrAmountTooLarge, want: codes.InvalidArgument},
+		{name: "As of the past", err: service.ErrInvalidAsOf, want: codes.InvalidArgument},
+		{name: "Work budget", err: calculator.ErrWorkBudgetExceeded, want: codes.ResourceExhausted},
+		{name: "Table too large", err: calculator.ErrTableTooLarge, want: codes.ResourceExhausted},
+		{name: "Infeasible", err: calculator.ErrInfeasible, want: codes.FailedPrecondition},
+		{name: "Rule", err: &calculator.RuleError{Rule: calculator.Rule{Kind: calculator.RuleMaxCount, Size: 250, Count: 1}}, want: codes.FailedPrecondition},
+		{name: "Not found", err: storage.ErrNotFound, want: codes.NotFound},
+		{name: "Deadline", err: context.DeadlineExceeded, want: codes.DeadlineExceeded},
+		{name: "Status", err: status.Error(codes.ResourceExhausted, "Rate limit exceeded"), want: codes.ResourceExhausted},
+		{name: "Other", err: errors.New("db read failed"), want: codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(toStatus(tt.err)); got != tt.want {
+				t.Errorf("toStatus() code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
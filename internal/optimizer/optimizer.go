@@ -0,0 +1,394 @@
+package optimizer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"denisgodoroja/retask/internal/calculator"
+)
+
+const (
+	// DefaultMaxCandidates bounds the candidate sizes derived from the demand.
+	DefaultMaxCandidates = 64
+	// DefaultLimit is the number of recommendations returned unless overridden.
+	DefaultLimit = 3
+	// maxPasses bounds the local search improvement passes.
+	maxPasses = 50
+)
+
+var (
+	// ErrNoDemand is returned when there are no positive demand samples.
+	ErrNoDemand = errors.New("no demand samples provided")
+	// ErrInvalidConstraints is returned when the constraints cannot be satisfied.
+	ErrInvalidConstraints = errors.New("invalid constraints")
+)
+
+// Constraints restricts the pack size sets the optimizer may recommend.
+type Constraints struct {
+	// AllowedSizes are the candidate pack sizes. When empty, the most frequent
+	// demand amounts are used, since a size matching an order fits it exactly.
+	AllowedSizes []int
+	// RequiredSizes must be part of every recommended set.
+	RequiredSizes []int
+	// MaxCount is the largest number of sizes in a set.
+	MaxCount int
+}
+
+// Costs weighs excess items against pack handling in the objective.
+type Costs struct {
+	ExcessItemCost float64
+	PackCost       float64
+}
+
+// Recommendation is a recommended pack size set with its expected metrics over the demand.
+type Recommendation struct {
+	Sizes []int
+	calculator.Metrics
+	Cost float64
+}
+
+// AverageExcess returns the expected excess of a single order.
+func (r Recommendation) AverageExcess() float64 {
+	if r.Orders == 0 {
+		return 0
+	}
+
+	return float64(r.TotalExcess) / float64(r.Orders)
+}
+
+// AveragePacks returns the expected number of packs of a single order.
+func (r Recommendation) AveragePacks() float64 {
+	if r.Orders == 0 {
+		return 0
+	}
+
+	return float64(r.TotalPacks) / float64(r.Orders)
+}
+
+// options holds the optional optimizer settings.
+type options struct {
+	limit         int
+	maxCandidates int
+	calcOpts      []calculator.Option
+}
+
+// Option configures an optional optimizer setting.
+type Option func(*options)
+
+// WithLimit sets the number of recommendations returned.
+func WithLimit(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.limit = n
+		}
+	}
+}
+
+// WithMaxCandidates bounds the candidate sizes derived from the demand.
+func WithMaxCandidates(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxCandidates = n
+		}
+	}
+}
+
+// WithCalculatorOptions passes options, such as the work budget, to every evaluation.
+// Sets whose solution table exceeds the work budget are skipped.
+func WithCalculatorOptions(opts ...calculator.Option) Option {
+	return func(o *options) {
+		o.calcOpts = append(o.calcOpts, opts...)
+	}
+}
+
+// Recommend searches for the pack size sets minimizing the total cost of
+// packing the demand, returning the best sets found, cheapest first.
+//
+// The search starts with a greedy construction adding the most profitable
+// size one at a time, then improves the set by local search: removing a size
+// or swapping it for another candidate, as long as the cost decreases.
+func Recommend(ctx context.Context, demand []int, c Constraints, costs Costs, opts ...Option) ([]Recommendation, error) {
+	o := options{limit: DefaultLimit, maxCandidates: DefaultMaxCandidates}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &search{
+		ctx:      ctx,
+		costs:    costs,
+		calcOpts: o.calcOpts,
+		demand:   make(map[int]int),
+		seen:     make(map[string]*Recommendation),
+	}
+
+	for _, amount := range demand {
+		if amount > 0 {
+			s.demand[amount]++
+		}
+	}
+	if len(s.demand) == 0 {
+		return nil, ErrNoDemand
+	}
+
+	required := distinct(c.RequiredSizes)
+	if c.MaxCount <= 0 || len(required) > c.MaxCount {
+		return nil, ErrInvalidConstraints
+	}
+
+	candidates := distinct(c.AllowedSizes)
+	if len(candidates) == 0 {
+		candidates = s.frequentAmounts(o.maxCandidates)
+	}
+	candidates = without(candidates, required)
+
+	best, err := s.greedy(required, candidates, c.MaxCount)
+	if err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return nil, ErrInvalidConstraints
+	}
+
+	if _, err := s.improve(best, required, candidates); err != nil {
+		return nil, err
+	}
+
+	return s.top(o.limit), nil
+}
+
+// search holds the state shared by a single optimization.
+type search struct {
+	ctx      context.Context
+	costs    Costs
+	calcOpts []calculator.Option
+
+	// demand maps every ordered amount to its number of orders.
+	demand map[int]int
+	// seen memoizes the evaluated sets by key, nil for infeasible sets.
+	seen map[string]*Recommendation
+}
+
+// greedy builds a set by adding the size lowering the cost most, until no
+// size improves it or the set is full. Required sizes are always included.
+func (s *search) greedy(required, candidates []int, maxCount int) (*Recommendation, error) {
+	set := append([]int{}, required...)
+
+	var current *Recommendation
+	if len(set) > 0 {
+		var err error
+		if current, err = s.evaluate(set); err != nil {
+			return nil, err
+		}
+	}
+
+	for len(set) < maxCount {
+		var best *Recommendation
+		for _, size := range candidates {
+			if contains(set, size) {
+				continue
+			}
+
+			r, err := s.evaluate(append(append([]int{}, set...), size))
+			if err != nil {
+				return nil, err
+			}
+			if r != nil && (best == nil || r.Cost < best.Cost) {
+				best = r
+			}
+		}
+
+		if best == nil || (current != nil && best.Cost >= current.Cost) {
+			break
+		}
+
+		current = best
+		set = best.Sizes
+	}
+
+	return current, nil
+}
+
+// improve applies removals and swaps of non-required sizes while they lower the cost.
+func (s *search) improve(current *Recommendation, required, candidates []int) (*Recommendation, error) {
+	for pass := 0; pass < maxPasses; pass++ {
+		improved := false
+
+		for _, size := range current.Sizes {
+			if contains(required, size) {
+				continue
+			}
+
+			rest := without(current.Sizes, []int{size})
+
+			// Try dropping the size altogether, then replacing it
+			neighbours := [][]int{rest}
+			for _, candidate := range candidates {
+				if !contains(current.Sizes, candidate) {
+					neighbours = append(neighbours, append(append([]int{}, rest...), candidate))
+				}
+			}
+
+			for _, set := range neighbours {
+				if len(set) == 0 {
+					continue
+				}
+
+				r, err := s.evaluate(set)
+				if err != nil {
+					return nil, err
+				}
+				if r != nil && r.Cost < current.Cost {
+					current, improved = r, true
+					break
+				}
+			}
+
+			if improved {
+				break
+			}
+		}
+
+		if !improved {
+			break
+		}
+	}
+
+	return current, nil
+}
+
+// evaluate returns the metrics of packing the demand with the sizes,
+// or nil when its table exceeds the work budget or calculator.MaxTableSize.
+func (s *search) evaluate(sizes []int) (*Recommendation, error) {
+	sizes = distinct(sizes)
+	key := setKey(sizes)
+	if r, ok := s.seen[key]; ok {
+		return r, nil
+	}
+
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	table, err := calculator.NewTable(s.ctx, sizes, s.calcOpts...)
+	if errors.Is(err, calculator.ErrWorkBudgetExceeded) || errors.Is(err, calculator.ErrTableTooLarge) {
+		s.seen[key] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recommendation{Sizes: sizes}
+	for amount, orders := range s.demand {
+		totalSum, numPacks := 0, 0
+		for size, count := range table.Lookup(amount) {
+			totalSum += size * count
+			numPacks += count
+		}
+
+		r.Orders += orders
+		r.TotalExcess += (totalSum - amount) * orders
+		r.TotalPacks += numPacks * orders
+	}
+	r.Cost = r.Metrics.Cost(s.costs.ExcessItemCost, s.costs.PackCost)
+
+	s.seen[key] = r
+
+	return r, nil
+}
+
+// top returns the cheapest evaluated sets, breaking ties by fewer sizes.
+func (s *search) top(limit int) []Recommendation {
+	out := make([]Recommendation, 0, len(s.seen))
+	for _, r := range s.seen {
+		if r != nil {
+			out = append(out, *r)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Cost != out[j].Cost {
+			return out[i].Cost < out[j].Cost
+		}
+		if len(out[i].Sizes) != len(out[j].Sizes) {
+			return len(out[i].Sizes) < len(out[j].Sizes)
+		}
+		return setKey(out[i].Sizes) < setKey(out[j].Sizes)
+	})
+
+	if len(out) > limit {
+		out = out[:limit]
+	}
+
+	return out
+}
+
+// frequentAmounts returns the n most ordered amounts, sorted ascending.
+func (s *search) frequentAmounts(n int) []int {
+	amounts := make([]int, 0, len(s.demand))
+	for amount := range s.demand {
+		amounts = append(amounts, amount)
+	}
+
+	sort.Slice(amounts, func(i, j int) bool {
+		if s.demand[amounts[i]] != s.demand[amounts[j]] {
+			return s.demand[amounts[i]] > s.demand[amounts[j]]
+		}
+		return amounts[i] < amounts[j]
+	})
+
+	if len(amounts) > n {
+		amounts = amounts[:n]
+	}
+	sort.Ints(amounts)
+
+	return amounts
+}
+
+// distinct returns the distinct positive sizes, sorted ascending.
+func distinct(sizes []int) []int {
+	out := make([]int, 0, len(sizes))
+	for _, size := range sizes {
+		if size > 0 && !contains(out, size) {
+			out = append(out, size)
+		}
+	}
+	sort.Ints(out)
+
+	return out
+}
+
+// without returns the sizes not present in excluded.
+func without(sizes, excluded []int) []int {
+	out := make([]int, 0, len(sizes))
+	for _, size := range sizes {
+		if !contains(excluded, size) {
+			out = append(out, size)
+		}
+	}
+
+	return out
+}
+
+func contains(sizes []int, size int) bool {
+	for _, s := range sizes {
+		if s == size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setKey identifies a sorted set of sizes.
+func setKey(sizes []int) string {
+	parts := make([]string, len(sizes))
+	for i, size := range sizes {
+		parts[i] = strconv.Itoa(size)
+	}
+
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,129 @@
+package optimizer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"denisgodoroja/retask/internal/calculator"
+)
+
+func TestRecommend(t *testing.T) {
+	// Orders of 300 and 700 items dominate the demand
+	demand := []int{300, 300, 300, 700, 700, 700, 1000}
+
+	fixtures := []struct {
+		name        string
+		constraints Constraints
+		costs       Costs
+		wantSizes   []int
+		wantExcess  int
+	}{
+		{
+			name:        "Sizes derived from the demand",
+			constraints: Constraints{MaxCount: 2},
+			costs:       Costs{ExcessItemCost: 1, PackCost: 1},
+			// 300 and 700 fit exactly, 1000 = 700 + 300
+			wantSizes:  []int{300, 700},
+			wantExcess: 0,
+		},
+		{
+			name:        "Single size",
+			constraints: Constraints{MaxCount: 1},
+			costs:       Costs{ExcessItemCost: 1, PackCost: 1},
+			// 700 -> 3 x 300 and 1000 -> 4 x 300, each with an excess of 200
+			wantSizes:  []int{300},
+			wantExcess: 3*200 + 200,
+		},
+		{
+			name:        "Allowed and required sizes",
+			constraints: Constraints{AllowedSizes: []int{100, 250, 500}, RequiredSizes: []int{1000}, MaxCount: 2},
+			costs:       Costs{ExcessItemCost: 1, PackCost: 100},
+			// 300 -> 500, 700 -> 1000, 1000 -> 1000: packs of 100 are too expensive to handle
+			wantSizes:  []int{500, 1000},
+			wantExcess: 3*200 + 3*300,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			got, err := Recommend(context.Background(), demand, fixture.constraints, fixture.costs)
+			if err != nil {
+				t.Fatalf("Recommend() returned an unexpected error: %v", err)
+			}
+			if len(got) == 0 || len(got) > DefaultLimit {
+				t.Fatalf("Recommend() returned %d recommendations", len(got))
+			}
+
+			best := got[0]
+			if !reflect.DeepEqual(best.Sizes, fixture.wantSizes) {
+				t.Errorf("best sizes = %v, want %v", best.Sizes, fixture.wantSizes)
+			}
+			if best.TotalExcess != fixture.wantExcess {
+				t.Errorf("best total excess = %d, want %d", best.TotalExcess, fixture.wantExcess)
+			}
+			if best.Orders != len(demand) {
+				t.Errorf("best orders = %d, want %d", best.Orders, len(demand))
+			}
+
+			// Recommendations are sorted by cost and respect the constraints
+			for i, r := range got {
+				if i > 0 && r.Cost < got[i-1].Cost {
+					t.Errorf("recommendation %d is cheaper than %d", i, i-1)
+				}
+				if len(r.Sizes) > fixture.constraints.MaxCount {
+					t.Errorf("recommendation %v has more than %d sizes", r.Sizes, fixture.constraints.MaxCount)
+				}
+				for _, size := range fixture.constraints.RequiredSizes {
+					if !contains(r.Sizes, size) {
+						t.Errorf("recommendation %v lacks required size %d", r.Sizes, size)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRecommend_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := Recommend(ctx, []int{0, -5}, Constraints{MaxCount: 1}, Costs{}); !errors.Is(err, ErrNoDemand) {
+		t.Errorf("Recommend() error = %v, want %v", err, ErrNoDemand)
+	}
+	if _, err := Recommend(ctx, []int{10}, Constraints{}, Costs{}); !errors.Is(err, ErrInvalidConstraints) {
+		t.Errorf("Recommend() error = %v, want %v", err, ErrInvalidConstraints)
+	}
+
+	// Every candidate set exceeds the work budget
+	_, err := Recommend(ctx, []int{997, 1000}, Constraints{MaxCount: 2}, Costs{ExcessItemCost: 1},
+		WithCalculatorOptions(calculator.WithWorkBudget(10)))
+	if !errors.Is(err, ErrInvalidConstraints) {
+		t.Errorf("Recommend() error = %v, want %v", err, ErrInvalidConstraints)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := Recommend(canceled, []int{10}, Constraints{MaxCount: 1}, Costs{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Recommend() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestRecommend_TableTooLarge tests that sets whose table exceeds the maximum
+// size are skipped like the ones exceeding the work budget.
+func TestRecommend_TableTooLarge(t *testing.T) {
+	// The table of {4999, 5000} holds about 25 million amounts
+	got, err := Recommend(context.Background(), []int{4999, 5000, 5000}, Constraints{AllowedSizes: []int{4999, 5000}, MaxCount: 2}, Costs{ExcessItemCost: 1})
+	if err != nil {
+		t.Fatalf("Recommend() returned an unexpected error: %v", err)
+	}
+
+	for _, r := range got {
+		if len(r.Sizes) > 1 {
+			t.Errorf("Recommend() returned the set %v exceeding the table size", r.Sizes)
+		}
+	}
+	if best := got[0]; !reflect.DeepEqual(best.Sizes, []int{5000}) || best.TotalExcess != 1 {
+		t.Errorf("best = %v with total excess %d, want [5000] with total excess 1", best.Sizes, best.TotalExcess)
+	}
+}
@@ -0,0 +1,132 @@
+// Package outbox relays the events journaled in a storage.Outbox.
+//
+// Repositories journal an event in the same transaction as the change it
+// reports, so a crash after the change never loses its notification. The Relay
+// polls the outbox and delivers the pending events, marking an event as
+// delivered only after the delivery succeeded: events are delivered at least
+// once, a crash between delivering and marking redelivers the event.
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+const (
+	// DefaultInterval is the wait between two polls of the outbox unless overridden.
+	DefaultInterval = time.Second
+	// DefaultBatchSize is the number of events delivered per poll unless overridden.
+	DefaultBatchSize = 100
+	// DefaultMaxAttempts is the number of delivery attempts of an event unless overridden.
+	DefaultMaxAttempts = 10
+)
+
+// DeliverFunc delivers an event, returning an error to retry it later.
+type DeliverFunc func(ctx context.Context, e storage.OutboxEvent) error
+
+// Relay delivers the pending events of an outbox.
+type Relay struct {
+	outbox      storage.Outbox
+	deliver     DeliverFunc
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+// Option configures optional Relay settings.
+type Option func(*Relay)
+
+// WithInterval sets the wait between two polls of the outbox.
+func WithInterval(d time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = d
+	}
+}
+
+// WithBatchSize sets the number of events delivered per poll.
+func WithBatchSize(n int) Option {
+	return func(r *Relay) {
+		r.batchSize = max(n, 1)
+	}
+}
+
+// WithMaxAttempts sets the number of delivery attempts of an event, after which
+// it stays undelivered in the outbox for inspection. Zero retries forever.
+func WithMaxAttempts(n int) Option {
+	return func(r *Relay) {
+		r.maxAttempts = max(n, 0)
+	}
+}
+
+// NewRelay creates a relay delivering the events of the outbox with deliver.
+func NewRelay(o storage.Outbox, deliver DeliverFunc, opts ...Option) *Relay {
+	r := &Relay{
+		outbox:      o,
+		deliver:     deliver,
+		interval:    DefaultInterval,
+		batchSize:   DefaultBatchSize,
+		maxAttempts: DefaultMaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run relays the events every interval until the context is canceled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to relay the outbox events: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RelayOnce delivers a batch of pending events, oldest first, and returns the
+// number of delivered ones. A failed delivery is counted and retried by a later
+// call; the later events of its tenant wait for it, so every tenant's events
+// are delivered in order.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	pending, err := r.outbox.Pending(ctx, r.batchSize, r.maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	failed := make(map[string]bool)
+	for _, e := range pending {
+		if failed[e.Tenant] {
+			continue
+		}
+
+		if err := r.deliver(ctx, e); err != nil {
+			failed[e.Tenant] = true
+			log.Printf("Failed to deliver the outbox event %d: %v", e.ID, err)
+			if err := r.outbox.MarkFailed(ctx, e.ID, err.Error()); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		if err := r.outbox.MarkDelivered(ctx, e.ID); err != nil {
+			// Delivered but still pending, so it is delivered again
+			return delivered, err
+		}
+		delivered++
+	}
+
+	return delivered, nil
+}
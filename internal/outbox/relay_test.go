@@ -0,0 +1,198 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/sqlstore"
+	"denisgodoroja/retask/internal/tenant"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestOutbox returns a pack repository journaling its changes in the returned
+// outbox, both on a migrated in-memory SQLite database.
+func newTestOutbox(t *testing.T) (*sqlstore.PackRepo, *sqlstore.OutboxRepo) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open() returned an unexpected error: %v", err)
+	}
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := sqlstore.Migrate(context.Background(), db, sqlstore.SQLite); err != nil {
+		t.Fatalf("Migrate() returned an unexpected error: %v", err)
+	}
+
+	return sqlstore.NewPackRepo(db, sqlstore.SQLite), sqlstore.NewOutboxRepo(db, sqlstore.SQLite)
+}
+
+// replace sets the packs of the tenant, journaling an event.
+func replace(t *testing.T, repo storage.PackRepository, id string, sizes ...int) {
+	t.Helper()
+
+	if err := repo.ReplaceAll(tenant.NewContext(context.Background(), id), storage.NewPacks(sizes...)); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+}
+
+// recorder delivers the events, failing the ones of the tenants in fail.
+type recorder struct {
+	delivered []int64
+	fail      map[string]bool
+}
+
+func (r *recorder) deliver(ctx context.Context, e storage.OutboxEvent) error {
+	if r.fail[e.Tenant] {
+		return errors.New("unexpected status 503")
+	}
+	r.delivered = append(r.delivered, e.ID)
+
+	return nil
+}
+
+// TestRelay_RelayOnce tests that failed deliveries are retried, in order per tenant.
+func TestRelay_RelayOnce(t *testing.T) {
+	repo, outbox := newTestOutbox(t)
+	replace(t, repo, "north", 250)
+	replace(t, repo, "south", 500)
+	replace(t, repo, "north", 1000)
+	replace(t, repo, "south", 2000)
+
+	rec := &recorder{fail: map[string]bool{"north": true}}
+	relay := NewRelay(outbox, rec.deliver)
+
+	// The second event of north waits for the first one
+	n, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce() returned an unexpected error: %v", err)
+	}
+	if n != 2 || !reflect.DeepEqual(rec.delivered, []int64{2, 4}) {
+		t.Errorf("RelayOnce() delivered %d events %v, want 2 events [2 4]", n, rec.delivered)
+	}
+
+	pending, err := outbox.Pending(context.Background(), 10, 0)
+	if err != nil {
+		t.Fatalf("Pending() returned an unexpected error: %v", err)
+	}
+	if len(pending) != 2 || pending[0].ID != 1 || pending[0].Attempts != 1 || pending[1].Attempts != 0 {
+		t.Errorf("Pending() got = %+v, want event 1 failed once and event 3", pending)
+	}
+
+	// Once the receiver recovers, the pending events are delivered
+	rec.fail = nil
+	rec.delivered = nil
+	if n, err := relay.RelayOnce(context.Background()); err != nil || n != 2 {
+		t.Fatalf("RelayOnce() = %d, %v, want 2 delivered events", n, err)
+	}
+	if !reflect.DeepEqual(rec.delivered, []int64{1, 3}) {
+		t.Errorf("RelayOnce() delivered %v, want [1 3]", rec.delivered)
+	}
+	if n, err := relay.RelayOnce(context.Background()); err != nil || n != 0 {
+		t.Errorf("RelayOnce() = %d, %v, want nothing left to deliver", n, err)
+	}
+}
+
+// crashingOutbox fails to mark the events as delivered, like a crash right after delivering.
+type crashingOutbox struct {
+	storage.Outbox
+	crash bool
+}
+
+func (o *crashingOutbox) MarkDelivered(ctx context.Context, id int64) error {
+	if o.crash {
+		return errors.New("connection lost")
+	}
+
+	return o.Outbox.MarkDelivered(ctx, id)
+}
+
+// TestRelay_AtLeastOnce tests that an event delivered but not marked is delivered again.
+func TestRelay_AtLeastOnce(t *testing.T) {
+	repo, outbox := newTestOutbox(t)
+	replace(t, repo, "north", 250)
+
+	rec := &recorder{}
+	crashing := &crashingOutbox{Outbox: outbox, crash: true}
+	relay := NewRelay(crashing, rec.deliver)
+
+	if _, err := relay.RelayOnce(context.Background()); err == nil {
+		t.Fatal("RelayOnce() expected an error marking the event")
+	}
+
+	crashing.crash = false
+	if n, err := relay.RelayOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("RelayOnce() = %d, %v, want 1 delivered event", n, err)
+	}
+	if !reflect.DeepEqual(rec.delivered, []int64{1, 1}) {
+		t.Errorf("delivered %v, want event 1 twice", rec.delivered)
+	}
+}
+
+func TestRelay_MaxAttempts(t *testing.T) {
+	repo, outbox := newTestOutbox(t)
+	replace(t, repo, "north", 250)
+	replace(t, repo, "north", 500)
+
+	rec := &recorder{fail: map[string]bool{"north": true}}
+	relay := NewRelay(outbox, rec.deliver, WithMaxAttempts(2), WithBatchSize(1))
+	for range 4 {
+		if _, err := relay.RelayOnce(context.Background()); err != nil {
+			t.Fatalf("RelayOnce() returned an unexpected error: %v", err)
+		}
+	}
+
+	// Both events ran out of attempts and stay in the outbox for inspection
+	if pending, err := relay.outbox.Pending(context.Background(), 10, 2); err != nil || len(pending) != 0 {
+		t.Errorf("Pending() = %+v, %v, want no retried events", pending, err)
+	}
+	pending, err := outbox.Pending(context.Background(), 10, 0)
+	if err != nil {
+		t.Fatalf("Pending() returned an unexpected error: %v", err)
+	}
+	if len(pending) != 2 || pending[0].Attempts != 2 || pending[1].Attempts != 2 {
+		t.Errorf("Pending() got = %+v, want both events failed twice", pending)
+	}
+}
+
+func TestRelay_Run(t *testing.T) {
+	repo, outbox := newTestOutbox(t)
+
+	delivered := make(chan int64, 10)
+	relay := NewRelay(outbox, func(ctx context.Context, e storage.OutboxEvent) error {
+		delivered <- e.ID
+		return nil
+	}, WithInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	replace(t, repo, "north", 250)
+	select {
+	case id := <-delivered:
+		if id != 1 {
+			t.Errorf("delivered event %d, want 1", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not deliver the event")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the context was canceled")
+	}
+}
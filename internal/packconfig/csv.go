@@ -0,0 +1,156 @@
+package packconfig
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvColumns are the columns of a CSV document, in the order they are written.
+// Only size is required when reading, the columns may come in any order.
+var csvColumns = []string{"size", "label", "sku", "cost", "weight", "length", "width", "height", "active"}
+
+// decodeCSV reads a CSV document: a header row naming the columns, then a pack per row.
+// Lines starting with # are comments.
+func decodeCSV(data []byte) (Document, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return Document{}, fmt.Errorf("%w: missing header row", ErrInvalidDocument)
+	}
+	if err != nil {
+		return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isCSVColumn(name) {
+			return Document{}, fmt.Errorf("%w: unknown column %q", ErrInvalidDocument, name)
+		}
+		if _, ok := index[name]; ok {
+			return Document{}, fmt.Errorf("%w: duplicate column %q", ErrInvalidDocument, name)
+		}
+		index[name] = i
+	}
+	if _, ok := index["size"]; !ok {
+		return Document{}, fmt.Errorf("%w: missing size column", ErrInvalidDocument)
+	}
+
+	d := Document{Packs: []Pack{}}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+		}
+
+		line, _ := r.FieldPos(0)
+		p, err := csvPack(record, index)
+		if err != nil {
+			return Document{}, fmt.Errorf("%w: line %d: %v", ErrInvalidDocument, line, err)
+		}
+		d.Packs = append(d.Packs, p)
+	}
+
+	return d, nil
+}
+
+func isCSVColumn(name string) bool {
+	for _, c := range csvColumns {
+		if c == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// csvPack reads the pack of a row. Empty cells keep the defaults.
+func csvPack(record []string, index map[string]int) (Pack, error) {
+	cell := func(name string) string {
+		if i, ok := index[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var p Pack
+	var err error
+	if p.Size, err = strconv.Atoi(cell("size")); err != nil {
+		return Pack{}, fmt.Errorf("invalid size %q", cell("size"))
+	}
+	p.Label = cell("label")
+	p.SKU = cell("sku")
+
+	var dims Dimensions
+	for _, f := range []struct {
+		name string
+		out  *float64
+	}{
+		{name: "cost", out: &p.Cost},
+		{name: "weight", out: &p.Weight},
+		{name: "length", out: &dims.Length},
+		{name: "width", out: &dims.Width},
+		{name: "height", out: &dims.Height},
+	} {
+		if v := cell(f.name); v != "" {
+			if *f.out, err = strconv.ParseFloat(v, 64); err != nil {
+				return Pack{}, fmt.Errorf("invalid %s %q", f.name, v)
+			}
+		}
+	}
+	if dims != (Dimensions{}) {
+		p.Dimensions = &dims
+	}
+
+	if v := cell("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return Pack{}, fmt.Errorf("invalid active %q", v)
+		}
+		p.Active = &active
+	}
+
+	return p, nil
+}
+
+// encodeCSV writes the packs of the document, with every column.
+func encodeCSV(w io.Writer, d Document) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+
+	float := func(f float64) string {
+		if f == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	for _, p := range d.Packs {
+		var dims Dimensions
+		if p.Dimensions != nil {
+			dims = *p.Dimensions
+		}
+		active := p.Active == nil || *p.Active
+
+		if err := cw.Write([]string{
+			strconv.Itoa(p.Size), p.Label, p.SKU, float(p.Cost), float(p.Weight),
+			float(dims.Length), float(dims.Width), float(dims.Height), strconv.FormatBool(active),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,230 @@
+// Package packconfig reads and writes pack configuration documents, used to
+// export the packs of a tenant and import them back after a reset or into
+// another deployment.
+//
+// A document carries its format Version, the unit of the sizes and the packs
+// with their attributes. It is encoded as JSON, YAML or CSV; CSV documents only
+// carry the packs, one per row.
+package packconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// Version is the format version of the documents written by this package.
+// Documents without a version are read as this version.
+const Version = 1
+
+var (
+	// ErrInvalidDocument is returned when a document cannot be decoded.
+	ErrInvalidDocument = errors.New("invalid configuration document")
+	// ErrUnsupportedFormat is returned for formats other than JSON, YAML and CSV.
+	ErrUnsupportedFormat = errors.New("unsupported configuration format")
+)
+
+// Format is the encoding of a document.
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+	CSV  Format = "csv"
+)
+
+// ParseFormat returns the format with the given name or file extension.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "json":
+		return JSON, nil
+	case "yaml", "yml":
+		return YAML, nil
+	case "csv":
+		return CSV, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, name)
+}
+
+// FormatOfPath returns the format of a file from its extension.
+func FormatOfPath(path string) (Format, error) {
+	return ParseFormat(filepath.Ext(path))
+}
+
+// FormatOfContentType returns the format of a media type such as "text/csv".
+func FormatOfContentType(contentType string) (Format, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, contentType)
+	}
+
+	switch mediaType {
+	case "application/json":
+		return JSON, nil
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return YAML, nil
+	case "text/csv":
+		return CSV, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, contentType)
+}
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case YAML:
+		return "application/yaml"
+	case CSV:
+		return "text/csv"
+	}
+
+	return "application/json"
+}
+
+// Dimensions are the outer dimensions of a pack.
+type Dimensions struct {
+	Length float64 `json:"length" yaml:"length"`
+	Width  float64 `json:"width" yaml:"width"`
+	Height float64 `json:"height" yaml:"height"`
+}
+
+// Pack is a pack size with its catalog attributes, see storage.Pack.
+type Pack struct {
+	Size       int         `json:"size" yaml:"size"`
+	Label      string      `json:"label,omitempty" yaml:"label,omitempty"`
+	SKU        string      `json:"sku,omitempty" yaml:"sku,omitempty"`
+	Cost       float64     `json:"cost,omitempty" yaml:"cost,omitempty"`
+	Weight     float64     `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Dimensions *Dimensions `json:"dimensions,omitempty" yaml:"dimensions,omitempty"`
+	// Active defaults to true when omitted.
+	Active *bool `json:"active,omitempty" yaml:"active,omitempty"`
+}
+
+// Document is a pack configuration.
+type Document struct {
+	Version int `json:"version" yaml:"version"`
+	// Tenant is the tenant the document was exported from, informational only.
+	Tenant string `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+	// Unit is the unit of the sizes, the current unit is kept when empty.
+	Unit  string `json:"unit,omitempty" yaml:"unit,omitempty"`
+	Packs []Pack `json:"packs" yaml:"packs"`
+	// Sizes are a shorthand for active packs without attributes in documents
+	// written by hand. Decode turns them into Packs.
+	Sizes []int `json:"sizes,omitempty" yaml:"sizes,omitempty"`
+}
+
+// New returns the document of the packs of a tenant.
+func New(tenantID, unit string, packs []storage.Pack) Document {
+	d := Document{Version: Version, Tenant: tenantID, Unit: unit, Packs: make([]Pack, len(packs))}
+	for i, p := range packs {
+		active := p.Active
+		d.Packs[i] = Pack{Size: p.Size, Label: p.Label, SKU: p.SKU, Cost: p.Cost, Weight: p.Weight, Active: &active}
+		if p.Dimensions != (storage.Dimensions{}) {
+			d.Packs[i].Dimensions = &Dimensions{Length: p.Dimensions.Length, Width: p.Dimensions.Width, Height: p.Dimensions.Height}
+		}
+	}
+
+	return d
+}
+
+// StoragePacks returns the packs of the document.
+func (d Document) StoragePacks() []storage.Pack {
+	packs := make([]storage.Pack, len(d.Packs))
+	for i, p := range d.Packs {
+		packs[i] = storage.Pack{Size: p.Size, Label: p.Label, SKU: p.SKU, Cost: p.Cost, Weight: p.Weight, Active: p.Active == nil || *p.Active}
+		if p.Dimensions != nil {
+			packs[i].Dimensions = storage.Dimensions{Length: p.Dimensions.Length, Width: p.Dimensions.Width, Height: p.Dimensions.Height}
+		}
+	}
+
+	return packs
+}
+
+// Decode reads a document in the given format. It checks the structure of the
+// document only, the packs are validated by the service importing them.
+func Decode(data []byte, f Format) (Document, error) {
+	var d Document
+	var err error
+	switch f {
+	case JSON:
+		d, err = decodeJSON(data)
+	case YAML:
+		d, err = decodeYAML(data)
+	case CSV:
+		d, err = decodeCSV(data)
+	default:
+		return Document{}, fmt.Errorf("%w: %q", ErrUnsupportedFormat, f)
+	}
+	if err != nil {
+		return Document{}, err
+	}
+
+	return d.normalize()
+}
+
+// normalize checks the version and expands the sizes shorthand.
+func (d Document) normalize() (Document, error) {
+	if d.Version == 0 {
+		d.Version = Version
+	}
+	if d.Version != Version {
+		return Document{}, fmt.Errorf("%w: unsupported version %d, expected %d", ErrInvalidDocument, d.Version, Version)
+	}
+
+	if d.Sizes != nil {
+		if d.Packs != nil {
+			return Document{}, fmt.Errorf("%w: set either sizes or packs", ErrInvalidDocument)
+		}
+		d.Packs = make([]Pack, len(d.Sizes))
+		for i, size := range d.Sizes {
+			d.Packs[i] = Pack{Size: size}
+		}
+		d.Sizes = nil
+	}
+	if d.Packs == nil {
+		return Document{}, fmt.Errorf("%w: no packs", ErrInvalidDocument)
+	}
+
+	return d, nil
+}
+
+// decodeJSON reads a JSON document, rejecting unknown fields.
+func decodeJSON(data []byte) (Document, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var d Document
+	if err := dec.Decode(&d); err != nil {
+		return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	if dec.More() {
+		return Document{}, fmt.Errorf("%w: unexpected data after the document", ErrInvalidDocument)
+	}
+
+	return d, nil
+}
+
+// Encode writes the document in the given format.
+func Encode(w io.Writer, d Document, f Format) error {
+	switch f {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case YAML:
+		return encodeYAML(w, d)
+	case CSV:
+		return encodeCSV(w, d)
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnsupportedFormat, f)
+}
@@ -0,0 +1,191 @@
+package packconfig
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// testPacks covers every attribute, an inactive pack and a pack without attributes.
+var testPacks = []storage.Pack{
+	{Size: 250, Label: `Small "box", #1`, SKU: "00250", Cost: 1.25, Weight: 0.2, Dimensions: storage.Dimensions{Length: 30, Width: 20, Height: 10.5}, Active: true},
+	{Size: 500, Active: false},
+	{Size: 1000, Active: true},
+}
+
+// TestEncode_RoundTrip tests that every format reads back what it wrote.
+func TestEncode_RoundTrip(t *testing.T) {
+	d := New("north", "kg", testPacks)
+
+	testCases := []struct {
+		format Format
+		// want is what the format keeps of the document.
+		want Document
+	}{
+		{format: JSON, want: d},
+		{format: YAML, want: d},
+		{format: CSV, want: Document{Version: Version, Packs: d.Packs}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, d, tc.format); err != nil {
+				t.Fatalf("Encode() returned an unexpected error: %v", err)
+			}
+
+			got, err := Decode(buf.Bytes(), tc.format)
+			if err != nil {
+				t.Fatalf("Decode() returned an unexpected error: %v\n%s", err, buf.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tc.want)
+			}
+			if packs := got.StoragePacks(); !reflect.DeepEqual(packs, testPacks) {
+				t.Errorf("StoragePacks() = %+v, want %+v", packs, testPacks)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	active := func(b bool) *bool { return &b }
+
+	testCases := []struct {
+		name    string
+		format  Format
+		data    string
+		want    Document
+		wantErr bool
+	}{
+		{
+			name:   "JSON sizes",
+			format: JSON,
+			data:   `{"sizes": [23, 31]}`,
+			want:   Document{Version: 1, Packs: []Pack{{Size: 23}, {Size: 31}}},
+		},
+		{name: "JSON unknown field", format: JSON, data: `{"version": 1, "packs": [], "size": [1]}`, wantErr: true},
+		{name: "JSON newer version", format: JSON, data: `{"version": 2, "packs": []}`, wantErr: true},
+		{name: "JSON sizes and packs", format: JSON, data: `{"sizes": [1], "packs": [{"size": 2}]}`, wantErr: true},
+		{name: "JSON no packs", format: JSON, data: `{"version": 1, "unit": "kg"}`, wantErr: true},
+		{name: "JSON trailing data", format: JSON, data: `{"sizes": [1]} {}`, wantErr: true},
+		{
+			name:   "YAML written by hand",
+			format: YAML,
+			data: `---
+# Warehouse north
+version: 1
+unit: 'kg'   # kilograms
+packs:
+- size: 250
+  label: "Small #1"
+  dimensions: {length: 30, width: 20, height: 10}
+-
+  size: 500
+  active: false
+`,
+			want: Document{Version: 1, Unit: "kg", Packs: []Pack{
+				{Size: 250, Label: "Small #1", Dimensions: &Dimensions{Length: 30, Width: 20, Height: 10}},
+				{Size: 500, Active: active(false)},
+			}},
+		},
+		{
+			name:   "YAML sizes",
+			format: YAML,
+			data:   "sizes: [23, 31, 53]\n",
+			want:   Document{Version: 1, Packs: []Pack{{Size: 23}, {Size: 31}, {Size: 53}}},
+		},
+		{
+			name:   "YAML block sizes",
+			format: YAML,
+			data:   "sizes:\n  - 23\n  - 31\n",
+			want:   Document{Version: 1, Packs: []Pack{{Size: 23}, {Size: 31}}},
+		},
+		{name: "YAML bad indentation", format: YAML, data: "version: 1\n  unit: kg\npacks: []\n", wantErr: true},
+		{name: "YAML duplicate key", format: YAML, data: "sizes: [1]\nsizes: [2]\n", wantErr: true},
+		{name: "YAML tabs", format: YAML, data: "packs:\n\t- size: 1\n", wantErr: true},
+		{name: "YAML not a mapping", format: YAML, data: "- 1\n- 2\n", wantErr: true},
+		{name: "YAML wrong type", format: YAML, data: "sizes: [one]\n", wantErr: true},
+		{name: "YAML unterminated", format: YAML, data: "sizes: [1, 2\n", wantErr: true},
+		{name: "YAML empty", format: YAML, data: "# nothing\n", wantErr: true},
+		{
+			name:   "YAML anchors and block scalars",
+			format: YAML,
+			data: `packs:
+- &small
+  size: 250
+  label: >-
+    Small
+    box
+- <<: *small
+  size: 500
+`,
+			want: Document{Version: 1, Packs: []Pack{{Size: 250, Label: "Small box"}, {Size: 500, Label: "Small box"}}},
+		},
+		{name: "YAML several documents", format: YAML, data: "sizes: [1]\n---\nsizes: [2]\n", wantErr: true},
+		{name: "YAML number keys", format: YAML, data: "sizes: [1]\n1: one\n", wantErr: true},
+		{
+			name:   "CSV partial columns",
+			format: CSV,
+			data:   "# exported by hand\nSKU, size, active\nB23, 23,\n,31,false\n",
+			want:   Document{Version: 1, Packs: []Pack{{Size: 23, SKU: "B23"}, {Size: 31, Active: active(false)}}},
+		},
+		{name: "CSV header only", format: CSV, data: "size\n", want: Document{Version: 1, Packs: []Pack{}}},
+		{name: "CSV missing size column", format: CSV, data: "label\nbox\n", wantErr: true},
+		{name: "CSV unknown column", format: CSV, data: "size,colour\n1,red\n", wantErr: true},
+		{name: "CSV invalid size", format: CSV, data: "size\nten\n", wantErr: true},
+		{name: "CSV invalid active", format: CSV, data: "size,active\n1,maybe\n", wantErr: true},
+		{name: "CSV empty", format: CSV, data: "", wantErr: true},
+		{name: "Unknown format", format: "xml", data: "<packs/>", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Decode([]byte(tc.data), tc.format)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidDocument) && !errors.Is(err, ErrUnsupportedFormat) {
+					t.Errorf("Decode() error = %v, want ErrInvalidDocument or ErrUnsupportedFormat", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	testCases := []struct {
+		name        string
+		path        string
+		contentType string
+		want        Format
+		wantErr     bool
+	}{
+		{name: "JSON", path: "packs.json", contentType: "application/json; charset=utf-8", want: JSON},
+		{name: "YAML", path: "packs.YML", contentType: "application/x-yaml", want: YAML},
+		{name: "CSV", path: "/tmp/packs.csv", contentType: "text/csv", want: CSV},
+		{name: "Unknown", path: "packs.xml", contentType: "application/xml", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FormatOfPath(tc.path)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Errorf("FormatOfPath() = %q, %v, want %q", got, err, tc.want)
+			}
+
+			got, err = FormatOfContentType(tc.contentType)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Errorf("FormatOfContentType() = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
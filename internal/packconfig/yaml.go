@@ -0,0 +1,51 @@
+package packconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeYAML reads a YAML document by converting it to JSON, so both formats
+// share the same field names and checks. A stream of several documents is
+// rejected.
+func decodeYAML(data []byte) (Document, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Document{}, fmt.Errorf("%w: empty document", ErrInvalidDocument)
+		}
+		return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	if _, ok := v.(map[string]any); !ok {
+		return Document{}, fmt.Errorf("%w: expected a mapping", ErrInvalidDocument)
+	}
+	if err := dec.Decode(new(any)); !errors.Is(err, io.EOF) {
+		return Document{}, fmt.Errorf("%w: expected a single document", ErrInvalidDocument)
+	}
+
+	// Mappings with keys other than strings, such as numbers, fail here
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	return decodeJSON(b)
+}
+
+// encodeYAML writes the document as YAML, indented by two spaces.
+func encodeYAML(w io.Writer, d Document) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(d); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
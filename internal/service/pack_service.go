@@ -1,40 +1,1339 @@
 package service
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"denisgodoroja/retask/internal/cache"
 	"denisgodoroja/retask/internal/calculator"
+	"denisgodoroja/retask/internal/events"
+	"denisgodoroja/retask/internal/optimizer"
+	"denisgodoroja/retask/internal/shipping"
 	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+	"denisgodoroja/retask/internal/webhook"
+)
+
+var (
+	// ErrAmountTooLarge is returned when the requested amount exceeds the configured maximum.
+	ErrAmountTooLarge = errors.New("amount exceeds the maximum allowed")
+	// ErrNoPackSizes is returned when an operation requires at least one pack size.
+	ErrNoPackSizes = errors.New("no pack sizes provided")
+	// ErrNoAmounts is returned when an operation requires at least one amount.
+	ErrNoAmounts = errors.New("no amounts provided")
+	// ErrHistoryDisabled is returned when the calculation history is not configured.
+	ErrHistoryDisabled = errors.New("calculation history is disabled")
+	// ErrCatalogDisabled is returned when changing the catalog without a catalog repository.
+	ErrCatalogDisabled = errors.New("catalog settings are disabled")
+	// ErrInvalidPack is returned when a pack has a non-positive or duplicate size,
+	// or a negative cost, weight or dimension.
+	ErrInvalidPack = errors.New("invalid pack")
+	// ErrScheduleDisabled is returned when scheduling a change without a schedule repository.
+	ErrScheduleDisabled = errors.New("pack schedule is disabled")
+	// ErrInvalidSchedule is returned when scheduling a change that is not in the future.
+	ErrInvalidSchedule = errors.New("effective date must be in the future")
+	// ErrInvalidAsOf is returned when reading the packs of a time in the past,
+	// which are not kept once replaced.
+	ErrInvalidAsOf = errors.New("as-of date must not be in the past")
+	// ErrChangeInEffect is returned when canceling a scheduled change that already took effect.
+	ErrChangeInEffect = errors.New("scheduled change is already in effect")
+	// ErrWebhooksDisabled is returned when managing webhooks without a webhook repository.
+	ErrWebhooksDisabled = errors.New("webhooks are disabled")
+	// ErrInvalidWebhook is returned when a webhook URL is not an absolute http or https URL,
+	// or targets a destination the dispatcher refuses, such as a private address.
+	ErrInvalidWebhook = errors.New("invalid webhook URL")
 )
 
+// CostModel weighs excess items against pack handling.
+type CostModel struct {
+	// ExcessItemCost is the cost of every item shipped above the ordered amount.
+	ExcessItemCost float64
+	// PackCost is the handling cost of every shipped pack.
+	PackCost float64
+}
+
+// SizeSetMetrics are the aggregated results of packing many amounts with a size set.
+type SizeSetMetrics struct {
+	Sizes []int
+	calculator.Metrics
+	Cost float64
+}
+
+// Comparison holds the results of packing the same amounts with the current
+// and a candidate size set.
+type Comparison struct {
+	Current   SizeSetMetrics
+	Candidate SizeSetMetrics
+
+	// The deltas are candidate minus current, negative values are improvements.
+	DeltaExcess int
+	DeltaPacks  int
+	DeltaCost   float64
+}
+
+// ShipmentLine is an order line of a shipment.
+type ShipmentLine struct {
+	Amount int
+	// Packs are the pack sizes of the ordered product with their dimensions.
+	Packs []shipping.PackSpec
+}
+
+// ShipmentPlan holds the packs chosen for every line of a shipment
+// and the containers they are shipped in.
+type ShipmentPlan struct {
+	// Lines holds the packs of every line, in order.
+	Lines []map[int]int
+	shipping.Plan
+}
+
+// Fit restricts the acceptable packs of a calculation (see calculator.WithExactOnly).
+type Fit struct {
+	// ExactOnly rejects any excess.
+	ExactOnly bool
+	// MaxExcess and MaxExcessPercent limit the excess, zero means unlimited.
+	MaxExcess        int
+	MaxExcessPercent float64
+	// UnderShip ships the largest total at or below the amount instead.
+	UnderShip bool
+}
+
+// checkOptions returns the calculator options validating a solution.
+func (f Fit) checkOptions() []calculator.Option {
+	opts := []calculator.Option{
+		calculator.WithMaxExcess(f.MaxExcess),
+		calculator.WithMaxExcessPercent(f.MaxExcessPercent),
+	}
+	if f.ExactOnly {
+		opts = append(opts, calculator.WithExactOnly())
+	}
+	if f.UnderShip {
+		opts = append(opts, calculator.WithUnderShip())
+	}
+
+	return opts
+}
+
 // PackService holds the core business logic.
 type PackService struct {
 	repo storage.PackRepository
+
+	// maxAmount is the largest amount accepted by Calculate, 0 means unlimited.
+	maxAmount int
+	// tenantMaxAmount overrides maxAmount per tenant.
+	tenantMaxAmount map[string]int
+	// workBudget is the solver work budget for a single calculation, 0 means unlimited.
+	workBudget int
+
+	// results caches calculations by size-set version and amount, nil when disabled.
+	results *cache.LRU[resultKey, map[int]int]
+
+	// tableMu guards tableBuilds. Tables are built without holding it, so
+	// building the table of one size set does not hold up the others.
+	tableMu sync.Mutex
+	// tables holds the tables of the recently used size sets by version, one per
+	// tenant in use, and nil for the sets whose table exceeds the work budget or
+	// calculator.MaxTableSize. It is nil when precomputing is disabled.
+	tables *cache.LRU[uint64, *calculator.Table]
+	// tableBuilds holds the tables being built by version, so concurrent
+	// calculations of a size set wait for a single build.
+	tableBuilds map[uint64]*tableBuild
+
+	// catalog holds the unit of the pack sizes and their rules,
+	// nil when sizes always count pieces without rules.
+	catalog storage.CatalogRepository
+
+	// schedule holds the upcoming pack changes, nil when disabled.
+	schedule storage.ScheduleRepository
+	// scheduleMu guards timers and closed.
+	scheduleMu sync.Mutex
+	// timers announce the upcoming changes when they take effect.
+	timers map[scheduledKey]*time.Timer
+	closed bool
+
+	// bus publishes the domain events, see package events.
+	bus *events.Bus
+
+	// webhooks holds the webhooks notified of pack changes by dispatcher, nil when disabled.
+	webhooks   storage.WebhookRepository
+	dispatcher *webhook.Dispatcher
+	// outbox leaves notifying the webhooks to an outbox relay calling NotifyWebhooks.
+	outbox bool
+
+	// history records every calculation, nil when disabled.
+	history storage.CalculationRepository
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// DefaultTableCacheSize is the number of precomputed tables kept unless overridden,
+// enough for a few tenants with distinct size sets.
+const DefaultTableCacheSize = 8
+
+// resultKey identifies a cached calculation.
+type resultKey struct {
+	version   uint64
+	amount    int
+	underShip bool
+}
+
+// Option configures optional PackService settings.
+type Option func(*PackService)
+
+// WithMaxAmount sets the largest amount accepted by Calculate.
+// A zero or negative value means unlimited.
+func WithMaxAmount(n int) Option {
+	return func(s *PackService) {
+		s.maxAmount = n
+	}
+}
+
+// WithTenantMaxAmount sets the largest amount accepted by Calculate for a tenant,
+// overriding WithMaxAmount. A zero or negative value means unlimited.
+func WithTenantMaxAmount(tenantID string, n int) Option {
+	return func(s *PackService) {
+		if s.tenantMaxAmount == nil {
+			s.tenantMaxAmount = make(map[string]int)
+		}
+		s.tenantMaxAmount[tenantID] = n
+	}
+}
+
+// WithTableCache sets the number of precomputed tables kept, one per size set in use.
+// A zero or negative size disables precomputing, every calculation is solved on its own.
+func WithTableCache(size int) Option {
+	return func(s *PackService) {
+		s.tables = nil
+		if size > 0 {
+			s.tables = cache.NewLRU[uint64, *calculator.Table](size, 0)
+		}
+	}
+}
+
+// WithWorkBudget sets the solver work budget for a single calculation.
+// A zero or negative value means unlimited.
+func WithWorkBudget(steps int) Option {
+	return func(s *PackService) {
+		s.workBudget = steps
+	}
+}
+
+// WithResultCache enables caching of calculation results,
+// holding up to size results for at most ttl each.
+func WithResultCache(size int, ttl time.Duration) Option {
+	return func(s *PackService) {
+		if size > 0 {
+			s.results = cache.NewLRU[resultKey, map[int]int](size, ttl)
+		}
+	}
+}
+
+// WithCatalog stores the catalog settings, such as the unit of the pack sizes, in the repository.
+func WithCatalog(r storage.CatalogRepository) Option {
+	return func(s *PackService) {
+		s.catalog = r
+	}
+}
+
+// WithHistory records every calculation in the repository.
+func WithHistory(r storage.CalculationRepository) Option {
+	return func(s *PackService) {
+		s.history = r
+	}
+}
+
+// WithSchedule enables effective-dated pack changes stored in the repository.
+func WithSchedule(r storage.ScheduleRepository) Option {
+	return func(s *PackService) {
+		s.schedule = r
+	}
+}
+
+// WithEventBus publishes the domain events on the bus instead of a bus of the service,
+// so other components subscribe to them.
+func WithEventBus(b *events.Bus) Option {
+	return func(s *PackService) {
+		s.bus = b
+	}
+}
+
+// WithWebhooks notifies the webhooks stored in the repository of every pack change,
+// delivering the events with the dispatcher.
+func WithWebhooks(r storage.WebhookRepository, d *webhook.Dispatcher) Option {
+	return func(s *PackService) {
+		s.webhooks = r
+		s.dispatcher = d
+	}
+}
+
+// WithOutbox leaves notifying the webhooks of pack changes to a relay of the
+// outbox the pack repository journals the changes in, calling NotifyWebhooks.
+// The service then no longer notifies them itself, so no change is notified twice.
+func WithOutbox() Option {
+	return func(s *PackService) {
+		s.outbox = true
+	}
+}
+
+// asOfKey is the context key of the time the packs are read at.
+type asOfKey struct{}
+
+// ContextWithAsOf returns a context reading the packs valid at t instead of
+// the current ones, such as the packs of a scheduled change.
+func ContextWithAsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, asOfKey{}, t)
+}
+
+// asOf returns the time set by ContextWithAsOf, the current time otherwise.
+// The packs replaced in the past are not kept, so earlier times return ErrInvalidAsOf.
+func (s *PackService) asOf(ctx context.Context) (time.Time, error) {
+	now := s.now()
+	if t, ok := ctx.Value(asOfKey{}).(time.Time); ok {
+		if t.Before(now) {
+			return time.Time{}, ErrInvalidAsOf
+		}
+		return t, nil
+	}
+
+	return now, nil
+}
+
+// requesterKey is the context key of the requester.
+type requesterKey struct{}
+
+// ContextWithRequester returns a context identifying the client requesting
+// the calculations, as recorded in the history.
+func ContextWithRequester(ctx context.Context, requester string) context.Context {
+	return context.WithValue(ctx, requesterKey{}, requester)
+}
+
+// RequesterFromContext returns the requester set by ContextWithRequester, if any.
+func RequesterFromContext(ctx context.Context) string {
+	requester, _ := ctx.Value(requesterKey{}).(string)
+	return requester
 }
 
 // NewPackService creates a new instance of the PackService.
-func NewPackService(r storage.PackRepository) *PackService {
-	return &PackService{
-		repo: r,
+func NewPackService(r storage.PackRepository, opts ...Option) *PackService {
+	s := &PackService{
+		repo:        r,
+		tables:      cache.NewLRU[uint64, *calculator.Table](DefaultTableCacheSize, 0),
+		tableBuilds: make(map[uint64]*tableBuild),
+		timers:      make(map[scheduledKey]*time.Timer),
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.bus == nil {
+		s.bus = events.NewBus()
+	}
+	if s.results != nil {
+		events.Subscribe(s.bus, s.purgeResults)
+	}
+	if s.history != nil {
+		events.Subscribe(s.bus, s.record)
+	}
+	if s.webhooks != nil && !s.outbox {
+		// Listing the webhooks must not delay setting the packs
+		events.SubscribeAsync(s.bus, s.notifyWebhooks)
+	}
+
+	return s
+}
+
+// GetPackSizes retrieves the sizes of the active packs valid at the time of the context (see ContextWithAsOf).
+func (s *PackService) GetPackSizes(ctx context.Context) ([]int, error) {
+	packs, err := s.GetPacks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.ActiveSizes(packs), nil
+}
+
+// SetPackSizes replaces all packs with active packs of the given sizes, without other attributes.
+// It returns ErrInvalidPack for a duplicate size or a size that is not positive, like SetPacks.
+func (s *PackService) SetPackSizes(ctx context.Context, sizes []int) error {
+	return s.SetPacks(ctx, storage.NewPacks(sizes...))
+}
+
+// GetPacks retrieves all packs valid at the time of the context (see ContextWithAsOf),
+// including the inactive ones: the last scheduled change in effect at that time,
+// or the stored packs when there is none. It returns ErrInvalidAsOf for a time in the past.
+func (s *PackService) GetPacks(ctx context.Context) ([]storage.Pack, error) {
+	at, err := s.asOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.schedule != nil {
+		changes, err := s.schedule.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// Changes scheduled before a restart are announced too
+		s.watchChanges(tenant.FromContext(ctx), changes)
+
+		for i := len(changes) - 1; i >= 0; i-- {
+			if !changes[i].EffectiveAt.After(at) {
+				return changes[i].Packs, nil
+			}
+		}
+	}
+
+	return s.repo.FindAll(ctx)
+}
+
+// SetPacks validates and persists new packs. Inactive packs are retained but not used by calculations.
+func (s *PackService) SetPacks(ctx context.Context, packs []storage.Pack) error {
+	if err := validatePacks(packs); err != nil {
+		return err
 	}
+
+	return s.replacePacks(ctx, packs)
 }
 
-// GetPackSizes retrieves the current pack sizes from storage.
-func (s *PackService) GetPackSizes() ([]int, error) {
-	return s.repo.FindAll()
+// ImportConfig validates a configuration and, unless dryRun, applies it: the
+// unit first, when set, then the packs, as SetUnit and SetPacks do.
+func (s *PackService) ImportConfig(ctx context.Context, unit string, packs []storage.Pack, dryRun bool) error {
+	if unit != "" {
+		u, err := calculator.ParseUnit(unit)
+		if err != nil {
+			return err
+		}
+		if s.catalog == nil && u != calculator.Pieces {
+			return ErrCatalogDisabled
+		}
+	}
+	if err := validatePacks(packs); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	if unit != "" {
+		if err := s.SetUnit(ctx, unit); err != nil {
+			return err
+		}
+	}
+
+	return s.replacePacks(ctx, packs)
 }
 
-// SetPackSizes persists new pack sizes to storage.
-func (s *PackService) SetPackSizes(sizes []int) error {
-	return s.repo.ReplaceAll(sizes)
+// validatePacks returns ErrInvalidPack when a pack is invalid.
+func validatePacks(packs []storage.Pack) error {
+	seen := make(map[int]bool, len(packs))
+	for _, p := range packs {
+		d := p.Dimensions
+		if p.Size <= 0 || seen[p.Size] || p.Cost < 0 || p.Weight < 0 || d.Length < 0 || d.Width < 0 || d.Height < 0 {
+			return fmt.Errorf("%w: size %d", ErrInvalidPack, p.Size)
+		}
+		seen[p.Size] = true
+	}
+
+	return nil
+}
+
+// ScheduleChange schedules the packs to replace the current ones from effectiveAt on.
+func (s *PackService) ScheduleChange(ctx context.Context, effectiveAt time.Time, packs []storage.Pack) (storage.ScheduledChange, error) {
+	if s.schedule == nil {
+		return storage.ScheduledChange{}, ErrScheduleDisabled
+	}
+	if !effectiveAt.After(s.now()) {
+		return storage.ScheduledChange{}, ErrInvalidSchedule
+	}
+	if err := validatePacks(packs); err != nil {
+		return storage.ScheduledChange{}, err
+	}
+
+	c := storage.ScheduledChange{EffectiveAt: effectiveAt.UTC(), Packs: packs}
+	if err := s.schedule.Add(ctx, &c); err != nil {
+		return storage.ScheduledChange{}, err
+	}
+	s.watchChanges(tenant.FromContext(ctx), []storage.ScheduledChange{c})
+
+	return c, nil
+}
+
+// UpcomingChanges returns the scheduled changes not in effect yet, soonest first.
+func (s *PackService) UpcomingChanges(ctx context.Context) ([]storage.ScheduledChange, error) {
+	if s.schedule == nil {
+		return nil, ErrScheduleDisabled
+	}
+
+	changes, err := s.schedule.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	upcoming := make([]storage.ScheduledChange, 0, len(changes))
+	for _, c := range changes {
+		if c.EffectiveAt.After(now) {
+			upcoming = append(upcoming, c)
+		}
+	}
+
+	return upcoming, nil
+}
+
+// CancelChange removes an upcoming change, returning storage.ErrNotFound when
+// there is none with the ID and ErrChangeInEffect when it already took effect.
+func (s *PackService) CancelChange(ctx context.Context, id int64) error {
+	if s.schedule == nil {
+		return ErrScheduleDisabled
+	}
+
+	changes, err := s.schedule.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if c.ID != id {
+			continue
+		}
+		if !c.EffectiveAt.After(s.now()) {
+			return ErrChangeInEffect
+		}
+		if err := s.schedule.Delete(ctx, id); err != nil {
+			return err
+		}
+		s.unwatchChange(tenant.FromContext(ctx), id)
+
+		return nil
+	}
+
+	return storage.ErrNotFound
+}
+
+// scheduledKey identifies a scheduled change of a tenant.
+type scheduledKey struct {
+	tenant string
+	id     int64
+}
+
+// watchChanges arms the timers announcing the upcoming changes of the tenant
+// when they take effect, unless already armed. The changes are announced by the
+// instance that scheduled or read them, and not when they take effect while the
+// service is down.
+func (s *PackService) watchChanges(tenantID string, changes []storage.ScheduledChange) {
+	now := s.now()
+
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	if s.closed {
+		return
+	}
+	for _, c := range changes {
+		key := scheduledKey{tenant: tenantID, id: c.ID}
+		if _, ok := s.timers[key]; ok || !c.EffectiveAt.After(now) {
+			continue
+		}
+		s.timers[key] = time.AfterFunc(c.EffectiveAt.Sub(now), func() {
+			s.announceChange(tenantID, c.ID)
+		})
+	}
+}
+
+// unwatchChange stops announcing the change of the tenant.
+func (s *PackService) unwatchChange(tenantID string, id int64) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	key := scheduledKey{tenant: tenantID, id: id}
+	if t, ok := s.timers[key]; ok {
+		t.Stop()
+		delete(s.timers, key)
+	}
+}
+
+// announceChange publishes the PackSizesChanged event of a change taking effect,
+// unless it was canceled or superseded meanwhile. The outbox only journals the
+// replaced packs, so the webhooks are notified here in any case.
+func (s *PackService) announceChange(tenantID string, id int64) {
+	s.scheduleMu.Lock()
+	delete(s.timers, scheduledKey{tenant: tenantID, id: id})
+	s.scheduleMu.Unlock()
+
+	ctx := tenant.NewContext(context.Background(), tenantID)
+	changes, err := s.schedule.List(ctx)
+	if err != nil {
+		log.Printf("Failed to list the scheduled changes of %s: %v", tenantID, err)
+		return
+	}
+
+	// Only the last change in effect is announced
+	now := s.now()
+	var change *storage.ScheduledChange
+	for i := range changes {
+		if !changes[i].EffectiveAt.After(now) {
+			change = &changes[i]
+		}
+	}
+	if change == nil || change.ID != id {
+		return
+	}
+
+	sorted := storage.ActiveSizes(change.Packs)
+	sort.Ints(sorted)
+	s.tableFor(ctx, sorted)
+
+	changed := events.PackSizesChanged{
+		Tenant: tenantID,
+		Packs:  change.Packs,
+		Sizes:  sorted,
+		At:     change.EffectiveAt,
+	}
+	s.bus.Publish(ctx, changed)
+	if s.webhooks != nil && s.outbox {
+		s.notifyWebhooks(ctx, changed)
+	}
+}
+
+// Close stops announcing the scheduled changes.
+func (s *PackService) Close() {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	s.closed = true
+	for key, t := range s.timers {
+		t.Stop()
+		delete(s.timers, key)
+	}
+}
+
+// replacePacks persists the packs and prepares the calculations of their active sizes.
+func (s *PackService) replacePacks(ctx context.Context, packs []storage.Pack) error {
+	if err := s.repo.ReplaceAll(ctx, packs); err != nil {
+		return err
+	}
+
+	// Changes in effect would hide the new packs, they are superseded
+	if s.schedule != nil {
+		changes, err := s.schedule.List(ctx)
+		if err != nil {
+			return err
+		}
+		now := s.now()
+		for _, c := range changes {
+			if !c.EffectiveAt.After(now) {
+				if err := s.schedule.Delete(ctx, c.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+					return err
+				}
+			}
+		}
+	}
+
+	// Precompute the solutions of the new size set once, so calculations are lookups.
+	// The repository returns the packs sorted ascending, so the version matches theirs.
+	// Failing here is not fatal, the table is built again by the next calculation.
+	sorted := storage.ActiveSizes(packs)
+	sort.Ints(sorted)
+	s.tableFor(ctx, sorted)
+
+	s.bus.Publish(ctx, events.PackSizesChanged{
+		Tenant: tenant.FromContext(ctx),
+		Packs:  packs,
+		Sizes:  sorted,
+		At:     s.now().UTC(),
+	})
+
+	return nil
+}
+
+// Events returns the bus the service publishes its domain events on.
+func (s *PackService) Events() *events.Bus {
+	return s.bus
+}
+
+// purgeResults drops the cached results, as the ones of the previous size set
+// will never be requested again.
+func (s *PackService) purgeResults(context.Context, events.PackSizesChanged) {
+	s.results.Purge()
+}
+
+// WatchPacks returns a channel receiving a value after every change of the packs
+// of the tenant of the context, and the function to stop watching. Changes made
+// while the previous one is not received yet are reported once.
+func (s *PackService) WatchPacks(ctx context.Context) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	id := tenant.FromContext(ctx)
+
+	stop := events.Subscribe(s.bus, func(_ context.Context, e events.PackSizesChanged) {
+		if e.Tenant != id {
+			return
+		}
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A notification is already pending
+		}
+	})
+
+	return ch, stop
+}
+
+// notifyWebhooks delivers an EventPackSizesChanged event to the webhooks.
+// The packs are already replaced, so failing to notify only gets logged.
+func (s *PackService) notifyWebhooks(ctx context.Context, changed events.PackSizesChanged) {
+	webhooks, err := s.webhooks.List(ctx)
+	if err != nil {
+		log.Printf("Failed to list the webhooks: %v", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	id, err := webhook.NewEventID()
+	if err != nil {
+		log.Printf("Failed to create the webhook event ID: %v", err)
+		return
+	}
+	e := webhookEvent(id, changed)
+	if err := s.dispatcher.Dispatch(webhooks, e); err != nil {
+		log.Printf("Failed to dispatch the %s event: %v", e.Type, err)
+	}
+}
+
+// NotifyWebhooks makes a single attempt to deliver an EventPackSizesChanged
+// event with the given ID to the webhooks of the tenant of the context, for
+// relays retrying the delivery until it succeeds (see WithOutbox).
+// Retries must reuse the event ID, so receivers drop the duplicates.
+func (s *PackService) NotifyWebhooks(ctx context.Context, eventID string, changed events.PackSizesChanged) error {
+	if s.webhooks == nil {
+		return ErrWebhooksDisabled
+	}
+
+	webhooks, err := s.webhooks.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	return s.dispatcher.Send(ctx, webhooks, webhookEvent(eventID, changed))
+}
+
+// webhookEvent returns the EventPackSizesChanged event of the change.
+func webhookEvent(id string, changed events.PackSizesChanged) webhook.Event {
+	return webhook.Event{
+		ID:        id,
+		Type:      webhook.EventPackSizesChanged,
+		Tenant:    changed.Tenant,
+		Timestamp: changed.At,
+		Data:      webhook.PackSizesChanged{Sizes: changed.Sizes},
+	}
+}
+
+// AddWebhook subscribes the URL to the pack changes. The payloads are signed with
+// the secret, a random one when empty, returned in the webhook.
+func (s *PackService) AddWebhook(ctx context.Context, rawURL, secret string) (storage.Webhook, error) {
+	if s.webhooks == nil {
+		return storage.Webhook{}, ErrWebhooksDisabled
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return storage.Webhook{}, ErrInvalidWebhook
+	}
+	if err := s.dispatcher.CheckDestination(ctx, u); err != nil {
+		return storage.Webhook{}, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	if secret == "" {
+		if secret, err = webhook.NewSecret(); err != nil {
+			return storage.Webhook{}, err
+		}
+	}
+
+	w := storage.Webhook{URL: u.String(), Secret: secret, CreatedAt: s.now().UTC()}
+	if err := s.webhooks.Add(ctx, &w); err != nil {
+		return storage.Webhook{}, err
+	}
+
+	return w, nil
+}
+
+// Webhooks returns the webhooks subscribed to the pack changes.
+func (s *PackService) Webhooks(ctx context.Context) ([]storage.Webhook, error) {
+	if s.webhooks == nil {
+		return nil, ErrWebhooksDisabled
+	}
+
+	return s.webhooks.List(ctx)
+}
+
+// DeleteWebhook unsubscribes a webhook, or returns storage.ErrNotFound.
+func (s *PackService) DeleteWebhook(ctx context.Context, id int64) error {
+	if s.webhooks == nil {
+		return ErrWebhooksDisabled
+	}
+
+	return s.webhooks.Delete(ctx, id)
+}
+
+// DeadLetters returns the deliveries to the webhooks of the tenant of the context
+// that failed every attempt, oldest first.
+func (s *PackService) DeadLetters(ctx context.Context) ([]webhook.DeadLetter, error) {
+	if s.webhooks == nil {
+		return nil, ErrWebhooksDisabled
+	}
+
+	return s.dispatcher.DeadLetters(tenant.FromContext(ctx)), nil
+}
+
+// Unit returns the unit the pack sizes are measured in, calculator.Pieces by default.
+func (s *PackService) Unit(ctx context.Context) (calculator.Unit, error) {
+	if s.catalog == nil {
+		return calculator.Pieces, nil
+	}
+
+	c, err := s.catalog.Get(ctx)
+	if err != nil {
+		return calculator.Unit{}, err
+	}
+
+	return calculator.ParseUnit(c.Unit)
+}
+
+// SetUnit changes the unit the pack sizes are measured in.
+// The sizes themselves are kept, so they should be set in the new unit as well.
+func (s *PackService) SetUnit(ctx context.Context, symbol string) error {
+	u, err := calculator.ParseUnit(symbol)
+	if err != nil {
+		return err
+	}
+
+	if s.catalog == nil {
+		if u == calculator.Pieces {
+			return nil
+		}
+		return ErrCatalogDisabled
+	}
+
+	c, err := s.catalog.Get(ctx)
+	if err != nil {
+		return err
+	}
+	c.Unit = u.Symbol
+
+	return s.catalog.Save(ctx, c)
+}
+
+// Rules returns the rules constraining every calculation, in the order they were set.
+func (s *PackService) Rules(ctx context.Context) ([]calculator.Rule, error) {
+	if s.catalog == nil {
+		return nil, nil
+	}
+
+	c, err := s.catalog.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]calculator.Rule, len(c.Rules))
+	for i, r := range c.Rules {
+		rules[i] = calculator.Rule{Kind: calculator.RuleKind(r.Kind), Size: r.Size, Sizes: r.Sizes, Count: r.Count, Amount: r.Amount}
+	}
+
+	return rules, nil
+}
+
+// SetRules replaces the rules constraining every calculation.
+// Cached results stay valid, the cache is keyed by the rules as well.
+func (s *PackService) SetRules(ctx context.Context, rules []calculator.Rule) error {
+	stored := make([]storage.Rule, len(rules))
+	for i, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		stored[i] = storage.Rule{Kind: string(r.Kind), Size: r.Size, Sizes: r.Sizes, Count: r.Count, Amount: r.Amount}
+	}
+
+	if s.catalog == nil {
+		if len(rules) == 0 {
+			return nil
+		}
+		return ErrCatalogDisabled
+	}
+
+	c, err := s.catalog.Get(ctx)
+	if err != nil {
+		return err
+	}
+	c.Rules = stored
+
+	return s.catalog.Save(ctx, c)
+}
+
+// CacheStats returns the result cache counters.
+// The second value is false when the cache is disabled.
+func (s *PackService) CacheStats() (cache.Stats, bool) {
+	if s.results == nil {
+		return cache.Stats{}, false
+	}
+
+	return s.results.Stats(), true
 }
 
 // Calculate is the core orchestration logic.
-func (s *PackService) Calculate(amount int) (map[int]int, error) {
-	sizes, err := s.repo.FindAll()
+// The calculation is aborted as soon as ctx is canceled or its deadline expires.
+func (s *PackService) Calculate(ctx context.Context, amount int) (map[int]int, error) {
+	return s.CalculateFit(ctx, amount, Fit{})
+}
+
+// CalculateFit calculates the packs for the amount, restricted by the fit and the rules.
+// Only the under-ship mode changes the solution, the other settings validate it,
+// so results are cached per mode and validated on every request.
+// An infeasible calculation returns a *calculator.RuleError naming the rule
+// preventing it, when dropping a single rule is enough.
+func (s *PackService) CalculateFit(ctx context.Context, amount int, fit Fit) (map[int]int, error) {
+	packs, err := s.calculateFit(ctx, amount, fit)
+	if err != nil {
+		s.bus.Publish(ctx, events.CalculationFailed{
+			Tenant:    tenant.FromContext(ctx),
+			Requester: RequesterFromContext(ctx),
+			Amount:    amount,
+			Err:       err,
+			At:        s.now().UTC(),
+		})
+		return nil, err
+	}
+
+	return packs, nil
+}
+
+// calculateFit implements CalculateFit, publishing the successful calculations.
+func (s *PackService) calculateFit(ctx context.Context, amount int, fit Fit) (map[int]int, error) {
+	if maxAmount := s.maxAmountFor(ctx); maxAmount > 0 && amount > maxAmount {
+		return nil, ErrAmountTooLarge
+	}
+
+	sizes, err := s.GetPackSizes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := s.Rules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	version := sizeSetVersion(sizes)
+	if len(rules) > 0 {
+		version = ruleSetVersion(version, rules)
+	}
+
+	packs, err := s.cachedCalculate(ctx, amount, sizes, rules, version, fit.UnderShip)
 	if err != nil {
 		return nil, err
 	}
 
-	packs := calculator.Calculate(amount, sizes)
+	if err := calculator.CheckFit(amount, packs, fit.checkOptions()...); err != nil {
+		if len(rules) == 0 {
+			return nil, err
+		}
+
+		// Solve again under the fit to find the rule to blame, if any
+		opts := append(fit.checkOptions(), calculator.WithRules(rules...), calculator.WithWorkBudget(s.workBudget))
+		_, err = calculator.Calculate(ctx, amount, sizes, opts...)
+		if err == nil {
+			err = calculator.ErrInfeasible
+		}
+		return nil, err
+	}
+
+	s.bus.Publish(ctx, events.CalculationPerformed{
+		Tenant:      tenant.FromContext(ctx),
+		Requester:   RequesterFromContext(ctx),
+		Amount:      amount,
+		Packs:       packs,
+		SizeVersion: version,
+		At:          s.now().UTC(),
+	})
 
 	return packs, nil
 }
+
+// CalculateQuantity calculates the packs for an amount measured in the given unit,
+// or in the unit of the pack sizes when unit is empty, restricted by the fit.
+// The amount is converted to the unit of the pack sizes and rounded up to a
+// whole number of it, or down when under-shipping.
+func (s *PackService) CalculateQuantity(ctx context.Context, amount calculator.Quantity, unit string, fit Fit) (map[int]int, error) {
+	to, err := s.Unit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	from := to
+	if unit != "" {
+		if from, err = calculator.ParseUnit(unit); err != nil {
+			return nil, err
+		}
+	}
+
+	// Round toward the side the fit allows, converting and then to whole units
+	convert, round := amount.Convert, calculator.Quantity.Ceil
+	if fit.UnderShip {
+		convert, round = amount.ConvertFloor, calculator.Quantity.Floor
+	}
+	converted, err := convert(from, to)
+	if err != nil {
+		return nil, err
+	}
+	whole := round(converted)
+
+	return s.CalculateFit(ctx, whole, fit)
+}
+
+// cachedCalculate answers from the result cache when enabled, calculating and caching on a miss.
+// The version identifies both the sizes and the rules.
+func (s *PackService) cachedCalculate(ctx context.Context, amount int, sizes []int, rules []calculator.Rule, version uint64, underShip bool) (map[int]int, error) {
+	var opts []calculator.Option
+	if underShip {
+		opts = append(opts, calculator.WithUnderShip())
+	}
+
+	if s.results == nil {
+		return s.calculate(ctx, amount, sizes, rules, opts)
+	}
+
+	key := resultKey{version: version, amount: amount, underShip: underShip}
+	if packs, ok := s.results.Get(key); ok {
+		return copyPacks(packs), nil
+	}
+
+	packs, err := s.calculate(ctx, amount, sizes, rules, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.results.Add(key, copyPacks(packs))
+
+	return packs, nil
+}
+
+// record saves a calculation in the history.
+// A failure is only logged, the caller already has a valid result.
+func (s *PackService) record(ctx context.Context, e events.CalculationPerformed) {
+	total, excess := 0, 0
+	for size, count := range e.Packs {
+		total += size * count
+	}
+	// Amounts of zero or less get no packs, and under-shipped amounts have no excess
+	if e.Amount > 0 {
+		excess = max(total-e.Amount, 0)
+	}
+
+	c := &storage.Calculation{
+		Timestamp:   e.At,
+		Amount:      e.Amount,
+		Packs:       copyPacks(e.Packs),
+		TotalItems:  total,
+		Excess:      excess,
+		SizeVersion: fmt.Sprintf("%016x", e.SizeVersion),
+		Requester:   e.Requester,
+		Tenant:      e.Tenant,
+	}
+
+	// The calculation is done, do not lose it because the client went away
+	if err := s.history.Save(context.WithoutCancel(ctx), c); err != nil {
+		log.Printf("Failed to record calculation of %d: %v", e.Amount, err)
+	}
+}
+
+// ListCalculations returns a page of the recorded calculations of the tenant of
+// the context matching the filter, newest first, together with the total number
+// of matching calculations.
+func (s *PackService) ListCalculations(ctx context.Context, f storage.CalculationFilter) ([]storage.Calculation, int, error) {
+	if s.history == nil {
+		return nil, 0, ErrHistoryDisabled
+	}
+	f.Tenant = tenant.FromContext(ctx)
+
+	return s.history.Find(ctx, f)
+}
+
+// CalculationStats aggregates the recorded calculations of the tenant of the context matching the filter.
+func (s *PackService) CalculationStats(ctx context.Context, f storage.CalculationFilter) (storage.CalculationStats, error) {
+	if s.history == nil {
+		return storage.CalculationStats{}, ErrHistoryDisabled
+	}
+	f.Tenant = tenant.FromContext(ctx)
+
+	return s.history.Stats(ctx, f)
+}
+
+// AnalyzePackSizes reports the consequences of using the given pack sizes
+// over the amounts from..to (see calculator.Analyze).
+// The current pack sizes are analysed when sizes is empty.
+func (s *PackService) AnalyzePackSizes(ctx context.Context, sizes []int, from, to int) (calculator.Analysis, error) {
+	if len(sizes) == 0 {
+		current, err := s.GetPackSizes(ctx)
+		if err != nil {
+			return calculator.Analysis{}, err
+		}
+		sizes = current
+	}
+
+	return calculator.Analyze(ctx, sizes, from, to, calculator.WithWorkBudget(s.workBudget))
+}
+
+// ComparePackSizes packs the amounts with both the current and the candidate
+// pack sizes and reports the aggregated differences, without changing anything.
+func (s *PackService) ComparePackSizes(ctx context.Context, candidate []int, amounts []int, costs CostModel) (Comparison, error) {
+	if len(candidate) == 0 {
+		return Comparison{}, ErrNoPackSizes
+	}
+	if err := s.validateAmounts(ctx, amounts); err != nil {
+		return Comparison{}, err
+	}
+
+	current, err := s.GetPackSizes(ctx)
+	if err != nil {
+		return Comparison{}, err
+	}
+
+	proposed := make([]int, len(candidate))
+	copy(proposed, candidate)
+	sort.Ints(proposed)
+
+	var c Comparison
+	for _, m := range []struct {
+		sizes []int
+		out   *SizeSetMetrics
+	}{
+		{sizes: current, out: &c.Current},
+		{sizes: proposed, out: &c.Candidate},
+	} {
+		metrics, err := calculator.Evaluate(ctx, m.sizes, amounts, calculator.WithWorkBudget(s.workBudget))
+		if err != nil {
+			return Comparison{}, err
+		}
+
+		*m.out = SizeSetMetrics{
+			Sizes:   m.sizes,
+			Metrics: metrics,
+			Cost:    metrics.Cost(costs.ExcessItemCost, costs.PackCost),
+		}
+	}
+
+	c.DeltaExcess = c.Candidate.TotalExcess - c.Current.TotalExcess
+	c.DeltaPacks = c.Candidate.TotalPacks - c.Current.TotalPacks
+	c.DeltaCost = c.Candidate.Cost - c.Current.Cost
+
+	return c, nil
+}
+
+// RecommendPackSizes suggests the pack size sets minimizing the cost of packing
+// the demand amounts under the constraints (see optimizer.Recommend).
+func (s *PackService) RecommendPackSizes(ctx context.Context, amounts []int, c optimizer.Constraints, costs CostModel, limit int) ([]optimizer.Recommendation, error) {
+	if err := s.validateAmounts(ctx, amounts); err != nil {
+		return nil, err
+	}
+
+	return optimizer.Recommend(ctx, amounts, c,
+		optimizer.Costs{ExcessItemCost: costs.ExcessItemCost, PackCost: costs.PackCost},
+		optimizer.WithLimit(limit),
+		optimizer.WithCalculatorOptions(calculator.WithWorkBudget(s.workBudget)),
+	)
+}
+
+// PlanShipment chooses the packs of every order line, then consolidates the
+// packs of all lines into the given container types (see shipping.Pack).
+func (s *PackService) PlanShipment(ctx context.Context, lines []ShipmentLine, containers []shipping.ContainerType) (ShipmentPlan, error) {
+	amounts := make([]int, len(lines))
+	for i, l := range lines {
+		if len(l.Packs) == 0 {
+			return ShipmentPlan{}, ErrNoPackSizes
+		}
+		amounts[i] = l.Amount
+	}
+	if err := s.validateAmounts(ctx, amounts); err != nil {
+		return ShipmentPlan{}, err
+	}
+
+	plan := ShipmentPlan{Lines: make([]map[int]int, len(lines))}
+	shipped := make([]shipping.Line, len(lines))
+	for i, l := range lines {
+		sizes := make([]int, len(l.Packs))
+		for j, spec := range l.Packs {
+			sizes[j] = spec.Size
+		}
+
+		packs, err := calculator.Calculate(ctx, l.Amount, sizes, calculator.WithWorkBudget(s.workBudget))
+		if err != nil {
+			return ShipmentPlan{}, err
+		}
+
+		plan.Lines[i] = packs
+		shipped[i] = shipping.Line{Packs: packs, Specs: l.Packs}
+	}
+
+	p, err := shipping.Pack(ctx, shipped, containers)
+	if err != nil {
+		return ShipmentPlan{}, err
+	}
+	plan.Plan = p
+
+	return plan, nil
+}
+
+// maxAmountFor returns the largest amount accepted for the tenant of the context.
+func (s *PackService) maxAmountFor(ctx context.Context) int {
+	if n, ok := s.tenantMaxAmount[tenant.FromContext(ctx)]; ok {
+		return n
+	}
+
+	return s.maxAmount
+}
+
+// validateAmounts checks a list of amounts to evaluate is not empty nor too large.
+func (s *PackService) validateAmounts(ctx context.Context, amounts []int) error {
+	if len(amounts) == 0 {
+		return ErrNoAmounts
+	}
+
+	maxAmount := s.maxAmountFor(ctx)
+	for _, amount := range amounts {
+		if maxAmount > 0 && amount > maxAmount {
+			return ErrAmountTooLarge
+		}
+	}
+
+	return nil
+}
+
+// calculate answers from the precomputed table of the size set when available,
+// falling back to solving the single amount when the table exceeds the work budget.
+// Calculations under rules are always solved on their own, the table ignores rules.
+func (s *PackService) calculate(ctx context.Context, amount int, sizes []int, rules []calculator.Rule, opts []calculator.Option) (map[int]int, error) {
+	if len(rules) > 0 {
+		opts = append(opts, calculator.WithRules(rules...), calculator.WithWorkBudget(s.workBudget))
+		return calculator.Calculate(ctx, amount, sizes, opts...)
+	}
+
+	if table := s.tableFor(ctx, sizes); table != nil {
+		return table.Solve(ctx, amount, opts...)
+	}
+
+	return calculator.Calculate(ctx, amount, sizes, append(opts, calculator.WithWorkBudget(s.workBudget))...)
+}
+
+// tableBuild is a table being built, done is closed once table is set.
+type tableBuild struct {
+	done  chan struct{}
+	table *calculator.Table
+}
+
+// tableFor returns the precomputed table of the size set, building it on first use.
+// It returns nil when the table cannot be built within the work budget or
+// calculator.MaxTableSize. Calculations of a size set being built wait for it.
+func (s *PackService) tableFor(ctx context.Context, sizes []int) *calculator.Table {
+	if s.tables == nil {
+		return nil
+	}
+
+	version := sizeSetVersion(sizes)
+	if table, ok := s.tables.Get(version); ok {
+		return table
+	}
+
+	s.tableMu.Lock()
+	// Built while waiting for the lock
+	if table, ok := s.tables.Get(version); ok {
+		s.tableMu.Unlock()
+		return table
+	}
+	if b, ok := s.tableBuilds[version]; ok {
+		s.tableMu.Unlock()
+		select {
+		case <-b.done:
+			return b.table
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	b := &tableBuild{done: make(chan struct{})}
+	s.tableBuilds[version] = b
+	s.tableMu.Unlock()
+
+	table, err := calculator.NewTable(ctx, sizes, calculator.WithWorkBudget(s.workBudget))
+
+	s.tableMu.Lock()
+	delete(s.tableBuilds, version)
+	// Interrupted by the caller, let the next calculation try again
+	if err == nil || errors.Is(err, calculator.ErrWorkBudgetExceeded) || errors.Is(err, calculator.ErrTableTooLarge) {
+		s.tables.Add(version, table)
+		b.table = table
+	}
+	s.tableMu.Unlock()
+	close(b.done)
+
+	return b.table
+}
+
+// sizeSetVersion returns a fingerprint identifying a sorted set of pack sizes.
+// Keying the cache by content keeps it correct even when the repository
+// is changed by another instance.
+func sizeSetVersion(sizes []int) uint64 {
+	h := fnv.New64a()
+
+	var buf [8]byte
+	for _, size := range sizes {
+		binary.LittleEndian.PutUint64(buf[:], uint64(size))
+		h.Write(buf[:])
+	}
+
+	return h.Sum64()
+}
+
+// ruleSetVersion extends the version of a size set with the rules constraining it.
+func ruleSetVersion(version uint64, rules []calculator.Rule) uint64 {
+	h := fnv.New64a()
+
+	var buf [8]byte
+	write := func(n int) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		h.Write(buf[:])
+	}
+
+	write(int(version))
+	for _, r := range rules {
+		h.Write([]byte(r.Kind))
+		write(r.Size)
+		write(r.Count)
+		write(r.Amount)
+		write(len(r.Sizes))
+		for _, size := range r.Sizes {
+			write(size)
+		}
+	}
+
+	return h.Sum64()
+}
+
+// copyPacks returns a copy of packs, so cached results cannot be modified by callers.
+func copyPacks(packs map[int]int) map[int]int {
+	out := make(map[int]int, len(packs))
+	for k, v := range packs {
+		out[k] = v
+	}
+
+	return out
+}
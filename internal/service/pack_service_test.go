@@ -1,32 +1,54 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"denisgodoroja/retask/internal/calculator"
+	"denisgodoroja/retask/internal/events"
+	"denisgodoroja/retask/internal/optimizer"
+	"denisgodoroja/retask/internal/shipping"
 	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/inmemory"
+	"denisgodoroja/retask/internal/tenant"
+	"denisgodoroja/retask/internal/webhook"
 )
 
 // mockPackRepository is a mock implementation of the storage.PackRepository interface.
 type mockPackRepository struct {
-	// FindAll return:
+	// FindAll return, findAllPacks when set and active packs of findAllSizes otherwise:
 	findAllSizes []int
+	findAllPacks []storage.Pack
 	findAllErr   error
 
 	// ReplaceAll return:
 	replaceAllErr error
 
 	// To check what was passed in
-	replaceAllCalledWith []int
+	replaceAllCalledWith []storage.Pack
 }
 
-func (m *mockPackRepository) FindAll() ([]int, error) {
-	return m.findAllSizes, m.findAllErr
+func (m *mockPackRepository) FindAll(ctx context.Context) ([]storage.Pack, error) {
+	if m.findAllErr != nil {
+		return nil, m.findAllErr
+	}
+	if m.findAllPacks != nil {
+		return m.findAllPacks, nil
+	}
+	return storage.NewPacks(m.findAllSizes...), nil
 }
 
-func (m *mockPackRepository) ReplaceAll(sizes []int) error {
-	m.replaceAllCalledWith = sizes
+func (m *mockPackRepository) ReplaceAll(ctx context.Context, packs []storage.Pack) error {
+	m.replaceAllCalledWith = packs
 	return m.replaceAllErr
 }
 
@@ -61,7 +83,7 @@ func TestPackService_GetPackSizes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := NewPackService(tt.mock)
-			got, err := s.GetPackSizes()
+			got, err := s.GetPackSizes(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetPackSizes() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -95,23 +117,272 @@ func TestPackService_SetPackSizes(t *testing.T) {
 			mock:    &mockPackRepository{replaceAllErr: errTest},
 			wantErr: true,
 		},
+		{
+			name:    "Duplicate size",
+			input:   []int{100, 200, 100},
+			mock:    &mockPackRepository{},
+			wantErr: true,
+		},
+		{
+			name:    "Size not positive",
+			input:   []int{100, 0, -5},
+			mock:    &mockPackRepository{},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := NewPackService(tt.mock)
-			err := s.SetPackSizes(tt.input)
+			err := s.SetPackSizes(context.Background(), tt.input)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("SetPackSizes() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.wantErr && tt.mock.replaceAllErr == nil && tt.mock.replaceAllCalledWith != nil {
+				t.Errorf("ReplaceAll() called with invalid sizes %v", tt.mock.replaceAllCalledWith)
+			}
 			// Check that the repo was called with the correct data
-			if !tt.wantErr && !reflect.DeepEqual(tt.mock.replaceAllCalledWith, tt.input) {
+			if want := storage.NewPacks(tt.input...); !tt.wantErr && !reflect.DeepEqual(tt.mock.replaceAllCalledWith, want) {
 				t.Errorf("ReplaceAll() not called with correct args. got = %v, want = %v",
-					tt.mock.replaceAllCalledWith, tt.input)
+					tt.mock.replaceAllCalledWith, want)
 			}
 		})
 	}
 }
 
+// TestPackService_SetPacks tests that inactive packs are retained but not used by calculations.
+func TestPackService_SetPacks(t *testing.T) {
+	s := NewPackService(inmemory.NewInMemoryPackRepo(), WithResultCache(10, time.Minute))
+	ctx := context.Background()
+
+	if got, err := s.Calculate(ctx, 1200); err != nil || !reflect.DeepEqual(got, map[int]int{1000: 1, 250: 1}) {
+		t.Fatalf("Calculate() = %v, %v, want %v", got, err, map[int]int{1000: 1, 250: 1})
+	}
+
+	packs := []storage.Pack{
+		{Size: 250, Label: "Small", SKU: "4006381333931", Cost: 0.5, Weight: 0.3, Active: true},
+		{Size: 500, Label: "Medium", Active: true},
+		{Size: 1000, Label: "Large", Dimensions: storage.Dimensions{Length: 40, Width: 30, Height: 20}},
+	}
+	if err := s.SetPacks(ctx, packs); err != nil {
+		t.Fatalf("SetPacks() returned an unexpected error: %v", err)
+	}
+
+	if got, err := s.GetPacks(ctx); err != nil || !reflect.DeepEqual(got, packs) {
+		t.Errorf("GetPacks() = %v, %v, want %v", got, err, packs)
+	}
+	if got, err := s.GetPackSizes(ctx); err != nil || !reflect.DeepEqual(got, []int{250, 500}) {
+		t.Errorf("GetPackSizes() = %v, %v, want %v", got, err, []int{250, 500})
+	}
+	if got, err := s.Calculate(ctx, 1200); err != nil || !reflect.DeepEqual(got, map[int]int{500: 2, 250: 1}) {
+		t.Errorf("Calculate() = %v, %v, want %v", got, err, map[int]int{500: 2, 250: 1})
+	}
+
+	for _, invalid := range [][]storage.Pack{
+		{{Size: 0, Active: true}},
+		{{Size: 250, Active: true}, {Size: 250}},
+		{{Size: 250, Cost: -1}},
+		{{Size: 250, Dimensions: storage.Dimensions{Height: -1}}},
+	} {
+		if err := s.SetPacks(ctx, invalid); !errors.Is(err, ErrInvalidPack) {
+			t.Errorf("SetPacks(%v) error = %v, wantErr %v", invalid, err, ErrInvalidPack)
+		}
+	}
+}
+
+// TestPackService_ImportConfig tests that a dry run validates without changing anything.
+func TestPackService_ImportConfig(t *testing.T) {
+	repo := &mockPackRepository{}
+	s := NewPackService(repo, WithCatalog(inmemory.NewInMemoryCatalogRepo()))
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		unit    string
+		packs   []storage.Pack
+		wantErr error
+	}{
+		{name: "Valid", unit: "kg", packs: storage.NewPacks(250, 500)},
+		{name: "Invalid pack", packs: storage.NewPacks(250, 250), wantErr: ErrInvalidPack},
+		{name: "Unknown unit", unit: "furlong", packs: storage.NewPacks(250), wantErr: calculator.ErrUnknownUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.ImportConfig(ctx, tt.unit, tt.packs, true); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ImportConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if repo.replaceAllCalledWith != nil {
+				t.Errorf("ImportConfig() dry run replaced the packs with %v", repo.replaceAllCalledWith)
+			}
+			if unit, err := s.Unit(ctx); err != nil || unit != calculator.Pieces {
+				t.Errorf("Unit() = %v, %v, want the unit before the dry run", unit, err)
+			}
+		})
+	}
+
+	if err := s.ImportConfig(ctx, "kg", storage.NewPacks(250, 500), false); err != nil {
+		t.Fatalf("ImportConfig() returned an unexpected error: %v", err)
+	}
+	if want := storage.NewPacks(250, 500); !reflect.DeepEqual(repo.replaceAllCalledWith, want) {
+		t.Errorf("ImportConfig() replaced the packs with %v, want %v", repo.replaceAllCalledWith, want)
+	}
+	if unit, err := s.Unit(ctx); err != nil || unit.Symbol != "kg" {
+		t.Errorf("Unit() = %v, %v, want kg", unit, err)
+	}
+
+	// Without a catalog the unit is checked by the dry run already
+	noCatalog := NewPackService(&mockPackRepository{})
+	if err := noCatalog.ImportConfig(ctx, "kg", storage.NewPacks(250), true); !errors.Is(err, ErrCatalogDisabled) {
+		t.Errorf("ImportConfig() error = %v, wantErr %v", err, ErrCatalogDisabled)
+	}
+}
+
+// TestPackService_Schedule tests that calculations use the packs valid at their time.
+func TestPackService_Schedule(t *testing.T) {
+	s := NewPackService(inmemory.NewInMemoryPackRepo(), WithSchedule(inmemory.NewInMemoryScheduleRepo()), WithResultCache(10, time.Minute))
+	defer s.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := s.ScheduleChange(ctx, now, storage.NewPacks(300)); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("ScheduleChange() error = %v, wantErr %v", err, ErrInvalidSchedule)
+	}
+
+	midnight := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	change, err := s.ScheduleChange(ctx, midnight, storage.NewPacks(300, 600))
+	if err != nil {
+		t.Fatalf("ScheduleChange() returned an unexpected error: %v", err)
+	}
+	later, err := s.ScheduleChange(ctx, midnight.AddDate(0, 1, 0), storage.NewPacks(100))
+	if err != nil {
+		t.Fatalf("ScheduleChange() returned an unexpected error: %v", err)
+	}
+
+	if got, err := s.UpcomingChanges(ctx); err != nil || len(got) != 2 || got[0].ID != change.ID || got[1].ID != later.ID {
+		t.Fatalf("UpcomingChanges() = %+v, %v, want the changes %d and %d", got, err, change.ID, later.ID)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want map[int]int
+	}{
+		{name: "Current packs", ctx: ctx, want: map[int]int{500: 1, 250: 1}},
+		{name: "As of the change", ctx: ContextWithAsOf(ctx, midnight), want: map[int]int{600: 1, 300: 1}},
+		{name: "As of before the change", ctx: ContextWithAsOf(ctx, midnight.Add(-time.Second)), want: map[int]int{500: 1, 250: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Calculate(tt.ctx, 750)
+			if err != nil {
+				t.Fatalf("Calculate() returned an unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Calculate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The replaced packs are not kept
+	if _, err := s.Calculate(ContextWithAsOf(ctx, now.Add(-time.Second)), 750); !errors.Is(err, ErrInvalidAsOf) {
+		t.Errorf("Calculate() error = %v, wantErr %v", err, ErrInvalidAsOf)
+	}
+
+	// Once the time comes, the change is in effect and no longer upcoming
+	now = midnight
+	if got, err := s.Calculate(ctx, 750); err != nil || !reflect.DeepEqual(got, map[int]int{600: 1, 300: 1}) {
+		t.Errorf("Calculate() = %v, %v, want %v", got, err, map[int]int{600: 1, 300: 1})
+	}
+	if err := s.CancelChange(ctx, change.ID); !errors.Is(err, ErrChangeInEffect) {
+		t.Errorf("CancelChange() error = %v, wantErr %v", err, ErrChangeInEffect)
+	}
+
+	if err := s.CancelChange(ctx, later.ID); err != nil {
+		t.Fatalf("CancelChange() returned an unexpected error: %v", err)
+	}
+	if err := s.CancelChange(ctx, later.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("CancelChange() error = %v, wantErr %v", err, storage.ErrNotFound)
+	}
+	if got, err := s.UpcomingChanges(ctx); err != nil || len(got) != 0 {
+		t.Errorf("UpcomingChanges() = %+v, %v, want none", got, err)
+	}
+
+	// Setting packs supersedes the change in effect
+	if err := s.SetPackSizes(ctx, []int{1000}); err != nil {
+		t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+	}
+	if got, err := s.GetPackSizes(ctx); err != nil || !reflect.DeepEqual(got, []int{1000}) {
+		t.Errorf("GetPackSizes() = %v, %v, want %v", got, err, []int{1000})
+	}
+
+	if _, err := NewPackService(&mockPackRepository{}).UpcomingChanges(ctx); !errors.Is(err, ErrScheduleDisabled) {
+		t.Errorf("UpcomingChanges() error = %v, wantErr %v", err, ErrScheduleDisabled)
+	}
+}
+
+// TestPackService_Schedule_Announce tests that the changes taking effect are
+// published, unless canceled before.
+func TestPackService_Schedule_Announce(t *testing.T) {
+	schedule := inmemory.NewInMemoryScheduleRepo()
+	s := NewPackService(inmemory.NewInMemoryPackRepo(), WithSchedule(schedule))
+	defer s.Close()
+
+	changed := make(chan events.PackSizesChanged, 10)
+	events.Subscribe(s.Events(), func(_ context.Context, e events.PackSizesChanged) { changed <- e })
+
+	ctx := tenant.NewContext(context.Background(), "north")
+	effectiveAt := time.Now().Add(50 * time.Millisecond)
+	change, err := s.ScheduleChange(ctx, effectiveAt, storage.NewPacks(300, 600))
+	if err != nil {
+		t.Fatalf("ScheduleChange() returned an unexpected error: %v", err)
+	}
+	canceled, err := s.ScheduleChange(ctx, effectiveAt.Add(10*time.Millisecond), storage.NewPacks(100))
+	if err != nil {
+		t.Fatalf("ScheduleChange() returned an unexpected error: %v", err)
+	}
+	if err := s.CancelChange(ctx, canceled.ID); err != nil {
+		t.Fatalf("CancelChange() returned an unexpected error: %v", err)
+	}
+
+	want := events.PackSizesChanged{Tenant: "north", Packs: change.Packs, Sizes: []int{300, 600}, At: change.EffectiveAt}
+	select {
+	case got := <-changed:
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("published event = %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the change taking effect was not published")
+	}
+	select {
+	case got := <-changed:
+		t.Errorf("the canceled change was published: %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A restarted service announces the changes once read
+	restarted := NewPackService(inmemory.NewInMemoryPackRepo(), WithSchedule(schedule))
+	defer restarted.Close()
+	events.Subscribe(restarted.Events(), func(_ context.Context, e events.PackSizesChanged) { changed <- e })
+
+	later, err := s.ScheduleChange(ctx, time.Now().Add(50*time.Millisecond), storage.NewPacks(1000))
+	if err != nil {
+		t.Fatalf("ScheduleChange() returned an unexpected error: %v", err)
+	}
+	s.Close()
+	if _, err := restarted.GetPackSizes(ctx); err != nil {
+		t.Fatalf("GetPackSizes() returned an unexpected error: %v", err)
+	}
+	select {
+	case got := <-changed:
+		if got.At != later.EffectiveAt || !reflect.DeepEqual(got.Sizes, []int{1000}) {
+			t.Errorf("published event = %+v, want the change %d", got, later.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the change taking effect was not published after a restart")
+	}
+}
+
 // TestPackService_Calculate tests the orchestration logic.
 func TestPackService_Calculate(t *testing.T) {
 	errTest := errors.New("some error")
@@ -154,7 +425,7 @@ func TestPackService_Calculate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := NewPackService(tt.mock)
-			got, err := s.Calculate(tt.amount)
+			got, err := s.Calculate(context.Background(), tt.amount)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Calculate() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -165,3 +436,766 @@ func TestPackService_Calculate(t *testing.T) {
 		})
 	}
 }
+
+// TestPackService_Calculate_Canceled tests that cancellation reaches the calculator.
+func TestPackService_Calculate_Canceled(t *testing.T) {
+	s := NewPackService(&mockPackRepository{findAllSizes: []int{997, 1000}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.Calculate(ctx, 50000); !errors.Is(err, context.Canceled) {
+		t.Errorf("Calculate() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestPackService_Calculate_Limits tests the amount and work budget guardrails.
+func TestPackService_Calculate_Limits(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int
+		opts    []Option
+		wantErr error
+	}{
+		{
+			name:    "Amount within limit",
+			amount:  1000,
+			opts:    []Option{WithMaxAmount(1000)},
+			wantErr: nil,
+		},
+		{
+			name:    "Amount above limit",
+			amount:  1001,
+			opts:    []Option{WithMaxAmount(1000)},
+			wantErr: ErrAmountTooLarge,
+		},
+		{
+			name:    "Work budget exceeded",
+			amount:  50000,
+			opts:    []Option{WithWorkBudget(100)},
+			wantErr: calculator.ErrWorkBudgetExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewPackService(&mockPackRepository{findAllSizes: []int{997, 1000}}, tt.opts...)
+			if _, err := s.Calculate(context.Background(), tt.amount); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Calculate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestPackService_Calculate_Cache tests that results are cached per size set
+// and invalidated when the sizes change.
+func TestPackService_Calculate_Cache(t *testing.T) {
+	mock := &mockPackRepository{findAllSizes: []int{250, 500, 1000}}
+	s := NewPackService(mock, WithResultCache(10, time.Minute))
+
+	calculate := func(amount int) map[int]int {
+		t.Helper()
+		got, err := s.Calculate(context.Background(), amount)
+		if err != nil {
+			t.Fatalf("Calculate() returned an unexpected error: %v", err)
+		}
+		return got
+	}
+
+	first := calculate(750)
+	// Modifying a returned result must not corrupt the cache
+	first[250] = 99
+
+	if got, want := calculate(750), map[int]int{250: 1, 500: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calculate() got = %v, want %v", got, want)
+	}
+
+	stats, ok := s.CacheStats()
+	if !ok {
+		t.Fatal("CacheStats() reported a disabled cache")
+	}
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("CacheStats() hits = %d, misses = %d, want 1, 1", stats.Hits, stats.Misses)
+	}
+
+	// A new size set must not be answered from the old results
+	if err := s.SetPackSizes(context.Background(), []int{750}); err != nil {
+		t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+	}
+	mock.findAllSizes = []int{750}
+
+	if got, want := calculate(750), map[int]int{750: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calculate() after SetPackSizes() got = %v, want %v", got, want)
+	}
+	if stats, _ := s.CacheStats(); stats.Misses != 2 {
+		t.Errorf("CacheStats() misses = %d, want 2", stats.Misses)
+	}
+}
+
+// TestPackService_CacheStats_Disabled tests the stats without a cache.
+func TestPackService_CacheStats_Disabled(t *testing.T) {
+	s := NewPackService(&mockPackRepository{})
+	if _, ok := s.CacheStats(); ok {
+		t.Error("CacheStats() reported an enabled cache")
+	}
+}
+
+// TestPackService_Calculate_History tests that calculations are recorded with their requester.
+func TestPackService_Calculate_History(t *testing.T) {
+	history := inmemory.NewInMemoryCalculationRepo()
+	s := NewPackService(&mockPackRepository{findAllSizes: []int{250, 500, 1000}},
+		WithHistory(history), WithResultCache(10, time.Minute))
+
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	ctx := ContextWithRequester(context.Background(), "10.0.0.1")
+	// The second calculation is a cache hit, and recorded all the same
+	for i := 0; i < 2; i++ {
+		if _, err := s.Calculate(ctx, 251); err != nil {
+			t.Fatalf("Calculate() returned an unexpected error: %v", err)
+		}
+	}
+
+	got, total, err := s.ListCalculations(context.Background(), storage.CalculationFilter{})
+	if err != nil {
+		t.Fatalf("ListCalculations() returned an unexpected error: %v", err)
+	}
+	if total != 2 {
+		t.Fatalf("ListCalculations() total = %d, want 2", total)
+	}
+
+	want := storage.Calculation{
+		ID:          2,
+		Timestamp:   now,
+		Amount:      251,
+		Packs:       map[int]int{500: 1},
+		TotalItems:  500,
+		Excess:      249,
+		SizeVersion: fmt.Sprintf("%016x", sizeSetVersion([]int{250, 500, 1000})),
+		Requester:   "10.0.0.1",
+		Tenant:      tenant.DefaultID,
+	}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("ListCalculations() got = %+v, want %+v", got[0], want)
+	}
+
+	stats, err := s.CalculationStats(context.Background(), storage.CalculationFilter{})
+	if err != nil {
+		t.Fatalf("CalculationStats() returned an unexpected error: %v", err)
+	}
+	if stats.Count != 2 || stats.TotalExcess != 498 {
+		t.Errorf("CalculationStats() count = %d, total excess = %d, want 2, 498", stats.Count, stats.TotalExcess)
+	}
+}
+
+// TestPackService_History_Disabled tests the history queries without a repository.
+func TestPackService_History_Disabled(t *testing.T) {
+	s := NewPackService(&mockPackRepository{})
+
+	if _, _, err := s.ListCalculations(context.Background(), storage.CalculationFilter{}); !errors.Is(err, ErrHistoryDisabled) {
+		t.Errorf("ListCalculations() error = %v, wantErr %v", err, ErrHistoryDisabled)
+	}
+	if _, err := s.CalculationStats(context.Background(), storage.CalculationFilter{}); !errors.Is(err, ErrHistoryDisabled) {
+		t.Errorf("CalculationStats() error = %v, wantErr %v", err, ErrHistoryDisabled)
+	}
+}
+
+// TestPackService_CalculateQuantity tests the conversion of amounts to the unit of the pack sizes.
+func TestPackService_CalculateQuantity(t *testing.T) {
+	s := NewPackService(&mockPackRepository{findAllSizes: []int{250, 500, 1000}},
+		WithCatalog(inmemory.NewInMemoryCatalogRepo()))
+
+	if err := s.SetUnit(context.Background(), "g"); err != nil {
+		t.Fatalf("SetUnit() returned an unexpected error: %v", err)
+	}
+	if u, err := s.Unit(context.Background()); err != nil || u != calculator.Gram {
+		t.Fatalf("Unit() = %v, %v, want %v", u, err, calculator.Gram)
+	}
+
+	tests := []struct {
+		name    string
+		amount  string
+		unit    string
+		fit     Fit
+		want    map[int]int
+		wantErr error
+	}{
+		{name: "Catalog unit", amount: "750", unit: "", want: map[int]int{250: 1, 500: 1}},
+		{name: "Fractional kilograms", amount: "1.2", unit: "kg", want: map[int]int{250: 1, 1000: 1}},
+		{name: "Fractional grams round up", amount: "500.5", unit: "g", want: map[int]int{250: 1, 500: 1}},
+		// 1249.9995 g, rounding up to 1250.000 g before flooring would ship more than ordered
+		{name: "Under ship rounds down", amount: "1249999.5", unit: "mg", fit: Fit{UnderShip: true}, want: map[int]int{1000: 1}},
+		{name: "Under ship, whole amount", amount: "1.25", unit: "kg", fit: Fit{UnderShip: true}, want: map[int]int{1000: 1, 250: 1}},
+		{name: "Incompatible unit", amount: "1", unit: "l", wantErr: calculator.ErrIncompatibleUnits},
+		{name: "Unknown unit", amount: "1", unit: "lb", wantErr: calculator.ErrUnknownUnit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, err := calculator.ParseQuantity(tt.amount)
+			if err != nil {
+				t.Fatalf("ParseQuantity() returned an unexpected error: %v", err)
+			}
+
+			got, err := s.CalculateQuantity(context.Background(), amount, tt.unit, tt.fit)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CalculateQuantity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CalculateQuantity() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPackService_SetUnit_NoCatalog tests that only pieces are accepted without a catalog.
+func TestPackService_SetUnit_NoCatalog(t *testing.T) {
+	s := NewPackService(&mockPackRepository{})
+
+	if err := s.SetUnit(context.Background(), "pcs"); err != nil {
+		t.Errorf("SetUnit() error = %v, wantErr %v", err, nil)
+	}
+	if err := s.SetUnit(context.Background(), "kg"); !errors.Is(err, ErrCatalogDisabled) {
+		t.Errorf("SetUnit() error = %v, wantErr %v", err, ErrCatalogDisabled)
+	}
+}
+
+// TestPackService_CalculateFit tests that cached results are validated against every fit.
+func TestPackService_CalculateFit(t *testing.T) {
+	s := NewPackService(&mockPackRepository{findAllSizes: []int{250, 500, 1000}}, WithResultCache(10, time.Minute))
+
+	tests := []struct {
+		name    string
+		fit     Fit
+		want    map[int]int
+		wantErr error
+	}{
+		{name: "Default", fit: Fit{}, want: map[int]int{1000: 1, 250: 1}},
+		{name: "Cached, exact only", fit: Fit{ExactOnly: true}, wantErr: calculator.ErrInfeasible},
+		{name: "Cached, within max excess", fit: Fit{MaxExcess: 50}, want: map[int]int{1000: 1, 250: 1}},
+		{name: "Under ship", fit: Fit{UnderShip: true}, want: map[int]int{1000: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CalculateFit(context.Background(), 1200, tt.fit)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CalculateFit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CalculateFit() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPackService_Rules tests that calculations follow the rules and name the rule making them infeasible.
+func TestPackService_Rules(t *testing.T) {
+	s := NewPackService(&mockPackRepository{findAllSizes: []int{250, 500, 1000}},
+		WithCatalog(inmemory.NewInMemoryCatalogRepo()), WithResultCache(10, time.Minute))
+	ctx := context.Background()
+
+	if got, err := s.Calculate(ctx, 1200); err != nil || !reflect.DeepEqual(got, map[int]int{1000: 1, 250: 1}) {
+		t.Fatalf("Calculate() = %v, %v, want %v", got, err, map[int]int{1000: 1, 250: 1})
+	}
+
+	noLarge := calculator.Rule{Kind: calculator.RuleMaxCount, Size: 1000, Count: 0}
+	if err := s.SetRules(ctx, []calculator.Rule{noLarge}); err != nil {
+		t.Fatalf("SetRules() returned an unexpected error: %v", err)
+	}
+	if got, err := s.Rules(ctx); err != nil || !reflect.DeepEqual(got, []calculator.Rule{noLarge}) {
+		t.Fatalf("Rules() = %v, %v, want %v", got, err, []calculator.Rule{noLarge})
+	}
+
+	// The cached result of the previous rules is not reused
+	if got, err := s.Calculate(ctx, 1200); err != nil || !reflect.DeepEqual(got, map[int]int{500: 2, 250: 1}) {
+		t.Errorf("Calculate() = %v, %v, want %v", got, err, map[int]int{500: 2, 250: 1})
+	}
+
+	required := calculator.Rule{Kind: calculator.RuleRequired, Size: 500}
+	if err := s.SetRules(ctx, []calculator.Rule{noLarge, required}); err != nil {
+		t.Fatalf("SetRules() returned an unexpected error: %v", err)
+	}
+
+	_, err := s.CalculateFit(ctx, 250, Fit{ExactOnly: true})
+	var ruleErr *calculator.RuleError
+	if !errors.As(err, &ruleErr) || !reflect.DeepEqual(ruleErr.Rule, required) {
+		t.Errorf("CalculateFit() error = %v, want the rule %v", err, required)
+	}
+
+	if err := s.SetRules(ctx, []calculator.Rule{{Kind: calculator.RuleRequired}}); !errors.Is(err, calculator.ErrInvalidRule) {
+		t.Errorf("SetRules() error = %v, wantErr %v", err, calculator.ErrInvalidRule)
+	}
+	if err := NewPackService(&mockPackRepository{}).SetRules(ctx, []calculator.Rule{noLarge}); !errors.Is(err, ErrCatalogDisabled) {
+		t.Errorf("SetRules() error = %v, wantErr %v", err, ErrCatalogDisabled)
+	}
+}
+
+// TestPackService_Calculate_Table tests that large amounts are answered
+// from the precomputed table within a small work budget.
+func TestPackService_Calculate_Table(t *testing.T) {
+	mock := &mockPackRepository{findAllSizes: []int{250, 500, 1000}}
+	s := NewPackService(mock, WithWorkBudget(2000))
+
+	got, err := s.Calculate(context.Background(), 1_000_000_001)
+	if err != nil {
+		t.Fatalf("Calculate() returned an unexpected error: %v", err)
+	}
+	if want := map[int]int{1000: 1_000_000, 250: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calculate() got = %v, want %v", got, want)
+	}
+}
+
+// TestPackService_Calculate_TableTooLarge tests that size sets whose table
+// exceeds calculator.MaxTableSize are solved on their own, even without a work budget.
+func TestPackService_Calculate_TableTooLarge(t *testing.T) {
+	mock := &mockPackRepository{findAllSizes: []int{1_000_003, 1_000_033}}
+	s := NewPackService(mock, WithWorkBudget(0))
+
+	got, err := s.Calculate(context.Background(), 1_000_004)
+	if err != nil {
+		t.Fatalf("Calculate() returned an unexpected error: %v", err)
+	}
+	if want := map[int]int{1_000_033: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calculate() got = %v, want %v", got, want)
+	}
+}
+
+// TestPackService_TableFor_Concurrent tests that concurrent calculations of a
+// size set share a single table.
+func TestPackService_TableFor_Concurrent(t *testing.T) {
+	s := NewPackService(&mockPackRepository{})
+	sizes := []int{23, 31, 53}
+
+	tables := make([]*calculator.Table, 8)
+	var wg sync.WaitGroup
+	for i := range tables {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tables[i] = s.tableFor(context.Background(), sizes)
+		}()
+	}
+	wg.Wait()
+
+	for i, table := range tables {
+		if table == nil || table != tables[0] {
+			t.Fatalf("tableFor() #%d = %p, want the shared table %p", i, table, tables[0])
+		}
+	}
+	if len(s.tableBuilds) != 0 {
+		t.Errorf("tableBuilds = %v, want no build in progress", s.tableBuilds)
+	}
+}
+
+// TestPackService_AnalyzePackSizes tests which sizes are analysed.
+func TestPackService_AnalyzePackSizes(t *testing.T) {
+	errTest := errors.New("some error")
+
+	tests := []struct {
+		name    string
+		input   []int
+		mock    storage.PackRepository
+		wantGCD int
+		wantErr bool
+	}{
+		{
+			name:    "Current sizes",
+			input:   nil,
+			mock:    &mockPackRepository{findAllSizes: []int{250, 500}},
+			wantGCD: 250,
+		},
+		{
+			name:    "Proposed sizes",
+			input:   []int{300, 500},
+			mock:    &mockPackRepository{findAllSizes: []int{250, 500}},
+			wantGCD: 100,
+		},
+		{
+			name:    "Repo error on FindAll",
+			input:   nil,
+			mock:    &mockPackRepository{findAllErr: errTest},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewPackService(tt.mock)
+			got, err := s.AnalyzePackSizes(context.Background(), tt.input, 1, 1000)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AnalyzePackSizes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.GCD != tt.wantGCD {
+				t.Errorf("AnalyzePackSizes() GCD = %d, want %d", got.GCD, tt.wantGCD)
+			}
+		})
+	}
+}
+
+// TestPackService_ComparePackSizes tests the what-if comparison.
+func TestPackService_ComparePackSizes(t *testing.T) {
+	s := NewPackService(&mockPackRepository{findAllSizes: []int{250, 500, 1000}})
+	costs := CostModel{ExcessItemCost: 0.1, PackCost: 1}
+
+	// 1 -> 250 | 100, 300 -> 500 | 300, 750 -> 250+500 | 300+300+100+100
+	got, err := s.ComparePackSizes(context.Background(), []int{300, 100}, []int{1, 300, 750}, costs)
+	if err != nil {
+		t.Fatalf("ComparePackSizes() returned an unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(got.Candidate.Sizes, []int{100, 300}) {
+		t.Errorf("candidate sizes = %v, want %v", got.Candidate.Sizes, []int{100, 300})
+	}
+	if got.Current.TotalExcess != 249+200 || got.Current.TotalPacks != 4 {
+		t.Errorf("current metrics = %+v", got.Current.Metrics)
+	}
+	if got.Candidate.TotalExcess != 99+0+50 || got.Candidate.TotalPacks != 1+1+4 {
+		t.Errorf("candidate metrics = %+v", got.Candidate.Metrics)
+	}
+	if got.DeltaExcess != -300 || got.DeltaPacks != 2 {
+		t.Errorf("deltas = %d excess, %d packs, want -300, 2", got.DeltaExcess, got.DeltaPacks)
+	}
+	if math.Abs(got.DeltaCost-(-28)) > 1e-9 {
+		t.Errorf("delta cost = %v, want -28", got.DeltaCost)
+	}
+
+	// Validation
+	if _, err := s.ComparePackSizes(context.Background(), nil, []int{1}, costs); !errors.Is(err, ErrNoPackSizes) {
+		t.Errorf("ComparePackSizes() error = %v, want %v", err, ErrNoPackSizes)
+	}
+	if _, err := s.ComparePackSizes(context.Background(), []int{1}, nil, costs); !errors.Is(err, ErrNoAmounts) {
+		t.Errorf("ComparePackSizes() error = %v, want %v", err, ErrNoAmounts)
+	}
+}
+
+// TestPackService_RecommendPackSizes tests the recommendation orchestration.
+func TestPackService_RecommendPackSizes(t *testing.T) {
+	s := NewPackService(&mockPackRepository{}, WithMaxAmount(1000))
+	costs := CostModel{ExcessItemCost: 1, PackCost: 1}
+
+	got, err := s.RecommendPackSizes(context.Background(), []int{300, 300, 700}, optimizer.Constraints{MaxCount: 2}, costs, 1)
+	if err != nil {
+		t.Fatalf("RecommendPackSizes() returned an unexpected error: %v", err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Sizes, []int{300, 700}) {
+		t.Errorf("RecommendPackSizes() got = %+v, want a single [300 700] set", got)
+	}
+
+	// Validation
+	_, err = s.RecommendPackSizes(context.Background(), []int{1001}, optimizer.Constraints{MaxCount: 2}, costs, 1)
+	if !errors.Is(err, ErrAmountTooLarge) {
+		t.Errorf("RecommendPackSizes() error = %v, want %v", err, ErrAmountTooLarge)
+	}
+}
+
+// TestPackService_PlanShipment tests that the packs of every line are consolidated.
+func TestPackService_PlanShipment(t *testing.T) {
+	s := NewPackService(&mockPackRepository{}, WithMaxAmount(10_000))
+
+	specs := []shipping.PackSpec{{Size: 250, Volume: 10, Weight: 1}, {Size: 500, Volume: 18, Weight: 2}}
+	cartons := []shipping.ContainerType{{Name: "carton", MaxVolume: 30, Cost: 1}}
+
+	tests := []struct {
+		name           string
+		lines          []ShipmentLine
+		wantLines      []map[int]int
+		wantContainers int
+		wantErr        error
+	}{
+		{
+			name:           "Two lines",
+			lines:          []ShipmentLine{{Amount: 750, Packs: specs}, {Amount: 1, Packs: specs}},
+			wantLines:      []map[int]int{{250: 1, 500: 1}, {250: 1}},
+			wantContainers: 2,
+		},
+		{name: "No lines", lines: nil, wantErr: ErrNoAmounts},
+		{name: "No pack sizes", lines: []ShipmentLine{{Amount: 1}}, wantErr: ErrNoPackSizes},
+		{name: "Amount too large", lines: []ShipmentLine{{Amount: 10_001, Packs: specs}}, wantErr: ErrAmountTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.PlanShipment(context.Background(), tt.lines, cartons)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PlanShipment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(got.Lines, tt.wantLines) {
+				t.Errorf("PlanShipment() lines = %v, want %v", got.Lines, tt.wantLines)
+			}
+			if len(got.Containers) != tt.wantContainers {
+				t.Errorf("PlanShipment() containers = %+v, want %d", got.Containers, tt.wantContainers)
+			}
+		})
+	}
+}
+
+// TestPackService_Tenants tests that the packs, limits and history of a tenant
+// never affect another tenant.
+func TestPackService_Tenants(t *testing.T) {
+	repo := storage.NewTenantPackRepo(func(string) storage.PackRepository {
+		return inmemory.NewInMemoryPackRepo()
+	})
+	s := NewPackService(repo,
+		WithHistory(inmemory.NewInMemoryCalculationRepo()),
+		WithResultCache(10, time.Minute),
+		WithTenantMaxAmount("south", 1000))
+
+	north := tenant.NewContext(context.Background(), "north")
+	south := tenant.NewContext(context.Background(), "south")
+
+	if err := s.SetPackSizes(north, []int{23, 31, 53}); err != nil {
+		t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+	}
+
+	got, err := s.Calculate(north, 263)
+	if err != nil {
+		t.Fatalf("Calculate() returned an unexpected error: %v", err)
+	}
+	if want := map[int]int{23: 2, 31: 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calculate() got = %v, want %v", got, want)
+	}
+
+	got, err = s.Calculate(south, 263)
+	if err != nil {
+		t.Fatalf("Calculate() returned an unexpected error: %v", err)
+	}
+	if want := map[int]int{500: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calculate() got = %v, want %v", got, want)
+	}
+
+	// The limit of south does not apply to north
+	if _, err := s.Calculate(south, 5000); !errors.Is(err, ErrAmountTooLarge) {
+		t.Errorf("Calculate() error = %v, wantErr %v", err, ErrAmountTooLarge)
+	}
+	if _, err := s.Calculate(north, 5000); err != nil {
+		t.Errorf("Calculate() returned an unexpected error: %v", err)
+	}
+
+	// Every tenant only sees its own history
+	calcs, total, err := s.ListCalculations(south, storage.CalculationFilter{Tenant: "north"})
+	if err != nil {
+		t.Fatalf("ListCalculations() returned an unexpected error: %v", err)
+	}
+	if total != 1 || calcs[0].Tenant != "south" {
+		t.Errorf("ListCalculations() got %d calculations, first = %+v, want 1 of south", total, calcs[0])
+	}
+}
+
+// TestPackService_Webhooks tests that setting the packs notifies the webhooks of the tenant.
+func TestPackService_Webhooks(t *testing.T) {
+	received := make(chan webhook.Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("failed to decode the event: %v", err)
+		}
+		received <- e
+	}))
+	defer server.Close()
+
+	dispatcher := webhook.NewDispatcher(webhook.WithPrivateDestinations())
+	defer dispatcher.Close()
+
+	hooks := storage.NewTenantWebhookRepo(func(string) storage.WebhookRepository {
+		return inmemory.NewInMemoryWebhookRepo()
+	})
+	bus := events.NewBus()
+	s := NewPackService(&mockPackRepository{}, WithEventBus(bus), WithWebhooks(hooks, dispatcher))
+
+	north := tenant.NewContext(context.Background(), "north")
+	south := tenant.NewContext(context.Background(), "south")
+
+	t.Run("Invalid URL", func(t *testing.T) {
+		for _, u := range []string{"", "ftp://example.com", "/hooks", "http://"} {
+			if _, err := s.AddWebhook(north, u, ""); !errors.Is(err, ErrInvalidWebhook) {
+				t.Errorf("AddWebhook(%q) error = %v, wantErr %v", u, err, ErrInvalidWebhook)
+			}
+		}
+	})
+
+	t.Run("Private destination", func(t *testing.T) {
+		d := webhook.NewDispatcher()
+		defer d.Close()
+
+		s := NewPackService(&mockPackRepository{}, WithWebhooks(inmemory.NewInMemoryWebhookRepo(), d))
+		if _, err := s.AddWebhook(north, server.URL, ""); !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("AddWebhook(%q) error = %v, wantErr %v", server.URL, err, ErrInvalidWebhook)
+		}
+	})
+
+	w, err := s.AddWebhook(north, server.URL, "")
+	if err != nil {
+		t.Fatalf("AddWebhook() returned an unexpected error: %v", err)
+	}
+	if w.ID != 1 || w.Secret == "" {
+		t.Errorf("AddWebhook() got = %+v, want ID 1 with a generated secret", w)
+	}
+
+	// Only the webhooks of the tenant changing its packs are notified
+	if err := s.SetPackSizes(south, []int{100}); err != nil {
+		t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+	}
+	if err := s.SetPackSizes(north, []int{500, 250}); err != nil {
+		t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+	}
+	// Wait for the webhooks to be listed, then delivered
+	bus.Close()
+	dispatcher.Wait()
+
+	if len(received) != 1 {
+		t.Fatalf("wrong number of deliveries. got %d, want 1", len(received))
+	}
+	e := <-received
+	if e.Type != webhook.EventPackSizesChanged || e.Tenant != "north" || e.ID == "" {
+		t.Errorf("wrong event. got %+v", e)
+	}
+	if data, ok := e.Data.(map[string]any); !ok || fmt.Sprint(data["sizes"]) != "[250 500]" {
+		t.Errorf("wrong event data. got %v, want sizes [250 500]", e.Data)
+	}
+
+	if err := s.DeleteWebhook(north, w.ID); err != nil {
+		t.Fatalf("DeleteWebhook() returned an unexpected error: %v", err)
+	}
+	if err := s.DeleteWebhook(north, w.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DeleteWebhook() error = %v, wantErr %v", err, storage.ErrNotFound)
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		s := NewPackService(&mockPackRepository{})
+		if _, err := s.AddWebhook(context.Background(), server.URL, ""); !errors.Is(err, ErrWebhooksDisabled) {
+			t.Errorf("AddWebhook() error = %v, wantErr %v", err, ErrWebhooksDisabled)
+		}
+		if _, err := s.DeadLetters(context.Background()); !errors.Is(err, ErrWebhooksDisabled) {
+			t.Errorf("DeadLetters() error = %v, wantErr %v", err, ErrWebhooksDisabled)
+		}
+	})
+}
+
+// TestPackService_Outbox tests that an outbox relay, not the service, notifies the webhooks.
+func TestPackService_Outbox(t *testing.T) {
+	received := make(chan webhook.Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("failed to decode the event: %v", err)
+		}
+		received <- e
+	}))
+	defer server.Close()
+
+	dispatcher := webhook.NewDispatcher(webhook.WithPrivateDestinations())
+	defer dispatcher.Close()
+
+	bus := events.NewBus()
+	s := NewPackService(&mockPackRepository{}, WithEventBus(bus),
+		WithWebhooks(inmemory.NewInMemoryWebhookRepo(), dispatcher), WithOutbox())
+
+	if _, err := s.AddWebhook(context.Background(), server.URL, ""); err != nil {
+		t.Fatalf("AddWebhook() returned an unexpected error: %v", err)
+	}
+	if err := s.SetPackSizes(context.Background(), []int{250}); err != nil {
+		t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+	}
+	bus.Close()
+	dispatcher.Wait()
+	if len(received) != 0 {
+		t.Fatalf("wrong number of deliveries. got %d, want 0", len(received))
+	}
+
+	// The relay delivers synchronously, with its own event ID
+	changed := events.PackSizesChanged{Tenant: tenant.DefaultID, Sizes: []int{250}}
+	if err := s.NotifyWebhooks(context.Background(), "outbox-1", changed); err != nil {
+		t.Fatalf("NotifyWebhooks() returned an unexpected error: %v", err)
+	}
+	if len(received) != 1 {
+		t.Fatalf("wrong number of deliveries. got %d, want 1", len(received))
+	}
+	if e := <-received; e.ID != "outbox-1" || e.Type != webhook.EventPackSizesChanged {
+		t.Errorf("wrong event. got %+v", e)
+	}
+
+	if err := NewPackService(&mockPackRepository{}).NotifyWebhooks(context.Background(), "outbox-1", changed); !errors.Is(err, ErrWebhooksDisabled) {
+		t.Errorf("NotifyWebhooks() error = %v, wantErr %v", err, ErrWebhooksDisabled)
+	}
+}
+
+// TestPackService_WatchPacks tests that watchers are notified of the pack changes of their tenant only.
+func TestPackService_WatchPacks(t *testing.T) {
+	s := NewPackService(&mockPackRepository{})
+
+	north := tenant.NewContext(context.Background(), "north")
+	south := tenant.NewContext(context.Background(), "south")
+
+	northCh, stopNorth := s.WatchPacks(north)
+	southCh, stopSouth := s.WatchPacks(south)
+	defer stopSouth()
+
+	// Two changes before receiving are reported once
+	for _, sizes := range [][]int{{250}, {250, 500}} {
+		if err := s.SetPackSizes(north, sizes); err != nil {
+			t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+		}
+	}
+
+	select {
+	case <-northCh:
+	default:
+		t.Fatal("WatchPacks() was not notified of a change of its tenant")
+	}
+	select {
+	case <-northCh:
+		t.Error("WatchPacks() was notified twice of coalesced changes")
+	case <-southCh:
+		t.Error("WatchPacks() was notified of a change of another tenant")
+	default:
+	}
+
+	// Stopped watchers are not notified anymore
+	stopNorth()
+	if err := s.SetPackSizes(north, []int{1000}); err != nil {
+		t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+	}
+	select {
+	case <-northCh:
+		t.Error("WatchPacks() was notified after being stopped")
+	default:
+	}
+}
+
+// TestPackService_Events tests the domain events published by the service.
+func TestPackService_Events(t *testing.T) {
+	s := NewPackService(&mockPackRepository{findAllSizes: []int{250, 500}}, WithMaxAmount(1000))
+
+	var got []any
+	events.Subscribe(s.Events(), func(_ context.Context, e events.PackSizesChanged) { got = append(got, e) })
+	events.Subscribe(s.Events(), func(_ context.Context, e events.CalculationPerformed) { got = append(got, e) })
+	events.Subscribe(s.Events(), func(_ context.Context, e events.CalculationFailed) { got = append(got, e) })
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := ContextWithRequester(tenant.NewContext(context.Background(), "north"), "10.0.0.1")
+
+	if err := s.SetPackSizes(ctx, []int{500, 250}); err != nil {
+		t.Fatalf("SetPackSizes() returned an unexpected error: %v", err)
+	}
+	if _, err := s.Calculate(ctx, 251); err != nil {
+		t.Fatalf("Calculate() returned an unexpected error: %v", err)
+	}
+	if _, err := s.Calculate(ctx, 1001); !errors.Is(err, ErrAmountTooLarge) {
+		t.Fatalf("Calculate() error = %v, wantErr %v", err, ErrAmountTooLarge)
+	}
+
+	want := []any{
+		events.PackSizesChanged{Tenant: "north", Packs: storage.NewPacks(500, 250), Sizes: []int{250, 500}, At: now},
+		events.CalculationPerformed{
+			Tenant: "north", Requester: "10.0.0.1", Amount: 251, Packs: map[int]int{500: 1},
+			SizeVersion: sizeSetVersion([]int{250, 500}), At: now,
+		},
+		events.CalculationFailed{Tenant: "north", Requester: "10.0.0.1", Amount: 1001, Err: ErrAmountTooLarge, At: now},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("published events = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,285 @@
+// Package shipping consolidates packs into shipping containers.
+//
+// It is the second packing stage: once the calculator chose the packs of
+// every order line, the packs are placed into cartons or pallets without
+// exceeding their volume and weight capacities.
+package shipping
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// DefaultMaxItems bounds the number of packs planned at once unless overridden.
+const DefaultMaxItems = 10_000
+
+var (
+	// ErrNoContainerTypes is returned when no container type is available.
+	ErrNoContainerTypes = errors.New("no container types provided")
+	// ErrInvalidItem is returned when a pack has a negative volume or weight,
+	// or a container type a negative capacity or cost.
+	ErrInvalidItem = errors.New("invalid pack or container dimensions")
+	// ErrItemTooLarge is returned when a pack fits no container type.
+	ErrItemTooLarge = errors.New("pack does not fit any container type")
+	// ErrTooManyItems is returned when the plan holds more packs than allowed by WithMaxItems.
+	ErrTooManyItems = errors.New("too many packs to plan")
+)
+
+// PackSpec describes the physical dimensions of a pack size.
+type PackSpec struct {
+	Size   int
+	Volume float64
+	Weight float64
+}
+
+// Line is an order line to ship: the packs chosen for it and their dimensions.
+type Line struct {
+	Packs map[int]int
+	// Specs describe the pack sizes of the line. Sizes without a spec have no volume nor weight.
+	Specs []PackSpec
+}
+
+// item is a single physical pack to ship.
+type item struct {
+	// line is the index of the order line the pack belongs to.
+	line   int
+	size   int
+	volume float64
+	weight float64
+}
+
+// ContainerType is a kind of carton or pallet. A zero capacity is unlimited.
+type ContainerType struct {
+	Name      string
+	MaxVolume float64
+	MaxWeight float64
+	// Cost is the price of shipping one container of this type.
+	Cost float64
+}
+
+// fits reports whether the type can hold the given volume and weight.
+func (t ContainerType) fits(volume, weight float64) bool {
+	return (t.MaxVolume == 0 || volume <= t.MaxVolume) && (t.MaxWeight == 0 || weight <= t.MaxWeight)
+}
+
+// Content is the number of packs of a size of an order line in a container.
+type Content struct {
+	Line  int
+	Size  int
+	Count int
+}
+
+// Container is a filled container of the plan.
+type Container struct {
+	Type   string
+	Volume float64
+	Weight float64
+	// Contents are sorted by line, then by descending size.
+	Contents []Content
+}
+
+// Plan is the assignment of every pack to a container.
+type Plan struct {
+	Containers []Container
+	TotalCost  float64
+}
+
+// options holds the optional planning settings.
+type options struct {
+	maxItems int
+}
+
+// Option configures an optional planning setting.
+type Option func(*options)
+
+// WithMaxItems bounds the number of packs planned at once.
+// A zero or negative value means unlimited.
+func WithMaxItems(n int) Option {
+	return func(o *options) {
+		o.maxItems = n
+	}
+}
+
+// Pack places the packs of all lines into containers with first-fit decreasing:
+// the packs are sorted by decreasing volume, then weight, and each is put into
+// the first open container with room left, or into a new container of the
+// cheapest type that can hold it. Every container is finally downsized to the
+// cheapest type still holding its contents.
+func Pack(ctx context.Context, lines []Line, types []ContainerType, opts ...Option) (Plan, error) {
+	o := options{maxItems: DefaultMaxItems}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if len(types) == 0 {
+		return Plan{}, ErrNoContainerTypes
+	}
+	for _, t := range types {
+		if t.MaxVolume < 0 || t.MaxWeight < 0 || t.Cost < 0 {
+			return Plan{}, ErrInvalidItem
+		}
+	}
+
+	// Cheapest types first, the smallest one on equal costs
+	byCost := make([]ContainerType, len(types))
+	copy(byCost, types)
+	sort.SliceStable(byCost, func(i, j int) bool {
+		if byCost[i].Cost != byCost[j].Cost {
+			return byCost[i].Cost < byCost[j].Cost
+		}
+		return capacityLess(byCost[i], byCost[j])
+	})
+
+	items, err := expand(lines, o.maxItems)
+	if err != nil {
+		return Plan{}, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].volume != items[j].volume {
+			return items[i].volume > items[j].volume
+		}
+		return items[i].weight > items[j].weight
+	})
+
+	var bins []*bin
+	for i, it := range items {
+		// Every item scans the open containers, so check for cancellation regularly
+		if i%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return Plan{}, err
+			}
+		}
+
+		placed := false
+		for _, b := range bins {
+			if b.typ.fits(b.volume+it.volume, b.weight+it.weight) {
+				b.add(it)
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+
+		t, ok := cheapestFitting(byCost, it.volume, it.weight)
+		if !ok {
+			return Plan{}, ErrItemTooLarge
+		}
+
+		b := &bin{typ: t}
+		b.add(it)
+		bins = append(bins, b)
+	}
+
+	plan := Plan{Containers: make([]Container, 0, len(bins))}
+	for _, b := range bins {
+		// Downsize to the cheapest type holding the contents, there is at least the current one
+		b.typ, _ = cheapestFitting(byCost, b.volume, b.weight)
+
+		plan.TotalCost += b.typ.Cost
+		plan.Containers = append(plan.Containers, b.container())
+	}
+
+	return plan, nil
+}
+
+// expand returns one item per pack of the lines, in a deterministic order.
+// The number of packs is checked against maxItems before allocating them.
+func expand(lines []Line, maxItems int) ([]item, error) {
+	total := 0
+	for _, l := range lines {
+		for _, count := range l.Packs {
+			if count < 0 {
+				return nil, ErrInvalidItem
+			}
+			total += count
+			if maxItems > 0 && total > maxItems {
+				return nil, ErrTooManyItems
+			}
+		}
+	}
+
+	items := make([]item, 0, total)
+	for i, l := range lines {
+		specs := make(map[int]PackSpec, len(l.Specs))
+		for _, spec := range l.Specs {
+			if spec.Volume < 0 || spec.Weight < 0 {
+				return nil, ErrInvalidItem
+			}
+			specs[spec.Size] = spec
+		}
+
+		sizes := make([]int, 0, len(l.Packs))
+		for size := range l.Packs {
+			sizes = append(sizes, size)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+
+		for _, size := range sizes {
+			spec := specs[size]
+			for n := 0; n < l.Packs[size]; n++ {
+				items = append(items, item{line: i, size: size, volume: spec.Volume, weight: spec.Weight})
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// cheapestFitting returns the first of the types sorted by cost able to hold the volume and weight.
+func cheapestFitting(byCost []ContainerType, volume, weight float64) (ContainerType, bool) {
+	for _, t := range byCost {
+		if t.fits(volume, weight) {
+			return t, true
+		}
+	}
+
+	return ContainerType{}, false
+}
+
+// capacityLess orders container types by volume, then weight, unlimited capacities last.
+func capacityLess(a, b ContainerType) bool {
+	if a.MaxVolume != b.MaxVolume {
+		return b.MaxVolume == 0 || (a.MaxVolume != 0 && a.MaxVolume < b.MaxVolume)
+	}
+	if a.MaxWeight == b.MaxWeight {
+		return false
+	}
+	return b.MaxWeight == 0 || (a.MaxWeight != 0 && a.MaxWeight < b.MaxWeight)
+}
+
+// bin is a container being filled.
+type bin struct {
+	typ    ContainerType
+	volume float64
+	weight float64
+	counts map[[2]int]int
+}
+
+func (b *bin) add(it item) {
+	if b.counts == nil {
+		b.counts = make(map[[2]int]int)
+	}
+
+	b.volume += it.volume
+	b.weight += it.weight
+	b.counts[[2]int{it.line, it.size}]++
+}
+
+func (b *bin) container() Container {
+	c := Container{Type: b.typ.Name, Volume: b.volume, Weight: b.weight}
+	for key, count := range b.counts {
+		c.Contents = append(c.Contents, Content{Line: key[0], Size: key[1], Count: count})
+	}
+
+	sort.Slice(c.Contents, func(i, j int) bool {
+		if c.Contents[i].Line != c.Contents[j].Line {
+			return c.Contents[i].Line < c.Contents[j].Line
+		}
+		return c.Contents[i].Size > c.Contents[j].Size
+	})
+
+	return c
+}
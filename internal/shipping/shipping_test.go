@@ -0,0 +1,134 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testTypes = []ContainerType{
+	{Name: "pallet", MaxVolume: 1000, MaxWeight: 500, Cost: 20},
+	{Name: "carton", MaxVolume: 100, MaxWeight: 20, Cost: 2},
+}
+
+func TestPack(t *testing.T) {
+	specs := []PackSpec{
+		{Size: 1000, Volume: 60, Weight: 10},
+		{Size: 500, Volume: 30, Weight: 5},
+		{Size: 250, Volume: 15, Weight: 2.5},
+	}
+
+	tests := []struct {
+		name     string
+		lines    []Line
+		want     []Container
+		wantCost float64
+	}{
+		{
+			name:  "Single carton",
+			lines: []Line{{Packs: map[int]int{1000: 1, 250: 1}, Specs: specs}},
+			want: []Container{
+				{Type: "carton", Volume: 75, Weight: 12.5, Contents: []Content{{Line: 0, Size: 1000, Count: 1}, {Line: 0, Size: 250, Count: 1}}},
+			},
+			wantCost: 2,
+		},
+		{
+			name: "Lines share cartons, largest packs first",
+			lines: []Line{
+				{Packs: map[int]int{1000: 2}, Specs: specs},
+				{Packs: map[int]int{500: 1, 250: 1}, Specs: specs},
+			},
+			want: []Container{
+				{Type: "carton", Volume: 90, Weight: 15, Contents: []Content{{Line: 0, Size: 1000, Count: 1}, {Line: 1, Size: 500, Count: 1}}},
+				{Type: "carton", Volume: 75, Weight: 12.5, Contents: []Content{{Line: 0, Size: 1000, Count: 1}, {Line: 1, Size: 250, Count: 1}}},
+			},
+			wantCost: 4,
+		},
+		{
+			name:  "Weight limit opens a new carton",
+			lines: []Line{{Packs: map[int]int{1: 3}, Specs: []PackSpec{{Size: 1, Volume: 10, Weight: 8}}}},
+			want: []Container{
+				{Type: "carton", Volume: 20, Weight: 16, Contents: []Content{{Line: 0, Size: 1, Count: 2}}},
+				{Type: "carton", Volume: 10, Weight: 8, Contents: []Content{{Line: 0, Size: 1, Count: 1}}},
+			},
+			wantCost: 4,
+		},
+		{
+			name:  "Oversized pack needs a pallet",
+			lines: []Line{{Packs: map[int]int{5000: 1}, Specs: []PackSpec{{Size: 5000, Volume: 300, Weight: 50}}}},
+			want: []Container{
+				{Type: "pallet", Volume: 300, Weight: 50, Contents: []Content{{Line: 0, Size: 5000, Count: 1}}},
+			},
+			wantCost: 20,
+		},
+		{
+			name:     "Nothing to ship",
+			lines:    []Line{{Packs: map[int]int{}}},
+			want:     []Container{},
+			wantCost: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Pack(context.Background(), tt.lines, testTypes)
+			if err != nil {
+				t.Fatalf("Pack() returned an unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.Containers, tt.want) {
+				t.Errorf("Pack() containers = %+v, want %+v", got.Containers, tt.want)
+			}
+			if got.TotalCost != tt.wantCost {
+				t.Errorf("Pack() cost = %v, want %v", got.TotalCost, tt.wantCost)
+			}
+		})
+	}
+}
+
+func TestPack_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []Line
+		types   []ContainerType
+		opts    []Option
+		wantErr error
+	}{
+		{name: "No container types", lines: []Line{}, types: nil, wantErr: ErrNoContainerTypes},
+		{
+			name:    "Too large",
+			lines:   []Line{{Packs: map[int]int{1: 1}, Specs: []PackSpec{{Size: 1, Volume: 2000}}}},
+			types:   testTypes,
+			wantErr: ErrItemTooLarge,
+		},
+		{
+			name:    "Negative weight",
+			lines:   []Line{{Packs: map[int]int{1: 1}, Specs: []PackSpec{{Size: 1, Weight: -1}}}},
+			types:   testTypes,
+			wantErr: ErrInvalidItem,
+		},
+		{
+			name:    "Too many packs",
+			lines:   []Line{{Packs: map[int]int{1: 1_000_000_000}}},
+			types:   testTypes,
+			opts:    []Option{WithMaxItems(100)},
+			wantErr: ErrTooManyItems,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Pack(context.Background(), tt.lines, tt.types, tt.opts...); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Pack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPack_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Pack(ctx, []Line{{Packs: map[int]int{1: 1}}}, testTypes)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Pack() error = %v, wantErr %v", err, context.Canceled)
+	}
+}
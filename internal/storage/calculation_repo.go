@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Calculation is a single recorded calculation.
+type Calculation struct {
+	ID        int64
+	Timestamp time.Time
+	Amount    int
+	Packs     map[int]int
+	// TotalItems is the number of items in all packs, Excess the items above the amount.
+	TotalItems int
+	Excess     int
+	// SizeVersion identifies the pack size set the calculation was made with.
+	SizeVersion string
+	// Requester identifies the client that requested the calculation.
+	Requester string
+	// Tenant is the business unit the calculation was made for.
+	Tenant string
+}
+
+// CalculationFilter selects recorded calculations. Zero fields do not filter.
+type CalculationFilter struct {
+	// From and To bound the timestamp, From inclusive and To exclusive.
+	From time.Time
+	To   time.Time
+
+	Tenant    string
+	Requester string
+	MinAmount int
+	MaxAmount int
+
+	// Limit and Offset paginate the results of Find, newest first.
+	Limit  int
+	Offset int
+}
+
+// DailyCalculationStats aggregates the calculations of a single UTC day.
+type DailyCalculationStats struct {
+	// Day is formatted as YYYY-MM-DD.
+	Day         string
+	Count       int
+	TotalExcess int
+	// MostUsedSize is the pack size with the most packs shipped that day,
+	// the smallest one on ties, and MostUsedSizePacks its number of packs.
+	MostUsedSize      int
+	MostUsedSizePacks int
+}
+
+// CalculationStats aggregates all calculations matching a filter.
+type CalculationStats struct {
+	Count       int
+	TotalExcess int
+	// Daily holds one entry per day with calculations, sorted by day.
+	Daily []DailyCalculationStats
+}
+
+// CalculationRepository defines the contract for the calculation history storage.
+type CalculationRepository interface {
+	// Save records a calculation, assigning its ID.
+	Save(ctx context.Context, c *Calculation) error
+
+	// Find returns a page of the calculations matching the filter, newest first,
+	// together with the total number of matching calculations.
+	Find(ctx context.Context, f CalculationFilter) ([]Calculation, int, error)
+
+	// Stats aggregates all calculations matching the filter, ignoring the pagination.
+	Stats(ctx context.Context, f CalculationFilter) (CalculationStats, error)
+}
+
+// Matches reports whether the calculation satisfies the filter, ignoring the pagination.
+func (f CalculationFilter) Matches(c Calculation) bool {
+	switch {
+	case !f.From.IsZero() && c.Timestamp.Before(f.From):
+		return false
+	case !f.To.IsZero() && !c.Timestamp.Before(f.To):
+		return false
+	case f.Tenant != "" && c.Tenant != f.Tenant:
+		return false
+	case f.Requester != "" && c.Requester != f.Requester:
+		return false
+	case f.MinAmount > 0 && c.Amount < f.MinAmount:
+		return false
+	case f.MaxAmount > 0 && c.Amount > f.MaxAmount:
+		return false
+	}
+
+	return true
+}
+
+// MostUsedSize returns the size with the most packs, the smallest one on ties.
+func MostUsedSize(packs map[int]int) (size, count int) {
+	for s, c := range packs {
+		if c > count || (c == count && s < size) {
+			size, count = s, c
+		}
+	}
+
+	return size, count
+}
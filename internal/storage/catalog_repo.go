@@ -0,0 +1,32 @@
+package storage
+
+import "context"
+
+// Catalog holds the settings shared by all pack sizes.
+type Catalog struct {
+	// Unit is the symbol of the unit the pack sizes are measured in, empty for pieces.
+	Unit string
+
+	// Rules constrain the packs of every calculation, in the order they were set.
+	Rules []Rule
+}
+
+// Rule is a constraint on the packs of a calculation, such as
+// "at most 4 packs of 250" or "packs of 5000 only for amounts of at least 10000".
+// Which fields apply depends on the kind, see calculator.Rule.
+type Rule struct {
+	Kind   string
+	Size   int
+	Sizes  []int
+	Count  int
+	Amount int
+}
+
+// CatalogRepository defines the contract for the catalog settings storage.
+type CatalogRepository interface {
+	// Get returns the current catalog.
+	Get(ctx context.Context) (Catalog, error)
+
+	// Save replaces the catalog.
+	Save(ctx context.Context, c Catalog) error
+}
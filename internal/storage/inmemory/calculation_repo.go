@@ -0,0 +1,142 @@
+package inmemory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// InMemoryCalculationRepo implements the storage.CalculationRepository interface
+// using a thread-safe in-memory slice.
+type InMemoryCalculationRepo struct {
+	mu           sync.RWMutex
+	calculations []storage.Calculation
+	nextID       int64
+}
+
+// NewInMemoryCalculationRepo creates a new empty in-memory calculation history.
+func NewInMemoryCalculationRepo() *InMemoryCalculationRepo {
+	return &InMemoryCalculationRepo{
+		nextID: 1,
+	}
+}
+
+// Save records a copy of the calculation, assigning its ID.
+func (r *InMemoryCalculationRepo) Save(ctx context.Context, c *storage.Calculation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c.ID = r.nextID
+	r.nextID++
+
+	r.calculations = append(r.calculations, copyCalculation(*c))
+
+	return nil
+}
+
+// Find returns a page of copies of the matching calculations, newest first.
+func (r *InMemoryCalculationRepo) Find(ctx context.Context, f storage.CalculationFilter) ([]storage.Calculation, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matching := r.matching(f)
+
+	// Newest first, the most recent ID first on equal timestamps
+	sort.SliceStable(matching, func(i, j int) bool {
+		if !matching[i].Timestamp.Equal(matching[j].Timestamp) {
+			return matching[i].Timestamp.After(matching[j].Timestamp)
+		}
+		return matching[i].ID > matching[j].ID
+	})
+
+	total := len(matching)
+
+	start := min(max(f.Offset, 0), total)
+	end := total
+	if f.Limit > 0 {
+		end = min(start+f.Limit, total)
+	}
+
+	out := make([]storage.Calculation, 0, end-start)
+	for _, c := range matching[start:end] {
+		out = append(out, copyCalculation(c))
+	}
+
+	return out, total, nil
+}
+
+// Stats aggregates all matching calculations.
+func (r *InMemoryCalculationRepo) Stats(ctx context.Context, f storage.CalculationFilter) (storage.CalculationStats, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.CalculationStats{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := storage.CalculationStats{Daily: []storage.DailyCalculationStats{}}
+	days := make(map[string]*storage.DailyCalculationStats)
+	packsPerDay := make(map[string]map[int]int)
+
+	for _, c := range r.matching(f) {
+		stats.Count++
+		stats.TotalExcess += c.Excess
+
+		day := c.Timestamp.UTC().Format("2006-01-02")
+		d, ok := days[day]
+		if !ok {
+			d = &storage.DailyCalculationStats{Day: day}
+			days[day] = d
+			packsPerDay[day] = make(map[int]int)
+		}
+		d.Count++
+		d.TotalExcess += c.Excess
+
+		for size, count := range c.Packs {
+			packsPerDay[day][size] += count
+		}
+	}
+
+	for day, d := range days {
+		d.MostUsedSize, d.MostUsedSizePacks = storage.MostUsedSize(packsPerDay[day])
+		stats.Daily = append(stats.Daily, *d)
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Day < stats.Daily[j].Day
+	})
+
+	return stats, nil
+}
+
+// matching returns the calculations matching the filter. The caller must hold the lock.
+func (r *InMemoryCalculationRepo) matching(f storage.CalculationFilter) []storage.Calculation {
+	out := make([]storage.Calculation, 0, len(r.calculations))
+	for _, c := range r.calculations {
+		if f.Matches(c) {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// copyCalculation returns a copy of the calculation not sharing its packs map.
+func copyCalculation(c storage.Calculation) storage.Calculation {
+	packs := make(map[int]int, len(c.Packs))
+	for size, count := range c.Packs {
+		packs[size] = count
+	}
+	c.Packs = packs
+
+	return c
+}
@@ -0,0 +1,110 @@
+package inmemory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// seedCalculations saves a small history spread over two days.
+func seedCalculations(t *testing.T, repo storage.CalculationRepository) time.Time {
+	t.Helper()
+
+	day1 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+
+	calculations := []storage.Calculation{
+		{Timestamp: day1, Amount: 1, Packs: map[int]int{250: 1}, TotalItems: 250, Excess: 249, Requester: "a", Tenant: "north"},
+		{Timestamp: day1.Add(time.Hour), Amount: 750, Packs: map[int]int{250: 1, 500: 1}, TotalItems: 750, Requester: "b", Tenant: "north"},
+		{Timestamp: day2, Amount: 1200, Packs: map[int]int{1000: 1, 250: 1}, TotalItems: 1250, Excess: 50, Requester: "a", Tenant: "south"},
+	}
+	for i := range calculations {
+		if err := repo.Save(context.Background(), &calculations[i]); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+		if calculations[i].ID != int64(i+1) {
+			t.Errorf("Save() assigned ID %d, want %d", calculations[i].ID, i+1)
+		}
+	}
+
+	return day1
+}
+
+// TestInMemoryCalculationRepo_Find tests filtering, ordering and pagination.
+func TestInMemoryCalculationRepo_Find(t *testing.T) {
+	repo := NewInMemoryCalculationRepo()
+	day1 := seedCalculations(t, repo)
+
+	tests := []struct {
+		name      string
+		filter    storage.CalculationFilter
+		wantIDs   []int64
+		wantTotal int
+	}{
+		{name: "All, newest first", filter: storage.CalculationFilter{}, wantIDs: []int64{3, 2, 1}, wantTotal: 3},
+		{name: "Paginated", filter: storage.CalculationFilter{Limit: 1, Offset: 1}, wantIDs: []int64{2}, wantTotal: 3},
+		{name: "Offset past the end", filter: storage.CalculationFilter{Offset: 10}, wantIDs: []int64{}, wantTotal: 3},
+		{name: "By tenant", filter: storage.CalculationFilter{Tenant: "north"}, wantIDs: []int64{2, 1}, wantTotal: 2},
+		{name: "By requester", filter: storage.CalculationFilter{Requester: "a"}, wantIDs: []int64{3, 1}, wantTotal: 2},
+		{name: "By amount", filter: storage.CalculationFilter{MinAmount: 2, MaxAmount: 1000}, wantIDs: []int64{2}, wantTotal: 1},
+		{
+			name:      "By time range",
+			filter:    storage.CalculationFilter{From: day1.Add(time.Hour), To: day1.Add(24 * time.Hour)},
+			wantIDs:   []int64{2},
+			wantTotal: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := repo.Find(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("Find() returned an unexpected error: %v", err)
+			}
+
+			ids := make([]int64, 0, len(got))
+			for _, c := range got {
+				ids = append(ids, c.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Find() IDs = %v, want %v", ids, tt.wantIDs)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("Find() total = %d, want %d", total, tt.wantTotal)
+			}
+		})
+	}
+
+	// Returned calculations are copies
+	got, _, _ := repo.Find(context.Background(), storage.CalculationFilter{})
+	got[0].Packs[1000] = 99
+	got, _, _ = repo.Find(context.Background(), storage.CalculationFilter{})
+	if got[0].Packs[1000] != 1 {
+		t.Error("Find() result shares its packs with the repository")
+	}
+}
+
+// TestInMemoryCalculationRepo_Stats tests the aggregates.
+func TestInMemoryCalculationRepo_Stats(t *testing.T) {
+	repo := NewInMemoryCalculationRepo()
+	seedCalculations(t, repo)
+
+	got, err := repo.Stats(context.Background(), storage.CalculationFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("Stats() returned an unexpected error: %v", err)
+	}
+
+	want := storage.CalculationStats{
+		Count:       3,
+		TotalExcess: 299,
+		Daily: []storage.DailyCalculationStats{
+			{Day: "2025-03-01", Count: 2, TotalExcess: 249, MostUsedSize: 250, MostUsedSizePacks: 2},
+			{Day: "2025-03-02", Count: 1, TotalExcess: 50, MostUsedSize: 250, MostUsedSizePacks: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// InMemoryCatalogRepo implements the storage.CatalogRepository interface
+// using a thread-safe in-memory value.
+type InMemoryCatalogRepo struct {
+	mu      sync.RWMutex
+	catalog storage.Catalog
+}
+
+// NewInMemoryCatalogRepo creates a new catalog counting pieces.
+func NewInMemoryCatalogRepo() *InMemoryCatalogRepo {
+	return &InMemoryCatalogRepo{}
+}
+
+// Get returns the current catalog.
+func (r *InMemoryCatalogRepo) Get(ctx context.Context) (storage.Catalog, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.Catalog{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return copyCatalog(r.catalog), nil
+}
+
+// Save replaces the catalog.
+func (r *InMemoryCatalogRepo) Save(ctx context.Context, c storage.Catalog) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.catalog = copyCatalog(c)
+
+	return nil
+}
+
+// copyCatalog returns a deep copy of c, so callers cannot modify the stored rules.
+func copyCatalog(c storage.Catalog) storage.Catalog {
+	if c.Rules == nil {
+		return c
+	}
+
+	rules := make([]storage.Rule, len(c.Rules))
+	for i, rule := range c.Rules {
+		rule.Sizes = append([]int(nil), rule.Sizes...)
+		rules[i] = rule
+	}
+	c.Rules = rules
+
+	return c
+}
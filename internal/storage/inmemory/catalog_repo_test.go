@@ -0,0 +1,55 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+)
+
+// TestInMemoryCatalogRepo_Shared runs the repository tests shared by the storage backends.
+func TestInMemoryCatalogRepo_Shared(t *testing.T) {
+	storagetest.TestCatalogRepository(t, func(*testing.T) storage.CatalogRepository {
+		return NewInMemoryCatalogRepo()
+	})
+}
+
+// TestInMemoryCatalogRepo tests the default catalog and replacing it.
+func TestInMemoryCatalogRepo(t *testing.T) {
+	repo := NewInMemoryCatalogRepo()
+
+	got, err := repo.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get() returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, storage.Catalog{}) {
+		t.Errorf("Get() got = %+v, want the empty catalog", got)
+	}
+
+	if err := repo.Save(context.Background(), storage.Catalog{Unit: "kg"}); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	if got, _ := repo.Get(context.Background()); got.Unit != "kg" {
+		t.Errorf("Get() unit = %q, want %q", got.Unit, "kg")
+	}
+
+	// Stored rules are not shared with the caller
+	rules := []storage.Rule{{Kind: "forbidden", Sizes: []int{250, 500}}}
+	if err := repo.Save(context.Background(), storage.Catalog{Rules: rules}); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	rules[0].Sizes[0] = 1000
+	got, _ = repo.Get(context.Background())
+	if want := []storage.Rule{{Kind: "forbidden", Sizes: []int{250, 500}}}; !reflect.DeepEqual(got.Rules, want) {
+		t.Errorf("Get() rules = %+v, want %+v", got.Rules, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := repo.Save(ctx, storage.Catalog{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Save() error = %v, wantErr %v", err, context.Canceled)
+	}
+}
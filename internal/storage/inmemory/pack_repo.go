@@ -1,52 +1,65 @@
 package inmemory
 
 import (
+	"context"
 	"sort"
 	"sync"
+
+	"denisgodoroja/retask/internal/storage"
 )
 
 // InMemoryPackRepo implements the storage.PackRepository interface using a thread-safe in-memory slice.
 type InMemoryPackRepo struct {
-	// mu is a Read-Write mutex to protect the sizes slice from concurrent access.
+	// mu is a Read-Write mutex to protect the packs slice from concurrent access.
 	mu    sync.RWMutex
-	sizes []int
+	packs []storage.Pack
 }
 
 // NewInMemoryPackRepo creates a new in-memory repository.
 func NewInMemoryPackRepo() *InMemoryPackRepo {
 	return &InMemoryPackRepo{
 		// Start with a default, sorted list
-		sizes: []int{250, 500, 1000, 2000, 5000},
+		packs: storage.NewPacks(storage.DefaultPackSizes...),
 	}
 }
 
-// FindAll returns a copy of all current pack sizes.
-func (r *InMemoryPackRepo) FindAll() ([]int, error) {
+// FindAll returns a copy of all current packs.
+func (r *InMemoryPackRepo) FindAll(ctx context.Context) ([]storage.Pack, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Read Lock allows multiple concurrent readers.
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	// Return a copy to prevent the caller from modifying the original slice.
-	out := make([]int, len(r.sizes))
-	copy(out, r.sizes)
+	out := make([]storage.Pack, len(r.packs))
+	copy(out, r.packs)
 
 	return out, nil
 }
 
-// ReplaceAll replaces all pack sizes with a new list sorted ascending.
-func (r *InMemoryPackRepo) ReplaceAll(sizes []int) error {
+// ReplaceAll replaces all packs with a new list sorted ascending by size.
+func (r *InMemoryPackRepo) ReplaceAll(ctx context.Context, packs []storage.Pack) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// Write Lock blocks all other readers and writers.
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	// Store a copy of the incoming slice
-	newSizes := make([]int, len(sizes))
-	copy(newSizes, sizes)
+	newPacks := make([]storage.Pack, len(packs))
+	copy(newPacks, packs)
 
-	// Sort the sizes to ensure consistency
-	sort.Ints(newSizes)
+	// Sort the packs to ensure consistency
+	sort.SliceStable(newPacks, func(i, j int) bool {
+		return newPacks[i].Size < newPacks[j].Size
+	})
 
-	r.sizes = newSizes
+	r.packs = newPacks
 
 	return nil
 }
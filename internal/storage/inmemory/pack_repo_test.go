@@ -1,84 +1,29 @@
 package inmemory
 
 import (
-	"reflect"
+	"path/filepath"
 	"testing"
-)
-
-// TestInMemoryPackRepo_FindAll tests the default state and copy behavior.
-func TestInMemoryPackRepo_FindAll(t *testing.T) {
-	repo := NewInMemoryPackRepo()
 
-	// 1. Test default values
-	sizes, err := repo.FindAll()
-	if err != nil {
-		t.Fatalf("FindAll() returned an unexpected error: %v", err)
-	}
-	expected := []int{250, 500, 1000, 2000, 5000}
-	if !reflect.DeepEqual(sizes, expected) {
-		t.Errorf("FindAll() got = %v, want %v", sizes, expected)
-	}
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+)
 
-	// 2. Test that a copy is returned
-	sizes[0] = 9999
-	sizes, err = repo.FindAll()
-	if err != nil {
-		t.Fatalf("FindAll() returned an unexpected error: %v", err)
-	}
-	// The internal slice should be unchanged
-	if !reflect.DeepEqual(sizes, expected) {
-		t.Errorf("FindAll() was modified by external slice change. got = %v, want %v", sizes, expected)
-	}
+// TestInMemoryPackRepo runs the repository tests shared by the storage backends.
+func TestInMemoryPackRepo(t *testing.T) {
+	storagetest.TestPackRepository(t, func(*testing.T) storage.PackRepository {
+		return NewInMemoryPackRepo()
+	})
 }
 
-// TestInMemoryPackRepo_ReplaceAll tests replacing and sorting.
-func TestInMemoryPackRepo_ReplaceAll(t *testing.T) {
-	repo := NewInMemoryPackRepo()
-
-	tests := []struct {
-		name    string
-		input   []int
-		want    []int
-		wantErr bool
-	}{
-		{
-			name:    "Replace with new sorted list",
-			input:   []int{10, 20, 30},
-			want:    []int{10, 20, 30},
-			wantErr: false,
-		},
-		{
-			name:    "Replace with unsorted list",
-			input:   []int{20, 50, 10},
-			want:    []int{10, 20, 50}, // Should be sorted
-			wantErr: false,
-		},
-		{
-			name:    "Replace with empty list",
-			input:   []int{},
-			want:    []int{},
-			wantErr: false,
-		},
-		{
-			name:    "Replace with nil list",
-			input:   nil,
-			want:    []int{},
-			wantErr: false,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := repo.ReplaceAll(tt.input); (err != nil) != tt.wantErr {
-				t.Errorf("ReplaceAll() error = %v, wantErr %v", err, tt.wantErr)
-			}
+// TestSnapshotPackRepo runs the repository tests shared by the storage backends.
+func TestSnapshotPackRepo(t *testing.T) {
+	storagetest.TestPackRepository(t, func(t *testing.T) storage.PackRepository {
+		repo, err := NewSnapshotPackRepo(filepath.Join(t.TempDir(), "packs.json"))
+		if err != nil {
+			t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
 
-			got, err := repo.FindAll()
-			if err != nil {
-				t.Fatalf("FindAll() returned an unexpected error: %v", err)
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("FindAll() got = %v, want %v", got, tt.want)
-			}
-		})
-	}
+		return repo
+	})
 }
@@ -0,0 +1,89 @@
+package inmemory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// InMemoryScheduleRepo implements the storage.ScheduleRepository interface
+// using a thread-safe in-memory slice.
+type InMemoryScheduleRepo struct {
+	mu      sync.RWMutex
+	changes []storage.ScheduledChange
+	lastID  int64
+}
+
+// NewInMemoryScheduleRepo creates a new empty schedule.
+func NewInMemoryScheduleRepo() *InMemoryScheduleRepo {
+	return &InMemoryScheduleRepo{}
+}
+
+// Add stores a copy of the change and sets its ID.
+func (r *InMemoryScheduleRepo) Add(ctx context.Context, c *storage.ScheduledChange) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	c.ID = r.lastID
+
+	stored := *c
+	stored.Packs = make([]storage.Pack, len(c.Packs))
+	copy(stored.Packs, c.Packs)
+	sort.SliceStable(stored.Packs, func(i, j int) bool {
+		return stored.Packs[i].Size < stored.Packs[j].Size
+	})
+
+	r.changes = append(r.changes, stored)
+	sort.SliceStable(r.changes, func(i, j int) bool {
+		if !r.changes[i].EffectiveAt.Equal(r.changes[j].EffectiveAt) {
+			return r.changes[i].EffectiveAt.Before(r.changes[j].EffectiveAt)
+		}
+		return r.changes[i].ID < r.changes[j].ID
+	})
+
+	return nil
+}
+
+// List returns a copy of all changes, sorted by EffectiveAt then ID.
+func (r *InMemoryScheduleRepo) List(ctx context.Context) ([]storage.ScheduledChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]storage.ScheduledChange, len(r.changes))
+	for i, c := range r.changes {
+		c.Packs = append([]storage.Pack(nil), c.Packs...)
+		out[i] = c
+	}
+
+	return out, nil
+}
+
+// Delete removes the change with the given ID.
+func (r *InMemoryScheduleRepo) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.changes {
+		if c.ID == id {
+			r.changes = append(r.changes[:i], r.changes[i+1:]...)
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
@@ -0,0 +1,65 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+)
+
+// TestInMemoryScheduleRepo_Shared runs the repository tests shared by the storage backends.
+func TestInMemoryScheduleRepo_Shared(t *testing.T) {
+	storagetest.TestScheduleRepository(t, func(*testing.T) storage.ScheduleRepository {
+		return NewInMemoryScheduleRepo()
+	})
+}
+
+// TestInMemoryScheduleRepo tests adding, listing in effective order and deleting changes.
+func TestInMemoryScheduleRepo(t *testing.T) {
+	repo := NewInMemoryScheduleRepo()
+	ctx := context.Background()
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	later := &storage.ScheduledChange{EffectiveAt: day.AddDate(0, 0, 2), Packs: storage.NewPacks(500, 250)}
+	sooner := &storage.ScheduledChange{EffectiveAt: day, Packs: storage.NewPacks(1000)}
+	for _, c := range []*storage.ScheduledChange{later, sooner} {
+		if err := repo.Add(ctx, c); err != nil {
+			t.Fatalf("Add() returned an unexpected error: %v", err)
+		}
+	}
+	if later.ID != 1 || sooner.ID != 2 {
+		t.Errorf("Add() IDs = %d, %d, want 1, 2", later.ID, sooner.ID)
+	}
+
+	got, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	want := []storage.ScheduledChange{
+		{ID: 2, EffectiveAt: day, Packs: storage.NewPacks(1000)},
+		{ID: 1, EffectiveAt: day.AddDate(0, 0, 2), Packs: storage.NewPacks(250, 500)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() got = %+v, want %+v", got, want)
+	}
+
+	// The listed packs are copies
+	got[0].Packs[0].Size = 1
+	if got, _ := repo.List(ctx); got[0].Packs[0].Size != 1000 {
+		t.Errorf("List() was modified by external slice change, size = %d", got[0].Packs[0].Size)
+	}
+
+	if err := repo.Delete(ctx, 2); err != nil {
+		t.Fatalf("Delete() returned an unexpected error: %v", err)
+	}
+	if err := repo.Delete(ctx, 2); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Delete() error = %v, wantErr %v", err, storage.ErrNotFound)
+	}
+	if got, _ := repo.List(ctx); len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("List() got = %+v, want only the change 1", got)
+	}
+}
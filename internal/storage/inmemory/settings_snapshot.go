@@ -0,0 +1,226 @@
+package inmemory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// dataSnapshotFile is the content of the snapshot file of a catalog or a
+// schedule, verified like the pack snapshots (see snapshotFile).
+type dataSnapshotFile struct {
+	Version  int             `json:"version"`
+	SavedAt  time.Time       `json:"savedAt"`
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// writeDataSnapshot replaces the snapshot file at path with v.
+func writeDataSnapshot(path string, savedAt time.Time, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(dataSnapshotFile{
+		Version:  snapshotVersion,
+		SavedAt:  savedAt.UTC(),
+		Checksum: checksum(raw),
+		Data:     raw,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// readDataSnapshot decodes the snapshot file at path into v, leaving v
+// unchanged when there is no file.
+func readDataSnapshot(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var f dataSnapshotFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	if f.Version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorruptSnapshot, f.Version)
+	}
+	raw, err := compact(f.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	if got := checksum(raw); got != f.Checksum {
+		return fmt.Errorf("%w: checksum %s, want %s", ErrCorruptSnapshot, got, f.Checksum)
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+
+	return nil
+}
+
+// restoreDataSnapshot reads the snapshot file at path into v. A snapshot failing
+// verification is moved aside to path+".corrupt" and v left unchanged.
+func restoreDataSnapshot(path string, v any) error {
+	err := readDataSnapshot(path, v)
+	if !errors.Is(err, ErrCorruptSnapshot) {
+		return err
+	}
+
+	log.Printf("Moving aside the snapshot %s: %v", path, err)
+	return os.Rename(path, path+".corrupt")
+}
+
+// SnapshotCatalogRepo is an InMemoryCatalogRepo whose catalog survives restarts
+// in a local snapshot file, written on every change like a SnapshotPackRepo.
+type SnapshotCatalogRepo struct {
+	repo *InMemoryCatalogRepo
+	path string
+
+	// mu serializes the changes and the writes, so the file never goes back in time.
+	mu sync.Mutex
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// NewSnapshotCatalogRepo creates a catalog snapshotted to the file at path,
+// restoring the catalog of the file when it exists and the empty catalog
+// otherwise. A snapshot failing verification is moved aside to path+".corrupt".
+func NewSnapshotCatalogRepo(path string) (*SnapshotCatalogRepo, error) {
+	r := &SnapshotCatalogRepo{repo: NewInMemoryCatalogRepo(), path: path, now: time.Now}
+
+	var c storage.Catalog
+	if err := restoreDataSnapshot(path, &c); err != nil {
+		return nil, err
+	}
+	r.repo.catalog = c
+
+	return r, nil
+}
+
+// Get returns the current catalog.
+func (r *SnapshotCatalogRepo) Get(ctx context.Context) (storage.Catalog, error) {
+	return r.repo.Get(ctx)
+}
+
+// Save replaces the catalog and writes the snapshot. When writing the snapshot
+// fails the catalog is left unchanged and the error returned.
+func (r *SnapshotCatalogRepo) Save(ctx context.Context, c storage.Catalog) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := writeDataSnapshot(r.path, r.now(), c); err != nil {
+		return fmt.Errorf("writing the snapshot: %w", err)
+	}
+
+	return r.repo.Save(context.WithoutCancel(ctx), c)
+}
+
+// SnapshotScheduleRepo is an InMemoryScheduleRepo whose changes survive restarts
+// in a local snapshot file, written on every change like a SnapshotPackRepo.
+type SnapshotScheduleRepo struct {
+	repo *InMemoryScheduleRepo
+	path string
+
+	// mu serializes the changes and the writes, so the file never goes back in time.
+	mu sync.Mutex
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// NewSnapshotScheduleRepo creates a schedule snapshotted to the file at path,
+// restoring the changes of the file when it exists and an empty schedule
+// otherwise. A snapshot failing verification is moved aside to path+".corrupt".
+func NewSnapshotScheduleRepo(path string) (*SnapshotScheduleRepo, error) {
+	r := &SnapshotScheduleRepo{repo: NewInMemoryScheduleRepo(), path: path, now: time.Now}
+
+	var changes []storage.ScheduledChange
+	if err := restoreDataSnapshot(path, &changes); err != nil {
+		return nil, err
+	}
+	r.repo.changes = changes
+	for _, c := range changes {
+		r.repo.lastID = max(r.repo.lastID, c.ID)
+	}
+
+	return r, nil
+}
+
+// Add stores the change, sets its ID and writes the snapshot. When writing the
+// snapshot fails the change is removed again and the error returned.
+func (r *SnapshotScheduleRepo) Add(ctx context.Context, c *storage.ScheduledChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.repo.Add(ctx, c); err != nil {
+		return err
+	}
+
+	if err := r.snapshot(); err != nil {
+		r.repo.Delete(context.WithoutCancel(ctx), c.ID)
+		return fmt.Errorf("writing the snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// List returns a copy of all changes, sorted by EffectiveAt then ID.
+func (r *SnapshotScheduleRepo) List(ctx context.Context) ([]storage.ScheduledChange, error) {
+	return r.repo.List(ctx)
+}
+
+// Delete removes the change with the given ID and writes the snapshot. When
+// writing the snapshot fails the change is restored and the error returned.
+func (r *SnapshotScheduleRepo) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, err := r.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if err := r.snapshot(); err != nil {
+		// Keep the changes of the snapshot on disk
+		r.repo.mu.Lock()
+		r.repo.changes = previous
+		r.repo.mu.Unlock()
+		return fmt.Errorf("writing the snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// snapshot writes the current changes to the file. The caller holds mu.
+func (r *SnapshotScheduleRepo) snapshot() error {
+	changes, err := r.repo.List(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return writeDataSnapshot(r.path, r.now(), changes)
+}
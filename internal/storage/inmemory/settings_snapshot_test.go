@@ -0,0 +1,117 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+)
+
+// TestSnapshotCatalogRepo runs the repository tests shared by the storage backends.
+func TestSnapshotCatalogRepo(t *testing.T) {
+	storagetest.TestCatalogRepository(t, func(t *testing.T) storage.CatalogRepository {
+		repo, err := NewSnapshotCatalogRepo(filepath.Join(t.TempDir(), "catalog.json"))
+		if err != nil {
+			t.Fatalf("NewSnapshotCatalogRepo() returned an unexpected error: %v", err)
+		}
+
+		return repo
+	})
+}
+
+// TestSnapshotScheduleRepo runs the repository tests shared by the storage backends.
+func TestSnapshotScheduleRepo(t *testing.T) {
+	storagetest.TestScheduleRepository(t, func(t *testing.T) storage.ScheduleRepository {
+		repo, err := NewSnapshotScheduleRepo(filepath.Join(t.TempDir(), "schedule.json"))
+		if err != nil {
+			t.Fatalf("NewSnapshotScheduleRepo() returned an unexpected error: %v", err)
+		}
+
+		return repo
+	})
+}
+
+// TestSnapshotCatalogRepo_Restore tests that a new repository on the same file
+// has the saved catalog, and that a corrupt file is moved aside.
+func TestSnapshotCatalogRepo_Restore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	ctx := context.Background()
+
+	repo, err := NewSnapshotCatalogRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotCatalogRepo() returned an unexpected error: %v", err)
+	}
+	want := storage.Catalog{Unit: "kg", Rules: []storage.Rule{{Kind: "forbidden", Sizes: []int{250, 500}}}}
+	if err := repo.Save(ctx, want); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	restored, err := NewSnapshotCatalogRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotCatalogRepo() returned an unexpected error: %v", err)
+	}
+	if got, _ := restored.Get(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() got = %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 1, "data": {"Unit": "lb"}}`), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() returned an unexpected error: %v", err)
+	}
+	restored, err = NewSnapshotCatalogRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotCatalogRepo() returned an unexpected error: %v", err)
+	}
+	if got, _ := restored.Get(ctx); !reflect.DeepEqual(got, storage.Catalog{}) {
+		t.Errorf("Get() got = %+v, want the empty catalog", got)
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Errorf("the corrupt snapshot was not moved aside: %v", err)
+	}
+}
+
+// TestSnapshotScheduleRepo_Restore tests that a new repository on the same file
+// has the stored changes and keeps assigning new IDs.
+func TestSnapshotScheduleRepo_Restore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	ctx := context.Background()
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	repo, err := NewSnapshotScheduleRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotScheduleRepo() returned an unexpected error: %v", err)
+	}
+	for _, sizes := range [][]int{{250}, {500}} {
+		if err := repo.Add(ctx, &storage.ScheduledChange{EffectiveAt: day, Packs: storage.NewPacks(sizes...)}); err != nil {
+			t.Fatalf("Add() returned an unexpected error: %v", err)
+		}
+	}
+	if err := repo.Delete(ctx, 1); err != nil {
+		t.Fatalf("Delete() returned an unexpected error: %v", err)
+	}
+
+	restored, err := NewSnapshotScheduleRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotScheduleRepo() returned an unexpected error: %v", err)
+	}
+	want := []storage.ScheduledChange{{ID: 2, EffectiveAt: day, Packs: storage.NewPacks(500)}}
+	if got, _ := restored.List(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() got = %+v, want %+v", got, want)
+	}
+
+	c := &storage.ScheduledChange{EffectiveAt: day, Packs: storage.NewPacks(1000)}
+	if err := restored.Add(ctx, c); err != nil {
+		t.Fatalf("Add() returned an unexpected error: %v", err)
+	}
+	if c.ID != 3 {
+		t.Errorf("Add() ID = %d, want 3", c.ID)
+	}
+	if err := restored.Delete(ctx, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, storage.ErrNotFound)
+	}
+}
@@ -0,0 +1,328 @@
+package inmemory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// snapshotVersion is the format version of the snapshot files.
+const snapshotVersion = 1
+
+// ErrCorruptSnapshot is returned when a snapshot file fails its checksum or cannot be decoded.
+var ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+// snapshotFile is the content of a snapshot file. The checksum covers the
+// compacted JSON of the packs, so any change to them is detected.
+type snapshotFile struct {
+	Version  int             `json:"version"`
+	SavedAt  time.Time       `json:"savedAt"`
+	Checksum string          `json:"checksum"`
+	Packs    json.RawMessage `json:"packs"`
+}
+
+// SnapshotPackRepo is an InMemoryPackRepo whose packs survive restarts in a
+// local snapshot file, for deployments too small for a database.
+//
+// The snapshot is written after every change, or every interval when the packs
+// changed, or both (see the options). Every write replaces the file atomically,
+// so a crash leaves either the previous or the new snapshot, never a partial one.
+type SnapshotPackRepo struct {
+	repo *InMemoryPackRepo
+	path string
+
+	interval time.Duration
+	onChange bool
+
+	// mu serializes the changes and the writes, so the file never goes back in time.
+	mu sync.Mutex
+	// dirty is set when the packs changed since the last snapshot.
+	dirty bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// SnapshotOption configures optional SnapshotPackRepo settings.
+type SnapshotOption func(*SnapshotPackRepo)
+
+// WithSnapshotInterval writes the snapshot every d when the packs changed.
+// Zero, the default, disables the periodic snapshots.
+func WithSnapshotInterval(d time.Duration) SnapshotOption {
+	return func(r *SnapshotPackRepo) {
+		r.interval = d
+	}
+}
+
+// WithSnapshotOnChange sets whether every change writes the snapshot before
+// ReplaceAll returns, the default. Without it only the periodic snapshots and
+// Close write it, trading the latest changes for fewer writes.
+func WithSnapshotOnChange(enabled bool) SnapshotOption {
+	return func(r *SnapshotPackRepo) {
+		r.onChange = enabled
+	}
+}
+
+// NewSnapshotPackRepo creates a repository snapshotted to the file at path,
+// restoring the packs of the file when it exists and the default packs
+// otherwise. A snapshot failing verification is moved aside to path+".corrupt"
+// for inspection and the repository starts from the default packs.
+// Close stops the periodic snapshots.
+func NewSnapshotPackRepo(path string, opts ...SnapshotOption) (*SnapshotPackRepo, error) {
+	r := &SnapshotPackRepo{
+		repo:     NewInMemoryPackRepo(),
+		path:     path,
+		onChange: true,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if err := r.restore(); err != nil {
+		if !errors.Is(err, ErrCorruptSnapshot) {
+			return nil, err
+		}
+
+		log.Printf("Moving aside the snapshot %s: %v", path, err)
+		if err := os.Rename(path, path+".corrupt"); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.interval > 0 {
+		go r.run()
+	} else {
+		close(r.done)
+	}
+
+	return r, nil
+}
+
+// FindAll returns a copy of all current packs.
+func (r *SnapshotPackRepo) FindAll(ctx context.Context) ([]storage.Pack, error) {
+	return r.repo.FindAll(ctx)
+}
+
+// ReplaceAll replaces all packs and, unless disabled, writes the snapshot.
+// When writing the snapshot fails the packs are left unchanged and the error
+// returned, so a change reported as saved is always in the snapshot. Without
+// on-change snapshots a change is only saved by the next periodic snapshot or
+// Close, and lost on a crash in between.
+func (r *SnapshotPackRepo) ReplaceAll(ctx context.Context, packs []storage.Pack) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, err := r.repo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.ReplaceAll(ctx, packs); err != nil {
+		return err
+	}
+
+	if !r.onChange {
+		r.dirty = true
+		return nil
+	}
+
+	if err := r.snapshot(); err != nil {
+		// Keep the packs of the snapshot on disk
+		r.repo.ReplaceAll(context.WithoutCancel(ctx), previous)
+		return fmt.Errorf("writing the snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// Snapshot writes the snapshot now, whether the packs changed or not.
+func (r *SnapshotPackRepo) Snapshot() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.snapshot()
+}
+
+// Close stops the periodic snapshots and writes the changes not written yet.
+func (r *SnapshotPackRepo) Close() error {
+	r.closeOnce.Do(func() { close(r.stop) })
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.dirty {
+		return nil
+	}
+
+	return r.snapshot()
+}
+
+// run writes the snapshot every interval when the packs changed, until Close.
+func (r *SnapshotPackRepo) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			if r.dirty {
+				if err := r.snapshot(); err != nil {
+					log.Printf("Failed to write the snapshot %s: %v", r.path, err)
+				}
+			}
+			r.mu.Unlock()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// snapshot writes the current packs to the file. The caller holds mu.
+func (r *SnapshotPackRepo) snapshot() error {
+	packs, err := r.repo.FindAll(context.Background())
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(packs)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snapshotFile{
+		Version:  snapshotVersion,
+		SavedAt:  r.now().UTC(),
+		Checksum: checksum(raw),
+		Packs:    raw,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(r.path, data); err != nil {
+		return err
+	}
+	r.dirty = false
+
+	return nil
+}
+
+// restore loads the packs of the snapshot file, if any.
+func (r *SnapshotPackRepo) restore() error {
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var f snapshotFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	if f.Version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorruptSnapshot, f.Version)
+	}
+	// Indenting the file indented the packs too
+	raw, err := compact(f.Packs)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	if got := checksum(raw); got != f.Checksum {
+		return fmt.Errorf("%w: checksum %s, want %s", ErrCorruptSnapshot, got, f.Checksum)
+	}
+
+	var packs []storage.Pack
+	if err := json.Unmarshal(raw, &packs); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+
+	return r.repo.ReplaceAll(context.Background(), packs)
+}
+
+// checksum returns the SHA-256 checksum of the data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// compact removes the insignificant white space of JSON data.
+func compact(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("missing packs")
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// syncDir syncs the directory, replaceable for tests.
+var syncDir = func(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// writeFileAtomic writes the data to a temporary file next to path and renames
+// it over path once synced, so readers see either the old or the new content.
+// Once renamed the new content is committed: failing to sync the directory
+// afterwards is only logged, since the new file is already the one read.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself survives a crash
+	if err := syncDir(dir); err != nil {
+		log.Printf("Failed to sync the directory of %s: %v", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package inmemory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+var snapshotPacks = []storage.Pack{
+	{Size: 23, Label: "Small", SKU: "B23", Cost: 0.5, Dimensions: storage.Dimensions{Length: 1, Width: 2, Height: 3}, Active: true},
+	{Size: 31, Active: false},
+}
+
+// findAll returns the packs of the repository, failing the test on error.
+func findAll(t *testing.T, repo storage.PackRepository) []storage.Pack {
+	t.Helper()
+
+	packs, err := repo.FindAll(context.Background())
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+
+	return packs
+}
+
+// TestSnapshotPackRepo_Restore tests that the packs written on change are restored by the next repository.
+func TestSnapshotPackRepo_Restore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packs.json")
+
+	repo, err := NewSnapshotPackRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+	}
+	if got, want := findAll(t, repo), storage.NewPacks(storage.DefaultPackSizes...); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %v, want the default packs %v", got, want)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the snapshot was written before any change: %v", err)
+	}
+
+	if err := repo.ReplaceAll(context.Background(), []storage.Pack{snapshotPacks[1], snapshotPacks[0]}); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+
+	// Restarting restores the sorted packs, without closing the previous repository
+	restored, err := NewSnapshotPackRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+	}
+	if got := findAll(t, restored); !reflect.DeepEqual(got, snapshotPacks) {
+		t.Errorf("FindAll() = %v, want %v", got, snapshotPacks)
+	}
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("ReadDir() returned an unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the snapshot directory holds %d files, want 1", len(entries))
+	}
+}
+
+// TestSnapshotPackRepo_Corrupt tests that a snapshot failing verification is moved aside.
+func TestSnapshotPackRepo_Corrupt(t *testing.T) {
+	testCases := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{name: "Changed pack", corrupt: func(data []byte) []byte { return bytes.Replace(data, []byte(`"B23"`), []byte(`"B42"`), 1) }},
+		{name: "Truncated", corrupt: func(data []byte) []byte { return data[:len(data)/2] }},
+		{name: "Unknown version", corrupt: func(data []byte) []byte {
+			return bytes.Replace(data, []byte(`"version": 1`), []byte(`"version": 9`), 1)
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "packs.json")
+			repo, err := NewSnapshotPackRepo(path)
+			if err != nil {
+				t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+			}
+			if err := repo.ReplaceAll(context.Background(), snapshotPacks); err != nil {
+				t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile() returned an unexpected error: %v", err)
+			}
+			corrupted := tc.corrupt(data)
+			if bytes.Equal(corrupted, data) {
+				t.Fatal("the test did not corrupt the snapshot")
+			}
+			if err := os.WriteFile(path, corrupted, 0o644); err != nil {
+				t.Fatalf("WriteFile() returned an unexpected error: %v", err)
+			}
+
+			if err := repo.restore(); !errors.Is(err, ErrCorruptSnapshot) {
+				t.Errorf("restore() error = %v, wantErr %v", err, ErrCorruptSnapshot)
+			}
+
+			restored, err := NewSnapshotPackRepo(path)
+			if err != nil {
+				t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+			}
+			if got, want := findAll(t, restored), storage.NewPacks(storage.DefaultPackSizes...); !reflect.DeepEqual(got, want) {
+				t.Errorf("FindAll() = %v, want the default packs %v", got, want)
+			}
+			if kept, err := os.ReadFile(path + ".corrupt"); err != nil || !bytes.Equal(kept, corrupted) {
+				t.Errorf("the corrupt snapshot was not kept aside: %v", err)
+			}
+		})
+	}
+}
+
+// TestSnapshotPackRepo_WriteFailure tests that a change whose snapshot cannot be
+// written fails and leaves the packs unchanged.
+func TestSnapshotPackRepo_WriteFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("Mkdir() returned an unexpected error: %v", err)
+	}
+
+	repo, err := NewSnapshotPackRepo(filepath.Join(dir, "packs.json"))
+	if err != nil {
+		t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+	}
+	if err := repo.ReplaceAll(context.Background(), snapshotPacks); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+
+	// The snapshot can no longer be written
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("RemoveAll() returned an unexpected error: %v", err)
+	}
+	if err := repo.ReplaceAll(context.Background(), storage.NewPacks(53)); err == nil {
+		t.Error("ReplaceAll() returned no error, want the snapshot failure")
+	}
+	if got := findAll(t, repo); !reflect.DeepEqual(got, snapshotPacks) {
+		t.Errorf("FindAll() = %v, want the packs of the last snapshot %v", got, snapshotPacks)
+	}
+}
+
+// TestSnapshotPackRepo_SyncDirFailure tests that a change whose snapshot was renamed
+// in place is kept when syncing the directory fails, like the snapshot on disk.
+func TestSnapshotPackRepo_SyncDirFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packs.json")
+
+	repo, err := NewSnapshotPackRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+	}
+
+	defer func(f func(string) error) { syncDir = f }(syncDir)
+	syncDir = func(string) error { return errors.New("sync failed") }
+
+	if err := repo.ReplaceAll(context.Background(), snapshotPacks); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+	if got := findAll(t, repo); !reflect.DeepEqual(got, snapshotPacks) {
+		t.Errorf("FindAll() = %v, want %v", got, snapshotPacks)
+	}
+
+	restored, err := NewSnapshotPackRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+	}
+	if got := findAll(t, restored); !reflect.DeepEqual(got, snapshotPacks) {
+		t.Errorf("FindAll() = %v, want the packs on disk %v", got, snapshotPacks)
+	}
+}
+
+// TestSnapshotPackRepo_Periodic tests that without on-change snapshots the changes are
+// written by the periodic snapshots and Close.
+func TestSnapshotPackRepo_Periodic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packs.json")
+
+	repo, err := NewSnapshotPackRepo(path, WithSnapshotOnChange(false), WithSnapshotInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+	}
+	if err := repo.ReplaceAll(context.Background(), snapshotPacks); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the periodic snapshot was not written")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close() returned an unexpected error: %v", err)
+	}
+
+	// Close writes the changes the periodic snapshots did not
+	repo, err = NewSnapshotPackRepo(path, WithSnapshotOnChange(false))
+	if err != nil {
+		t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+	}
+	if err := repo.ReplaceAll(context.Background(), storage.NewPacks(53)); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+	if got := findAll(t, mustRestore(t, path)); !reflect.DeepEqual(got, snapshotPacks) {
+		t.Errorf("FindAll() = %v, want the packs before Close %v", got, snapshotPacks)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close() returned an unexpected error: %v", err)
+	}
+	if got, want := findAll(t, mustRestore(t, path)), storage.NewPacks(53); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %v, want %v", got, want)
+	}
+}
+
+// mustRestore returns a repository restored from the snapshot.
+func mustRestore(t *testing.T, path string) *SnapshotPackRepo {
+	t.Helper()
+
+	repo, err := NewSnapshotPackRepo(path)
+	if err != nil {
+		t.Fatalf("NewSnapshotPackRepo() returned an unexpected error: %v", err)
+	}
+
+	return repo
+}
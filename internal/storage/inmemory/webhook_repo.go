@@ -0,0 +1,71 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// InMemoryWebhookRepo implements the storage.WebhookRepository interface
+// using a thread-safe in-memory slice.
+type InMemoryWebhookRepo struct {
+	mu       sync.RWMutex
+	webhooks []storage.Webhook
+	lastID   int64
+}
+
+// NewInMemoryWebhookRepo creates a new repository without webhooks.
+func NewInMemoryWebhookRepo() *InMemoryWebhookRepo {
+	return &InMemoryWebhookRepo{}
+}
+
+// Add stores a copy of the webhook and sets its ID.
+func (r *InMemoryWebhookRepo) Add(ctx context.Context, w *storage.Webhook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	w.ID = r.lastID
+	r.webhooks = append(r.webhooks, *w)
+
+	return nil
+}
+
+// List returns a copy of all webhooks, sorted by ID.
+func (r *InMemoryWebhookRepo) List(ctx context.Context) ([]storage.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]storage.Webhook, len(r.webhooks))
+	copy(out, r.webhooks)
+
+	return out, nil
+}
+
+// Delete removes the webhook with the given ID.
+func (r *InMemoryWebhookRepo) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, w := range r.webhooks {
+		if w.ID == id {
+			r.webhooks = append(r.webhooks[:i], r.webhooks[i+1:]...)
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
@@ -0,0 +1,47 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// TestInMemoryWebhookRepo tests adding, listing and deleting webhooks.
+func TestInMemoryWebhookRepo(t *testing.T) {
+	repo := NewInMemoryWebhookRepo()
+	ctx := context.Background()
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	wms := &storage.Webhook{URL: "https://wms.example.com/hooks", Secret: "a", CreatedAt: created}
+	printer := &storage.Webhook{URL: "https://printer.example.com/hooks", Secret: "b", CreatedAt: created}
+	for _, w := range []*storage.Webhook{wms, printer} {
+		if err := repo.Add(ctx, w); err != nil {
+			t.Fatalf("Add() returned an unexpected error: %v", err)
+		}
+	}
+	if wms.ID != 1 || printer.ID != 2 {
+		t.Errorf("Add() IDs = %d, %d, want 1, 2", wms.ID, printer.ID)
+	}
+
+	got, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	if want := []storage.Webhook{*wms, *printer}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() got = %+v, want %+v", got, want)
+	}
+
+	if err := repo.Delete(ctx, 1); err != nil {
+		t.Fatalf("Delete() returned an unexpected error: %v", err)
+	}
+	if err := repo.Delete(ctx, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Delete() error = %v, wantErr %v", err, storage.ErrNotFound)
+	}
+	if got, _ := repo.List(ctx); len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("List() got = %+v, want only the webhook 2", got)
+	}
+}
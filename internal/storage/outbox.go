@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// OutboxPackSizesChanged is the type of the outbox events journaled with every
+// replacement of the packs, with a PackSizesChangedPayload.
+const OutboxPackSizesChanged = "pack_sizes.changed"
+
+// PackSizesChangedPayload is the payload of an OutboxPackSizesChanged event.
+type PackSizesChangedPayload struct {
+	// Sizes are the active pack sizes, ascending.
+	Sizes []int `json:"sizes"`
+}
+
+// OutboxEvent is an event journaled in the same transaction as the change it
+// reports, waiting to be delivered.
+type OutboxEvent struct {
+	ID        int64
+	Tenant    string
+	Type      string
+	Payload   []byte
+	CreatedAt time.Time
+	// Attempts is the number of failed deliveries so far.
+	Attempts int
+}
+
+// Outbox defines the contract for reading and settling the journaled events.
+// Events are delivered at least once: an event stays pending until marked as delivered.
+type Outbox interface {
+	// Pending returns up to limit undelivered events, oldest first, skipping the
+	// ones that failed maxAttempts times already. A zero maxAttempts skips none.
+	Pending(ctx context.Context, limit, maxAttempts int) ([]OutboxEvent, error)
+
+	// MarkDelivered settles the event with the given ID.
+	MarkDelivered(ctx context.Context, id int64) error
+
+	// MarkFailed records a failed delivery of the event with the given ID.
+	MarkFailed(ctx context.Context, id int64, reason string) error
+}
@@ -1,10 +1,62 @@
 package storage
 
-// PackRepository defines the contract for all pack size storage operations.
+import "context"
+
+// Dimensions are the outer dimensions of a pack.
+type Dimensions struct {
+	Length float64
+	Width  float64
+	Height float64
+}
+
+// Volume returns the volume of the dimensions.
+func (d Dimensions) Volume() float64 {
+	return d.Length * d.Width * d.Height
+}
+
+// Pack is a pack size together with its catalog attributes.
+type Pack struct {
+	Size  int
+	Label string
+	// SKU is the stock keeping unit barcode of the pack.
+	SKU        string
+	Cost       float64
+	Weight     float64
+	Dimensions Dimensions
+	// Active packs are used by calculations, inactive ones are only retained.
+	Active bool
+}
+
+// DefaultPackSizes are the pack sizes of a repository where none were set yet.
+var DefaultPackSizes = []int{250, 500, 1000, 2000, 5000}
+
+// NewPacks returns active packs of the given sizes without other attributes.
+func NewPacks(sizes ...int) []Pack {
+	packs := make([]Pack, len(sizes))
+	for i, size := range sizes {
+		packs[i] = Pack{Size: size, Active: true}
+	}
+
+	return packs
+}
+
+// ActiveSizes returns the sizes of the active packs, in the order of packs.
+func ActiveSizes(packs []Pack) []int {
+	sizes := make([]int, 0, len(packs))
+	for _, p := range packs {
+		if p.Active {
+			sizes = append(sizes, p.Size)
+		}
+	}
+
+	return sizes
+}
+
+// PackRepository defines the contract for all pack storage operations.
 type PackRepository interface {
-	// FindAll returns all current pack sizes, sorted ascending.
-	FindAll() ([]int, error)
+	// FindAll returns all current packs, active or not, sorted ascending by size.
+	FindAll(ctx context.Context) ([]Pack, error)
 
-	// ReplaceAll atomically deletes all existing sizes and inserts the new ones.
-	ReplaceAll(sizes []int) error
+	// ReplaceAll atomically deletes all existing packs and inserts the new ones.
+	ReplaceAll(ctx context.Context, packs []Pack) error
 }
@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// CalculationRepo implements the storage.CalculationRepository interface on PostgreSQL.
+// The UTC day of every calculation is stored next to its timestamp for the daily stats.
+type CalculationRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewCalculationRepo creates a calculation history on the database.
+// The tables must have been created by Migrate.
+func NewCalculationRepo(pool *pgxpool.Pool) *CalculationRepo {
+	return &CalculationRepo{pool: pool}
+}
+
+// Save records the calculation and its packs in a single transaction, assigning its ID.
+func (r *CalculationRepo) Save(ctx context.Context, c *storage.Calculation) error {
+	var id int64
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO calculations (created_at, created_day, amount, total_items, excess, size_version, requester, tenant)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			c.Timestamp.UTC(), c.Timestamp.UTC().Format("2006-01-02"),
+			c.Amount, c.TotalItems, c.Excess, c.SizeVersion, c.Requester, c.Tenant,
+		).Scan(&id); err != nil {
+			return err
+		}
+
+		rows := make([][]any, 0, len(c.Packs))
+		for size, count := range c.Packs {
+			rows = append(rows, []any{id, size, count})
+		}
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{"calculation_packs"},
+			[]string{"calculation_id", "size", "pack_count"}, pgx.CopyFromRows(rows))
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.ID = id
+
+	return nil
+}
+
+// Find returns a page of the matching calculations, newest first.
+func (r *CalculationRepo) Find(ctx context.Context, f storage.CalculationFilter) ([]storage.Calculation, int, error) {
+	where, args := whereClause(f, "")
+
+	var total int
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM calculations`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// A NULL limit returns every row
+	var limit any
+	if f.Limit > 0 {
+		limit = f.Limit
+	}
+	n := len(args)
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, created_at, amount, total_items, excess, size_version, requester, tenant
+		FROM calculations`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $`+fmt.Sprint(n+1)+` OFFSET $`+fmt.Sprint(n+2),
+		append(args, limit, max(f.Offset, 0))...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := []storage.Calculation{}
+	index := make(map[int64]int)
+	var ids []int64
+	for rows.Next() {
+		var c storage.Calculation
+		if err := rows.Scan(&c.ID, &c.Timestamp, &c.Amount, &c.TotalItems, &c.Excess, &c.SizeVersion, &c.Requester, &c.Tenant); err != nil {
+			return nil, 0, err
+		}
+		c.Timestamp = c.Timestamp.UTC()
+		c.Packs = map[int]int{}
+
+		index[c.ID] = len(out)
+		ids = append(ids, c.ID)
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return out, total, nil
+	}
+
+	packRows, err := r.pool.Query(ctx,
+		`SELECT calculation_id, size, pack_count FROM calculation_packs WHERE calculation_id = ANY($1)`, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer packRows.Close()
+
+	for packRows.Next() {
+		var id int64
+		var size, count int
+		if err := packRows.Scan(&id, &size, &count); err != nil {
+			return nil, 0, err
+		}
+		out[index[id]].Packs[size] = count
+	}
+	if err := packRows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
+
+// Stats aggregates the matching calculations per day in the database.
+func (r *CalculationRepo) Stats(ctx context.Context, f storage.CalculationFilter) (storage.CalculationStats, error) {
+	where, args := whereClause(f, "")
+
+	stats := storage.CalculationStats{Daily: []storage.DailyCalculationStats{}}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT created_day, COUNT(*), SUM(excess)::BIGINT FROM calculations`+where+`
+		GROUP BY created_day ORDER BY created_day`,
+		args...,
+	)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	days := make(map[string]int)
+	for rows.Next() {
+		var d storage.DailyCalculationStats
+		if err := rows.Scan(&d.Day, &d.Count, &d.TotalExcess); err != nil {
+			return stats, err
+		}
+
+		stats.Count += d.Count
+		stats.TotalExcess += d.TotalExcess
+
+		days[d.Day] = len(stats.Daily)
+		stats.Daily = append(stats.Daily, d)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	// Sum the packs of every size per day, then pick the most used one
+	whereAlias, _ := whereClause(f, "c.")
+	packRows, err := r.pool.Query(ctx,
+		`SELECT c.created_day, p.size, SUM(p.pack_count)::BIGINT
+		FROM calculations c JOIN calculation_packs p ON p.calculation_id = c.id`+
+			whereAlias+`
+		GROUP BY c.created_day, p.size`,
+		args...,
+	)
+	if err != nil {
+		return stats, err
+	}
+	defer packRows.Close()
+
+	packsPerDay := make(map[string]map[int]int)
+	for packRows.Next() {
+		var day string
+		var size, count int
+		if err := packRows.Scan(&day, &size, &count); err != nil {
+			return stats, err
+		}
+		if packsPerDay[day] == nil {
+			packsPerDay[day] = make(map[int]int)
+		}
+		packsPerDay[day][size] = count
+	}
+	if err := packRows.Err(); err != nil {
+		return stats, err
+	}
+
+	for day, packs := range packsPerDay {
+		d := &stats.Daily[days[day]]
+		d.MostUsedSize, d.MostUsedSizePacks = storage.MostUsedSize(packs)
+	}
+
+	return stats, nil
+}
+
+// whereClause returns the WHERE clause selecting the calculations matching the filter,
+// with its arguments numbered from $1. The columns are prefixed by alias, such as "c.",
+// when joining tables.
+func whereClause(f storage.CalculationFilter, alias string) (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf("%s%s $%d", alias, cond, len(args)))
+	}
+
+	if !f.From.IsZero() {
+		add("created_at >=", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		add("created_at <", f.To.UTC())
+	}
+	if f.Tenant != "" {
+		add("tenant =", f.Tenant)
+	}
+	if f.Requester != "" {
+		add("requester =", f.Requester)
+	}
+	if f.MinAmount > 0 {
+		add("amount >=", f.MinAmount)
+	}
+	if f.MaxAmount > 0 {
+		add("amount <=", f.MaxAmount)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// TestCalculationRepo tests saving, filtering, paginating and aggregating the calculations.
+func TestCalculationRepo(t *testing.T) {
+	repo := NewCalculationRepo(newTestPool(t))
+	ctx := context.Background()
+
+	day1 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	calculations := []storage.Calculation{
+		{Timestamp: day1, Amount: 1, Packs: map[int]int{250: 1}, TotalItems: 250, Excess: 249, SizeVersion: "v1", Requester: "a", Tenant: "north"},
+		{Timestamp: day1.Add(time.Hour), Amount: 750, Packs: map[int]int{250: 1, 500: 1}, TotalItems: 750, SizeVersion: "v1", Requester: "b", Tenant: "north"},
+		{Timestamp: day2, Amount: 1200, Packs: map[int]int{1000: 1, 250: 1}, TotalItems: 1250, Excess: 50, SizeVersion: "v2", Requester: "a", Tenant: "south"},
+	}
+	for i := range calculations {
+		if err := repo.Save(ctx, &calculations[i]); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+		if calculations[i].ID != int64(i+1) {
+			t.Errorf("Save() assigned ID %d, want %d", calculations[i].ID, i+1)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		filter    storage.CalculationFilter
+		wantIDs   []int64
+		wantTotal int
+	}{
+		{name: "All, newest first", filter: storage.CalculationFilter{}, wantIDs: []int64{3, 2, 1}, wantTotal: 3},
+		{name: "Paginated", filter: storage.CalculationFilter{Limit: 1, Offset: 1}, wantIDs: []int64{2}, wantTotal: 3},
+		{name: "By tenant", filter: storage.CalculationFilter{Tenant: "north"}, wantIDs: []int64{2, 1}, wantTotal: 2},
+		{name: "By amount", filter: storage.CalculationFilter{MinAmount: 2, MaxAmount: 1000}, wantIDs: []int64{2}, wantTotal: 1},
+		{name: "By time range", filter: storage.CalculationFilter{From: day1.Add(time.Hour), To: day2}, wantIDs: []int64{2}, wantTotal: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := repo.Find(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Find() returned an unexpected error: %v", err)
+			}
+
+			ids := make([]int64, 0, len(got))
+			for _, c := range got {
+				ids = append(ids, c.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Find() IDs = %v, want %v", ids, tt.wantIDs)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("Find() total = %d, want %d", total, tt.wantTotal)
+			}
+		})
+	}
+
+	got, _, err := repo.Find(ctx, storage.CalculationFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("Find() returned an unexpected error: %v", err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], calculations[2]) {
+		t.Errorf("Find() got = %+v, want %+v", got, calculations[2])
+	}
+
+	stats, err := repo.Stats(ctx, storage.CalculationFilter{})
+	if err != nil {
+		t.Fatalf("Stats() returned an unexpected error: %v", err)
+	}
+	want := storage.CalculationStats{
+		Count:       3,
+		TotalExcess: 299,
+		Daily: []storage.DailyCalculationStats{
+			{Day: "2025-03-01", Count: 2, TotalExcess: 249, MostUsedSize: 250, MostUsedSizePacks: 2},
+			{Day: "2025-03-02", Count: 1, TotalExcess: 50, MostUsedSize: 250, MostUsedSizePacks: 1},
+		},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("Stats() got = %+v, want %+v", stats, want)
+	}
+}
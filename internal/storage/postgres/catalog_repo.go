@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// CatalogRepo implements the storage.CatalogRepository interface on PostgreSQL,
+// scoping the catalog to the tenant of the context. The rules are stored as JSONB.
+type CatalogRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewCatalogRepo creates a catalog repository on the database.
+// The tables must have been created by Migrate.
+func NewCatalogRepo(pool *pgxpool.Pool) *CatalogRepo {
+	return &CatalogRepo{pool: pool}
+}
+
+// Get returns the catalog of the tenant of the context, the empty catalog when
+// the tenant never saved one.
+func (r *CatalogRepo) Get(ctx context.Context) (storage.Catalog, error) {
+	var c storage.Catalog
+	var rules []byte
+	err := r.pool.QueryRow(ctx,
+		`SELECT unit, rules FROM catalogs WHERE tenant = $1`, tenant.FromContext(ctx),
+	).Scan(&c.Unit, &rules)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.Catalog{}, nil
+	}
+	if err != nil {
+		return storage.Catalog{}, err
+	}
+
+	if err := json.Unmarshal(rules, &c.Rules); err != nil {
+		return storage.Catalog{}, err
+	}
+
+	return c, nil
+}
+
+// Save replaces the catalog of the tenant of the context.
+func (r *CatalogRepo) Save(ctx context.Context, c storage.Catalog) error {
+	rules, err := json.Marshal(c.Rules)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.pool.Exec(ctx,
+		`INSERT INTO catalogs (tenant, unit, rules) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant) DO UPDATE SET unit = EXCLUDED.unit, rules = EXCLUDED.rules`,
+		tenant.FromContext(ctx), c.Unit, rules,
+	)
+
+	return err
+}
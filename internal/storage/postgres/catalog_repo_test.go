@@ -0,0 +1,15 @@
+package postgres
+
+import (
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+)
+
+// TestCatalogRepo runs the repository tests shared by the storage backends.
+func TestCatalogRepo(t *testing.T) {
+	storagetest.TestCatalogRepository(t, func(t *testing.T) storage.CatalogRepository {
+		return NewCatalogRepo(newTestPool(t))
+	})
+}
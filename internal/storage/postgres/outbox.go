@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// maxErrorLength bounds the last delivery error kept for an outbox event.
+const maxErrorLength = 1024
+
+// OutboxRepo implements the storage.Outbox interface on the outbox table
+// written by PackRepo.
+type OutboxRepo struct {
+	pool *pgxpool.Pool
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// NewOutboxRepo creates the outbox of the database.
+// The tables must have been created by Migrate.
+func NewOutboxRepo(pool *pgxpool.Pool) *OutboxRepo {
+	return &OutboxRepo{pool: pool, now: time.Now}
+}
+
+// Pending returns up to limit undelivered events, oldest first.
+func (r *OutboxRepo) Pending(ctx context.Context, limit, maxAttempts int) ([]storage.OutboxEvent, error) {
+	query := `SELECT id, tenant, event_type, payload, created_at, attempts FROM outbox WHERE delivered_at IS NULL`
+	args := []any{limit}
+	if maxAttempts > 0 {
+		query += ` AND attempts < $2`
+		args = append(args, maxAttempts)
+	}
+	query += ` ORDER BY id LIMIT $1`
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []storage.OutboxEvent{}
+	for rows.Next() {
+		var e storage.OutboxEvent
+		if err := rows.Scan(&e.ID, &e.Tenant, &e.Type, &e.Payload, &e.CreatedAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = e.CreatedAt.UTC()
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// MarkDelivered settles the event with the given ID.
+func (r *OutboxRepo) MarkDelivered(ctx context.Context, id int64) error {
+	return r.update(ctx, `UPDATE outbox SET delivered_at = $1 WHERE id = $2`, r.now().UTC(), id)
+}
+
+// MarkFailed counts a failed delivery of the event with the given ID.
+func (r *OutboxRepo) MarkFailed(ctx context.Context, id int64, reason string) error {
+	if len(reason) > maxErrorLength {
+		reason = reason[:maxErrorLength]
+	}
+
+	return r.update(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2`, reason, id)
+}
+
+// update runs a statement updating a single event, or returns storage.ErrNotFound.
+func (r *OutboxRepo) update(ctx context.Context, query string, args ...any) error {
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// TestPackRepo_Outbox tests that the outbox event is committed with the packs, or not at all.
+func TestPackRepo_Outbox(t *testing.T) {
+	pool := newTestPool(t)
+	repo := NewPackRepo(pool)
+	outbox := NewOutboxRepo(pool)
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	repo.now = func() time.Time { return now }
+	ctx := tenant.NewContext(context.Background(), "north")
+
+	if err := repo.ReplaceAll(ctx, []storage.Pack{{Size: 53, Active: true}, {Size: 31, Active: false}, {Size: 23, Active: true}}); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+
+	// Duplicate sizes violate the primary key, rolling back the outbox event too
+	if err := repo.ReplaceAll(ctx, storage.NewPacks(250, 250)); err == nil {
+		t.Fatal("ReplaceAll() expected an error for duplicate sizes")
+	}
+
+	events, err := outbox.Pending(context.Background(), 10, 0)
+	if err != nil {
+		t.Fatalf("Pending() returned an unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Pending() got %d events, want 1", len(events))
+	}
+
+	e := events[0]
+	if e.Tenant != "north" || e.Type != storage.OutboxPackSizesChanged || !e.CreatedAt.Equal(now) || e.Attempts != 0 {
+		t.Errorf("Pending() got = %+v", e)
+	}
+	var payload storage.PackSizesChangedPayload
+	if err := json.Unmarshal(e.Payload, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", e.Payload, err)
+	}
+	if !reflect.DeepEqual(payload.Sizes, []int{23, 53}) {
+		t.Errorf("payload sizes = %v, want [23 53]", payload.Sizes)
+	}
+}
+
+func TestOutboxRepo(t *testing.T) {
+	pool := newTestPool(t)
+	repo := NewPackRepo(pool)
+	outbox := NewOutboxRepo(pool)
+	ctx := context.Background()
+
+	for _, size := range []int{1, 2, 3} {
+		if err := repo.ReplaceAll(ctx, storage.NewPacks(size)); err != nil {
+			t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+		}
+	}
+
+	if err := outbox.MarkDelivered(ctx, 1); err != nil {
+		t.Fatalf("MarkDelivered() returned an unexpected error: %v", err)
+	}
+	for range 2 {
+		if err := outbox.MarkFailed(ctx, 2, "unexpected status 503"); err != nil {
+			t.Fatalf("MarkFailed() returned an unexpected error: %v", err)
+		}
+	}
+	if err := outbox.MarkDelivered(ctx, 42); err != storage.ErrNotFound {
+		t.Errorf("MarkDelivered() error = %v, want %v", err, storage.ErrNotFound)
+	}
+
+	testCases := []struct {
+		name        string
+		limit       int
+		maxAttempts int
+		wantIDs     []int64
+	}{
+		{name: "All pending", limit: 10, wantIDs: []int64{2, 3}},
+		{name: "Limit", limit: 1, wantIDs: []int64{2}},
+		{name: "Max attempts", limit: 10, maxAttempts: 2, wantIDs: []int64{3}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := outbox.Pending(ctx, tc.limit, tc.maxAttempts)
+			if err != nil {
+				t.Fatalf("Pending() returned an unexpected error: %v", err)
+			}
+
+			ids := []int64{}
+			for _, e := range events {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.wantIDs) {
+				t.Errorf("Pending() IDs = %v, want %v", ids, tc.wantIDs)
+			}
+		})
+	}
+}
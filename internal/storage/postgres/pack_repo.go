@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// maxAttempts is the number of times ReplaceAll runs its transaction before
+// returning a serialization failure.
+const maxAttempts = 5
+
+// PackRepo implements the storage.PackRepository interface on PostgreSQL,
+// scoping the packs to the tenant of the context. Every ReplaceAll journals an
+// storage.OutboxPackSizesChanged event in the outbox table in the same transaction,
+// so the change is never committed without its notification (see OutboxRepo).
+type PackRepo struct {
+	pool *pgxpool.Pool
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// NewPackRepo creates a pack repository on the database.
+// The tables must have been created by Migrate.
+func NewPackRepo(pool *pgxpool.Pool) *PackRepo {
+	return &PackRepo{pool: pool, now: time.Now}
+}
+
+// FindAll returns the packs of the tenant of the context sorted by size,
+// storage.DefaultPackSizes when the tenant never set its packs.
+func (r *PackRepo) FindAll(ctx context.Context) ([]storage.Pack, error) {
+	// A single statement sees a single snapshot, never half of a ReplaceAll.
+	// A set without packs yields one row of NULL packs.
+	rows, err := r.pool.Query(ctx,
+		`SELECT p.size, p.label, p.sku, p.cost, p.weight, p.length, p.width, p.height, p.active
+		FROM pack_sets s LEFT JOIN packs p ON p.tenant = s.tenant
+		WHERE s.tenant = $1 ORDER BY p.size`, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := false
+	packs := []storage.Pack{}
+	for rows.Next() {
+		found = true
+
+		var size *int
+		var p storage.Pack
+		var label, sku *string
+		var cost, weight, length, width, height *float64
+		var active *bool
+		if err := rows.Scan(&size, &label, &sku, &cost, &weight, &length, &width, &height, &active); err != nil {
+			return nil, err
+		}
+		if size == nil {
+			continue
+		}
+
+		p.Size, p.Label, p.SKU, p.Cost, p.Weight = *size, *label, *sku, *cost, *weight
+		p.Dimensions = storage.Dimensions{Length: *length, Width: *width, Height: *height}
+		p.Active = *active
+		packs = append(packs, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return storage.NewPacks(storage.DefaultPackSizes...), nil
+	}
+
+	return packs, nil
+}
+
+// ReplaceAll replaces the packs of the tenant of the context and journals the
+// change in the outbox, in a serializable transaction retried when it conflicts
+// with a concurrent one.
+func (r *PackRepo) ReplaceAll(ctx context.Context, packs []storage.Pack) error {
+	id := tenant.FromContext(ctx)
+
+	sorted := append([]storage.Pack(nil), packs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Size < sorted[j].Size })
+
+	payload, err := json.Marshal(storage.PackSizesChangedPayload{Sizes: storage.ActiveSizes(sorted)})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = pgx.BeginTxFunc(ctx, r.pool, pgx.TxOptions{IsoLevel: pgx.Serializable}, func(tx pgx.Tx) error {
+			return r.replaceAll(ctx, tx, id, sorted, payload)
+		})
+		if !isSerializationFailure(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// replaceAll replaces the packs of the tenant and journals the change in the transaction.
+func (r *PackRepo) replaceAll(ctx context.Context, tx pgx.Tx, id string, packs []storage.Pack, payload []byte) error {
+	now := r.now().UTC()
+
+	// The set row tells an empty set from a tenant that never set its packs
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO pack_sets (tenant, updated_at) VALUES ($1, $2)
+		ON CONFLICT (tenant) DO UPDATE SET updated_at = EXCLUDED.updated_at`,
+		id, now,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM packs WHERE tenant = $1`, id); err != nil {
+		return err
+	}
+
+	rows := make([][]any, len(packs))
+	for i, p := range packs {
+		rows[i] = []any{id, p.Size, p.Label, p.SKU, p.Cost, p.Weight,
+			p.Dimensions.Length, p.Dimensions.Width, p.Dimensions.Height, p.Active}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"packs"},
+		[]string{"tenant", "size", "label", "sku", "cost", "weight", "length", "width", "height", "active"},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO outbox (tenant, event_type, payload, created_at) VALUES ($1, $2, $3, $4)`,
+		id, storage.OutboxPackSizesChanged, string(payload), now,
+	)
+
+	return err
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// newTestPool connects to the database of POSTGRES_TEST_URL, skipping the test
+// when it is unset. Every pool works in a schema of its own, dropped at the end
+// of the test, so the tests start from an empty database.
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL is not set")
+	}
+
+	ctx := context.Background()
+	admin, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("pgx.Connect() returned an unexpected error: %v", err)
+	}
+	defer admin.Close(ctx)
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatalf("creating the schema returned an unexpected error: %v", err)
+	}
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("pgxpool.ParseConfig() returned an unexpected error: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("pgxpool.NewWithConfig() returned an unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+		if admin, err := pgx.Connect(ctx, url); err == nil {
+			admin.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+			admin.Close(ctx)
+		}
+	})
+
+	if err := Migrate(ctx, pool); err != nil {
+		t.Fatalf("Migrate() returned an unexpected error: %v", err)
+	}
+	// Migrations are idempotent
+	if err := Migrate(ctx, pool); err != nil {
+		t.Fatalf("Migrate() second run returned an unexpected error: %v", err)
+	}
+
+	return pool
+}
+
+// TestPackRepo runs the repository tests shared by the storage backends.
+func TestPackRepo(t *testing.T) {
+	storagetest.TestPackRepository(t, func(t *testing.T) storage.PackRepository {
+		return NewPackRepo(newTestPool(t))
+	})
+}
+
+// TestPackRepo_Tenants tests that the packs are scoped to the tenant, and that an
+// empty set stays empty instead of falling back to the defaults.
+func TestPackRepo_Tenants(t *testing.T) {
+	repo := NewPackRepo(newTestPool(t))
+	north := tenant.NewContext(context.Background(), "north")
+	south := tenant.NewContext(context.Background(), "south")
+
+	if err := repo.ReplaceAll(north, storage.NewPacks(31, 23)); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+	got, err := repo.FindAll(south)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	if want := storage.NewPacks(storage.DefaultPackSizes...); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %+v, want %+v", got, want)
+	}
+
+	if err := repo.ReplaceAll(south, nil); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+	got, err = repo.FindAll(south)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("FindAll() = %+v, want no packs", got)
+	}
+
+	got, err = repo.FindAll(north)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	if want := storage.NewPacks(23, 31); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %+v, want %+v", got, want)
+	}
+}
+
+// TestPackRepo_ConcurrentReplaceAll tests that concurrent replacements of the
+// same tenant are retried on serialization failures, leaving one of the sets.
+// Every round of conflicts commits one of them, so maxAttempts writers all succeed.
+func TestPackRepo_ConcurrentReplaceAll(t *testing.T) {
+	repo := NewPackRepo(newTestPool(t))
+	ctx := tenant.NewContext(context.Background(), "north")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, maxAttempts)
+	for i := range maxAttempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.ReplaceAll(ctx, storage.NewPacks(i+1, i+100))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("ReplaceAll() returned an unexpected error: %v", err)
+		}
+	}
+
+	got, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[1].Size != got[0].Size+99 {
+		t.Errorf("FindAll() = %+v, want one of the sets", got)
+	}
+}
@@ -0,0 +1,142 @@
+// Package postgres implements the storage repositories on PostgreSQL with pgx.
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrations are the schema changes, in order. Migrate records the applied ones
+// by their index, so a released migration must never change: add another one.
+var migrations = []string{
+	`CREATE TABLE pack_sets (
+		tenant TEXT PRIMARY KEY,
+		updated_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE TABLE packs (
+		tenant TEXT NOT NULL REFERENCES pack_sets (tenant) ON DELETE CASCADE,
+		size BIGINT NOT NULL,
+		label TEXT NOT NULL,
+		sku TEXT NOT NULL,
+		cost DOUBLE PRECISION NOT NULL,
+		weight DOUBLE PRECISION NOT NULL,
+		length DOUBLE PRECISION NOT NULL,
+		width DOUBLE PRECISION NOT NULL,
+		height DOUBLE PRECISION NOT NULL,
+		active BOOLEAN NOT NULL,
+		PRIMARY KEY (tenant, size)
+	)`,
+	`CREATE TABLE outbox (
+		id BIGSERIAL PRIMARY KEY,
+		tenant TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		payload JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		delivered_at TIMESTAMPTZ NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX outbox_pending ON outbox (id) WHERE delivered_at IS NULL`,
+	`CREATE TABLE calculations (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL,
+		created_day CHAR(10) NOT NULL,
+		amount BIGINT NOT NULL,
+		total_items BIGINT NOT NULL,
+		excess BIGINT NOT NULL,
+		size_version TEXT NOT NULL,
+		requester TEXT NOT NULL,
+		tenant TEXT NOT NULL
+	);
+	CREATE TABLE calculation_packs (
+		calculation_id BIGINT NOT NULL REFERENCES calculations (id) ON DELETE CASCADE,
+		size BIGINT NOT NULL,
+		pack_count BIGINT NOT NULL,
+		PRIMARY KEY (calculation_id, size)
+	)`,
+	`CREATE TABLE catalogs (
+		tenant TEXT PRIMARY KEY,
+		unit TEXT NOT NULL,
+		rules JSONB NOT NULL
+	)`,
+	`CREATE TABLE scheduled_changes (
+		id BIGSERIAL PRIMARY KEY,
+		tenant TEXT NOT NULL,
+		effective_at TIMESTAMPTZ NOT NULL,
+		packs JSONB NOT NULL
+	);
+	CREATE INDEX scheduled_changes_tenant ON scheduled_changes (tenant, effective_at, id)`,
+}
+
+// migrationLock is the key of the advisory lock serializing Migrate across instances.
+const migrationLock = 7_081_923_461
+
+// Open connects to the database of the connection string and migrates it.
+func Open(ctx context.Context, connString string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// Migrate applies the migrations not applied yet, each in its own transaction.
+// It is safe to run on every start, and by several instances at once.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	if _, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("postgres migration: %w", err)
+	}
+
+	for i, stmt := range migrations {
+		version := i + 1
+		err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			// Released at the end of the transaction
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+				return err
+			}
+
+			var applied bool
+			if err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version,
+			).Scan(&applied); err != nil {
+				return err
+			}
+			if applied {
+				return nil
+			}
+
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("postgres migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// isSerializationFailure reports whether the transaction failed because of a
+// concurrent one, and succeeds when retried.
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	// serialization_failure and deadlock_detected
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
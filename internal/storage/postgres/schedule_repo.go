@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// ScheduleRepo implements the storage.ScheduleRepository interface on PostgreSQL,
+// scoping the changes to the tenant of the context. The packs of a change are
+// stored as JSONB.
+type ScheduleRepo struct {
+	pool *pgxpool.Pool
+}
+
+// NewScheduleRepo creates a schedule repository on the database.
+// The tables must have been created by Migrate.
+func NewScheduleRepo(pool *pgxpool.Pool) *ScheduleRepo {
+	return &ScheduleRepo{pool: pool}
+}
+
+// Add stores the change for the tenant of the context and sets its ID.
+func (r *ScheduleRepo) Add(ctx context.Context, c *storage.ScheduledChange) error {
+	sorted := append([]storage.Pack(nil), c.Packs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Size < sorted[j].Size })
+
+	packs, err := json.Marshal(sorted)
+	if err != nil {
+		return err
+	}
+
+	return r.pool.QueryRow(ctx,
+		`INSERT INTO scheduled_changes (tenant, effective_at, packs) VALUES ($1, $2, $3) RETURNING id`,
+		tenant.FromContext(ctx), c.EffectiveAt, packs,
+	).Scan(&c.ID)
+}
+
+// List returns the changes of the tenant of the context, sorted by EffectiveAt then ID.
+func (r *ScheduleRepo) List(ctx context.Context) ([]storage.ScheduledChange, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, effective_at, packs FROM scheduled_changes
+		WHERE tenant = $1 ORDER BY effective_at, id`, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []storage.ScheduledChange{}
+	for rows.Next() {
+		var c storage.ScheduledChange
+		var at time.Time
+		var packs []byte
+		if err := rows.Scan(&c.ID, &at, &packs); err != nil {
+			return nil, err
+		}
+		c.EffectiveAt = at.UTC()
+		if err := json.Unmarshal(packs, &c.Packs); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+
+	return changes, rows.Err()
+}
+
+// Delete removes the change of the tenant of the context with the given ID,
+// or returns storage.ErrNotFound.
+func (r *ScheduleRepo) Delete(ctx context.Context, id int64) error {
+	tag, err := r.pool.Exec(ctx,
+		`DELETE FROM scheduled_changes WHERE id = $1 AND tenant = $2`, id, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
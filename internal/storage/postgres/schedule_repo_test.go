@@ -0,0 +1,15 @@
+package postgres
+
+import (
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+)
+
+// TestScheduleRepo runs the repository tests shared by the storage backends.
+func TestScheduleRepo(t *testing.T) {
+	storagetest.TestScheduleRepository(t, func(t *testing.T) storage.ScheduleRepository {
+		return NewScheduleRepo(newTestPool(t))
+	})
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a stored item does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ScheduledChange is a set of packs replacing the current one from EffectiveAt on.
+type ScheduledChange struct {
+	// ID is assigned by the repository when the change is added.
+	ID          int64
+	EffectiveAt time.Time
+	Packs       []Pack
+}
+
+// ScheduleRepository defines the contract for the storage of scheduled pack changes.
+type ScheduleRepository interface {
+	// Add stores the change and sets its ID.
+	Add(ctx context.Context, c *ScheduledChange) error
+
+	// List returns all changes, in effect or upcoming, sorted by EffectiveAt then ID.
+	List(ctx context.Context) ([]ScheduledChange, error)
+
+	// Delete removes the change with the given ID, or returns ErrNotFound.
+	Delete(ctx context.Context, id int64) error
+}
@@ -0,0 +1,262 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// CalculationRepo implements the storage.CalculationRepository interface on a SQL database.
+// Timestamps are stored as Unix nanoseconds, together with their UTC day for the daily stats.
+type CalculationRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewCalculationRepo creates a calculation history on the database.
+// The tables must have been created by Migrate.
+func NewCalculationRepo(db *sql.DB, d Dialect) *CalculationRepo {
+	return &CalculationRepo{db: db, dialect: d}
+}
+
+// Save records the calculation and its packs in a single transaction, assigning its ID.
+func (r *CalculationRepo) Save(ctx context.Context, c *storage.Calculation) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO calculations (created_at, created_day, amount, total_items, excess, size_version, requester, tenant)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Timestamp.UnixNano(), c.Timestamp.UTC().Format("2006-01-02"),
+		c.Amount, c.TotalItems, c.Excess, c.SizeVersion, c.Requester, c.Tenant,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for size, count := range c.Packs {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO calculation_packs (calculation_id, size, pack_count) VALUES (?, ?, ?)`,
+			id, size, count,
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.ID = id
+
+	return nil
+}
+
+// Find returns a page of the matching calculations, newest first.
+func (r *CalculationRepo) Find(ctx context.Context, f storage.CalculationFilter) ([]storage.Calculation, int, error) {
+	where, args := whereClause(f, "")
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM calculations`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Both dialects need a LIMIT to accept an OFFSET
+	limit := int64(math.MaxInt64)
+	if f.Limit > 0 {
+		limit = int64(f.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, created_at, amount, total_items, excess, size_version, requester, tenant
+		FROM calculations`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?`,
+		append(args, limit, max(f.Offset, 0))...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := []storage.Calculation{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		var (
+			c  storage.Calculation
+			at int64
+		)
+		if err := rows.Scan(&c.ID, &at, &c.Amount, &c.TotalItems, &c.Excess, &c.SizeVersion, &c.Requester, &c.Tenant); err != nil {
+			return nil, 0, err
+		}
+		c.Timestamp = time.Unix(0, at).UTC()
+		c.Packs = map[int]int{}
+
+		index[c.ID] = len(out)
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.loadPacks(ctx, out, index); err != nil {
+		return nil, 0, err
+	}
+
+	return out, total, nil
+}
+
+// loadPacks fills in the packs of the calculations, indexed by ID.
+func (r *CalculationRepo) loadPacks(ctx context.Context, calcs []storage.Calculation, index map[int64]int) error {
+	if len(calcs) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(calcs))
+	args := make([]any, len(calcs))
+	for i, c := range calcs {
+		placeholders[i] = "?"
+		args[i] = c.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT calculation_id, size, pack_count FROM calculation_packs
+		WHERE calculation_id IN (`+strings.Join(placeholders, ", ")+`)`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var size, count int
+		if err := rows.Scan(&id, &size, &count); err != nil {
+			return err
+		}
+		calcs[index[id]].Packs[size] = count
+	}
+
+	return rows.Err()
+}
+
+// Stats aggregates the matching calculations per day in the database.
+func (r *CalculationRepo) Stats(ctx context.Context, f storage.CalculationFilter) (storage.CalculationStats, error) {
+	where, args := whereClause(f, "")
+
+	stats := storage.CalculationStats{Daily: []storage.DailyCalculationStats{}}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT created_day, COUNT(*), SUM(excess) FROM calculations`+where+`
+		GROUP BY created_day ORDER BY created_day`,
+		args...,
+	)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	days := make(map[string]int)
+	for rows.Next() {
+		var d storage.DailyCalculationStats
+		if err := rows.Scan(&d.Day, &d.Count, &d.TotalExcess); err != nil {
+			return stats, err
+		}
+
+		stats.Count += d.Count
+		stats.TotalExcess += d.TotalExcess
+
+		days[d.Day] = len(stats.Daily)
+		stats.Daily = append(stats.Daily, d)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	// Sum the packs of every size per day, then pick the most used one
+	whereAlias, _ := whereClause(f, "c.")
+	packRows, err := r.db.QueryContext(ctx,
+		`SELECT c.created_day, p.size, SUM(p.pack_count)
+		FROM calculations c JOIN calculation_packs p ON p.calculation_id = c.id`+
+			whereAlias+`
+		GROUP BY c.created_day, p.size`,
+		args...,
+	)
+	if err != nil {
+		return stats, err
+	}
+	defer packRows.Close()
+
+	packsPerDay := make(map[string]map[int]int)
+	for packRows.Next() {
+		var day string
+		var size, count int
+		if err := packRows.Scan(&day, &size, &count); err != nil {
+			return stats, err
+		}
+		if packsPerDay[day] == nil {
+			packsPerDay[day] = make(map[int]int)
+		}
+		packsPerDay[day][size] = count
+	}
+	if err := packRows.Err(); err != nil {
+		return stats, err
+	}
+
+	for day, packs := range packsPerDay {
+		d := &stats.Daily[days[day]]
+		d.MostUsedSize, d.MostUsedSizePacks = storage.MostUsedSize(packs)
+	}
+
+	return stats, nil
+}
+
+// whereClause returns the WHERE clause selecting the calculations matching the filter,
+// with its arguments. The columns are prefixed by alias, such as "c.", when joining tables.
+func whereClause(f storage.CalculationFilter, alias string) (string, []any) {
+	var conds []string
+	var args []any
+
+	if !f.From.IsZero() {
+		conds = append(conds, alias+"created_at >= ?")
+		args = append(args, f.From.UnixNano())
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, alias+"created_at < ?")
+		args = append(args, f.To.UnixNano())
+	}
+	if f.Tenant != "" {
+		conds = append(conds, alias+"tenant = ?")
+		args = append(args, f.Tenant)
+	}
+	if f.Requester != "" {
+		conds = append(conds, alias+"requester = ?")
+		args = append(args, f.Requester)
+	}
+	if f.MinAmount > 0 {
+		conds = append(conds, alias+"amount >= ?")
+		args = append(args, f.MinAmount)
+	}
+	if f.MaxAmount > 0 {
+		conds = append(conds, alias+"amount <= ?")
+		args = append(args, f.MaxAmount)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,196 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestDB opens a migrated in-memory SQLite database.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open() returned an unexpected error: %v", err)
+	}
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(context.Background(), db, SQLite); err != nil {
+		t.Fatalf("Migrate() returned an unexpected error: %v", err)
+	}
+	// Migrations are idempotent
+	if err := Migrate(context.Background(), db, SQLite); err != nil {
+		t.Fatalf("Migrate() second run returned an unexpected error: %v", err)
+	}
+
+	return db
+}
+
+// seedCalculations saves a small history spread over two days.
+func seedCalculations(t *testing.T, repo storage.CalculationRepository) time.Time {
+	t.Helper()
+
+	day1 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+
+	calculations := []storage.Calculation{
+		{Timestamp: day1, Amount: 1, Packs: map[int]int{250: 1}, TotalItems: 250, Excess: 249, SizeVersion: "v1", Requester: "a", Tenant: "north"},
+		{Timestamp: day1.Add(time.Hour), Amount: 750, Packs: map[int]int{250: 1, 500: 1}, TotalItems: 750, SizeVersion: "v1", Requester: "b", Tenant: "north"},
+		{Timestamp: day2, Amount: 1200, Packs: map[int]int{1000: 1, 250: 1}, TotalItems: 1250, Excess: 50, SizeVersion: "v2", Requester: "a", Tenant: "south"},
+	}
+	for i := range calculations {
+		if err := repo.Save(context.Background(), &calculations[i]); err != nil {
+			t.Fatalf("Save() returned an unexpected error: %v", err)
+		}
+		if calculations[i].ID != int64(i+1) {
+			t.Errorf("Save() assigned ID %d, want %d", calculations[i].ID, i+1)
+		}
+	}
+
+	return day1
+}
+
+// TestCalculationRepo_Find tests filtering, ordering, pagination and loading the packs.
+func TestCalculationRepo_Find(t *testing.T) {
+	repo := NewCalculationRepo(newTestDB(t), SQLite)
+	day1 := seedCalculations(t, repo)
+
+	tests := []struct {
+		name      string
+		filter    storage.CalculationFilter
+		wantIDs   []int64
+		wantTotal int
+	}{
+		{name: "All, newest first", filter: storage.CalculationFilter{}, wantIDs: []int64{3, 2, 1}, wantTotal: 3},
+		{name: "Paginated", filter: storage.CalculationFilter{Limit: 1, Offset: 1}, wantIDs: []int64{2}, wantTotal: 3},
+		{name: "Offset past the end", filter: storage.CalculationFilter{Offset: 10}, wantIDs: []int64{}, wantTotal: 3},
+		{name: "By tenant", filter: storage.CalculationFilter{Tenant: "north"}, wantIDs: []int64{2, 1}, wantTotal: 2},
+		{name: "By requester", filter: storage.CalculationFilter{Requester: "a"}, wantIDs: []int64{3, 1}, wantTotal: 2},
+		{name: "By amount", filter: storage.CalculationFilter{MinAmount: 2, MaxAmount: 1000}, wantIDs: []int64{2}, wantTotal: 1},
+		{
+			name:      "By time range",
+			filter:    storage.CalculationFilter{From: day1.Add(time.Hour), To: day1.Add(24 * time.Hour)},
+			wantIDs:   []int64{2},
+			wantTotal: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := repo.Find(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("Find() returned an unexpected error: %v", err)
+			}
+
+			ids := make([]int64, 0, len(got))
+			for _, c := range got {
+				ids = append(ids, c.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Find() IDs = %v, want %v", ids, tt.wantIDs)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("Find() total = %d, want %d", total, tt.wantTotal)
+			}
+		})
+	}
+
+	got, _, err := repo.Find(context.Background(), storage.CalculationFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("Find() returned an unexpected error: %v", err)
+	}
+	want := storage.Calculation{
+		ID:          3,
+		Timestamp:   day1.Add(24 * time.Hour),
+		Amount:      1200,
+		Packs:       map[int]int{1000: 1, 250: 1},
+		TotalItems:  1250,
+		Excess:      50,
+		SizeVersion: "v2",
+		Requester:   "a",
+		Tenant:      "south",
+	}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("Find() = %+v, want %+v", got[0], want)
+	}
+}
+
+// TestCalculationRepo_Stats tests the aggregates.
+func TestCalculationRepo_Stats(t *testing.T) {
+	repo := NewCalculationRepo(newTestDB(t), SQLite)
+	day1 := seedCalculations(t, repo)
+
+	got, err := repo.Stats(context.Background(), storage.CalculationFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("Stats() returned an unexpected error: %v", err)
+	}
+
+	want := storage.CalculationStats{
+		Count:       3,
+		TotalExcess: 299,
+		Daily: []storage.DailyCalculationStats{
+			{Day: "2025-03-01", Count: 2, TotalExcess: 249, MostUsedSize: 250, MostUsedSizePacks: 2},
+			{Day: "2025-03-02", Count: 1, TotalExcess: 50, MostUsedSize: 250, MostUsedSizePacks: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// Filters apply to the joined packs too
+	got, err = repo.Stats(context.Background(), storage.CalculationFilter{From: day1.Add(time.Hour), Requester: "b"})
+	if err != nil {
+		t.Fatalf("Stats() returned an unexpected error: %v", err)
+	}
+	want = storage.CalculationStats{
+		Count: 1,
+		Daily: []storage.DailyCalculationStats{
+			{Day: "2025-03-01", Count: 1, MostUsedSize: 250, MostUsedSizePacks: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+// TestMigrate_AddsColumns tests that tables created before a column existed get it.
+func TestMigrate_AddsColumns(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open() returned an unexpected error: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	// The calculations table as created before tenants
+	if _, err := db.Exec(`CREATE TABLE calculations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, created_at BIGINT NOT NULL, created_day CHAR(10) NOT NULL,
+		amount BIGINT NOT NULL, total_items BIGINT NOT NULL, excess BIGINT NOT NULL,
+		size_version VARCHAR(32) NOT NULL, requester VARCHAR(255) NOT NULL)`); err != nil {
+		t.Fatalf("Exec() returned an unexpected error: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO calculations (created_at, created_day, amount, total_items, excess, size_version, requester)
+		VALUES (0, '1970-01-01', 1, 250, 249, 'v1', 'a')`); err != nil {
+		t.Fatalf("Exec() returned an unexpected error: %v", err)
+	}
+
+	if err := Migrate(context.Background(), db, SQLite); err != nil {
+		t.Fatalf("Migrate() returned an unexpected error: %v", err)
+	}
+
+	got, total, err := NewCalculationRepo(db, SQLite).Find(context.Background(), storage.CalculationFilter{Tenant: "default"})
+	if err != nil {
+		t.Fatalf("Find() returned an unexpected error: %v", err)
+	}
+	if total != 1 || got[0].Tenant != "default" {
+		t.Errorf("Find() = %+v, %d, want the old calculation in the default tenant", got, total)
+	}
+}
@@ -0,0 +1,72 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// CatalogRepo implements the storage.CatalogRepository interface on a SQL database,
+// scoping the catalog to the tenant of the context. The rules are stored as JSON.
+type CatalogRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewCatalogRepo creates a catalog repository on the database.
+// The tables must have been created by Migrate.
+func NewCatalogRepo(db *sql.DB, d Dialect) *CatalogRepo {
+	return &CatalogRepo{db: db, dialect: d}
+}
+
+// Get returns the catalog of the tenant of the context, the empty catalog when
+// the tenant never saved one.
+func (r *CatalogRepo) Get(ctx context.Context) (storage.Catalog, error) {
+	var c storage.Catalog
+	var rules string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT unit, rules FROM catalogs WHERE tenant = ?`, tenant.FromContext(ctx),
+	).Scan(&c.Unit, &rules)
+	if err == sql.ErrNoRows {
+		return storage.Catalog{}, nil
+	}
+	if err != nil {
+		return storage.Catalog{}, err
+	}
+
+	if err := json.Unmarshal([]byte(rules), &c.Rules); err != nil {
+		return storage.Catalog{}, err
+	}
+
+	return c, nil
+}
+
+// Save replaces the catalog of the tenant of the context.
+func (r *CatalogRepo) Save(ctx context.Context, c storage.Catalog) error {
+	id := tenant.FromContext(ctx)
+
+	rules, err := json.Marshal(c.Rules)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM catalogs WHERE tenant = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO catalogs (tenant, unit, rules) VALUES (?, ?, ?)`, id, c.Unit, string(rules),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,37 @@
+package sqlstore
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// TestCatalogRepo runs the repository tests shared by the storage backends.
+func TestCatalogRepo(t *testing.T) {
+	storagetest.TestCatalogRepository(t, func(t *testing.T) storage.CatalogRepository {
+		return NewCatalogRepo(newTestDB(t), SQLite)
+	})
+}
+
+// TestCatalogRepo_Tenants tests that the catalog of every tenant is kept apart.
+func TestCatalogRepo_Tenants(t *testing.T) {
+	repo := NewCatalogRepo(newTestDB(t), SQLite)
+	north := tenant.NewContext(context.Background(), "north")
+	south := tenant.NewContext(context.Background(), "south")
+
+	want := storage.Catalog{Unit: "kg", Rules: []storage.Rule{{Kind: "max_count", Size: 250, Count: 4}}}
+	if err := repo.Save(north, want); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+
+	if got, err := repo.Get(north); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %+v, %v, want %+v", got, err, want)
+	}
+	if got, err := repo.Get(south); err != nil || !reflect.DeepEqual(got, storage.Catalog{}) {
+		t.Errorf("Get() = %+v, %v, want the empty catalog", got, err)
+	}
+}
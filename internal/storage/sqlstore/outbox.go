@@ -0,0 +1,93 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// maxErrorLength bounds the last delivery error kept for an outbox event.
+const maxErrorLength = 1024
+
+// OutboxRepo implements the storage.Outbox interface on the outbox table
+// written by PackRepo.
+type OutboxRepo struct {
+	db      *sql.DB
+	dialect Dialect
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// NewOutboxRepo creates the outbox of the database.
+// The tables must have been created by Migrate.
+func NewOutboxRepo(db *sql.DB, d Dialect) *OutboxRepo {
+	return &OutboxRepo{db: db, dialect: d, now: time.Now}
+}
+
+// Pending returns up to limit undelivered events, oldest first.
+func (r *OutboxRepo) Pending(ctx context.Context, limit, maxAttempts int) ([]storage.OutboxEvent, error) {
+	query := `SELECT id, tenant, event_type, payload, created_at, attempts FROM outbox WHERE delivered_at IS NULL`
+	var args []any
+	if maxAttempts > 0 {
+		query += ` AND attempts < ?`
+		args = append(args, maxAttempts)
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []storage.OutboxEvent{}
+	for rows.Next() {
+		var e storage.OutboxEvent
+		var payload string
+		var createdAt int64
+		if err := rows.Scan(&e.ID, &e.Tenant, &e.Type, &payload, &createdAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		e.CreatedAt = time.Unix(0, createdAt).UTC()
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// MarkDelivered settles the event with the given ID.
+func (r *OutboxRepo) MarkDelivered(ctx context.Context, id int64) error {
+	return r.update(ctx, `UPDATE outbox SET delivered_at = ? WHERE id = ?`, r.now().UnixNano(), id)
+}
+
+// MarkFailed counts a failed delivery of the event with the given ID.
+func (r *OutboxRepo) MarkFailed(ctx context.Context, id int64, reason string) error {
+	if len(reason) > maxErrorLength {
+		reason = reason[:maxErrorLength]
+	}
+
+	return r.update(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?`, reason, id)
+}
+
+// update runs a statement updating a single event, or returns storage.ErrNotFound.
+func (r *OutboxRepo) update(ctx context.Context, query string, args ...any) error {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
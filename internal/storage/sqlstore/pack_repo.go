@@ -0,0 +1,125 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// PackRepo implements the storage.PackRepository interface on a SQL database,
+// scoping the packs to the tenant of the context. Every ReplaceAll journals an
+// storage.OutboxPackSizesChanged event in the outbox table in the same transaction,
+// so the change is never committed without its notification (see OutboxRepo).
+type PackRepo struct {
+	db      *sql.DB
+	dialect Dialect
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// NewPackRepo creates a pack repository on the database.
+// The tables must have been created by Migrate.
+func NewPackRepo(db *sql.DB, d Dialect) *PackRepo {
+	return &PackRepo{db: db, dialect: d, now: time.Now}
+}
+
+// FindAll returns the packs of the tenant of the context sorted by size,
+// storage.DefaultPackSizes when the tenant never set its packs.
+func (r *PackRepo) FindAll(ctx context.Context) ([]storage.Pack, error) {
+	id := tenant.FromContext(ctx)
+
+	var updatedAt int64
+	err := r.db.QueryRowContext(ctx, `SELECT updated_at FROM pack_sets WHERE tenant = ?`, id).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		return storage.NewPacks(storage.DefaultPackSizes...), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT size, label, sku, cost, weight, length, width, height, active
+		FROM packs WHERE tenant = ? ORDER BY size`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packs := []storage.Pack{}
+	for rows.Next() {
+		var p storage.Pack
+		var active int
+		if err := rows.Scan(&p.Size, &p.Label, &p.SKU, &p.Cost, &p.Weight,
+			&p.Dimensions.Length, &p.Dimensions.Width, &p.Dimensions.Height, &active); err != nil {
+			return nil, err
+		}
+		p.Active = active != 0
+		packs = append(packs, p)
+	}
+
+	return packs, rows.Err()
+}
+
+// ReplaceAll replaces the packs of the tenant of the context and journals the
+// change in the outbox, in a single transaction.
+func (r *PackRepo) ReplaceAll(ctx context.Context, packs []storage.Pack) error {
+	id := tenant.FromContext(ctx)
+	now := r.now()
+
+	sorted := append([]storage.Pack(nil), packs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Size < sorted[j].Size })
+
+	payload, err := json.Marshal(storage.PackSizesChangedPayload{Sizes: storage.ActiveSizes(sorted)})
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM packs WHERE tenant = ?`, id); err != nil {
+		return err
+	}
+	for _, p := range sorted {
+		active := 0
+		if p.Active {
+			active = 1
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO packs (tenant, size, label, sku, cost, weight, length, width, height, active)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, p.Size, p.Label, p.SKU, p.Cost, p.Weight,
+			p.Dimensions.Length, p.Dimensions.Width, p.Dimensions.Height, active,
+		); err != nil {
+			return err
+		}
+	}
+
+	// The set row tells an empty set from a tenant that never set its packs
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pack_sets WHERE tenant = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO pack_sets (tenant, updated_at) VALUES (?, ?)`, id, now.UnixNano(),
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO outbox (tenant, event_type, payload, created_at) VALUES (?, ?, ?, ?)`,
+		id, storage.OutboxPackSizesChanged, string(payload), now.UnixNano(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
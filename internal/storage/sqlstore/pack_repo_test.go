@@ -0,0 +1,173 @@
+package sqlstore
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// TestPackRepo runs the repository tests shared by the storage backends.
+func TestPackRepo(t *testing.T) {
+	storagetest.TestPackRepository(t, func(t *testing.T) storage.PackRepository {
+		return NewPackRepo(newTestDB(t), SQLite)
+	})
+}
+
+func TestPackRepo_ReplaceAll(t *testing.T) {
+	repo := NewPackRepo(newTestDB(t), SQLite)
+	north := tenant.NewContext(context.Background(), "north")
+	south := tenant.NewContext(context.Background(), "south")
+
+	// A tenant that never set its packs has the default ones
+	got, err := repo.FindAll(north)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	if want := storage.NewPacks(storage.DefaultPackSizes...); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %+v, want %+v", got, want)
+	}
+
+	packs := []storage.Pack{
+		{Size: 500, Label: "Box", SKU: "B500", Cost: 1.5, Weight: 0.2, Dimensions: storage.Dimensions{Length: 3, Width: 2, Height: 1}, Active: true},
+		{Size: 23, Active: false},
+		{Size: 250, Active: true},
+	}
+	if err := repo.ReplaceAll(north, packs); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+
+	got, err = repo.FindAll(north)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	want := []storage.Pack{packs[1], packs[2], packs[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %+v, want %+v", got, want)
+	}
+
+	// Other tenants are untouched
+	got, err = repo.FindAll(south)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	if sizes := storage.ActiveSizes(got); !reflect.DeepEqual(sizes, storage.DefaultPackSizes) {
+		t.Errorf("FindAll() sizes = %v, want %v", sizes, storage.DefaultPackSizes)
+	}
+
+	// An empty set stays empty instead of falling back to the defaults
+	if err := repo.ReplaceAll(south, nil); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+	got, err = repo.FindAll(south)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("FindAll() = %+v, want no packs", got)
+	}
+}
+
+// TestPackRepo_Outbox tests that the outbox event is committed with the packs, or not at all.
+func TestPackRepo_Outbox(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewPackRepo(db, SQLite)
+	outbox := NewOutboxRepo(db, SQLite)
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	repo.now = func() time.Time { return now }
+	ctx := tenant.NewContext(context.Background(), "north")
+
+	if err := repo.ReplaceAll(ctx, []storage.Pack{{Size: 53, Active: true}, {Size: 31, Active: false}, {Size: 23, Active: true}}); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+
+	// Duplicate sizes violate the primary key, rolling back the outbox event too
+	if err := repo.ReplaceAll(ctx, storage.NewPacks(250, 250)); err == nil {
+		t.Fatal("ReplaceAll() expected an error for duplicate sizes")
+	}
+	packs, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+	if sizes := storage.ActiveSizes(packs); !reflect.DeepEqual(sizes, []int{23, 53}) {
+		t.Errorf("FindAll() sizes = %v, want the packs before the failed replacement", sizes)
+	}
+
+	events, err := outbox.Pending(context.Background(), 10, 0)
+	if err != nil {
+		t.Fatalf("Pending() returned an unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Pending() got %d events, want 1", len(events))
+	}
+
+	e := events[0]
+	if e.Tenant != "north" || e.Type != storage.OutboxPackSizesChanged || !e.CreatedAt.Equal(now) || e.Attempts != 0 {
+		t.Errorf("Pending() got = %+v", e)
+	}
+	var payload storage.PackSizesChangedPayload
+	if err := json.Unmarshal(e.Payload, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", e.Payload, err)
+	}
+	if !reflect.DeepEqual(payload.Sizes, []int{23, 53}) {
+		t.Errorf("payload sizes = %v, want [23 53]", payload.Sizes)
+	}
+}
+
+func TestOutboxRepo(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewPackRepo(db, SQLite)
+	outbox := NewOutboxRepo(db, SQLite)
+	ctx := context.Background()
+
+	for _, size := range []int{1, 2, 3} {
+		if err := repo.ReplaceAll(ctx, storage.NewPacks(size)); err != nil {
+			t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+		}
+	}
+
+	if err := outbox.MarkDelivered(ctx, 1); err != nil {
+		t.Fatalf("MarkDelivered() returned an unexpected error: %v", err)
+	}
+	for range 2 {
+		if err := outbox.MarkFailed(ctx, 2, "unexpected status 503"); err != nil {
+			t.Fatalf("MarkFailed() returned an unexpected error: %v", err)
+		}
+	}
+	if err := outbox.MarkDelivered(ctx, 42); err != storage.ErrNotFound {
+		t.Errorf("MarkDelivered() error = %v, want %v", err, storage.ErrNotFound)
+	}
+
+	testCases := []struct {
+		name        string
+		limit       int
+		maxAttempts int
+		wantIDs     []int64
+	}{
+		{name: "All pending", limit: 10, wantIDs: []int64{2, 3}},
+		{name: "Limit", limit: 1, wantIDs: []int64{2}},
+		{name: "Max attempts", limit: 10, maxAttempts: 2, wantIDs: []int64{3}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := outbox.Pending(ctx, tc.limit, tc.maxAttempts)
+			if err != nil {
+				t.Fatalf("Pending() returned an unexpected error: %v", err)
+			}
+
+			ids := []int64{}
+			for _, e := range events {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.wantIDs) {
+				t.Errorf("Pending() IDs = %v, want %v", ids, tc.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// ScheduleRepo implements the storage.ScheduleRepository interface on a SQL database,
+// scoping the changes to the tenant of the context. The packs of a change are
+// stored as JSON and its time as Unix nanoseconds.
+type ScheduleRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewScheduleRepo creates a schedule repository on the database.
+// The tables must have been created by Migrate.
+func NewScheduleRepo(db *sql.DB, d Dialect) *ScheduleRepo {
+	return &ScheduleRepo{db: db, dialect: d}
+}
+
+// Add stores the change for the tenant of the context and sets its ID.
+func (r *ScheduleRepo) Add(ctx context.Context, c *storage.ScheduledChange) error {
+	sorted := append([]storage.Pack(nil), c.Packs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Size < sorted[j].Size })
+
+	packs, err := json.Marshal(sorted)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO scheduled_changes (tenant, effective_at, packs) VALUES (?, ?, ?)`,
+		tenant.FromContext(ctx), c.EffectiveAt.UnixNano(), string(packs),
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = id
+
+	return nil
+}
+
+// List returns the changes of the tenant of the context, sorted by EffectiveAt then ID.
+func (r *ScheduleRepo) List(ctx context.Context) ([]storage.ScheduledChange, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, effective_at, packs FROM scheduled_changes
+		WHERE tenant = ? ORDER BY effective_at, id`, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []storage.ScheduledChange{}
+	for rows.Next() {
+		var c storage.ScheduledChange
+		var at int64
+		var packs string
+		if err := rows.Scan(&c.ID, &at, &packs); err != nil {
+			return nil, err
+		}
+		c.EffectiveAt = time.Unix(0, at).UTC()
+		if err := json.Unmarshal([]byte(packs), &c.Packs); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+
+	return changes, rows.Err()
+}
+
+// Delete removes the change of the tenant of the context with the given ID,
+// or returns storage.ErrNotFound.
+func (r *ScheduleRepo) Delete(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM scheduled_changes WHERE id = ? AND tenant = ?`, id, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
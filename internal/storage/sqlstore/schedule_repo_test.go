@@ -0,0 +1,42 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// TestScheduleRepo runs the repository tests shared by the storage backends.
+func TestScheduleRepo(t *testing.T) {
+	storagetest.TestScheduleRepository(t, func(t *testing.T) storage.ScheduleRepository {
+		return NewScheduleRepo(newTestDB(t), SQLite)
+	})
+}
+
+// TestScheduleRepo_Tenants tests that a tenant neither lists nor deletes the
+// changes of another.
+func TestScheduleRepo_Tenants(t *testing.T) {
+	repo := NewScheduleRepo(newTestDB(t), SQLite)
+	north := tenant.NewContext(context.Background(), "north")
+	south := tenant.NewContext(context.Background(), "south")
+
+	c := &storage.ScheduledChange{EffectiveAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Packs: storage.NewPacks(250)}
+	if err := repo.Add(north, c); err != nil {
+		t.Fatalf("Add() returned an unexpected error: %v", err)
+	}
+
+	if got, err := repo.List(south); err != nil || len(got) != 0 {
+		t.Errorf("List() = %+v, %v, want no changes", got, err)
+	}
+	if err := repo.Delete(south, c.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, storage.ErrNotFound)
+	}
+	if got, err := repo.List(north); err != nil || len(got) != 1 {
+		t.Errorf("List() = %+v, %v, want the change", got, err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package sqlstore implements the storage repositories on top of database/sql.
+// The driver is chosen by the caller, the SQL differences are covered by a Dialect.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Dialect describes the SQL differences between the supported databases.
+type Dialect struct {
+	// Name identifies the dialect in errors.
+	Name string
+	// AutoIncrement is the column definition of an auto-incremented primary key.
+	AutoIncrement string
+}
+
+var (
+	// MySQL is the dialect of MySQL and MariaDB (github.com/go-sql-driver/mysql).
+	MySQL = Dialect{
+		Name:          "mysql",
+		AutoIncrement: "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY",
+	}
+	// SQLite is the dialect of SQLite (modernc.org/sqlite).
+	SQLite = Dialect{
+		Name:          "sqlite",
+		AutoIncrement: "INTEGER PRIMARY KEY AUTOINCREMENT",
+	}
+)
+
+// schema returns the statements creating the tables, in order.
+func (d Dialect) schema() []string {
+	return []string{
+		`CREATE TABLE IF NOT EXISTS calculations (
+			id ` + d.AutoIncrement + `,
+			created_at BIGINT NOT NULL,
+			created_day CHAR(10) NOT NULL,
+			amount BIGINT NOT NULL,
+			total_items BIGINT NOT NULL,
+			excess BIGINT NOT NULL,
+			size_version VARCHAR(32) NOT NULL,
+			requester VARCHAR(255) NOT NULL,
+			tenant VARCHAR(64) NOT NULL DEFAULT 'default'
+		)`,
+		`CREATE TABLE IF NOT EXISTS calculation_packs (
+			calculation_id BIGINT NOT NULL,
+			size BIGINT NOT NULL,
+			pack_count BIGINT NOT NULL,
+			PRIMARY KEY (calculation_id, size)
+		)`,
+		`CREATE TABLE IF NOT EXISTS pack_sets (
+			tenant VARCHAR(64) NOT NULL PRIMARY KEY,
+			updated_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS packs (
+			tenant VARCHAR(64) NOT NULL,
+			size BIGINT NOT NULL,
+			label VARCHAR(255) NOT NULL,
+			sku VARCHAR(64) NOT NULL,
+			cost DOUBLE NOT NULL,
+			weight DOUBLE NOT NULL,
+			length DOUBLE NOT NULL,
+			width DOUBLE NOT NULL,
+			height DOUBLE NOT NULL,
+			active SMALLINT NOT NULL,
+			PRIMARY KEY (tenant, size)
+		)`,
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id ` + d.AutoIncrement + `,
+			tenant VARCHAR(64) NOT NULL,
+			event_type VARCHAR(64) NOT NULL,
+			payload TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			delivered_at BIGINT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			last_error VARCHAR(1024) NOT NULL DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS catalogs (
+			tenant VARCHAR(64) NOT NULL PRIMARY KEY,
+			unit VARCHAR(64) NOT NULL,
+			rules TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS scheduled_changes (
+			id ` + d.AutoIncrement + `,
+			tenant VARCHAR(64) NOT NULL,
+			effective_at BIGINT NOT NULL,
+			packs TEXT NOT NULL
+		)`,
+	}
+}
+
+// columns are the columns added after their table was created, with their definition.
+// Rows recorded before a column existed get its default.
+var columns = []struct {
+	table, name, definition string
+}{
+	{table: "calculations", name: "tenant", definition: "VARCHAR(64) NOT NULL DEFAULT 'default'"},
+}
+
+// Migrate creates the missing tables and columns. It is safe to run on every start.
+func Migrate(ctx context.Context, db *sql.DB, d Dialect) error {
+	for _, stmt := range d.schema() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s migration: %w", d.Name, err)
+		}
+	}
+
+	for _, c := range columns {
+		// Selecting a missing column fails in every dialect
+		if _, err := db.ExecContext(ctx, `SELECT `+c.name+` FROM `+c.table+` WHERE 1 = 0`); err == nil {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, `ALTER TABLE `+c.table+` ADD COLUMN `+c.name+` `+c.definition); err != nil {
+			return fmt.Errorf("%s migration: %w", d.Name, err)
+		}
+	}
+
+	return nil
+}
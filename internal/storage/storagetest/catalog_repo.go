@@ -0,0 +1,111 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// TestCatalogRepository tests a storage.CatalogRepository implementation.
+// newRepo returns an empty repository, every subtest uses its own.
+//
+// A repository must return the empty catalog until Save is called, then the
+// last saved catalog with its rules in order, as copies that the callers cannot
+// change the catalog through. A canceled context fails without changing it.
+func TestCatalogRepository(t *testing.T, newRepo func(t *testing.T) storage.CatalogRepository) {
+	t.Run("Empty", func(t *testing.T) { testCatalogEmpty(t, newRepo(t)) })
+	t.Run("Save", func(t *testing.T) { testCatalogSave(t, newRepo(t)) })
+	t.Run("Copies", func(t *testing.T) { testCatalogCopies(t, newRepo(t)) })
+	t.Run("CanceledContext", func(t *testing.T) { testCatalogCanceledContext(t, newRepo(t)) })
+}
+
+// getCatalog returns the catalog of the repository, failing the test on error.
+func getCatalog(t *testing.T, repo storage.CatalogRepository) storage.Catalog {
+	t.Helper()
+
+	c, err := repo.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get() returned an unexpected error: %v", err)
+	}
+
+	return c
+}
+
+// testCatalogEmpty tests that a new repository has the empty catalog.
+func testCatalogEmpty(t *testing.T, repo storage.CatalogRepository) {
+	if got := getCatalog(t, repo); !reflect.DeepEqual(got, storage.Catalog{}) {
+		t.Errorf("Get() got = %+v, want the empty catalog", got)
+	}
+}
+
+// testCatalogSave tests that every save replaces the whole catalog.
+func testCatalogSave(t *testing.T, repo storage.CatalogRepository) {
+	tests := []struct {
+		name    string
+		catalog storage.Catalog
+	}{
+		{name: "Unit", catalog: storage.Catalog{Unit: "kg"}},
+		{
+			name: "Rules in order",
+			catalog: storage.Catalog{Unit: "g", Rules: []storage.Rule{
+				{Kind: "max_count", Size: 250, Count: 4},
+				{Kind: "forbidden", Sizes: []int{250, 500}},
+				{Kind: "min_amount", Size: 5000, Amount: 10_000},
+			}},
+		},
+		{name: "No rules", catalog: storage.Catalog{Unit: "g", Rules: []storage.Rule{}}},
+		{name: "Pieces", catalog: storage.Catalog{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.Save(context.Background(), tt.catalog); err != nil {
+				t.Fatalf("Save() returned an unexpected error: %v", err)
+			}
+
+			if got := getCatalog(t, repo); !reflect.DeepEqual(got, tt.catalog) {
+				t.Errorf("Get() got = %+v, want %+v", got, tt.catalog)
+			}
+		})
+	}
+}
+
+// testCatalogCopies tests that changing the rules passed to Save or returned by
+// Get does not change the catalog of the repository.
+func testCatalogCopies(t *testing.T, repo storage.CatalogRepository) {
+	input := storage.Catalog{Rules: []storage.Rule{{Kind: "forbidden", Sizes: []int{250, 500}}}}
+	if err := repo.Save(context.Background(), input); err != nil {
+		t.Fatalf("Save() returned an unexpected error: %v", err)
+	}
+	input.Rules[0].Sizes[0] = 1
+
+	got := getCatalog(t, repo)
+	want := storage.Catalog{Rules: []storage.Rule{{Kind: "forbidden", Sizes: []int{250, 500}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() was modified by a change of the Save() input. got = %+v, want %+v", got, want)
+	}
+
+	got.Rules[0].Sizes[0] = 1
+	if got := getCatalog(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() was modified by external slice change. got = %+v, want %+v", got, want)
+	}
+}
+
+// testCatalogCanceledContext tests that a canceled context is honoured.
+func testCatalogCanceledContext(t *testing.T, repo storage.CatalogRepository) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.Get(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get() error = %v, want %v", err, context.Canceled)
+	}
+	if err := repo.Save(ctx, storage.Catalog{Unit: "kg"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Save() error = %v, want %v", err, context.Canceled)
+	}
+
+	if got := getCatalog(t, repo); !reflect.DeepEqual(got, storage.Catalog{}) {
+		t.Errorf("Get() got = %+v after canceled Save()", got)
+	}
+}
@@ -0,0 +1,146 @@
+// Package storagetest implements tests of the storage repositories, run by
+// every backend so they all behave like the in-memory one.
+//
+// The tests take a constructor of the repository under test, so a new backend
+// runs them from its own tests:
+//
+//	func TestPackRepo(t *testing.T) {
+//		storagetest.TestPackRepository(t, func(t *testing.T) storage.PackRepository {
+//			return NewPackRepo(newTestDB(t))
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// TestPackRepository tests a storage.PackRepository implementation.
+// newRepo returns an empty repository, every subtest uses its own.
+//
+// A repository must return the default packs until ReplaceAll is called, the
+// packs sorted ascending by size, and copies that the callers cannot change
+// the packs through. A canceled context fails without changing the packs.
+// Concurrent readers must only see complete sets written by ReplaceAll.
+func TestPackRepository(t *testing.T, newRepo func(t *testing.T) storage.PackRepository) {
+	t.Run("Defaults", func(t *testing.T) { testDefaults(t, newRepo(t)) })
+	t.Run("ReplaceAll", func(t *testing.T) { testReplaceAll(t, newRepo(t)) })
+	t.Run("Copies", func(t *testing.T) { testCopies(t, newRepo(t)) })
+	t.Run("CanceledContext", func(t *testing.T) { testCanceledContext(t, newRepo(t)) })
+	t.Run("ConcurrentReadWrite", func(t *testing.T) { testConcurrentReadWrite(t, newRepo(t)) })
+}
+
+// findAll returns the packs of the repository, failing the test on error.
+func findAll(t *testing.T, repo storage.PackRepository) []storage.Pack {
+	t.Helper()
+
+	packs, err := repo.FindAll(context.Background())
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+
+	return packs
+}
+
+// testDefaults tests that a new repository has the default packs.
+func testDefaults(t *testing.T, repo storage.PackRepository) {
+	if got, want := findAll(t, repo), storage.NewPacks(storage.DefaultPackSizes...); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() got = %v, want %v", got, want)
+	}
+}
+
+// testReplaceAll tests replacing and sorting.
+func testReplaceAll(t *testing.T, repo storage.PackRepository) {
+	tests := []struct {
+		name    string
+		input   []storage.Pack
+		want    []storage.Pack
+		wantErr bool
+	}{
+		{
+			name:    "Replace with new sorted list",
+			input:   storage.NewPacks(10, 20, 30),
+			want:    storage.NewPacks(10, 20, 30),
+			wantErr: false,
+		},
+		{
+			name:    "Replace with unsorted list",
+			input:   storage.NewPacks(20, 50, 10),
+			want:    storage.NewPacks(10, 20, 50), // Should be sorted
+			wantErr: false,
+		},
+		{
+			name:    "Keep inactive packs and attributes",
+			input:   []storage.Pack{{Size: 500, Label: "Box", SKU: "4006381333931", Cost: 1.5, Weight: 0.2, Dimensions: storage.Dimensions{Length: 10, Width: 10, Height: 5}}, {Size: 250, Active: true}},
+			want:    []storage.Pack{{Size: 250, Active: true}, {Size: 500, Label: "Box", SKU: "4006381333931", Cost: 1.5, Weight: 0.2, Dimensions: storage.Dimensions{Length: 10, Width: 10, Height: 5}}},
+			wantErr: false,
+		},
+		{
+			name:    "Replace with empty list",
+			input:   []storage.Pack{},
+			want:    []storage.Pack{},
+			wantErr: false,
+		},
+		{
+			name:    "Replace with nil list",
+			input:   nil,
+			want:    []storage.Pack{},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.ReplaceAll(context.Background(), tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("ReplaceAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := findAll(t, repo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindAll() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testCopies tests that changing the packs passed to ReplaceAll or returned by
+// FindAll does not change the packs of the repository.
+func testCopies(t *testing.T, repo storage.PackRepository) {
+	expected := storage.NewPacks(250, 500, 1000, 2000, 5000)
+
+	sizes := findAll(t, repo)
+	sizes[0].Size = 9999
+	if got := findAll(t, repo); !reflect.DeepEqual(got, expected) {
+		t.Errorf("FindAll() was modified by external slice change. got = %v, want %v", got, expected)
+	}
+
+	input := storage.NewPacks(10, 20)
+	if err := repo.ReplaceAll(context.Background(), input); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+	input[0].Size = 9999
+	if got, want := findAll(t, repo), storage.NewPacks(10, 20); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() was modified by a change of the ReplaceAll() input. got = %v, want %v", got, want)
+	}
+}
+
+// testCanceledContext tests that a canceled context is honoured.
+func testCanceledContext(t *testing.T, repo storage.PackRepository) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.FindAll(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindAll() error = %v, want %v", err, context.Canceled)
+	}
+	if err := repo.ReplaceAll(ctx, storage.NewPacks(1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReplaceAll() error = %v, want %v", err, context.Canceled)
+	}
+
+	// The state must be untouched by the canceled write
+	if got, want := findAll(t, repo), storage.NewPacks(storage.DefaultPackSizes...); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() got = %v after canceled ReplaceAll()", got)
+	}
+}
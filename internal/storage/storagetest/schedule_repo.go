@@ -0,0 +1,127 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+// TestScheduleRepository tests a storage.ScheduleRepository implementation.
+// newRepo returns an empty repository, every subtest uses its own.
+//
+// A repository must assign increasing IDs, list the changes sorted by
+// EffectiveAt then ID with their packs sorted ascending by size, as copies,
+// and return storage.ErrNotFound when deleting a missing change. A canceled
+// context fails without changing the schedule.
+func TestScheduleRepository(t *testing.T, newRepo func(t *testing.T) storage.ScheduleRepository) {
+	t.Run("AddListDelete", func(t *testing.T) { testScheduleAddListDelete(t, newRepo(t)) })
+	t.Run("Copies", func(t *testing.T) { testScheduleCopies(t, newRepo(t)) })
+	t.Run("CanceledContext", func(t *testing.T) { testScheduleCanceledContext(t, newRepo(t)) })
+}
+
+// scheduleDay is the day of the test changes. Times are whole seconds in UTC,
+// which every backend stores exactly.
+var scheduleDay = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// listChanges returns the changes of the repository, failing the test on error.
+func listChanges(t *testing.T, repo storage.ScheduleRepository) []storage.ScheduledChange {
+	t.Helper()
+
+	changes, err := repo.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+
+	return changes
+}
+
+// testScheduleAddListDelete tests the order of the listed changes and deleting them.
+func testScheduleAddListDelete(t *testing.T, repo storage.ScheduleRepository) {
+	ctx := context.Background()
+
+	if got := listChanges(t, repo); len(got) != 0 {
+		t.Errorf("List() got = %+v, want no changes", got)
+	}
+
+	later := &storage.ScheduledChange{EffectiveAt: scheduleDay.AddDate(0, 0, 2), Packs: storage.NewPacks(500, 250)}
+	sooner := &storage.ScheduledChange{EffectiveAt: scheduleDay, Packs: []storage.Pack{{Size: 1000, Label: "Crate", Active: false}}}
+	sameDay := &storage.ScheduledChange{EffectiveAt: scheduleDay, Packs: storage.NewPacks(23)}
+	for _, c := range []*storage.ScheduledChange{later, sooner, sameDay} {
+		if err := repo.Add(ctx, c); err != nil {
+			t.Fatalf("Add() returned an unexpected error: %v", err)
+		}
+	}
+	if !(later.ID < sooner.ID && sooner.ID < sameDay.ID) {
+		t.Errorf("Add() IDs = %d, %d, %d, want increasing", later.ID, sooner.ID, sameDay.ID)
+	}
+
+	want := []storage.ScheduledChange{
+		{ID: sooner.ID, EffectiveAt: scheduleDay, Packs: []storage.Pack{{Size: 1000, Label: "Crate", Active: false}}},
+		{ID: sameDay.ID, EffectiveAt: scheduleDay, Packs: storage.NewPacks(23)},
+		{ID: later.ID, EffectiveAt: scheduleDay.AddDate(0, 0, 2), Packs: storage.NewPacks(250, 500)},
+	}
+	if got := listChanges(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() got = %+v, want %+v", got, want)
+	}
+
+	if err := repo.Delete(ctx, sooner.ID); err != nil {
+		t.Fatalf("Delete() returned an unexpected error: %v", err)
+	}
+	if err := repo.Delete(ctx, sooner.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, storage.ErrNotFound)
+	}
+	if got := listChanges(t, repo); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("List() got = %+v, want %+v", got, want[1:])
+	}
+}
+
+// testScheduleCopies tests that changing the packs passed to Add or returned
+// by List does not change the schedule.
+func testScheduleCopies(t *testing.T, repo storage.ScheduleRepository) {
+	c := &storage.ScheduledChange{EffectiveAt: scheduleDay, Packs: storage.NewPacks(250, 500)}
+	if err := repo.Add(context.Background(), c); err != nil {
+		t.Fatalf("Add() returned an unexpected error: %v", err)
+	}
+	c.Packs[0].Size = 1
+
+	want := []storage.ScheduledChange{{ID: c.ID, EffectiveAt: scheduleDay, Packs: storage.NewPacks(250, 500)}}
+	got := listChanges(t, repo)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() was modified by a change of the Add() input. got = %+v, want %+v", got, want)
+	}
+
+	got[0].Packs[0].Size = 1
+	if got := listChanges(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() was modified by external slice change. got = %+v, want %+v", got, want)
+	}
+}
+
+// testScheduleCanceledContext tests that a canceled context is honoured.
+func testScheduleCanceledContext(t *testing.T, repo storage.ScheduleRepository) {
+	c := &storage.ScheduledChange{EffectiveAt: scheduleDay, Packs: storage.NewPacks(250)}
+	if err := repo.Add(context.Background(), c); err != nil {
+		t.Fatalf("Add() returned an unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := repo.Add(ctx, &storage.ScheduledChange{EffectiveAt: scheduleDay, Packs: storage.NewPacks(500)}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Add() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := repo.List(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("List() error = %v, want %v", err, context.Canceled)
+	}
+	if err := repo.Delete(ctx, c.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Delete() error = %v, want %v", err, context.Canceled)
+	}
+
+	want := []storage.ScheduledChange{{ID: c.ID, EffectiveAt: scheduleDay, Packs: storage.NewPacks(250)}}
+	if got := listChanges(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() got = %+v after canceled calls", got)
+	}
+}
@@ -0,0 +1,169 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+const (
+	// stressWriters is the number of concurrent writers. It is kept low as
+	// databases retry the conflicting transactions a limited number of times.
+	stressWriters = 2
+	// stressReaders is the number of concurrent readers.
+	stressReaders = 4
+	// stressReads is the number of reads of every reader, or stressShortReads with -short.
+	stressReads      = 200
+	stressShortReads = 50
+	// stressSetSize is the number of packs of every written set.
+	stressSetSize = 3
+)
+
+// stressSet returns the packs written by the writer at the iteration, in
+// descending order. All of them carry the base size of the set as label, so a
+// reader can tell a set from a mix of several.
+func stressSet(writer, iteration int) []storage.Pack {
+	base := (writer*1_000_000 + iteration + 1) * 10
+
+	packs := make([]storage.Pack, stressSetSize)
+	for i := range packs {
+		packs[i] = storage.Pack{Size: base + stressSetSize - 1 - i, Label: strconv.Itoa(base), Active: true}
+	}
+
+	return packs
+}
+
+// checkStressSet returns why the packs are neither the default packs nor a
+// complete set written by stressSet, sorted ascending by size.
+func checkStressSet(packs []storage.Pack) error {
+	if reflect.DeepEqual(packs, storage.NewPacks(storage.DefaultPackSizes...)) {
+		return nil
+	}
+	if len(packs) != stressSetSize {
+		return fmt.Errorf("got %d packs, want %d", len(packs), stressSetSize)
+	}
+
+	base, err := strconv.Atoi(packs[0].Label)
+	if err != nil {
+		return fmt.Errorf("unexpected label %q", packs[0].Label)
+	}
+	for i, p := range packs {
+		if p.Label != packs[0].Label {
+			return fmt.Errorf("packs of several sets %v", packs)
+		}
+		if p.Size != base+i {
+			return fmt.Errorf("packs not sorted or incomplete %v", packs)
+		}
+	}
+
+	return nil
+}
+
+// testConcurrentReadWrite tests concurrent readers and writers. Every read must
+// return a complete set sorted by size, never a mix of two writes, and changing
+// it must not affect the other readers. The writers keep writing until all the
+// reads are done, then the last set written remains.
+// Running it with -race also finds the data races of the backend.
+func testConcurrentReadWrite(t *testing.T, repo storage.PackRepository) {
+	reads := stressReads
+	if testing.Short() {
+		reads = stressShortReads
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var writers, readers sync.WaitGroup
+	start := make(chan struct{})
+	readsDone := make(chan struct{})
+	errs := make(chan error, stressWriters+stressReaders)
+	// last is the set written last by every writer
+	last := make([][]storage.Pack, stressWriters)
+
+	for w := range stressWriters {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			<-start
+			for i := 0; ; i++ {
+				select {
+				case <-readsDone:
+					return
+				default:
+				}
+
+				packs := stressSet(w, i)
+				if err := repo.ReplaceAll(ctx, packs); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					errs <- fmt.Errorf("ReplaceAll() returned an unexpected error: %v", err)
+					cancel()
+					return
+				}
+				last[w] = packs
+			}
+		}()
+	}
+
+	for range stressReaders {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			<-start
+			for range reads {
+				packs, err := repo.FindAll(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					errs <- fmt.Errorf("FindAll() returned an unexpected error: %v", err)
+					cancel()
+					return
+				}
+				if err := checkStressSet(packs); err != nil {
+					errs <- fmt.Errorf("FindAll() returned an inconsistent set: %v", err)
+					cancel()
+					return
+				}
+
+				// The other readers must not see this change
+				for i := range packs {
+					packs[i].Size = -1
+				}
+			}
+		}()
+	}
+
+	close(start)
+	readers.Wait()
+	close(readsDone)
+	writers.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		return
+	}
+
+	got := findAll(t, repo)
+	for _, want := range last {
+		if want == nil {
+			continue
+		}
+		want = append([]storage.Pack{}, want...)
+		sort.Slice(want, func(i, j int) bool { return want[i].Size < want[j].Size })
+		if reflect.DeepEqual(got, want) {
+			return
+		}
+	}
+	t.Errorf("FindAll() got = %v, want the last set of a writer", got)
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// PerTenant holds one repository per tenant, created on the first write.
+// Reads of tenants without a repository fall back to the defaults without
+// creating one, so requests naming unknown tenants do not allocate anything.
+// The tenant is read from the context (see tenant.FromContext).
+type PerTenant[T any] struct {
+	mu      sync.Mutex
+	repos   map[string]T
+	newRepo func(tenantID string) T
+}
+
+// NewPerTenant creates the repositories of every tenant with newRepo.
+func NewPerTenant[T any](newRepo func(tenantID string) T) *PerTenant[T] {
+	return &PerTenant[T]{
+		repos:   make(map[string]T),
+		newRepo: newRepo,
+	}
+}
+
+// Existing returns the repository of the tenant of the context, false when
+// the tenant has none yet.
+func (p *PerTenant[T]) Existing(ctx context.Context) (T, bool) {
+	id := tenant.FromContext(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	repo, ok := p.repos[id]
+	return repo, ok
+}
+
+// For returns the repository of the tenant of the context, creating it when
+// the tenant has none yet.
+func (p *PerTenant[T]) For(ctx context.Context) T {
+	id := tenant.FromContext(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	repo, ok := p.repos[id]
+	if !ok {
+		repo = p.newRepo(id)
+		p.repos[id] = repo
+	}
+
+	return repo
+}
+
+// Close closes the repositories implementing io.Closer, such as the snapshotted
+// ones, and returns their errors joined.
+func (p *PerTenant[T]) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for id, repo := range p.repos {
+		if c, ok := any(repo).(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: %w", id, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// TenantPackRepo implements PackRepository with a separate repository per tenant.
+type TenantPackRepo struct {
+	*PerTenant[PackRepository]
+}
+
+// NewTenantPackRepo creates a pack repository isolating the packs of every tenant.
+func NewTenantPackRepo(newRepo func(tenantID string) PackRepository) *TenantPackRepo {
+	return &TenantPackRepo{NewPerTenant(newRepo)}
+}
+
+// FindAll returns the packs of the tenant of the context, the default packs
+// when it never replaced them.
+func (r *TenantPackRepo) FindAll(ctx context.Context) ([]Pack, error) {
+	repo, ok := r.Existing(ctx)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return NewPacks(DefaultPackSizes...), nil
+	}
+
+	return repo.FindAll(ctx)
+}
+
+// ReplaceAll replaces the packs of the tenant of the context.
+func (r *TenantPackRepo) ReplaceAll(ctx context.Context, packs []Pack) error {
+	return r.For(ctx).ReplaceAll(ctx, packs)
+}
+
+// TenantCatalogRepo implements CatalogRepository with a separate repository per tenant.
+type TenantCatalogRepo struct {
+	*PerTenant[CatalogRepository]
+}
+
+// NewTenantCatalogRepo creates a catalog repository isolating the catalog of every tenant.
+func NewTenantCatalogRepo(newRepo func(tenantID string) CatalogRepository) *TenantCatalogRepo {
+	return &TenantCatalogRepo{NewPerTenant(newRepo)}
+}
+
+// Get returns the catalog of the tenant of the context, an empty one when it
+// never saved one.
+func (r *TenantCatalogRepo) Get(ctx context.Context) (Catalog, error) {
+	repo, ok := r.Existing(ctx)
+	if !ok {
+		return Catalog{}, ctx.Err()
+	}
+
+	return repo.Get(ctx)
+}
+
+// Save replaces the catalog of the tenant of the context.
+func (r *TenantCatalogRepo) Save(ctx context.Context, c Catalog) error {
+	return r.For(ctx).Save(ctx, c)
+}
+
+// TenantScheduleRepo implements ScheduleRepository with a separate repository per tenant.
+type TenantScheduleRepo struct {
+	*PerTenant[ScheduleRepository]
+}
+
+// NewTenantScheduleRepo creates a schedule repository isolating the changes of every tenant.
+func NewTenantScheduleRepo(newRepo func(tenantID string) ScheduleRepository) *TenantScheduleRepo {
+	return &TenantScheduleRepo{NewPerTenant(newRepo)}
+}
+
+// Add stores a change of the tenant of the context.
+func (r *TenantScheduleRepo) Add(ctx context.Context, c *ScheduledChange) error {
+	return r.For(ctx).Add(ctx, c)
+}
+
+// List returns the changes of the tenant of the context.
+func (r *TenantScheduleRepo) List(ctx context.Context) ([]ScheduledChange, error) {
+	repo, ok := r.Existing(ctx)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return []ScheduledChange{}, nil
+	}
+
+	return repo.List(ctx)
+}
+
+// Delete removes a change of the tenant of the context.
+func (r *TenantScheduleRepo) Delete(ctx context.Context, id int64) error {
+	repo, ok := r.Existing(ctx)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
+
+	return repo.Delete(ctx, id)
+}
+
+// TenantWebhookRepo implements WebhookRepository with a separate repository per tenant.
+type TenantWebhookRepo struct {
+	*PerTenant[WebhookRepository]
+}
+
+// NewTenantWebhookRepo creates a webhook repository isolating the webhooks of every tenant.
+func NewTenantWebhookRepo(newRepo func(tenantID string) WebhookRepository) *TenantWebhookRepo {
+	return &TenantWebhookRepo{NewPerTenant(newRepo)}
+}
+
+// Add stores a webhook of the tenant of the context.
+func (r *TenantWebhookRepo) Add(ctx context.Context, w *Webhook) error {
+	return r.For(ctx).Add(ctx, w)
+}
+
+// List returns the webhooks of the tenant of the context.
+func (r *TenantWebhookRepo) List(ctx context.Context) ([]Webhook, error) {
+	repo, ok := r.Existing(ctx)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return []Webhook{}, nil
+	}
+
+	return repo.List(ctx)
+}
+
+// Delete removes a webhook of the tenant of the context.
+func (r *TenantWebhookRepo) Delete(ctx context.Context, id int64) error {
+	repo, ok := r.Existing(ctx)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
+
+	return repo.Delete(ctx, id)
+}
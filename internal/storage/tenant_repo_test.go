@@ -0,0 +1,90 @@
+package storage_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/inmemory"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+func TestTenantPackRepo(t *testing.T) {
+	var created []string
+	repo := storage.NewTenantPackRepo(func(id string) storage.PackRepository {
+		created = append(created, id)
+		return inmemory.NewInMemoryPackRepo()
+	})
+
+	north := tenant.NewContext(context.Background(), "north")
+	if err := repo.ReplaceAll(north, storage.NewPacks(23, 31)); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		ctx  context.Context
+		want []int
+	}{
+		{name: "Same tenant", ctx: north, want: []int{23, 31}},
+		{name: "Other tenant", ctx: tenant.NewContext(context.Background(), "south"), want: []int{250, 500, 1000, 2000, 5000}},
+		{name: "Default tenant", ctx: context.Background(), want: []int{250, 500, 1000, 2000, 5000}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			packs, err := repo.FindAll(tc.ctx)
+			if err != nil {
+				t.Fatalf("FindAll() returned an unexpected error: %v", err)
+			}
+			if got := storage.ActiveSizes(packs); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FindAll() got = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// Only the tenant that wrote has a repository, the reads of the others do not create one
+	if want := []string{"north"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("created repositories = %v, want %v", created, want)
+	}
+}
+
+// TestTenantRepos_ReadsDoNotCreate tests that reading the catalog, schedule and
+// webhooks of an unknown tenant returns the defaults without creating a repository.
+func TestTenantRepos_ReadsDoNotCreate(t *testing.T) {
+	created := 0
+	catalog := storage.NewTenantCatalogRepo(func(string) storage.CatalogRepository {
+		created++
+		return inmemory.NewInMemoryCatalogRepo()
+	})
+	schedule := storage.NewTenantScheduleRepo(func(string) storage.ScheduleRepository {
+		created++
+		return inmemory.NewInMemoryScheduleRepo()
+	})
+	webhooks := storage.NewTenantWebhookRepo(func(string) storage.WebhookRepository {
+		created++
+		return inmemory.NewInMemoryWebhookRepo()
+	})
+	ctx := tenant.NewContext(context.Background(), "unknown")
+
+	if c, err := catalog.Get(ctx); err != nil || !reflect.DeepEqual(c, storage.Catalog{}) {
+		t.Errorf("Get() = %+v, %v, want an empty catalog", c, err)
+	}
+	if changes, err := schedule.List(ctx); err != nil || len(changes) != 0 {
+		t.Errorf("List() = %+v, %v, want no changes", changes, err)
+	}
+	if err := schedule.Delete(ctx, 1); err != storage.ErrNotFound {
+		t.Errorf("Delete() error = %v, want %v", err, storage.ErrNotFound)
+	}
+	if hooks, err := webhooks.List(ctx); err != nil || len(hooks) != 0 {
+		t.Errorf("List() = %+v, %v, want no webhooks", hooks, err)
+	}
+	if err := webhooks.Delete(ctx, 1); err != storage.ErrNotFound {
+		t.Errorf("Delete() error = %v, want %v", err, storage.ErrNotFound)
+	}
+
+	if created != 0 {
+		t.Errorf("created %d repositories, want none", created)
+	}
+}
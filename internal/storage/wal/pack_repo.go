@@ -0,0 +1,521 @@
+// Package wal implements a durable storage.PackRepository without a database.
+//
+// Every ReplaceAll appends a record to a log file and syncs it before
+// returning, and opening the log replays the records to rebuild the packs of
+// every tenant. The records double as the history of the packs of a tenant.
+// Compaction rewrites the log with the latest records of every tenant only,
+// bounding its size.
+//
+// The log starts with a magic header, followed by the records:
+//
+//	length  uint32, big endian, of the payload
+//	crc     uint32, big endian, CRC-32C of the payload
+//	payload JSON of a Revision
+//
+// A crash may leave the last record partially written. Replaying truncates the
+// log at a bad record reaching its end with no valid record after it, so a torn
+// write never surfaces as data. A bad record followed by more records is
+// corruption instead: opening fails and the log is moved aside, keeping every
+// revision for inspection.
+package wal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+const (
+	// DefaultHistoryLimit is the number of revisions of a tenant kept by compaction unless overridden.
+	DefaultHistoryLimit = 100
+
+	// magic starts every log, versioning its format.
+	magic = "PACKWAL1"
+	// headerSize is the size of the length and checksum preceding every payload.
+	headerSize = 8
+	// maxPayloadSize bounds a record, larger lengths are torn or corrupt headers.
+	maxPayloadSize = 64 << 20
+)
+
+var (
+	// ErrInvalidLog is returned when opening a file that is not a pack log.
+	ErrInvalidLog = errors.New("not a pack log")
+	// ErrCorruptLog is returned when opening a log with a bad record followed by
+	// more records. The log is moved aside rather than truncated, so no later
+	// revision is dropped silently.
+	ErrCorruptLog = errors.New("corrupt pack log")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Revision is a replacement of the packs of a tenant, as journaled in the log.
+type Revision struct {
+	// Seq orders the revisions of all tenants, starting at 1.
+	Seq    uint64         `json:"seq"`
+	Tenant string         `json:"tenant"`
+	At     time.Time      `json:"at"`
+	Packs  []storage.Pack `json:"packs"`
+}
+
+// PackRepo implements the storage.PackRepository interface on a log file,
+// scoping the packs to the tenant of the context.
+type PackRepo struct {
+	path string
+
+	historyLimit    int
+	compactInterval time.Duration
+
+	// mu guards the file and the revisions, writers hold it exclusively.
+	mu   sync.RWMutex
+	file *os.File
+	// size is the size of the log up to the last complete record.
+	size int64
+	seq  uint64
+	// revisions are the revisions of every tenant, oldest first.
+	revisions map[string][]Revision
+	// appended counts the records appended since the last compaction.
+	appended int
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// Option configures optional PackRepo settings.
+type Option func(*PackRepo)
+
+// WithHistoryLimit sets the number of revisions of every tenant kept by
+// compaction. Zero keeps them all, compaction then only drops a torn tail.
+func WithHistoryLimit(n int) Option {
+	return func(r *PackRepo) {
+		r.historyLimit = max(n, 0)
+	}
+}
+
+// WithCompactInterval compacts the log every d when records were appended.
+// Zero, the default, leaves compaction to Compact.
+func WithCompactInterval(d time.Duration) Option {
+	return func(r *PackRepo) {
+		r.compactInterval = d
+	}
+}
+
+// Open opens the log at path, creating it when missing, and replays it.
+// Close stops the periodic compaction and closes the log.
+func Open(path string, opts ...Option) (*PackRepo, error) {
+	r := &PackRepo{
+		path:         path,
+		historyLimit: DefaultHistoryLimit,
+		revisions:    make(map[string][]Revision),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+
+	if err := r.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if r.compactInterval > 0 {
+		go r.run()
+	} else {
+		close(r.done)
+	}
+
+	return r, nil
+}
+
+// replay rebuilds the revisions from the log, truncating a torn tail. A bad
+// record followed by more data is corruption rather than a torn write: the log
+// is moved aside to path+".corrupt" and ErrCorruptLog returned.
+func (r *PackRepo) replay() error {
+	info, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		// A new log
+		if _, err := r.file.Write([]byte(magic)); err != nil {
+			return err
+		}
+		r.size = int64(len(magic))
+		return r.file.Sync()
+	}
+
+	rd := io.NewSectionReader(r.file, 0, info.Size())
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(rd, head); err != nil || string(head) != magic {
+		return fmt.Errorf("%w: %s", ErrInvalidLog, r.path)
+	}
+
+	r.size = int64(len(magic))
+	for {
+		rev, n, err := readRecord(rd)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !r.tornTail(n, info.Size()) {
+				return r.moveAside(fmt.Errorf("%w: %s at byte %d: %v", ErrCorruptLog, r.path, r.size, err))
+			}
+
+			log.Printf("Truncating the torn tail of the pack log %s at byte %d, dropping %d bytes: %v", r.path, r.size, info.Size()-r.size, err)
+			if err := r.file.Truncate(r.size); err != nil {
+				return err
+			}
+			return r.file.Sync()
+		}
+
+		r.apply(rev)
+		r.size += n
+	}
+}
+
+// tornTail reports whether the bad record at r.size, of n bytes when its
+// header gives its length, is the tail of the log left by an interrupted
+// write: only zeros follow it, or it is the last record of the log, reaching
+// its end with no valid record starting after it. A corrupt length may reach
+// past later records, so the length alone does not make it the last.
+func (r *PackRepo) tornTail(n, size int64) bool {
+	if r.zerosFrom(r.size, size) {
+		return true
+	}
+
+	return n > 0 && r.size+n >= size && !r.recordFrom(r.size+1, size)
+}
+
+// recordFrom reports whether a valid record starts at any offset from offset
+// to size. Only the headers of records fitting in the log are checked further.
+func (r *PackRepo) recordFrom(offset, size int64) bool {
+	var header [headerSize]byte
+	for ; offset+headerSize < size; offset++ {
+		if _, err := r.file.ReadAt(header[:], offset); err != nil {
+			return false
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if length == 0 || length > maxPayloadSize || offset+headerSize+length > size {
+			continue
+		}
+		if _, _, err := readRecord(io.NewSectionReader(r.file, offset, size-offset)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// zerosFrom reports whether the log holds only zeros from offset to size,
+// as file systems may leave after an interrupted write.
+func (r *PackRepo) zerosFrom(offset, size int64) bool {
+	buf := make([]byte, 32<<10)
+	for offset < size {
+		n, err := r.file.ReadAt(buf[:min(int64(len(buf)), size-offset)], offset)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false
+			}
+		}
+		if err != nil && err != io.EOF {
+			return false
+		}
+		offset += int64(n)
+	}
+
+	return true
+}
+
+// moveAside closes the corrupt log and renames it to path+".corrupt", keeping
+// its history for inspection, then returns err.
+func (r *PackRepo) moveAside(err error) error {
+	r.file.Close()
+	r.file = nil
+
+	if renameErr := os.Rename(r.path, r.path+".corrupt"); renameErr != nil {
+		return errors.Join(err, renameErr)
+	}
+	log.Printf("Moved the corrupt pack log %s aside to %s.corrupt", r.path, r.path)
+
+	return err
+}
+
+// readRecord reads the next record and its size. It returns io.EOF at the end
+// of the log and another error for an incomplete or corrupt record, with the
+// size the header gives it, or 0 when the length of the header is invalid.
+func readRecord(rd io.Reader) (Revision, int64, error) {
+	var header [headerSize]byte
+	if n, err := io.ReadFull(rd, header[:]); err != nil {
+		if err == io.EOF && n == 0 {
+			return Revision{}, 0, io.EOF
+		}
+		// Reaches the end of the log, whatever the length would have been
+		return Revision{}, headerSize, errors.New("incomplete record header")
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length == 0 || length > maxPayloadSize {
+		return Revision{}, 0, fmt.Errorf("invalid record length %d", length)
+	}
+	size := headerSize + int64(length)
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(rd, payload); err != nil {
+		return Revision{}, size, errors.New("incomplete record payload")
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return Revision{}, size, errors.New("record checksum mismatch")
+	}
+
+	var rev Revision
+	if err := json.Unmarshal(payload, &rev); err != nil {
+		return Revision{}, size, fmt.Errorf("invalid record: %v", err)
+	}
+
+	return rev, size, nil
+}
+
+// encodeRecord returns the framed record of the revision.
+func encodeRecord(rev Revision) ([]byte, error) {
+	payload, err := json.Marshal(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[headerSize:], payload)
+
+	return record, nil
+}
+
+// apply adds the revision to the state. The caller holds mu or owns r.
+func (r *PackRepo) apply(rev Revision) {
+	r.revisions[rev.Tenant] = append(r.revisions[rev.Tenant], rev)
+	r.seq = max(r.seq, rev.Seq)
+}
+
+// FindAll returns a copy of the current packs of the tenant of the context,
+// the default packs when the tenant never set them.
+func (r *PackRepo) FindAll(ctx context.Context) ([]storage.Pack, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revs := r.revisions[tenant.FromContext(ctx)]
+	if len(revs) == 0 {
+		return storage.NewPacks(storage.DefaultPackSizes...), nil
+	}
+
+	return append([]storage.Pack{}, revs[len(revs)-1].Packs...), nil
+}
+
+// ReplaceAll replaces the packs of the tenant of the context, sorted ascending
+// by size, once the revision is synced to the log.
+func (r *PackRepo) ReplaceAll(ctx context.Context, packs []storage.Pack) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sorted := append([]storage.Pack{}, packs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Size < sorted[j].Size })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+
+	rev := Revision{Seq: r.seq + 1, Tenant: tenant.FromContext(ctx), At: r.now().UTC(), Packs: sorted}
+	record, err := encodeRecord(rev)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.file.WriteAt(record, r.size); err != nil {
+		// Drop what was written of the record, replaying would drop it anyway
+		r.file.Truncate(r.size)
+		return err
+	}
+	if err := r.file.Sync(); err != nil {
+		// The caller is told the change failed, so it must not come back on replay
+		r.file.Truncate(r.size)
+		return err
+	}
+
+	r.size += int64(len(record))
+	r.appended++
+	r.apply(rev)
+
+	return nil
+}
+
+// History returns the revisions of the tenant of the context kept in the log, oldest first.
+func (r *PackRepo) History(ctx context.Context) ([]Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revs := r.revisions[tenant.FromContext(ctx)]
+	out := make([]Revision, len(revs))
+	for i, rev := range revs {
+		rev.Packs = append([]storage.Pack{}, rev.Packs...)
+		out[i] = rev
+	}
+
+	return out, nil
+}
+
+// Compact rewrites the log with the last revisions of every tenant, up to the
+// history limit. The new log replaces the old one atomically.
+func (r *PackRepo) Compact() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+
+	kept := make(map[string][]Revision, len(r.revisions))
+	var all []Revision
+	for id, revs := range r.revisions {
+		if r.historyLimit > 0 && len(revs) > r.historyLimit {
+			revs = revs[len(revs)-r.historyLimit:]
+		}
+		kept[id] = revs
+		all = append(all, revs...)
+	}
+	// Keep the order of the log, so replaying yields the same state
+	sort.Slice(all, func(i, j int) bool { return all[i].Seq < all[j].Seq })
+
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	for _, rev := range all {
+		record, err := encodeRecord(rev)
+		if err != nil {
+			return err
+		}
+		buf.Write(record)
+	}
+
+	f, err := replaceFile(r.path, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	r.file.Close()
+	r.file = f
+	r.size = int64(buf.Len())
+	r.revisions = kept
+	r.appended = 0
+
+	return nil
+}
+
+// replaceFile atomically replaces the file at path with the data and returns
+// the new file, open for writing.
+func replaceFile(path string, data []byte) (*os.File, error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+
+	fail := func(err error) (*os.File, error) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fail(err)
+	}
+
+	// Sync the directory so the rename itself survives a crash
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return tmp, nil
+}
+
+// Close stops the periodic compaction and closes the log.
+func (r *PackRepo) Close() error {
+	r.closeOnce.Do(func() { close(r.stop) })
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+// run compacts the log every interval when records were appended, until Close.
+func (r *PackRepo) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.compactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.RLock()
+			appended := r.appended
+			r.mu.RUnlock()
+
+			if appended > 0 {
+				if err := r.Compact(); err != nil {
+					log.Printf("Failed to compact the pack log %s: %v", r.path, err)
+				}
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/storagetest"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// mustOpen opens the log, failing the test on error, and closes it at the end of the test.
+func mustOpen(t *testing.T, path string, opts ...Option) *PackRepo {
+	t.Helper()
+
+	repo, err := Open(path, opts...)
+	if err != nil {
+		t.Fatalf("Open() returned an unexpected error: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	return repo
+}
+
+// findAll returns the packs of the tenant, failing the test on error.
+func findAll(t *testing.T, repo *PackRepo, id string) []storage.Pack {
+	t.Helper()
+
+	packs, err := repo.FindAll(tenant.NewContext(context.Background(), id))
+	if err != nil {
+		t.Fatalf("FindAll() returned an unexpected error: %v", err)
+	}
+
+	return packs
+}
+
+// replaceAll replaces the packs of the tenant, failing the test on error.
+func replaceAll(t *testing.T, repo *PackRepo, id string, sizes ...int) {
+	t.Helper()
+
+	if err := repo.ReplaceAll(tenant.NewContext(context.Background(), id), storage.NewPacks(sizes...)); err != nil {
+		t.Fatalf("ReplaceAll() returned an unexpected error: %v", err)
+	}
+}
+
+// TestPackRepo_Replay tests that reopening the log restores the packs and the history of every tenant.
+func TestPackRepo_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packs.wal")
+
+	repo := mustOpen(t, path)
+	if got, want := findAll(t, repo, "north"), storage.NewPacks(storage.DefaultPackSizes...); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %v, want the default packs %v", got, want)
+	}
+
+	replaceAll(t, repo, "north", 31, 23)
+	replaceAll(t, repo, "south", 53)
+	replaceAll(t, repo, "north", 10, 20)
+
+	// Reopening does not need Close, every change is synced
+	restored := mustOpen(t, path)
+	if got, want := findAll(t, restored, "north"), storage.NewPacks(10, 20); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll(north) = %v, want %v", got, want)
+	}
+	if got, want := findAll(t, restored, "south"), storage.NewPacks(53); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll(south) = %v, want %v", got, want)
+	}
+
+	history, err := restored.History(tenant.NewContext(context.Background(), "north"))
+	if err != nil {
+		t.Fatalf("History() returned an unexpected error: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("History() returned %d revisions, want 2", len(history))
+	}
+	if history[0].Seq != 1 || history[1].Seq != 3 {
+		t.Errorf("wrong revision sequence. got %d and %d, want 1 and 3", history[0].Seq, history[1].Seq)
+	}
+	if got, want := history[0].Packs, storage.NewPacks(23, 31); !reflect.DeepEqual(got, want) {
+		t.Errorf("History()[0].Packs = %v, want the sorted packs %v", got, want)
+	}
+
+	// The sequence continues after the replayed revisions
+	replaceAll(t, restored, "south", 54)
+	history, _ = restored.History(tenant.NewContext(context.Background(), "south"))
+	if got := history[len(history)-1].Seq; got != 4 {
+		t.Errorf("wrong sequence after replay. got %d, want 4", got)
+	}
+}
+
+// TestPackRepo_TornWrite tests that a log truncated anywhere within its last
+// record replays the previous records and accepts new ones.
+func TestPackRepo_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "packs.wal")
+
+	repo := mustOpen(t, path)
+	replaceAll(t, repo, "north", 23, 31)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() returned an unexpected error: %v", err)
+	}
+	complete := info.Size()
+	replaceAll(t, repo, "north", 53)
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close() returned an unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() returned an unexpected error: %v", err)
+	}
+
+	// Every length cutting the last record, from its header to its last byte
+	for size := complete + 1; size < int64(len(data)); size++ {
+		torn := filepath.Join(dir, "torn.wal")
+		if err := os.WriteFile(torn, data[:size], 0o644); err != nil {
+			t.Fatalf("WriteFile() returned an unexpected error: %v", err)
+		}
+
+		repo, err := Open(torn)
+		if err != nil {
+			t.Fatalf("Open() of the log cut at %d returned an unexpected error: %v", size, err)
+		}
+		if got, want := findAll(t, repo, "north"), storage.NewPacks(23, 31); !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAll() of the log cut at %d = %v, want %v", size, got, want)
+		}
+		if info, _ := os.Stat(torn); info.Size() != complete {
+			t.Errorf("the log cut at %d was truncated to %d bytes, want %d", size, info.Size(), complete)
+		}
+
+		// The next record follows the last complete one
+		replaceAll(t, repo, "north", 77)
+		repo.Close()
+		repo = mustOpen(t, torn)
+		if got, want := findAll(t, repo, "north"), storage.NewPacks(77); !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAll() after appending to the log cut at %d = %v, want %v", size, got, want)
+		}
+		repo.Close()
+	}
+}
+
+// TestPackRepo_Corrupt tests that a bad last record is truncated like a torn
+// write, while a bad record followed by more records fails the opening and moves
+// the log aside, and that a file that is not a log is refused.
+func TestPackRepo_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "packs.wal")
+
+	repo := mustOpen(t, path)
+	replaceAll(t, repo, "north", 23)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() returned an unexpected error: %v", err)
+	}
+	first := info.Size()
+	replaceAll(t, repo, "north", 53)
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() returned an unexpected error: %v", err)
+	}
+	second := info.Size()
+	replaceAll(t, repo, "north", 100)
+	repo.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() returned an unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		name      string
+		corrupt   func(data []byte) []byte
+		wantErr   error
+		wantPacks []storage.Pack
+	}{
+		{
+			name:      "Last record",
+			corrupt:   func(data []byte) []byte { data[len(data)-3] ^= 0xff; return data },
+			wantPacks: storage.NewPacks(53),
+		},
+		{
+			name: "Last record reaching past the end",
+			corrupt: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[second:], uint32(len(data)))
+				return data
+			},
+			wantPacks: storage.NewPacks(53),
+		},
+		{
+			name:      "Zeros after the last record",
+			corrupt:   func(data []byte) []byte { return append(data, make([]byte, 100)...) },
+			wantPacks: storage.NewPacks(100),
+		},
+		{
+			name:    "Record followed by another",
+			corrupt: func(data []byte) []byte { data[first-3] ^= 0xff; return data },
+			wantErr: ErrCorruptLog,
+		},
+		{
+			name:    "Length followed by another record",
+			corrupt: func(data []byte) []byte { copy(data[len(magic):], []byte{0, 0, 0, 0}); return data },
+			wantErr: ErrCorruptLog,
+		},
+		{
+			name: "Middle record reaching past the end",
+			corrupt: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[first:], uint32(len(data)))
+				return data
+			},
+			wantErr: ErrCorruptLog,
+		},
+		{
+			name:    "Middle record followed by zeros and records",
+			corrupt: func(data []byte) []byte { clear(data[first : second-10]); return data },
+			wantErr: ErrCorruptLog,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "packs.wal")
+			corrupted := tc.corrupt(append([]byte{}, data...))
+			if err := os.WriteFile(path, corrupted, 0o644); err != nil {
+				t.Fatalf("WriteFile() returned an unexpected error: %v", err)
+			}
+
+			repo, err := Open(path)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				// The history is kept aside, nothing dropped
+				if kept, err := os.ReadFile(path + ".corrupt"); err != nil || !bytes.Equal(kept, corrupted) {
+					t.Errorf("the corrupt log was not kept aside: %v", err)
+				}
+				if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("the corrupt log is still in place: %v", err)
+				}
+				return
+			}
+			defer repo.Close()
+
+			if got := findAll(t, repo, "north"); !reflect.DeepEqual(got, tc.wantPacks) {
+				t.Errorf("FindAll() = %v, want %v", got, tc.wantPacks)
+			}
+		})
+	}
+
+	other := filepath.Join(dir, "packs.json")
+	if err := os.WriteFile(other, []byte(`{"packs": []}`), 0o644); err != nil {
+		t.Fatalf("WriteFile() returned an unexpected error: %v", err)
+	}
+	if _, err := Open(other); !errors.Is(err, ErrInvalidLog) {
+		t.Errorf("Open() error = %v, wantErr %v", err, ErrInvalidLog)
+	}
+}
+
+// TestPackRepo_Compact tests that compaction keeps the last revisions of every
+// tenant, and that the compacted log replays to the same packs.
+func TestPackRepo_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packs.wal")
+
+	repo := mustOpen(t, path, WithHistoryLimit(2))
+	for size := 1; size <= 5; size++ {
+		replaceAll(t, repo, "north", size)
+	}
+	replaceAll(t, repo, "south", 53)
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() returned an unexpected error: %v", err)
+	}
+	if err := repo.Compact(); err != nil {
+		t.Fatalf("Compact() returned an unexpected error: %v", err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() returned an unexpected error: %v", err)
+	}
+	if after.Size() >= before.Size() {
+		t.Errorf("the compacted log has %d bytes, want less than %d", after.Size(), before.Size())
+	}
+
+	// Appending continues on the compacted log
+	replaceAll(t, repo, "north", 6)
+
+	restored := mustOpen(t, path)
+	history, err := restored.History(tenant.NewContext(context.Background(), "north"))
+	if err != nil {
+		t.Fatalf("History() returned an unexpected error: %v", err)
+	}
+	var got []int
+	for _, rev := range history {
+		got = append(got, rev.Packs[0].Size)
+	}
+	if want := []int{4, 5, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong history sizes. got %v, want %v", got, want)
+	}
+	if got, want := findAll(t, restored, "south"), storage.NewPacks(53); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll(south) = %v, want %v", got, want)
+	}
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("ReadDir() returned an unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the log directory holds %d files, want 1", len(entries))
+	}
+}
+
+// TestPackRepo_PeriodicCompact tests that the log is compacted every interval after changes.
+func TestPackRepo_PeriodicCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packs.wal")
+
+	repo := mustOpen(t, path, WithHistoryLimit(1), WithCompactInterval(time.Millisecond))
+	replaceAll(t, repo, "north", 23)
+	replaceAll(t, repo, "north", 31)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		history, err := repo.History(tenant.NewContext(context.Background(), "north"))
+		if err != nil {
+			t.Fatalf("History() returned an unexpected error: %v", err)
+		}
+		if len(history) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the log was not compacted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close() returned an unexpected error: %v", err)
+	}
+	if err := repo.ReplaceAll(context.Background(), storage.NewPacks(1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("ReplaceAll() after Close() error = %v, wantErr %v", err, os.ErrClosed)
+	}
+	if got, want := findAll(t, mustOpen(t, path), "north"), storage.NewPacks(31); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %v, want %v", got, want)
+	}
+}
+
+// TestPackRepo runs the repository tests shared by the storage backends.
+func TestPackRepo(t *testing.T) {
+	storagetest.TestPackRepository(t, func(t *testing.T) storage.PackRepository {
+		return mustOpen(t, filepath.Join(t.TempDir(), "packs.wal"))
+	})
+}
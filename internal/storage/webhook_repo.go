@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Webhook is a subscription of a downstream system to the pack changes.
+type Webhook struct {
+	// ID is assigned by the repository when the webhook is added.
+	ID  int64
+	URL string
+	// Secret signs the payloads delivered to URL.
+	Secret    string
+	CreatedAt time.Time
+}
+
+// WebhookRepository defines the contract for the storage of webhook subscriptions.
+type WebhookRepository interface {
+	// Add stores the webhook and sets its ID.
+	Add(ctx context.Context, w *Webhook) error
+
+	// List returns all webhooks sorted by ID.
+	List(ctx context.Context) ([]Webhook, error)
+
+	// Delete removes the webhook with the given ID, or returns ErrNotFound.
+	Delete(ctx context.Context, id int64) error
+}
@@ -0,0 +1,142 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned when a bearer token is missing, malformed,
+	// badly signed or expired.
+	ErrInvalidToken = errors.New("invalid tenant token")
+	// ErrUnknown is returned for a tenant that is not allowed.
+	ErrUnknown = errors.New("unknown tenant")
+)
+
+// Resolver identifies the tenant of a request, for every transport. The tenant
+// is the one the request names, or the "tenant" claim of an HS256 signed bearer
+// token when a token secret is set. Requests identifying no tenant belong to
+// DefaultID.
+type Resolver struct {
+	// secret verifies the bearer tokens. When set, the named tenant is ignored.
+	secret []byte
+	// allowed lists the known tenants, any valid tenant is accepted when nil.
+	allowed map[string]bool
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// ResolverOption configures optional Resolver settings.
+type ResolverOption func(*Resolver)
+
+// WithTokenSecret identifies the tenants by the "tenant" claim of HS256 bearer
+// tokens signed with the secret, instead of the tenant the requests name.
+func WithTokenSecret(secret []byte) ResolverOption {
+	return func(r *Resolver) {
+		r.secret = secret
+	}
+}
+
+// WithAllowed only accepts the listed tenants.
+func WithAllowed(ids ...string) ResolverOption {
+	return func(r *Resolver) {
+		r.allowed = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			r.allowed[id] = true
+		}
+	}
+}
+
+// NewResolver creates a resolver, trusting the tenant named by the requests
+// unless configured otherwise.
+func NewResolver(opts ...ResolverOption) *Resolver {
+	r := &Resolver{now: time.Now}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Resolve returns the tenant of a request naming the tenant id, possibly empty,
+// with the authorization value, such as "Bearer <token>". It returns
+// ErrInvalidToken, ErrInvalidID or ErrUnknown when the request is refused.
+func (r *Resolver) Resolve(id, authorization string) (string, error) {
+	if r.secret != nil {
+		var err error
+		if id, err = r.fromToken(authorization); err != nil {
+			return "", err
+		}
+	}
+
+	if id == "" {
+		id = DefaultID
+	}
+	if err := Validate(id); err != nil {
+		return "", err
+	}
+	if r.allowed != nil && !r.allowed[id] {
+		return "", ErrUnknown
+	}
+
+	return id, nil
+}
+
+// fromToken returns the tenant claim of the bearer token.
+func (r *Resolver) fromToken(authorization string) (string, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return "", ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", ErrInvalidToken
+	}
+
+	var claims struct {
+		Tenant string `json:"tenant"`
+		Exp    *int64 `json:"exp"`
+	}
+	if err := decodeTokenPart(parts[1], &claims); err != nil || claims.Tenant == "" {
+		return "", ErrInvalidToken
+	}
+	if claims.Exp != nil && !r.now().Before(time.Unix(*claims.Exp, 0)) {
+		return "", ErrInvalidToken
+	}
+
+	return claims.Tenant, nil
+}
+
+// decodeTokenPart decodes a base64url encoded JSON part of a token into v.
+func decodeTokenPart(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,84 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// signToken returns an HS256 token with the claims signed with the secret.
+func signToken(secret, claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + payload))
+
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	secret := WithTokenSecret([]byte("s3cret"))
+
+	testCases := []struct {
+		name          string
+		opts          []ResolverOption
+		id            string
+		authorization string
+		want          string
+		wantErr       error
+	}{
+		{name: "Named", id: "north", want: "north"},
+		{name: "Not named", want: DefaultID},
+		{name: "Invalid", id: "north/south", wantErr: ErrInvalidID},
+		{name: "Allowed", opts: []ResolverOption{WithAllowed("north")}, id: "north", want: "north"},
+		{name: "Not allowed", opts: []ResolverOption{WithAllowed("north")}, id: "south", wantErr: ErrUnknown},
+		{name: "Default not allowed", opts: []ResolverOption{WithAllowed("north")}, wantErr: ErrUnknown},
+		{
+			name: "Token", opts: []ResolverOption{secret}, id: "south",
+			authorization: "Bearer " + signToken("s3cret", `{"tenant":"north","exp":1735693200}`),
+			want:          "north",
+		},
+		{name: "Missing token", opts: []ResolverOption{secret}, id: "north", wantErr: ErrInvalidToken},
+		{name: "Not a bearer token", opts: []ResolverOption{secret}, authorization: "Basic bm9ydGg6", wantErr: ErrInvalidToken},
+		{
+			name: "Bad signature", opts: []ResolverOption{secret},
+			authorization: "Bearer " + signToken("other", `{"tenant":"north"}`),
+			wantErr:       ErrInvalidToken,
+		},
+		{
+			name: "Expired token", opts: []ResolverOption{secret},
+			authorization: "Bearer " + signToken("s3cret", `{"tenant":"north","exp":1735686000}`),
+			wantErr:       ErrInvalidToken,
+		},
+		{
+			name: "No tenant claim", opts: []ResolverOption{secret},
+			authorization: "Bearer " + signToken("s3cret", `{"sub":"north"}`),
+			wantErr:       ErrInvalidToken,
+		},
+		{
+			name: "Token of a tenant not allowed", opts: []ResolverOption{secret, WithAllowed("south")},
+			authorization: "Bearer " + signToken("s3cret", `{"tenant":"north"}`),
+			wantErr:       ErrUnknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewResolver(tc.opts...)
+			r.now = func() time.Time { return now }
+
+			got, err := r.Resolve(tc.id, tc.authorization)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("Resolve() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
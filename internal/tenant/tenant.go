@@ -0,0 +1,52 @@
+// Package tenant identifies the business unit a request belongs to.
+//
+// The tenant travels in the request context, so the storage layer can scope
+// every read and write to it without the service layer passing it around.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// DefaultID is the tenant of requests that do not identify one.
+const DefaultID = "default"
+
+// maxIDLength bounds the length of a tenant ID.
+const maxIDLength = 64
+
+// ErrInvalidID is returned when a tenant ID is empty, too long or has
+// characters other than ASCII letters, digits, '-' and '_'.
+var ErrInvalidID = errors.New("invalid tenant ID")
+
+// Validate returns ErrInvalidID when the ID is not a valid tenant ID.
+func Validate(id string) error {
+	if id == "" || len(id) > maxIDLength {
+		return ErrInvalidID
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return ErrInvalidID
+		}
+	}
+
+	return nil
+}
+
+// contextKey is the context key of the tenant ID.
+type contextKey struct{}
+
+// NewContext returns a context belonging to the tenant.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant set by NewContext, DefaultID otherwise.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+
+	return DefaultID
+}
@@ -0,0 +1,39 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		wantErr error
+	}{
+		{name: "Letters and digits", id: "unit42"},
+		{name: "Dashes and underscores", id: "north-east_1"},
+		{name: "Empty", id: "", wantErr: ErrInvalidID},
+		{name: "Too long", id: strings.Repeat("a", maxIDLength+1), wantErr: ErrInvalidID},
+		{name: "Path separator", id: "a/b", wantErr: ErrInvalidID},
+		{name: "Non ASCII", id: "unité", wantErr: ErrInvalidID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.id); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != DefaultID {
+		t.Errorf("FromContext() got = %q, want %q", got, DefaultID)
+	}
+	if got := FromContext(NewContext(context.Background(), "unit42")); got != "unit42" {
+		t.Errorf("FromContext() got = %q, want %q", got, "unit42")
+	}
+}
@@ -0,0 +1,423 @@
+// Package webhook delivers events to the webhooks subscribed by downstream systems.
+//
+// Every delivery is an HTTP POST of the JSON event, signed with the secret of
+// the webhook, and is retried with exponential backoff until it succeeds or
+// runs out of attempts. Deliveries that ran out of attempts are kept in a
+// dead-letter list of their tenant for inspection.
+//
+// Unless allowed by WithPrivateDestinations, webhooks must not target private,
+// loopback or link-local addresses: the destinations are checked when the
+// webhooks are registered and again when dialing, and redirects are not
+// followed, so a webhook cannot reach the internal network of the service.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+const (
+	// DefaultMaxAttempts is the number of delivery attempts unless overridden.
+	DefaultMaxAttempts = 5
+	// DefaultBaseBackoff is the wait before the first retry unless overridden.
+	DefaultBaseBackoff = time.Second
+	// DefaultMaxBackoff bounds the wait between retries unless overridden.
+	DefaultMaxBackoff = time.Minute
+	// DefaultMaxDeadLetters is the number of dead letters kept per tenant unless overridden.
+	DefaultMaxDeadLetters = 1000
+	// DefaultTimeout bounds a single delivery attempt unless overridden.
+	DefaultTimeout = 10 * time.Second
+)
+
+// EventPackSizesChanged is the type of the event sent after the packs are replaced.
+const EventPackSizesChanged = "pack_sizes.changed"
+
+// ErrForbiddenDestination is returned for webhooks targeting a private,
+// loopback or link-local address.
+var ErrForbiddenDestination = errors.New("forbidden webhook destination")
+
+// Headers of every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event is the payload of a delivery.
+type Event struct {
+	// ID identifies the event, receivers use it to drop duplicate deliveries.
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Tenant    string    `json:"tenant"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data"`
+}
+
+// PackSizesChanged is the data of an EventPackSizesChanged event.
+type PackSizesChanged struct {
+	// Sizes are the active pack sizes, ascending.
+	Sizes []int `json:"sizes"`
+}
+
+// NewEventID returns a random event ID.
+func NewEventID() (string, error) {
+	return randomHex(16)
+}
+
+// NewSecret returns a random webhook secret.
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("reading random bytes: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// forbiddenIP reports whether the address is private, loopback, link-local,
+// unspecified or multicast.
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// checkDial refuses the connections to forbidden addresses. It runs after the
+// host is resolved, so a name resolving to another address than when the
+// webhook was registered is still refused.
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenDestination, host)
+	}
+
+	return nil
+}
+
+// newHTTPClient returns the client of the deliveries, refusing the forbidden
+// addresses unless allowPrivate and never following redirects.
+func newHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: DefaultTimeout}
+	if !allowPrivate {
+		dialer.Control = checkDial
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   DefaultTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Sign returns the signature of a delivery: the hex encoded HMAC-SHA256, keyed
+// with the secret, of the timestamp header, a dot and the body.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeadLetter is a delivery that failed every attempt.
+type DeadLetter struct {
+	WebhookID int64
+	URL       string
+	Event     Event
+	Attempts  int
+	LastError string
+	FailedAt  time.Time
+}
+
+// Dispatcher delivers events to webhooks in the background.
+type Dispatcher struct {
+	client         *http.Client
+	allowPrivate   bool
+	maxAttempts    int
+	baseBackoff    time.Duration
+	maxBackoff     time.Duration
+	maxDeadLetters int
+
+	// ctx is canceled by Close, abandoning the pending deliveries.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// deadLetters holds the dead letters of every tenant, oldest first.
+	deadLetters map[string][]DeadLetter
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// Option configures optional Dispatcher settings.
+type Option func(*Dispatcher)
+
+// WithHTTPClient sends the deliveries with the client, which then decides
+// which destinations and redirects it accepts.
+func WithHTTPClient(c *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = c
+	}
+}
+
+// WithPrivateDestinations allows the webhooks targeting private, loopback and
+// link-local addresses, for receivers on the internal network.
+func WithPrivateDestinations() Option {
+	return func(d *Dispatcher) {
+		d.allowPrivate = true
+	}
+}
+
+// WithMaxAttempts sets the number of delivery attempts before a dead letter.
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = max(n, 1)
+	}
+}
+
+// WithBackoff waits base before the first retry, doubling the wait after
+// every failed retry up to max.
+func WithBackoff(base, max time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.baseBackoff = base
+		d.maxBackoff = max
+	}
+}
+
+// WithMaxDeadLetters sets the number of dead letters kept per tenant, the oldest
+// ones are dropped. A tenant whose webhooks keep failing only drops its own.
+func WithMaxDeadLetters(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxDeadLetters = n
+	}
+}
+
+// NewDispatcher creates a dispatcher, stopped by Close.
+func NewDispatcher(opts ...Option) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d := &Dispatcher{
+		maxAttempts:    DefaultMaxAttempts,
+		baseBackoff:    DefaultBaseBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		maxDeadLetters: DefaultMaxDeadLetters,
+		deadLetters:    make(map[string][]DeadLetter),
+		ctx:            ctx,
+		cancel:         cancel,
+		now:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.client == nil {
+		d.client = newHTTPClient(d.allowPrivate)
+	}
+
+	return d
+}
+
+// CheckDestination returns ErrForbiddenDestination when the host of the URL is
+// or resolves to an address the dispatcher refuses to deliver to.
+func (d *Dispatcher) CheckDestination(ctx context.Context, u *url.URL) error {
+	if d.allowPrivate {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if forbiddenIP(ip) {
+			return fmt.Errorf("%w: %s", ErrForbiddenDestination, host)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: resolving %s: %v", ErrForbiddenDestination, host, err)
+	}
+	for _, a := range addrs {
+		if forbiddenIP(a.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenDestination, host, a.IP)
+		}
+	}
+
+	return nil
+}
+
+// Dispatch delivers the event to every webhook in the background.
+func (d *Dispatcher) Dispatch(webhooks []storage.Webhook, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range webhooks {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.deliver(w, e, body)
+		}()
+	}
+
+	return nil
+}
+
+// Send makes a single attempt to deliver the event to every webhook and waits
+// for them, returning the errors of the failed deliveries. Callers retrying the
+// event retry it for every webhook, receivers drop the duplicates by event ID.
+func (d *Dispatcher) Send(ctx context.Context, webhooks []storage.Webhook, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(webhooks))
+	var wg sync.WaitGroup
+	for i, w := range webhooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.send(ctx, w, e, body); err != nil {
+				errs[i] = fmt.Errorf("webhook %d: %w", w.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Close abandons the pending retries and waits for the deliveries in flight.
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// Wait waits for every delivery dispatched so far to succeed or fail.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// DeadLetters returns the deliveries of the events of the tenant that failed
+// every attempt, oldest first.
+func (d *Dispatcher) DeadLetters(tenantID string) []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]DeadLetter{}, d.deadLetters[tenantID]...)
+}
+
+// deliver sends the event to the webhook until it succeeds or runs out of attempts.
+func (d *Dispatcher) deliver(w storage.Webhook, e Event, body []byte) {
+	backoff := d.baseBackoff
+
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if err = d.send(d.ctx, w, e, body); err == nil {
+			return
+		}
+		if attempt == d.maxAttempts {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			err = fmt.Errorf("%w, last attempt: %v", d.ctx.Err(), err)
+		}
+		if d.ctx.Err() != nil {
+			break
+		}
+
+		backoff = min(2*backoff, d.maxBackoff)
+	}
+
+	d.addDeadLetter(DeadLetter{
+		WebhookID: w.ID,
+		URL:       w.URL,
+		Event:     e,
+		Attempts:  attempt,
+		LastError: err.Error(),
+		FailedAt:  d.now().UTC(),
+	})
+}
+
+// send makes a single delivery attempt, failing on any status other than 2xx,
+// redirects included.
+func (d *Dispatcher) send(ctx context.Context, w storage.Webhook, e Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, e.Type)
+	req.Header.Set(HeaderID, e.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// addDeadLetter keeps the failed delivery, dropping the oldest one of its
+// tenant when the tenant's list is full.
+func (d *Dispatcher) addDeadLetter(l DeadLetter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letters := append(d.deadLetters[l.Event.Tenant], l)
+	if d.maxDeadLetters > 0 && len(letters) > d.maxDeadLetters {
+		letters = letters[len(letters)-d.maxDeadLetters:]
+	}
+	d.deadLetters[l.Event.Tenant] = letters
+}
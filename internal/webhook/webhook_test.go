@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/storage"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("s3cret", "1735689600", []byte(`{"id":"1"}`))
+	want := "sha256=22e44e8c8a6b6091054e8b39f91546163c5df6fc74dd7744ccda245ab2bd84f7"
+	if got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	event := Event{
+		ID:        "evt-1",
+		Type:      EventPackSizesChanged,
+		Tenant:    "north",
+		Timestamp: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Data:      PackSizesChanged{Sizes: []int{250, 500}},
+	}
+
+	testCases := []struct {
+		name string
+		// failures is the number of failed attempts before the receiver succeeds.
+		failures        int32
+		wantRequests    int32
+		wantDeadLetters int
+	}{
+		{name: "Delivered", failures: 0, wantRequests: 1},
+		{name: "Retried", failures: 2, wantRequests: 3},
+		{name: "Dead letter", failures: 10, wantRequests: 3, wantDeadLetters: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+
+				// Every attempt is signed with the secret of the webhook
+				if got := r.Header.Get(HeaderSignature); got != Sign("s3cret", r.Header.Get(HeaderTimestamp), body) {
+					t.Errorf("wrong signature. got %q", got)
+				}
+				if got := r.Header.Get(HeaderEvent); got != EventPackSizesChanged {
+					t.Errorf("wrong event header. got %q, want %q", got, EventPackSizesChanged)
+				}
+
+				var got Event
+				if err := json.Unmarshal(body, &got); err != nil || got.ID != event.ID || got.Tenant != event.Tenant {
+					t.Errorf("wrong body. got %s", body)
+				}
+
+				if requests.Add(1) <= tc.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			d := NewDispatcher(WithPrivateDestinations(), WithMaxAttempts(3), WithBackoff(time.Millisecond, 4*time.Millisecond))
+			defer d.Close()
+
+			webhooks := []storage.Webhook{{ID: 7, URL: server.URL, Secret: "s3cret"}}
+			if err := d.Dispatch(webhooks, event); err != nil {
+				t.Fatalf("Dispatch() returned an unexpected error: %v", err)
+			}
+			d.Wait()
+
+			if got := requests.Load(); got != tc.wantRequests {
+				t.Errorf("wrong number of requests. got %d, want %d", got, tc.wantRequests)
+			}
+
+			letters := d.DeadLetters("north")
+			if len(letters) != tc.wantDeadLetters {
+				t.Fatalf("DeadLetters() got %d, want %d", len(letters), tc.wantDeadLetters)
+			}
+			if tc.wantDeadLetters > 0 {
+				l := letters[0]
+				if l.WebhookID != 7 || l.Attempts != 3 || l.Event.ID != event.ID || l.LastError != "unexpected status 503" {
+					t.Errorf("DeadLetters() got = %+v", l)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_Send(t *testing.T) {
+	var requests atomic.Int32
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	d := NewDispatcher(WithPrivateDestinations(), WithMaxAttempts(3))
+	defer d.Close()
+
+	webhooks := []storage.Webhook{{ID: 1, URL: ok.URL}, {ID: 2, URL: failing.URL}}
+	err := d.Send(context.Background(), webhooks, Event{ID: "evt-1"})
+	if err == nil || !strings.Contains(err.Error(), "webhook 2: unexpected status 503") {
+		t.Errorf("Send() error = %v, want the failure of webhook 2", err)
+	}
+
+	// A single attempt per webhook, the failures are left to the caller
+	if got := requests.Load(); got != 2 {
+		t.Errorf("wrong number of requests. got %d, want 2", got)
+	}
+	if letters := d.DeadLetters(""); len(letters) != 0 {
+		t.Errorf("DeadLetters() got = %+v, want none", letters)
+	}
+
+	if err := d.Send(context.Background(), webhooks[:1], Event{ID: "evt-2"}); err != nil {
+		t.Errorf("Send() returned an unexpected error: %v", err)
+	}
+}
+
+// TestDispatcher_ForbiddenDestinations tests that private addresses are refused
+// when registering and when dialing, and that redirects are not followed.
+func TestDispatcher_ForbiddenDestinations(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher()
+	defer d.Close()
+
+	for _, raw := range []string{server.URL, "http://localhost/hook", "http://10.0.0.1/hook", "http://169.254.169.254/latest", "http://[::1]/hook", "http://0.0.0.0/hook"} {
+		u, _ := url.Parse(raw)
+		if err := d.CheckDestination(context.Background(), u); !errors.Is(err, ErrForbiddenDestination) {
+			t.Errorf("CheckDestination(%q) error = %v, want %v", raw, err, ErrForbiddenDestination)
+		}
+	}
+	u, _ := url.Parse("http://203.0.113.10/hook")
+	if err := d.CheckDestination(context.Background(), u); err != nil {
+		t.Errorf("CheckDestination(%q) returned an unexpected error: %v", u, err)
+	}
+
+	// A webhook registered before its name resolved to a private address is refused when dialing
+	err := d.Send(context.Background(), []storage.Webhook{{ID: 1, URL: server.URL}}, Event{ID: "evt-1"})
+	if !errors.Is(err, ErrForbiddenDestination) {
+		t.Errorf("Send() error = %v, want %v", err, ErrForbiddenDestination)
+	}
+	if got := requests.Load(); got != 0 {
+		t.Errorf("wrong number of requests. got %d, want 0", got)
+	}
+
+	// The redirects are failures, not followed
+	allowed := NewDispatcher(WithPrivateDestinations())
+	defer allowed.Close()
+	err = allowed.Send(context.Background(), []storage.Webhook{{ID: 1, URL: server.URL}}, Event{ID: "evt-2"})
+	if err == nil || !strings.Contains(err.Error(), "unexpected status 302") {
+		t.Errorf("Send() error = %v, want the redirect status", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("wrong number of requests. got %d, want 1", got)
+	}
+}
+
+func TestDispatcher_Close(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// The retry would wait for an hour, Close abandons it
+	d := NewDispatcher(WithPrivateDestinations(), WithMaxAttempts(5), WithBackoff(time.Hour, time.Hour))
+	if err := d.Dispatch([]storage.Webhook{{ID: 1, URL: server.URL}}, Event{ID: "evt-1"}); err != nil {
+		t.Fatalf("Dispatch() returned an unexpected error: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		d.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() did not abandon the pending retry")
+	}
+
+	if letters := d.DeadLetters(""); len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Errorf("DeadLetters() got = %+v, want the abandoned delivery", letters)
+	}
+}
+
+// TestDispatcher_MaxDeadLetters tests that every tenant keeps its last dead
+// letters, whatever the dead letters of the others.
+func TestDispatcher_MaxDeadLetters(t *testing.T) {
+	d := NewDispatcher(WithMaxDeadLetters(2))
+	d.addDeadLetter(DeadLetter{Event: Event{ID: "south-1", Tenant: "south"}})
+	for _, id := range []string{"1", "2", "3"} {
+		d.addDeadLetter(DeadLetter{Event: Event{ID: id, Tenant: "north"}})
+	}
+
+	letters := d.DeadLetters("north")
+	if len(letters) != 2 || letters[0].Event.ID != "2" || letters[1].Event.ID != "3" {
+		t.Errorf("DeadLetters() got = %+v, want the last two", letters)
+	}
+	if letters := d.DeadLetters("south"); len(letters) != 1 || letters[0].Event.ID != "south-1" {
+		t.Errorf("DeadLetters() got = %+v, want the dead letter of south", letters)
+	}
+	if letters := d.DeadLetters("east"); letters == nil || len(letters) != 0 {
+		t.Errorf("DeadLetters() got = %#v, want an empty list", letters)
+	}
+}
@@ -1,39 +1,390 @@
 package webservice
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/gorilla/mux"
+
+	"denisgodoroja/retask/internal/calculator"
+	"denisgodoroja/retask/internal/optimizer"
+	"denisgodoroja/retask/internal/packconfig"
 	"denisgodoroja/retask/internal/service"
+	"denisgodoroja/retask/internal/shipping"
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/tenant"
+	"denisgodoroja/retask/internal/webhook"
 )
 
+// Pack is a pack size with its catalog attributes, see storage.Pack.
+type Pack struct {
+	Size       int         `json:"size"`
+	Label      string      `json:"label,omitempty"`
+	SKU        string      `json:"sku,omitempty"`
+	Cost       float64     `json:"cost,omitempty"`
+	Weight     float64     `json:"weight,omitempty"`
+	Dimensions *Dimensions `json:"dimensions,omitempty"`
+	// Active defaults to true when omitted.
+	Active *bool `json:"active,omitempty"`
+}
+
+type Dimensions struct {
+	Length float64 `json:"length"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
 type GetSizesResponse struct {
-	Sizes []int `json:"sizes"`
+	// Sizes are the sizes of the active packs.
+	Sizes []int  `json:"sizes"`
+	Packs []Pack `json:"packs"`
+	Unit  string `json:"unit"`
 }
 
 type SetSizesRequest struct {
 	Sizes []int `json:"sizes"`
+	// Packs replace the sizes with packs carrying their attributes when set.
+	Packs []Pack `json:"packs,omitempty"`
+	// Unit changes the unit of the sizes when set.
+	Unit string `json:"unit,omitempty"`
+}
+
+type ImportResponse struct {
+	// DryRun is set when the configuration was only validated, not applied.
+	DryRun bool `json:"dryRun"`
+	// Sizes, Packs and Unit are the configuration in effect after the import.
+	Sizes []int  `json:"sizes"`
+	Packs []Pack `json:"packs"`
+	Unit  string `json:"unit"`
 }
 
 type CalculateRequest struct {
-	Amount int `json:"amount"`
+	Amount calculator.Quantity `json:"amount"`
+	// Unit is the unit of the amount, the unit of the pack sizes when empty.
+	Unit string `json:"unit,omitempty"`
+
+	// The fit settings restrict the acceptable packs, see service.Fit.
+	ExactOnly        bool    `json:"exactOnly,omitempty"`
+	MaxExcess        int     `json:"maxExcess,omitempty"`
+	MaxExcessPercent float64 `json:"maxExcessPercent,omitempty"`
+	UnderShip        bool    `json:"underShip,omitempty"`
+
+	// AsOf calculates with the packs valid at that time instead of the current ones.
+	AsOf *time.Time `json:"asOf,omitempty"`
+}
+
+type ScheduleChangeRequest struct {
+	EffectiveAt time.Time `json:"effectiveAt"`
+	// Packs, or bare active Sizes, replacing the current ones from EffectiveAt on.
+	Sizes []int  `json:"sizes,omitempty"`
+	Packs []Pack `json:"packs,omitempty"`
+}
+
+type ScheduledChange struct {
+	ID          int64     `json:"id"`
+	EffectiveAt time.Time `json:"effectiveAt"`
+	Packs       []Pack    `json:"packs"`
+}
+
+type ListScheduledChangesResponse struct {
+	Changes []ScheduledChange `json:"changes"`
+}
+
+type WebhookRequest struct {
+	URL string `json:"url"`
+	// Secret signs the payloads, a random one is generated when empty.
+	Secret string `json:"secret,omitempty"`
+}
+
+type Webhook struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url"`
+	// Secret is only returned when the webhook is added.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type DeadLetter struct {
+	WebhookID int64         `json:"webhookId"`
+	URL       string        `json:"url"`
+	Event     webhook.Event `json:"event"`
+	Attempts  int           `json:"attempts"`
+	LastError string        `json:"lastError"`
+	FailedAt  time.Time     `json:"failedAt"`
+}
+
+type ListDeadLettersResponse struct {
+	DeadLetters []DeadLetter `json:"deadLetters"`
 }
 
 type CalculateResponse struct {
 	Packs map[int]int `json:"packs"`
+	Unit  string      `json:"unit"`
+}
+
+// Rule is a constraint on the packs of every calculation, see calculator.Rule.
+type Rule struct {
+	Kind   string `json:"kind"`
+	Size   int    `json:"size,omitempty"`
+	Sizes  []int  `json:"sizes,omitempty"`
+	Count  int    `json:"count,omitempty"`
+	Amount int    `json:"amount,omitempty"`
+}
+
+type RulesRequest struct {
+	Rules []Rule `json:"rules"`
+}
+
+type RulesResponse struct {
+	Rules []Rule `json:"rules"`
+}
+
+// InfeasibleResponse names the rule making a calculation infeasible.
+type InfeasibleResponse struct {
+	Error string `json:"error"`
+	Rule  Rule   `json:"rule"`
+}
+
+type AnalyzeRequest struct {
+	Sizes []int `json:"sizes"`
+	From  int   `json:"from"`
+	To    int   `json:"to"`
+}
+
+type AnalyzeResponse struct {
+	GCD               int     `json:"gcd"`
+	Redundant         []int   `json:"redundant"`
+	PeriodicThreshold int     `json:"periodicThreshold"`
+	From              int     `json:"from"`
+	To                int     `json:"to"`
+	WorstExcess       int     `json:"worstExcess"`
+	WorstExcessAmount int     `json:"worstExcessAmount"`
+	AverageExcess     float64 `json:"averageExcess"`
+}
+
+type CompareRequest struct {
+	Sizes          []int   `json:"sizes"`
+	Amounts        []int   `json:"amounts"`
+	ExcessItemCost float64 `json:"excessItemCost"`
+	PackCost       float64 `json:"packCost"`
+}
+
+type SizeSetMetrics struct {
+	Sizes       []int   `json:"sizes"`
+	Orders      int     `json:"orders"`
+	TotalExcess int     `json:"totalExcess"`
+	TotalPacks  int     `json:"totalPacks"`
+	Cost        float64 `json:"cost"`
+}
+
+type CompareResponse struct {
+	Current     SizeSetMetrics `json:"current"`
+	Candidate   SizeSetMetrics `json:"candidate"`
+	DeltaExcess int            `json:"deltaExcess"`
+	DeltaPacks  int            `json:"deltaPacks"`
+	DeltaCost   float64        `json:"deltaCost"`
+}
+
+type RecommendRequest struct {
+	Amounts        []int   `json:"amounts"`
+	AllowedSizes   []int   `json:"allowedSizes"`
+	RequiredSizes  []int   `json:"requiredSizes"`
+	MaxCount       int     `json:"maxCount"`
+	ExcessItemCost float64 `json:"excessItemCost"`
+	PackCost       float64 `json:"packCost"`
+	Limit          int     `json:"limit"`
+}
+
+type Recommendation struct {
+	Sizes         []int   `json:"sizes"`
+	Orders        int     `json:"orders"`
+	TotalExcess   int     `json:"totalExcess"`
+	TotalPacks    int     `json:"totalPacks"`
+	AverageExcess float64 `json:"averageExcess"`
+	AveragePacks  float64 `json:"averagePacks"`
+	Cost          float64 `json:"cost"`
+}
+
+type RecommendResponse struct {
+	Recommendations []Recommendation `json:"recommendations"`
+}
+
+type CacheStatsResponse struct {
+	Enabled   bool    `json:"enabled"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	Size      int     `json:"size"`
+	Capacity  int     `json:"capacity"`
+	HitRatio  float64 `json:"hitRatio"`
+}
+
+type PackSpec struct {
+	Size   int     `json:"size"`
+	Volume float64 `json:"volume"`
+	Weight float64 `json:"weight"`
+}
+
+type ShipmentLine struct {
+	Amount int        `json:"amount"`
+	Packs  []PackSpec `json:"packs"`
+}
+
+type ContainerType struct {
+	Name      string  `json:"name"`
+	MaxVolume float64 `json:"maxVolume"`
+	MaxWeight float64 `json:"maxWeight"`
+	Cost      float64 `json:"cost"`
+}
+
+type PlanShipmentRequest struct {
+	Lines      []ShipmentLine  `json:"lines"`
+	Containers []ContainerType `json:"containers"`
+}
+
+type ShipmentLinePacks struct {
+	Packs map[int]int `json:"packs"`
+}
+
+type ContainerContent struct {
+	Line  int `json:"line"`
+	Size  int `json:"size"`
+	Count int `json:"count"`
 }
 
+type Container struct {
+	Type     string             `json:"type"`
+	Volume   float64            `json:"volume"`
+	Weight   float64            `json:"weight"`
+	Contents []ContainerContent `json:"contents"`
+}
+
+type PlanShipmentResponse struct {
+	Lines      []ShipmentLinePacks `json:"lines"`
+	Containers []Container         `json:"containers"`
+	TotalCost  float64             `json:"totalCost"`
+}
+
+type CalculationRecord struct {
+	ID          int64       `json:"id"`
+	Timestamp   time.Time   `json:"timestamp"`
+	Amount      int         `json:"amount"`
+	Packs       map[int]int `json:"packs"`
+	TotalItems  int         `json:"totalItems"`
+	Excess      int         `json:"excess"`
+	SizeVersion string      `json:"sizeVersion"`
+	Requester   string      `json:"requester"`
+}
+
+type DailyCalculationStats struct {
+	Day               string `json:"day"`
+	Count             int    `json:"count"`
+	TotalExcess       int    `json:"totalExcess"`
+	MostUsedSize      int    `json:"mostUsedSize"`
+	MostUsedSizePacks int    `json:"mostUsedSizePacks"`
+}
+
+type CalculationStats struct {
+	Count       int                     `json:"count"`
+	TotalExcess int                     `json:"totalExcess"`
+	Daily       []DailyCalculationStats `json:"daily"`
+}
+
+type ListCalculationsResponse struct {
+	Calculations []CalculationRecord `json:"calculations"`
+	Total        int                 `json:"total"`
+	Limit        int                 `json:"limit"`
+	Offset       int                 `json:"offset"`
+	Stats        CalculationStats    `json:"stats"`
+}
+
+// DefaultCalculationTimeout is the deadline applied to a single calculation
+// unless overridden with WithCalculationTimeout.
+const DefaultCalculationTimeout = 5 * time.Second
+
+// DefaultMaxBodyBytes is the largest accepted JSON request body
+// unless overridden with WithMaxBodyBytes.
+const DefaultMaxBodyBytes = 1 << 20
+
+// DefaultHeartbeatInterval is the time between the keep-alive comments of event streams
+// unless overridden, below the 60s read timeout of Nginx.
+const DefaultHeartbeatInterval = 25 * time.Second
+
+const (
+	// DefaultPageSize is the number of calculations listed when no limit is given.
+	DefaultPageSize = 50
+	// MaxPageSize is the largest number of calculations listed at once.
+	MaxPageSize = 1000
+)
+
 // Handler holds the dependencies for your HTTP handlers,
 // which is primarily the PackService.
 type Handler struct {
 	service *service.PackService
+
+	// calculationTimeout bounds the time spent on a single calculation.
+	calculationTimeout time.Duration
+	// maxBodyBytes bounds the size of every decoded JSON request body.
+	maxBodyBytes int64
+	// heartbeatInterval is the time between the keep-alive comments of event streams.
+	heartbeatInterval time.Duration
+
+	// streamsDone is closed by CloseStreams, ending the event streams.
+	streamsDone      chan struct{}
+	closeStreamsOnce sync.Once
+}
+
+// HandlerOption configures optional Handler settings.
+type HandlerOption func(*Handler)
+
+// WithCalculationTimeout sets the per-request calculation deadline.
+// A zero or negative value disables the deadline.
+func WithCalculationTimeout(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.calculationTimeout = d
+	}
+}
+
+// WithMaxBodyBytes sets the largest accepted JSON request body.
+func WithMaxBodyBytes(n int64) HandlerOption {
+	return func(h *Handler) {
+		h.maxBodyBytes = n
+	}
 }
 
 // NewHandler creates a new Handler with its dependencies.
-func NewHandler(s *service.PackService) *Handler {
-	return &Handler{
-		service: s,
+func NewHandler(s *service.PackService, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		service:            s,
+		calculationTimeout: DefaultCalculationTimeout,
+		maxBodyBytes:       DefaultMaxBodyBytes,
+		heartbeatInterval:  DefaultHeartbeatInterval,
+		streamsDone:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(h)
 	}
+
+	return h
+}
+
+// CloseStreams ends the event streams, open and future ones, so a graceful
+// shutdown does not wait for their clients to leave (see http.Server.RegisterOnShutdown).
+func (h *Handler) CloseStreams() {
+	h.closeStreamsOnce.Do(func() { close(h.streamsDone) })
 }
 
 // HandleGetPackSizes handles GET /pack/get-sizes
@@ -43,13 +394,100 @@ func (h *Handler) HandleGetPackSizes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sizes, err := h.service.GetPackSizes()
+	resp, err := h.packSizes(r.Context())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, GetSizesResponse{Sizes: sizes})
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// packSizes returns the current packs and their unit.
+func (h *Handler) packSizes(ctx context.Context) (GetSizesResponse, error) {
+	packs, err := h.service.GetPacks(ctx)
+	if err != nil {
+		return GetSizesResponse{}, err
+	}
+
+	unit, err := h.service.Unit(ctx)
+	if err != nil {
+		return GetSizesResponse{}, err
+	}
+
+	resp := GetSizesResponse{Sizes: storage.ActiveSizes(packs), Packs: make([]Pack, len(packs)), Unit: unit.Symbol}
+	for i, p := range packs {
+		resp.Packs[i] = toPack(p)
+	}
+
+	return resp, nil
+}
+
+// HandlePackSizesEvents handles GET /pack/sizes/events, a Server-Sent Events stream
+// sending the current packs, as GET /pack/sizes does, on connect and after every change.
+func (h *Handler) HandlePackSizesEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	// Watch before reading the current packs, so no change is missed in between
+	changes, stop := h.service.WatchPacks(r.Context())
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Nginx buffers proxied responses unless told otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func() bool {
+		resp, err := h.packSizes(r.Context())
+		if err != nil {
+			log.Printf("Failed to read the pack sizes of the event stream: %v", err)
+			return false
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return false
+		}
+
+		return writeEvent(w, rc, fmt.Sprintf("event: sizes\ndata: %s\n\n", data))
+	}
+
+	heartbeat := time.NewTicker(h.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	if !send() {
+		return
+	}
+	for {
+		select {
+		case <-changes:
+			if !send() {
+				return
+			}
+		case <-heartbeat.C:
+			// Comments keep idle connections open through proxies
+			if !writeEvent(w, rc, ": ping\n\n") {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.streamsDone:
+			return
+		}
+	}
+}
+
+// writeEvent writes and flushes an event, reporting whether the client is still connected.
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, event string) bool {
+	if _, err := io.WriteString(w, event); err != nil {
+		return false
+	}
+
+	return rc.Flush() == nil
 }
 
 // HandleSetPackSizes handles POST /pack/set-sizes
@@ -60,19 +498,211 @@ func (h *Handler) HandleSetPackSizes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req SetSizesRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	// The unit and the packs are validated together before either is applied
+	var err error
+	switch {
+	case req.Packs != nil:
+		packs := make([]storage.Pack, len(req.Packs))
+		for i, p := range req.Packs {
+			packs[i] = fromPack(p)
+		}
+		err = h.service.ImportConfig(r.Context(), req.Unit, packs, false)
+	case req.Unit != "":
+		err = h.service.ImportConfig(r.Context(), req.Unit, storage.NewPacks(req.Sizes...), false)
+	default:
+		err = h.service.SetPackSizes(r.Context(), req.Sizes)
+	}
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleExportPackSizes handles GET /pack/sizes/export, the configuration document
+// of the current packs, as JSON unless the format query parameter is yaml or csv.
+func (h *Handler) HandleExportPackSizes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	format := packconfig.JSON
+	if v := r.URL.Query().Get("format"); v != "" {
+		f, err := packconfig.ParseFormat(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		format = f
+	}
+
+	packs, err := h.service.GetPacks(r.Context())
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	unit, err := h.service.Unit(r.Context())
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	id := tenant.FromContext(r.Context())
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="pack-sizes-%s.%s"`, id, format))
+	w.WriteHeader(http.StatusOK)
+	if err := packconfig.Encode(w, packconfig.New(id, unit.Symbol, packs), format); err != nil {
+		log.Printf("Failed to write the pack configuration: %v", err)
+	}
+}
+
+// HandleImportPackSizes handles POST /pack/sizes/import, replacing the packs with
+// a configuration document in the format of the format query parameter or of the
+// Content-Type, JSON by default. With dryRun=true the document is only validated.
+func (h *Handler) HandleImportPackSizes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	q := r.URL.Query()
+	format := packconfig.JSON
+	var err error
+	switch {
+	case q.Get("format") != "":
+		format, err = packconfig.ParseFormat(q.Get("format"))
+	case r.Header.Get("Content-Type") != "":
+		format, err = packconfig.FormatOfContentType(r.Header.Get("Content-Type"))
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	dryRun := false
+	if v := q.Get("dryRun"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid dryRun: expected true or false")
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if err := h.service.SetPackSizes(req.Sizes); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	doc, err := packconfig.Decode(body, format)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	packs := doc.StoragePacks()
+	if err := h.service.ImportConfig(r.Context(), doc.Unit, packs, dryRun); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	unit := doc.Unit
+	if unit == "" {
+		current, err := h.service.Unit(r.Context())
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		unit = current.Symbol
+	}
+
+	resp := ImportResponse{DryRun: dryRun, Sizes: storage.ActiveSizes(packs), Packs: make([]Pack, len(packs)), Unit: unit}
+	for i, p := range packs {
+		resp.Packs[i] = toPack(p)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func toPack(p storage.Pack) Pack {
+	active := p.Active
+	out := Pack{Size: p.Size, Label: p.Label, SKU: p.SKU, Cost: p.Cost, Weight: p.Weight, Active: &active}
+	if p.Dimensions != (storage.Dimensions{}) {
+		out.Dimensions = &Dimensions{Length: p.Dimensions.Length, Width: p.Dimensions.Width, Height: p.Dimensions.Height}
+	}
+
+	return out
+}
+
+func fromPack(p Pack) storage.Pack {
+	out := storage.Pack{Size: p.Size, Label: p.Label, SKU: p.SKU, Cost: p.Cost, Weight: p.Weight, Active: p.Active == nil || *p.Active}
+	if p.Dimensions != nil {
+		out.Dimensions = storage.Dimensions{Length: p.Dimensions.Length, Width: p.Dimensions.Width, Height: p.Dimensions.Height}
+	}
+
+	return out
+}
+
+// HandleGetRules handles GET /pack/rules
+func (h *Handler) HandleGetRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	rules, err := h.service.Rules(r.Context())
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	resp := RulesResponse{Rules: make([]Rule, len(rules))}
+	for i, rule := range rules {
+		resp.Rules[i] = toRule(rule)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// HandleSetRules handles POST /pack/rules
+func (h *Handler) HandleSetRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	var req RulesRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	rules := make([]calculator.Rule, len(req.Rules))
+	for i, rule := range req.Rules {
+		rules[i] = calculator.Rule{Kind: calculator.RuleKind(rule.Kind), Size: rule.Size, Sizes: rule.Sizes, Count: rule.Count, Amount: rule.Amount}
+	}
+
+	if err := h.service.SetRules(r.Context(), rules); err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+func toRule(r calculator.Rule) Rule {
+	return Rule{Kind: string(r.Kind), Size: r.Size, Sizes: r.Sizes, Count: r.Count, Amount: r.Amount}
+}
+
 // HandleCalculate handles POST /calculate
 func (h *Handler) HandleCalculate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -81,18 +711,580 @@ func (h *Handler) HandleCalculate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req CalculateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if !h.decodeJSON(w, r, &req) {
 		return
 	}
 
-	packs, err := h.service.Calculate(req.Amount)
+	ctx, cancel := h.calculationContext(r)
+	defer cancel()
+
+	ctx = service.ContextWithRequester(ctx, ClientIP(r))
+	if req.AsOf != nil {
+		ctx = service.ContextWithAsOf(ctx, *req.AsOf)
+	}
+
+	fit := service.Fit{
+		ExactOnly:        req.ExactOnly,
+		MaxExcess:        req.MaxExcess,
+		MaxExcessPercent: req.MaxExcessPercent,
+		UnderShip:        req.UnderShip,
+	}
+
+	packs, err := h.service.CalculateQuantity(ctx, req.Amount, req.Unit, fit)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, err)
+		return
+	}
+
+	unit, err := h.service.Unit(ctx)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, CalculateResponse{Packs: packs, Unit: unit.Symbol})
+}
+
+// HandleScheduleChange handles POST /pack/schedule
+func (h *Handler) HandleScheduleChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	var req ScheduleChangeRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	packs := storage.NewPacks(req.Sizes...)
+	if req.Packs != nil {
+		packs = make([]storage.Pack, len(req.Packs))
+		for i, p := range req.Packs {
+			packs[i] = fromPack(p)
+		}
+	}
+
+	c, err := h.service.ScheduleChange(r.Context(), req.EffectiveAt, packs)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, toScheduledChange(c))
+}
+
+// HandleListScheduledChanges handles GET /pack/schedule
+func (h *Handler) HandleListScheduledChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	changes, err := h.service.UpcomingChanges(r.Context())
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	resp := ListScheduledChangesResponse{Changes: make([]ScheduledChange, len(changes))}
+	for i, c := range changes {
+		resp.Changes[i] = toScheduledChange(c)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// HandleCancelScheduledChange handles DELETE /pack/schedule/{id}
+func (h *Handler) HandleCancelScheduledChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	if err := h.service.CancelChange(r.Context(), id); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func toScheduledChange(c storage.ScheduledChange) ScheduledChange {
+	out := ScheduledChange{ID: c.ID, EffectiveAt: c.EffectiveAt, Packs: make([]Pack, len(c.Packs))}
+	for i, p := range c.Packs {
+		out.Packs[i] = toPack(p)
+	}
+
+	return out
+}
+
+// HandleAddWebhook handles POST /webhooks
+func (h *Handler) HandleAddWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	var req WebhookRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	hook, err := h.service.AddWebhook(r.Context(), req.URL, req.Secret)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	resp := toWebhook(hook)
+	resp.Secret = hook.Secret
+
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// HandleListWebhooks handles GET /webhooks
+func (h *Handler) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	hooks, err := h.service.Webhooks(r.Context())
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	resp := ListWebhooksResponse{Webhooks: make([]Webhook, len(hooks))}
+	for i, hook := range hooks {
+		resp.Webhooks[i] = toWebhook(hook)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// HandleDeleteWebhook handles DELETE /webhooks/{id}
+func (h *Handler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	if err := h.service.DeleteWebhook(r.Context(), id); err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleListDeadLetters handles GET /webhooks/dead-letters
+func (h *Handler) HandleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, CalculateResponse{Packs: packs})
+	letters, err := h.service.DeadLetters(r.Context())
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	resp := ListDeadLettersResponse{DeadLetters: make([]DeadLetter, len(letters))}
+	for i, l := range letters {
+		resp.DeadLetters[i] = DeadLetter{
+			WebhookID: l.WebhookID,
+			URL:       l.URL,
+			Event:     l.Event,
+			Attempts:  l.Attempts,
+			LastError: l.LastError,
+			FailedAt:  l.FailedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// toWebhook converts a webhook to its response, without its secret.
+func toWebhook(w storage.Webhook) Webhook {
+	return Webhook{ID: w.ID, URL: w.URL, CreatedAt: w.CreatedAt}
+}
+
+// HandleAnalyzePackSizes handles POST /pack/sizes/analyze
+func (h *Handler) HandleAnalyzePackSizes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	var req AnalyzeRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := h.calculationContext(r)
+	defer cancel()
+
+	a, err := h.service.AnalyzePackSizes(ctx, req.Sizes, req.From, req.To)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, AnalyzeResponse{
+		GCD:               a.GCD,
+		Redundant:         a.Redundant,
+		PeriodicThreshold: a.PeriodicThreshold,
+		From:              a.From,
+		To:                a.To,
+		WorstExcess:       a.WorstExcess,
+		WorstExcessAmount: a.WorstExcessAmount,
+		AverageExcess:     a.AverageExcess,
+	})
+}
+
+// HandleComparePackSizes handles POST /pack/sizes/compare
+func (h *Handler) HandleComparePackSizes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	var req CompareRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := h.calculationContext(r)
+	defer cancel()
+
+	costs := service.CostModel{ExcessItemCost: req.ExcessItemCost, PackCost: req.PackCost}
+	c, err := h.service.ComparePackSizes(ctx, req.Sizes, req.Amounts, costs)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, CompareResponse{
+		Current:     toSizeSetMetrics(c.Current),
+		Candidate:   toSizeSetMetrics(c.Candidate),
+		DeltaExcess: c.DeltaExcess,
+		DeltaPacks:  c.DeltaPacks,
+		DeltaCost:   c.DeltaCost,
+	})
+}
+
+func toSizeSetMetrics(m service.SizeSetMetrics) SizeSetMetrics {
+	return SizeSetMetrics{
+		Sizes:       m.Sizes,
+		Orders:      m.Orders,
+		TotalExcess: m.TotalExcess,
+		TotalPacks:  m.TotalPacks,
+		Cost:        m.Cost,
+	}
+}
+
+// HandleRecommendPackSizes handles POST /pack/sizes/recommend
+func (h *Handler) HandleRecommendPackSizes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	var req RecommendRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := h.calculationContext(r)
+	defer cancel()
+
+	constraints := optimizer.Constraints{
+		AllowedSizes:  req.AllowedSizes,
+		RequiredSizes: req.RequiredSizes,
+		MaxCount:      req.MaxCount,
+	}
+	costs := service.CostModel{ExcessItemCost: req.ExcessItemCost, PackCost: req.PackCost}
+
+	recommendations, err := h.service.RecommendPackSizes(ctx, req.Amounts, constraints, costs, req.Limit)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	resp := RecommendResponse{Recommendations: make([]Recommendation, len(recommendations))}
+	for i, rec := range recommendations {
+		resp.Recommendations[i] = Recommendation{
+			Sizes:         rec.Sizes,
+			Orders:        rec.Orders,
+			TotalExcess:   rec.TotalExcess,
+			TotalPacks:    rec.TotalPacks,
+			AverageExcess: rec.AverageExcess(),
+			AveragePacks:  rec.AveragePacks(),
+			Cost:          rec.Cost,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// HandleCacheStats handles GET /calculate/cache-stats
+func (h *Handler) HandleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	stats, enabled := h.service.CacheStats()
+
+	respondWithJSON(w, http.StatusOK, CacheStatsResponse{
+		Enabled:   enabled,
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Evictions: stats.Evictions,
+		Size:      stats.Size,
+		Capacity:  stats.Capacity,
+		HitRatio:  stats.HitRatio(),
+	})
+}
+
+// HandlePlanShipment handles POST /shipments/plan
+func (h *Handler) HandlePlanShipment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	var req PlanShipmentRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	lines := make([]service.ShipmentLine, len(req.Lines))
+	for i, l := range req.Lines {
+		lines[i] = service.ShipmentLine{Amount: l.Amount, Packs: make([]shipping.PackSpec, len(l.Packs))}
+		for j, p := range l.Packs {
+			lines[i].Packs[j] = shipping.PackSpec(p)
+		}
+	}
+	containers := make([]shipping.ContainerType, len(req.Containers))
+	for i, c := range req.Containers {
+		containers[i] = shipping.ContainerType(c)
+	}
+
+	ctx, cancel := h.calculationContext(r)
+	defer cancel()
+
+	plan, err := h.service.PlanShipment(ctx, lines, containers)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	resp := PlanShipmentResponse{
+		Lines:      make([]ShipmentLinePacks, len(plan.Lines)),
+		Containers: make([]Container, len(plan.Containers)),
+		TotalCost:  plan.TotalCost,
+	}
+	for i, packs := range plan.Lines {
+		resp.Lines[i] = ShipmentLinePacks{Packs: packs}
+	}
+	for i, c := range plan.Containers {
+		resp.Containers[i] = Container{
+			Type:     c.Type,
+			Volume:   c.Volume,
+			Weight:   c.Weight,
+			Contents: make([]ContainerContent, len(c.Contents)),
+		}
+		for j, content := range c.Contents {
+			resp.Containers[i].Contents[j] = ContainerContent(content)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// HandleListCalculations handles GET /calculations
+// The query parameters from and to (RFC 3339), requester, minAmount and maxAmount
+// filter the history, limit and offset paginate it. The stats cover all matching
+// calculations, not only the listed page.
+func (h *Handler) HandleListCalculations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	f, err := parseCalculationFilter(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	calculations, total, err := h.service.ListCalculations(r.Context(), f)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	stats, err := h.service.CalculationStats(r.Context(), f)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	resp := ListCalculationsResponse{
+		Calculations: make([]CalculationRecord, len(calculations)),
+		Total:        total,
+		Limit:        f.Limit,
+		Offset:       f.Offset,
+		Stats: CalculationStats{
+			Count:       stats.Count,
+			TotalExcess: stats.TotalExcess,
+			Daily:       make([]DailyCalculationStats, len(stats.Daily)),
+		},
+	}
+	for i, c := range calculations {
+		resp.Calculations[i] = CalculationRecord{
+			ID:          c.ID,
+			Timestamp:   c.Timestamp,
+			Amount:      c.Amount,
+			Packs:       c.Packs,
+			TotalItems:  c.TotalItems,
+			Excess:      c.Excess,
+			SizeVersion: c.SizeVersion,
+			Requester:   c.Requester,
+		}
+	}
+	for i, d := range stats.Daily {
+		resp.Stats.Daily[i] = DailyCalculationStats(d)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// parseCalculationFilter reads the history filter from the query parameters.
+func parseCalculationFilter(r *http.Request) (storage.CalculationFilter, error) {
+	q := r.URL.Query()
+	f := storage.CalculationFilter{
+		Requester: q.Get("requester"),
+		Limit:     DefaultPageSize,
+	}
+
+	for _, p := range []struct {
+		name string
+		out  *time.Time
+	}{
+		{name: "from", out: &f.From},
+		{name: "to", out: &f.To},
+	} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, errors.New("invalid " + p.name + ": expected an RFC 3339 timestamp")
+			}
+			*p.out = t
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		out  *int
+	}{
+		{name: "minAmount", out: &f.MinAmount},
+		{name: "maxAmount", out: &f.MaxAmount},
+		{name: "limit", out: &f.Limit},
+		{name: "offset", out: &f.Offset},
+	} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return f, errors.New("invalid " + p.name + ": expected a non-negative integer")
+			}
+			*p.out = n
+		}
+	}
+
+	if f.Limit <= 0 || f.Limit > MaxPageSize {
+		return f, errors.New("invalid limit: expected 1 to " + strconv.Itoa(MaxPageSize))
+	}
+
+	return f, nil
+}
+
+// calculationContext derives the context of a calculation from the request,
+// bounded by the calculation deadline.
+func (h *Handler) calculationContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if h.calculationTimeout > 0 {
+		return context.WithTimeout(r.Context(), h.calculationTimeout)
+	}
+
+	return context.WithCancel(r.Context())
+}
+
+// decodeJSON decodes the size-limited request body into v.
+// On failure it writes the error response and returns false.
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return false
+		}
+
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+
+	return true
+}
+
+// respondWithServiceError maps an error returned by the service layer to an HTTP status.
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	var ruleErr *calculator.RuleError
+
+	switch {
+	case errors.Is(err, calculator.ErrInvalidRange), errors.Is(err, service.ErrNoPackSizes), errors.Is(err, service.ErrNoAmounts),
+		errors.Is(err, optimizer.ErrNoDemand), errors.Is(err, optimizer.ErrInvalidConstraints),
+		errors.Is(err, calculator.ErrInvalidQuantity), errors.Is(err, calculator.ErrUnknownUnit), errors.Is(err, calculator.ErrIncompatibleUnits),
+		errors.Is(err, calculator.ErrInvalidRule), errors.Is(err, service.ErrInvalidPack), errors.Is(err, service.ErrInvalidSchedule), errors.Is(err, service.ErrInvalidAsOf), errors.Is(err, service.ErrInvalidWebhook),
+		errors.Is(err, packconfig.ErrInvalidDocument),
+		errors.Is(err, shipping.ErrNoContainerTypes), errors.Is(err, shipping.ErrInvalidItem), errors.Is(err, shipping.ErrItemTooLarge):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrAmountTooLarge), errors.Is(err, calculator.ErrWorkBudgetExceeded), errors.Is(err, calculator.ErrTableTooLarge),
+		errors.Is(err, shipping.ErrTooManyItems):
+		respondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.As(err, &ruleErr):
+		respondWithJSON(w, http.StatusUnprocessableEntity, InfeasibleResponse{Error: err.Error(), Rule: toRule(ruleErr.Rule)})
+	case errors.Is(err, calculator.ErrInfeasible):
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, service.ErrHistoryDisabled), errors.Is(err, service.ErrCatalogDisabled), errors.Is(err, service.ErrScheduleDisabled),
+		errors.Is(err, service.ErrWebhooksDisabled), errors.Is(err, storage.ErrNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrChangeInEffect):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		respondWithError(w, http.StatusGatewayTimeout, "calculation timed out")
+	case errors.Is(err, context.Canceled):
+		respondWithError(w, http.StatusServiceUnavailable, "request canceled")
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
 }
 
 func respondWithError(w http.ResponseWriter, code int, message string) {
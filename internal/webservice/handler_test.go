@@ -1,36 +1,50 @@
 package webservice
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
+
+	"denisgodoroja/retask/internal/events"
 	"denisgodoroja/retask/internal/service"
 	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/inmemory"
+	"denisgodoroja/retask/internal/tenant"
+	"denisgodoroja/retask/internal/webhook"
 )
 
 // -- This is a mock *repository* --
 type mockPackRepository struct {
 	storage.PackRepository // Embed the interface for good practice
-	FindAllFunc            func() ([]int, error)
-	ReplaceAllFunc         func(sizes []int) error
+	FindAllFunc            func(ctx context.Context) ([]storage.Pack, error)
+	ReplaceAllFunc         func(ctx context.Context, packs []storage.Pack) error
 }
 
-func (m *mockPackRepository) FindAll() ([]int, error)      { return m.FindAllFunc() }
-func (m *mockPackRepository) ReplaceAll(sizes []int) error { return m.ReplaceAllFunc(sizes) }
+func (m *mockPackRepository) FindAll(ctx context.Context) ([]storage.Pack, error) {
+	return m.FindAllFunc(ctx)
+}
+func (m *mockPackRepository) ReplaceAll(ctx context.Context, packs []storage.Pack) error {
+	return m.ReplaceAllFunc(ctx, packs)
+}
 
 // setupTest creates a Handler with a mock service for testing.
-func setupTest() (*Handler, *mockPackRepository) {
+func setupTest(opts ...HandlerOption) (*Handler, *mockPackRepository) {
 	// Create the real service with the mock repo
 	mockRepo := &mockPackRepository{}
 	realService := service.NewPackService(mockRepo)
 
 	// Create the real handler with the real service
-	handler := NewHandler(realService)
+	handler := NewHandler(realService, opts...)
 
 	// Return the handler *and* the mock repo so we can control it
 	return handler, mockRepo
@@ -41,8 +55,8 @@ func TestHandler_HandleGetPackSizes(t *testing.T) {
 
 	// Case 1: Success
 	t.Run("Success", func(t *testing.T) {
-		mockRepo.FindAllFunc = func() ([]int, error) {
-			return []int{100, 200}, nil
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(100, 200), nil
 		}
 
 		req := httptest.NewRequest(http.MethodGet, "/pack/get-sizes", nil)
@@ -53,7 +67,7 @@ func TestHandler_HandleGetPackSizes(t *testing.T) {
 			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
 		}
 
-		wantBody := `{"sizes":[100,200]}`
+		wantBody := `{"sizes":[100,200],"packs":[{"size":100,"active":true},{"size":200,"active":true}],"unit":"pcs"}`
 		if rr.Body.String() != wantBody {
 			t.Errorf("wrong body. got %q, want %q", rr.Body.String(), wantBody)
 		}
@@ -61,7 +75,7 @@ func TestHandler_HandleGetPackSizes(t *testing.T) {
 
 	// Case 2: Service Error
 	t.Run("Service Error", func(t *testing.T) {
-		mockRepo.FindAllFunc = func() ([]int, error) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
 			return nil, errors.New("db broke")
 		}
 
@@ -97,8 +111,8 @@ func TestHandler_HandleSetPackSizes(t *testing.T) {
 
 	// Case 1: Success
 	t.Run("Success", func(t *testing.T) {
-		mockRepo.ReplaceAllFunc = func(sizes []int) error {
-			if !reflect.DeepEqual(sizes, []int{10, 20}) {
+		mockRepo.ReplaceAllFunc = func(ctx context.Context, packs []storage.Pack) error {
+			if !reflect.DeepEqual(packs, storage.NewPacks(10, 20)) {
 				t.Error("ReplaceAll not called with correct args")
 			}
 			return nil
@@ -126,9 +140,23 @@ func TestHandler_HandleSetPackSizes(t *testing.T) {
 		}
 	})
 
-	// Case 3: Service Error
+	// Case 3: Body Too Large
+	t.Run("Body Too Large", func(t *testing.T) {
+		handler, _ := setupTest(WithMaxBodyBytes(8))
+
+		body := bytes.NewBufferString(`{"sizes":[10,20]}`)
+		req := httptest.NewRequest(http.MethodPost, "/pack/set-sizes", body)
+		rr := httptest.NewRecorder()
+		handler.HandleSetPackSizes(rr, req)
+
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+		}
+	})
+
+	// Case 4: Service Error
 	t.Run("Service Error", func(t *testing.T) {
-		mockRepo.ReplaceAllFunc = func(sizes []int) error {
+		mockRepo.ReplaceAllFunc = func(ctx context.Context, packs []storage.Pack) error {
 			return errors.New("db write failed")
 		}
 
@@ -141,6 +169,372 @@ func TestHandler_HandleSetPackSizes(t *testing.T) {
 			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusInternalServerError)
 		}
 	})
+
+	// Case 5: Invalid Sizes
+	t.Run("Invalid Sizes", func(t *testing.T) {
+		mockRepo.ReplaceAllFunc = func(ctx context.Context, packs []storage.Pack) error {
+			t.Error("ReplaceAll called with invalid sizes")
+			return nil
+		}
+
+		for _, body := range []string{`{"sizes":[10,10]}`, `{"sizes":[10,0]}`, `{"sizes":[-10]}`} {
+			req := httptest.NewRequest(http.MethodPost, "/pack/set-sizes", bytes.NewBufferString(body))
+			rr := httptest.NewRecorder()
+			handler.HandleSetPackSizes(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("wrong status for %s. got %d, want %d", body, rr.Code, http.StatusBadRequest)
+			}
+		}
+	})
+}
+
+func TestHandler_HandleSetPackSizes_Packs(t *testing.T) {
+	t.Parallel()
+
+	handler := NewHandler(service.NewPackService(inmemory.NewInMemoryPackRepo()))
+
+	body := `{"packs":[{"size":250,"label":"Small","sku":"4006381333931","cost":0.5,"weight":0.3,"dimensions":{"length":10,"width":10,"height":5}},{"size":500},{"size":1000,"active":false}]}`
+	rr := httptest.NewRecorder()
+	handler.HandleSetPackSizes(rr, httptest.NewRequest(http.MethodPost, "/pack/sizes", bytes.NewBufferString(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleGetPackSizes(rr, httptest.NewRequest(http.MethodGet, "/pack/sizes", nil))
+	wantBody := `{"sizes":[250,500],"packs":[` +
+		`{"size":250,"label":"Small","sku":"4006381333931","cost":0.5,"weight":0.3,"dimensions":{"length":10,"width":10,"height":5},"active":true},` +
+		`{"size":500,"active":true},{"size":1000,"active":false}],"unit":"pcs"}`
+	if rr.Body.String() != wantBody {
+		t.Errorf("wrong body. got %q, want %q", rr.Body.String(), wantBody)
+	}
+
+	// The inactive pack is retained but not used
+	rr = httptest.NewRecorder()
+	handler.HandleCalculate(rr, httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(`{"amount":1000}`)))
+	if want := `{"packs":{"500":2},"unit":"pcs"}`; rr.Body.String() != want {
+		t.Errorf("wrong body. got %q, want %q", rr.Body.String(), want)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleSetPackSizes(rr, httptest.NewRequest(http.MethodPost, "/pack/sizes", bytes.NewBufferString(`{"packs":[{"size":250},{"size":250}]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestHandler_HandleImportPackSizes tests validating and importing every format,
+// and that an export imports back.
+func TestHandler_HandleImportPackSizes(t *testing.T) {
+	t.Parallel()
+
+	handler := NewHandler(service.NewPackService(inmemory.NewInMemoryPackRepo(), service.WithCatalog(inmemory.NewInMemoryCatalogRepo())))
+	router := NewRouter(handler)
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name: "Dry run JSON", path: "/pack/sizes/import?dryRun=true",
+			body:       `{"version":1,"unit":"kg","packs":[{"size":23},{"size":31,"active":false}]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"dryRun":true,"sizes":[23],"packs":[{"size":23,"active":true},{"size":31,"active":false}],"unit":"kg"}`,
+		},
+		{
+			name: "Dry run YAML", path: "/pack/sizes/import?dryRun=true", contentType: "application/yaml",
+			body:       "sizes: [23, 31]\n",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"dryRun":true,"sizes":[23,31],"packs":[{"size":23,"active":true},{"size":31,"active":true}],"unit":"pcs"}`,
+		},
+		{
+			name: "Dry run CSV", path: "/pack/sizes/import?dryRun=1&format=csv",
+			body:       "size,label\n53,Big\n",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"dryRun":true,"sizes":[53],"packs":[{"size":53,"label":"Big","active":true}],"unit":"pcs"}`,
+		},
+		{name: "Duplicate sizes", path: "/pack/sizes/import?dryRun=true", body: `{"sizes":[23,23]}`, wantStatus: http.StatusBadRequest},
+		{name: "Unknown unit", path: "/pack/sizes/import?dryRun=true", body: `{"unit":"furlong","sizes":[23]}`, wantStatus: http.StatusBadRequest},
+		{name: "Invalid document", path: "/pack/sizes/import", contentType: "text/csv", body: "colour\nred\n", wantStatus: http.StatusBadRequest},
+		{name: "Unsupported format", path: "/pack/sizes/import", contentType: "application/xml", body: "<packs/>", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "Invalid dry run", path: "/pack/sizes/import?dryRun=maybe", body: `{"sizes":[23]}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(http.MethodPost, tt.path, tt.contentType, tt.body)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("wrong status. got %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("wrong body. got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	// Dry runs changed nothing
+	if rr := do(http.MethodGet, "/pack/sizes", "", ""); !strings.HasPrefix(rr.Body.String(), `{"sizes":[250,500,1000,2000,5000]`) {
+		t.Fatalf("wrong body. got %q", rr.Body.String())
+	}
+
+	rr := do(http.MethodPost, "/pack/sizes/import", "application/json", `{"unit":"kg","packs":[{"size":23,"sku":"B23"},{"size":31,"active":false}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status. got %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	for _, format := range []string{"json", "yaml", "csv"} {
+		t.Run("Export "+format, func(t *testing.T) {
+			rr := do(http.MethodGet, "/pack/sizes/export?format="+format, "", "")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+			}
+			if got, want := rr.Header().Get("Content-Disposition"), `attachment; filename="pack-sizes-default.`+format+`"`; got != want {
+				t.Errorf("wrong Content-Disposition. got %q, want %q", got, want)
+			}
+
+			// The export imports back as is, CSV keeps the current unit
+			rr = do(http.MethodPost, "/pack/sizes/import?dryRun=true", rr.Header().Get("Content-Type"), rr.Body.String())
+			want := `{"dryRun":true,"sizes":[23],"packs":[{"size":23,"sku":"B23","active":true},{"size":31,"active":false}],"unit":"kg"}`
+			if rr.Body.String() != want {
+				t.Errorf("wrong body. got %q, want %q", rr.Body.String(), want)
+			}
+		})
+	}
+
+	if rr := do(http.MethodGet, "/pack/sizes/export?format=xml", "", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandler_HandleSchedule(t *testing.T) {
+	t.Parallel()
+
+	handler := NewHandler(service.NewPackService(inmemory.NewInMemoryPackRepo(), service.WithSchedule(inmemory.NewInMemoryScheduleRepo())))
+	effectiveAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second).Format(time.RFC3339)
+
+	rr := httptest.NewRecorder()
+	body := `{"effectiveAt":"` + effectiveAt + `","sizes":[300,600]}`
+	handler.HandleScheduleChange(rr, httptest.NewRequest(http.MethodPost, "/pack/schedule", bytes.NewBufferString(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusCreated)
+	}
+	change := `{"id":1,"effectiveAt":"` + effectiveAt + `","packs":[{"size":300,"active":true},{"size":600,"active":true}]}`
+	if rr.Body.String() != change {
+		t.Errorf("wrong body. got %q, want %q", rr.Body.String(), change)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleListScheduledChanges(rr, httptest.NewRequest(http.MethodGet, "/pack/schedule", nil))
+	if want := `{"changes":[` + change + `]}`; rr.Body.String() != want {
+		t.Errorf("wrong body. got %q, want %q", rr.Body.String(), want)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{name: "Current packs", body: `{"amount":750}`, wantBody: `{"packs":{"250":1,"500":1},"unit":"pcs"}`},
+		{name: "As of the change", body: `{"amount":750,"asOf":"` + effectiveAt + `"}`, wantBody: `{"packs":{"300":1,"600":1},"unit":"pcs"}`},
+		{name: "As of the past", body: `{"amount":750,"asOf":"2020-01-01T00:00:00Z"}`, wantBody: `{"error":"as-of date must not be in the past"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.HandleCalculate(rr, httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(tt.body)))
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("wrong body. got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleScheduleChange(rr, httptest.NewRequest(http.MethodPost, "/pack/schedule", bytes.NewBufferString(`{"effectiveAt":"2020-01-01T00:00:00Z","sizes":[300]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	for _, tc := range []struct {
+		id         string
+		wantStatus int
+	}{
+		{id: "1", wantStatus: http.StatusOK},
+		{id: "1", wantStatus: http.StatusNotFound},
+		{id: "first", wantStatus: http.StatusBadRequest},
+	} {
+		rr := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/pack/schedule/"+tc.id, nil), map[string]string{"id": tc.id})
+		handler.HandleCancelScheduledChange(rr, req)
+		if rr.Code != tc.wantStatus {
+			t.Errorf("DELETE %s: wrong status. got %d, want %d", tc.id, rr.Code, tc.wantStatus)
+		}
+	}
+
+	// Without a schedule there is nothing to list
+	handler, _ = setupTest()
+	rr = httptest.NewRecorder()
+	handler.HandleListScheduledChanges(rr, httptest.NewRequest(http.MethodGet, "/pack/schedule", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandler_HandlePackSizesEvents(t *testing.T) {
+	repo := storage.NewTenantPackRepo(func(string) storage.PackRepository {
+		return inmemory.NewInMemoryPackRepo()
+	})
+	handler := NewHandler(service.NewPackService(repo))
+	handler.heartbeatInterval = 10 * time.Millisecond
+
+	server := httptest.NewServer(NewRouter(handler))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/pack/sizes/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open the event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("wrong content type. got %q, want %q", got, "text/event-stream")
+	}
+
+	// next returns the data of the next sizes event, skipping the heartbeats
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		t.Helper()
+		for lines.Scan() {
+			if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+				return data
+			}
+		}
+		t.Fatalf("the event stream ended: %v", lines.Err())
+		return ""
+	}
+
+	want := `{"sizes":[250,500,1000,2000,5000],"packs":[{"size":250,"active":true},{"size":500,"active":true},{"size":1000,"active":true},{"size":2000,"active":true},{"size":5000,"active":true}],"unit":"pcs"}`
+	if got := next(); got != want {
+		t.Errorf("wrong initial event. got %q, want %q", got, want)
+	}
+
+	// Another tenant saving its sizes is not reported, the own tenant is
+	for _, tc := range []struct{ tenant, body string }{
+		{tenant: "other", body: `{"sizes":[700]}`},
+		{tenant: tenant.DefaultID, body: `{"sizes":[300,600]}`},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/pack/sizes", bytes.NewBufferString(tc.body))
+		req.Header.Set(TenantHeader, tc.tenant)
+		rr := httptest.NewRecorder()
+		NewRouter(handler).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+		}
+	}
+
+	want = `{"sizes":[300,600],"packs":[{"size":300,"active":true},{"size":600,"active":true}],"unit":"pcs"}`
+	if got := next(); got != want {
+		t.Errorf("wrong change event. got %q, want %q", got, want)
+	}
+}
+
+func TestHandler_HandleWebhooks(t *testing.T) {
+	received := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(webhook.HeaderEvent)
+	}))
+	defer receiver.Close()
+
+	dispatcher := webhook.NewDispatcher(webhook.WithPrivateDestinations())
+	defer dispatcher.Close()
+
+	bus := events.NewBus()
+	handler := NewHandler(service.NewPackService(inmemory.NewInMemoryPackRepo(),
+		service.WithEventBus(bus), service.WithWebhooks(inmemory.NewInMemoryWebhookRepo(), dispatcher)))
+
+	rr := httptest.NewRecorder()
+	body := `{"url":"` + receiver.URL + `","secret":"s3cret"}`
+	handler.HandleAddWebhook(rr, httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewBufferString(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusCreated)
+	}
+	var created Webhook
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || created.ID != 1 || created.Secret != "s3cret" {
+		t.Errorf("wrong body. got %+v, want the webhook 1 with its secret", created)
+	}
+
+	// The secret is never listed
+	rr = httptest.NewRecorder()
+	handler.HandleListWebhooks(rr, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	want := `{"webhooks":[{"id":1,"url":"` + receiver.URL + `","createdAt":"` + created.CreatedAt.Format(time.RFC3339Nano) + `"}]}`
+	if rr.Body.String() != want {
+		t.Errorf("wrong body. got %q, want %q", rr.Body.String(), want)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleSetPackSizes(rr, httptest.NewRequest(http.MethodPost, "/pack/sizes", bytes.NewBufferString(`{"sizes":[300,600]}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+	}
+	bus.Close()
+	dispatcher.Wait()
+	if len(received) != 1 || <-received != webhook.EventPackSizesChanged {
+		t.Errorf("wrong deliveries. got %d, want one %s event", len(received), webhook.EventPackSizesChanged)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleListDeadLetters(rr, httptest.NewRequest(http.MethodGet, "/webhooks/dead-letters", nil))
+	if want := `{"deadLetters":[]}`; rr.Body.String() != want {
+		t.Errorf("wrong body. got %q, want %q", rr.Body.String(), want)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleAddWebhook(rr, httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewBufferString(`{"url":"not a url"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	for _, tc := range []struct {
+		id         string
+		wantStatus int
+	}{
+		{id: "1", wantStatus: http.StatusOK},
+		{id: "1", wantStatus: http.StatusNotFound},
+		{id: "first", wantStatus: http.StatusBadRequest},
+	} {
+		rr := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/webhooks/"+tc.id, nil), map[string]string{"id": tc.id})
+		handler.HandleDeleteWebhook(rr, req)
+		if rr.Code != tc.wantStatus {
+			t.Errorf("DELETE %s: wrong status. got %d, want %d", tc.id, rr.Code, tc.wantStatus)
+		}
+	}
+
+	// Without webhooks there is nothing to list
+	handler, _ = setupTest()
+	rr = httptest.NewRecorder()
+	handler.HandleListWebhooks(rr, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusNotFound)
+	}
 }
 
 func TestHandler_HandleCalculateOrder(t *testing.T) {
@@ -151,8 +545,8 @@ func TestHandler_HandleCalculateOrder(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		// This handler calls the service, which calls the repo AND the calculator.
 		// We only need to mock the repo part.
-		mockRepo.FindAllFunc = func() ([]int, error) {
-			return []int{250, 500}, nil // Calculator will use these
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 500), nil // Calculator will use these
 		}
 
 		body := bytes.NewBufferString(`{"amount":300}`)
@@ -178,7 +572,7 @@ func TestHandler_HandleCalculateOrder(t *testing.T) {
 
 	// Case 2: Repo Error
 	t.Run("Repo Error", func(t *testing.T) {
-		mockRepo.FindAllFunc = func() ([]int, error) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
 			return nil, errors.New("repo died")
 		}
 
@@ -195,7 +589,26 @@ func TestHandler_HandleCalculateOrder(t *testing.T) {
 		}
 	})
 
-	// Case 3: Bad JSON
+	// Case 3: Client Gone
+	t.Run("Client Gone", func(t *testing.T) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return nil, ctx.Err()
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		body := bytes.NewBufferString(`{"amount":300}`)
+		req := httptest.NewRequest(http.MethodPost, "/calculate", body).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		handler.HandleCalculate(rr, req)
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusServiceUnavailable)
+		}
+	})
+
+	// Case 4: Bad JSON
 	t.Run("Bad JSON", func(t *testing.T) {
 		body := bytes.NewBufferString(`{"amount":`)
 		req := httptest.NewRequest(http.MethodPost, "/calculate", body)
@@ -207,3 +620,488 @@ func TestHandler_HandleCalculateOrder(t *testing.T) {
 		}
 	})
 }
+
+func TestHandler_HandleCalculate_Units(t *testing.T) {
+	t.Parallel()
+
+	mockRepo := &mockPackRepository{
+		FindAllFunc: func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 500), nil
+		},
+		ReplaceAllFunc: func(ctx context.Context, packs []storage.Pack) error {
+			return nil
+		},
+	}
+	handler := NewHandler(service.NewPackService(mockRepo, service.WithCatalog(inmemory.NewInMemoryCatalogRepo())))
+
+	// Sizes are set in grams
+	rr := httptest.NewRecorder()
+	handler.HandleSetPackSizes(rr, httptest.NewRequest(http.MethodPost, "/pack/sizes", bytes.NewBufferString(`{"sizes":[250,500],"unit":"g"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	// A request with invalid packs changes neither the packs nor the unit
+	rr = httptest.NewRecorder()
+	handler.HandleSetPackSizes(rr, httptest.NewRequest(http.MethodPost, "/pack/sizes", bytes.NewBufferString(`{"packs":[{"size":250},{"size":250}],"unit":"kg"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	if unit, err := handler.service.Unit(context.Background()); err != nil || unit.Symbol != "g" {
+		t.Errorf("Unit() = %v, %v, want the unit before the failed request", unit.Symbol, err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Kilograms", body: `{"amount":0.3,"unit":"kg"}`, wantStatus: http.StatusOK, wantBody: `{"packs":{"500":1},"unit":"g"}`},
+		{name: "Catalog unit", body: `{"amount":250}`, wantStatus: http.StatusOK, wantBody: `{"packs":{"250":1},"unit":"g"}`},
+		{name: "Incompatible unit", body: `{"amount":1,"unit":"l"}`, wantStatus: http.StatusBadRequest, wantBody: `{"error":"incompatible units"}`},
+		{name: "Too many decimals", body: `{"amount":0.0001,"unit":"kg"}`, wantStatus: http.StatusBadRequest, wantBody: `{"error":"Invalid request body"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.HandleCalculate(rr, httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(tt.body)))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("wrong status. got %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("wrong body. got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleCalculate_Fit(t *testing.T) {
+	t.Parallel()
+
+	mockRepo := &mockPackRepository{
+		FindAllFunc: func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 500, 1000), nil
+		},
+	}
+	handler := NewHandler(service.NewPackService(mockRepo, service.WithResultCache(10, time.Minute)))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Exact fit", body: `{"amount":750,"exactOnly":true}`, wantStatus: http.StatusOK, wantBody: `{"packs":{"250":1,"500":1},"unit":"pcs"}`},
+		{name: "No exact fit", body: `{"amount":751,"exactOnly":true}`, wantStatus: http.StatusUnprocessableEntity,
+			wantBody: `{"error":"no combination of packs satisfies the constraints"}`},
+		{name: "Excess within 10%", body: `{"amount":1200,"maxExcessPercent":10}`, wantStatus: http.StatusOK, wantBody: `{"packs":{"1000":1,"250":1},"unit":"pcs"}`},
+		{name: "Excess above 10", body: `{"amount":1200,"maxExcess":10}`, wantStatus: http.StatusUnprocessableEntity,
+			wantBody: `{"error":"no combination of packs satisfies the constraints"}`},
+		{name: "Under ship", body: `{"amount":1200,"underShip":true}`, wantStatus: http.StatusOK, wantBody: `{"packs":{"1000":1},"unit":"pcs"}`},
+		// The cached result of the default mode must not answer the under-ship mode
+		{name: "Default after under ship", body: `{"amount":1200}`, wantStatus: http.StatusOK, wantBody: `{"packs":{"1000":1,"250":1},"unit":"pcs"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.HandleCalculate(rr, httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(tt.body)))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("wrong status. got %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("wrong body. got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleRules(t *testing.T) {
+	t.Parallel()
+
+	mockRepo := &mockPackRepository{
+		FindAllFunc: func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 5000), nil
+		},
+	}
+	handler := NewHandler(service.NewPackService(mockRepo, service.WithCatalog(inmemory.NewInMemoryCatalogRepo())))
+
+	rules := `{"rules":[{"kind":"minAmount","size":5000,"amount":10000},{"kind":"maxCount","size":250,"count":4}]}`
+	rr := httptest.NewRecorder()
+	handler.HandleSetRules(rr, httptest.NewRequest(http.MethodPost, "/pack/rules", bytes.NewBufferString(rules)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleGetRules(rr, httptest.NewRequest(http.MethodGet, "/pack/rules", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != rules {
+		t.Fatalf("wrong response. got %d %q, want %d %q", rr.Code, rr.Body.String(), http.StatusOK, rules)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Large amount", body: `{"amount":10000}`, wantStatus: http.StatusOK, wantBody: `{"packs":{"5000":2},"unit":"pcs"}`},
+		{name: "Max count", body: `{"amount":12000,"exactOnly":true}`, wantStatus: http.StatusUnprocessableEntity,
+			wantBody: `{"error":"no combination of packs satisfies the constraints: at most 4 packs of 250","rule":{"kind":"maxCount","size":250,"count":4}}`},
+		{name: "Min amount", body: `{"amount":5000}`, wantStatus: http.StatusUnprocessableEntity,
+			wantBody: `{"error":"no combination of packs satisfies the constraints: packs of 5000 only for amounts of at least 10000","rule":{"kind":"minAmount","size":5000,"amount":10000}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.HandleCalculate(rr, httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(tt.body)))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("wrong status. got %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if rr.Body.String() != tt.wantBody {
+				t.Errorf("wrong body. got %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	rr = httptest.NewRecorder()
+	handler.HandleSetRules(rr, httptest.NewRequest(http.MethodPost, "/pack/rules", bytes.NewBufferString(`{"rules":[{"kind":"never"}]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandler_HandleCalculate_Timeout(t *testing.T) {
+	t.Parallel()
+	handler, mockRepo := setupTest(WithCalculationTimeout(time.Millisecond))
+
+	// Block until the calculation deadline expires
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	body := bytes.NewBufferString(`{"amount":300}`)
+	req := httptest.NewRequest(http.MethodPost, "/calculate", body)
+	rr := httptest.NewRecorder()
+	handler.HandleCalculate(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusGatewayTimeout)
+	}
+
+	wantBody := `{"error":"calculation timed out"}`
+	if rr.Body.String() != wantBody {
+		t.Errorf("wrong body. got %q, want %q", rr.Body.String(), wantBody)
+	}
+}
+
+func TestHandler_HandleCalculate_AmountTooLarge(t *testing.T) {
+	t.Parallel()
+
+	mockRepo := &mockPackRepository{
+		FindAllFunc: func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 500), nil
+		},
+	}
+	handler := NewHandler(service.NewPackService(mockRepo, service.WithMaxAmount(1000)))
+
+	body := bytes.NewBufferString(`{"amount":1001}`)
+	req := httptest.NewRequest(http.MethodPost, "/calculate", body)
+	rr := httptest.NewRecorder()
+	handler.HandleCalculate(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestHandler_HandleCacheStats(t *testing.T) {
+	t.Parallel()
+
+	mockRepo := &mockPackRepository{
+		FindAllFunc: func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 500), nil
+		},
+	}
+	handler := NewHandler(service.NewPackService(mockRepo, service.WithResultCache(10, time.Minute)))
+
+	// One miss followed by one hit
+	for i := 0; i < 2; i++ {
+		body := bytes.NewBufferString(`{"amount":300}`)
+		handler.HandleCalculate(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/calculate", body))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/calculate/cache-stats", nil)
+	rr := httptest.NewRecorder()
+	handler.HandleCacheStats(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	wantBody := `{"enabled":true,"hits":1,"misses":1,"evictions":0,"size":1,"capacity":10,"hitRatio":0.5}`
+	if rr.Body.String() != wantBody {
+		t.Errorf("wrong body. got %q, want %q", rr.Body.String(), wantBody)
+	}
+}
+
+func TestHandler_HandleAnalyzePackSizes(t *testing.T) {
+	t.Parallel()
+	handler, mockRepo := setupTest()
+
+	// Case 1: Current sizes
+	t.Run("Current Sizes", func(t *testing.T) {
+		mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(300, 500, 800), nil
+		}
+
+		body := bytes.NewBufferString(`{"from":1,"to":500}`)
+		req := httptest.NewRequest(http.MethodPost, "/pack/sizes/analyze", body)
+		rr := httptest.NewRecorder()
+		handler.HandleAnalyzePackSizes(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+		}
+
+		wantBody := `{"gcd":100,"redundant":[800],"periodicThreshold":3501,"from":1,"to":500,` +
+			`"worstExcess":299,"worstExcessAmount":1,"averageExcess":129.5}`
+		if rr.Body.String() != wantBody {
+			t.Errorf("wrong body. got %q, want %q", rr.Body.String(), wantBody)
+		}
+	})
+
+	// Case 2: Invalid Range
+	t.Run("Invalid Range", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"sizes":[3,5],"from":10,"to":5}`)
+		req := httptest.NewRequest(http.MethodPost, "/pack/sizes/analyze", body)
+		rr := httptest.NewRecorder()
+		handler.HandleAnalyzePackSizes(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestHandler_HandleComparePackSizes(t *testing.T) {
+	t.Parallel()
+	handler, mockRepo := setupTest()
+	mockRepo.FindAllFunc = func(ctx context.Context) ([]storage.Pack, error) {
+		return storage.NewPacks(250, 500, 1000), nil
+	}
+
+	// Case 1: Success
+	t.Run("Success", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"sizes":[300,100],"amounts":[1,300,750],"excessItemCost":0.5,"packCost":1}`)
+		req := httptest.NewRequest(http.MethodPost, "/pack/sizes/compare", body)
+		rr := httptest.NewRecorder()
+		handler.HandleComparePackSizes(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+		}
+
+		wantBody := `{"current":{"sizes":[250,500,1000],"orders":3,"totalExcess":449,"totalPacks":4,"cost":228.5},` +
+			`"candidate":{"sizes":[100,300],"orders":3,"totalExcess":149,"totalPacks":6,"cost":80.5},` +
+			`"deltaExcess":-300,"deltaPacks":2,"deltaCost":-148}`
+		if rr.Body.String() != wantBody {
+			t.Errorf("wrong body. got %q, want %q", rr.Body.String(), wantBody)
+		}
+	})
+
+	// Case 2: No Amounts
+	t.Run("No Amounts", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"sizes":[300,100]}`)
+		req := httptest.NewRequest(http.MethodPost, "/pack/sizes/compare", body)
+		rr := httptest.NewRecorder()
+		handler.HandleComparePackSizes(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	// Case 3: Candidate table too large, every amount is solved on its own
+	t.Run("Table Too Large", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"sizes":[4999,5000],"amounts":[1,10000]}`)
+		req := httptest.NewRequest(http.MethodPost, "/pack/sizes/compare", body)
+		rr := httptest.NewRecorder()
+		handler.HandleComparePackSizes(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("wrong status. got %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		if want := `"candidate":{"sizes":[4999,5000],"orders":2,"totalExcess":4998,"totalPacks":3,`; !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("wrong body. got %q, want it to contain %q", rr.Body.String(), want)
+		}
+	})
+}
+
+func TestHandler_HandleRecommendPackSizes(t *testing.T) {
+	t.Parallel()
+	handler, _ := setupTest()
+
+	// Case 1: Success
+	t.Run("Success", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"amounts":[300,300,700],"maxCount":2,"excessItemCost":1,"packCost":1,"limit":1}`)
+		req := httptest.NewRequest(http.MethodPost, "/pack/sizes/recommend", body)
+		rr := httptest.NewRecorder()
+		handler.HandleRecommendPackSizes(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+		}
+
+		wantBody := `{"recommendations":[{"sizes":[300,700],"orders":3,"totalExcess":0,"totalPacks":3,` +
+			`"averageExcess":0,"averagePacks":1,"cost":3}]}`
+		if rr.Body.String() != wantBody {
+			t.Errorf("wrong body. got %q, want %q", rr.Body.String(), wantBody)
+		}
+	})
+
+	// Case 2: Invalid Constraints
+	t.Run("Invalid Constraints", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"amounts":[300],"maxCount":0}`)
+		req := httptest.NewRequest(http.MethodPost, "/pack/sizes/recommend", body)
+		rr := httptest.NewRecorder()
+		handler.HandleRecommendPackSizes(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestHandler_HandlePlanShipment(t *testing.T) {
+	t.Parallel()
+	handler, _ := setupTest()
+
+	// Case 1: Success
+	t.Run("Success", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"lines":[` +
+			`{"amount":750,"packs":[{"size":250,"volume":10,"weight":1},{"size":500,"volume":18,"weight":2}]},` +
+			`{"amount":2,"packs":[{"size":1,"volume":1,"weight":0.5}]}],` +
+			`"containers":[{"name":"carton","maxVolume":30,"maxWeight":0,"cost":1.5}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/shipments/plan", body)
+		rr := httptest.NewRecorder()
+		handler.HandlePlanShipment(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+		}
+
+		wantBody := `{"lines":[{"packs":{"250":1,"500":1}},{"packs":{"1":2}}],"containers":[` +
+			`{"type":"carton","volume":30,"weight":4,"contents":[{"line":0,"size":500,"count":1},{"line":0,"size":250,"count":1},{"line":1,"size":1,"count":2}]}],` +
+			`"totalCost":1.5}`
+		if rr.Body.String() != wantBody {
+			t.Errorf("wrong body. got %q, want %q", rr.Body.String(), wantBody)
+		}
+	})
+
+	// Case 2: Pack Too Large
+	t.Run("Pack Too Large", func(t *testing.T) {
+		body := bytes.NewBufferString(`{"lines":[{"amount":1,"packs":[{"size":1,"volume":50}]}],` +
+			`"containers":[{"name":"carton","maxVolume":30}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/shipments/plan", body)
+		rr := httptest.NewRecorder()
+		handler.HandlePlanShipment(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestHandler_HandleListCalculations(t *testing.T) {
+	t.Parallel()
+
+	mockRepo := &mockPackRepository{
+		FindAllFunc: func(ctx context.Context) ([]storage.Pack, error) {
+			return storage.NewPacks(250, 500), nil
+		},
+	}
+	handler := NewHandler(service.NewPackService(mockRepo, service.WithHistory(inmemory.NewInMemoryCalculationRepo())))
+
+	for _, amount := range []string{"1", "300", "750"} {
+		req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(`{"amount":`+amount+`}`))
+		req.RemoteAddr = "10.0.0.1:54321"
+		handler.HandleCalculate(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    []int64
+		wantTotal  int
+	}{
+		{name: "All, newest first", query: "", wantStatus: http.StatusOK, wantIDs: []int64{3, 2, 1}, wantTotal: 3},
+		{name: "Paginated", query: "?limit=1&offset=1", wantStatus: http.StatusOK, wantIDs: []int64{2}, wantTotal: 3},
+		{name: "By amount", query: "?minAmount=2&maxAmount=500", wantStatus: http.StatusOK, wantIDs: []int64{2}, wantTotal: 1},
+		{name: "By requester", query: "?requester=10.0.0.2", wantStatus: http.StatusOK, wantIDs: []int64{}, wantTotal: 0},
+		{name: "Invalid time", query: "?from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "Invalid limit", query: "?limit=5000", wantStatus: http.StatusBadRequest},
+		{name: "Negative offset", query: "?offset=-1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.HandleListCalculations(rr, httptest.NewRequest(http.MethodGet, "/calculations"+tt.query, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("wrong status. got %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp ListCalculationsResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("could not decode response: %v", err)
+			}
+
+			ids := make([]int64, 0, len(resp.Calculations))
+			for _, c := range resp.Calculations {
+				ids = append(ids, c.ID)
+				if c.Requester != "10.0.0.1" {
+					t.Errorf("wrong requester. got %q, want %q", c.Requester, "10.0.0.1")
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("wrong IDs. got %v, want %v", ids, tt.wantIDs)
+			}
+			if resp.Total != tt.wantTotal || resp.Stats.Count != tt.wantTotal {
+				t.Errorf("wrong totals. got %d and %d, want %d", resp.Total, resp.Stats.Count, tt.wantTotal)
+			}
+		})
+	}
+
+	// The stats cover every matching calculation: 249 + 200 + 0
+	rr := httptest.NewRecorder()
+	handler.HandleListCalculations(rr, httptest.NewRequest(http.MethodGet, "/calculations?limit=1", nil))
+
+	var resp ListCalculationsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if resp.Stats.TotalExcess != 449 || len(resp.Stats.Daily) != 1 || resp.Stats.Daily[0].MostUsedSize != 250 {
+		t.Errorf("wrong stats. got %+v", resp.Stats)
+	}
+}
+
+func TestHandler_HandleListCalculations_Disabled(t *testing.T) {
+	t.Parallel()
+	handler, _ := setupTest()
+
+	rr := httptest.NewRecorder()
+	handler.HandleListCalculations(rr, httptest.NewRequest(http.MethodGet, "/calculations", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,255 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// limiterIdleTTL is how long an idle client bucket is kept before being swept.
+const limiterIdleTTL = 10 * time.Minute
+
+// RateLimiter is a per-client token bucket rate limiter.
+// Clients are identified by ClientIP, or by tenant with TenantMiddleware.
+type RateLimiter struct {
+	rate  float64 // tokens added per second
+	burst float64 // bucket capacity
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing rps requests per second
+// per client, with bursts of up to burst requests.
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rps,
+		burst:   math.Max(float64(burst), 1),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether the client identified by key may perform a request now.
+func (l *RateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = b
+	}
+
+	// Refill the bucket for the time elapsed since the last request
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*l.rate)
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// sweep drops the buckets of clients that have been idle for a while,
+// so the map does not grow with every client ever seen.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterIdleTTL {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= limiterIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware rejects requests above the client's rate with 429 Too Many Requests.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return l.middleware(next, ClientIP)
+}
+
+// TenantMiddleware rejects requests above the tenant's rate with 429 Too Many Requests.
+// The tenant is read from the request context, so it runs after the TenantResolver.
+func (l *RateLimiter) TenantMiddleware(next http.Handler) http.Handler {
+	return l.middleware(next, func(r *http.Request) string {
+		return tenant.FromContext(r.Context())
+	})
+}
+
+// middleware rejects requests above the rate of the bucket returned by key.
+func (l *RateLimiter) middleware(next http.Handler, key func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.Allow(key(r)) {
+			w.Header().Set("Retry-After", "1")
+			respondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ConcurrencyLimiter bounds the number of requests processed at the same time.
+type ConcurrencyLimiter struct {
+	slots chan struct{}
+}
+
+// NewConcurrencyLimiter creates a limiter allowing up to n concurrent requests.
+func NewConcurrencyLimiter(n int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		slots: make(chan struct{}, n),
+	}
+}
+
+// Middleware rejects requests with 429 Too Many Requests when all slots are busy.
+// Requests never queue, so a burst of slow calculations cannot pile up.
+func (l *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l.slots <- struct{}{}:
+			defer func() { <-l.slots }()
+		default:
+			w.Header().Set("Retry-After", "1")
+			respondWithError(w, http.StatusTooManyRequests, "Too many concurrent requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIPKey is the context key of the client address set by TrustedProxies.
+type clientIPKey struct{}
+
+// ClientIP returns the address of the client that issued the request, as
+// identified by the TrustedProxies middleware, otherwise the peer address.
+// Forwarding headers are never read here, any client can set them.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+
+	return peerHost(r)
+}
+
+// peerHost returns the host of the peer address of the request.
+func peerHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// TrustedProxies are the networks of the reverse proxies, such as the Nginx one,
+// trusted to report the client address in their forwarding headers.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// ParseTrustedProxies parses the networks of the trusted proxies, in CIDR
+// notation or as single addresses. No networks trust no proxy.
+func ParseTrustedProxies(cidrs []string) (*TrustedProxies, error) {
+	p := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", cidr)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			p.nets = append(p.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		p.nets = append(p.nets, n)
+	}
+
+	return p, nil
+}
+
+// trusts reports whether the address belongs to a trusted proxy.
+func (p *TrustedProxies) trusts(ip net.IP) bool {
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP returns the address of the client that issued the request. The
+// forwarding headers are only read from a trusted proxy: the rightmost address
+// of X-Forwarded-For that is not a trusted proxy, otherwise X-Real-IP.
+// Requests from other peers are identified by the peer address.
+func (p *TrustedProxies) ClientIP(r *http.Request) string {
+	host := peerHost(r)
+	if ip := net.ParseIP(host); ip == nil || !p.trusts(ip) {
+		return host
+	}
+
+	// Every proxy appends the address it received the request from
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		addrs := strings.Split(strings.Join(values, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(addrs[i]))
+			if ip == nil {
+				break
+			}
+			if i == 0 || !p.trusts(ip) {
+				return ip.String()
+			}
+		}
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	return host
+}
+
+// Middleware identifies the client of every request for ClientIP.
+func (p *TrustedProxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, p.ClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
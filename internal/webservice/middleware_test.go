@@ -0,0 +1,142 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := NewRateLimiter(1, 2)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	// The burst is available immediately
+	if !limiter.Allow("a") || !limiter.Allow("a") {
+		t.Fatal("Allow() rejected a request within the burst")
+	}
+	if limiter.Allow("a") {
+		t.Error("Allow() accepted a request above the burst")
+	}
+
+	// Other clients have their own bucket
+	if !limiter.Allow("b") {
+		t.Error("Allow() rejected a request from another client")
+	}
+
+	// One token is refilled after one second
+	now = now.Add(time.Second)
+	if !limiter.Allow("a") {
+		t.Error("Allow() rejected a request after the bucket was refilled")
+	}
+	if limiter.Allow("a") {
+		t.Error("Allow() accepted a request above the refilled tokens")
+	}
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/pack/sizes", nil)
+		req.RemoteAddr = "10.0.0.1:54321"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("wrong statuses. got %v, want [%d %d]", codes, http.StatusOK, http.StatusTooManyRequests)
+	}
+}
+
+func TestConcurrencyLimiter_Middleware(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Occupy the only slot
+	done := make(chan int)
+	go func() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/calculate", nil))
+		done <- rr.Code
+	}()
+	<-entered
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/calculate", nil))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("wrong status. got %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("wrong status. got %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"172.16.0.0/12", " 10.0.0.5", ""})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() returned an unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		realIP       string
+		forwardedFor []string
+		want         string
+	}{
+		{name: "Peer address", remoteAddr: "192.168.1.10:54321", want: "192.168.1.10"},
+		{name: "Header from an untrusted peer", remoteAddr: "192.168.1.10:54321", realIP: "10.0.0.1", forwardedFor: []string{"10.0.0.2"}, want: "192.168.1.10"},
+		{name: "X-Real-IP from a trusted proxy", remoteAddr: "172.18.0.3:80", realIP: "203.0.113.7", want: "203.0.113.7"},
+		{name: "X-Forwarded-For from a trusted proxy", remoteAddr: "172.18.0.3:80", realIP: "10.0.0.5", forwardedFor: []string{"198.51.100.1, 203.0.113.7", "10.0.0.5"}, want: "203.0.113.7"},
+		{name: "Spoofed X-Forwarded-For", remoteAddr: "10.0.0.5:80", forwardedFor: []string{"1.2.3.4, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "Only trusted proxies", remoteAddr: "10.0.0.5:80", forwardedFor: []string{"172.16.0.1"}, want: "172.16.0.1"},
+		{name: "Malformed headers", remoteAddr: "10.0.0.5:80", realIP: "unknown", forwardedFor: []string{"unknown"}, want: "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			for _, v := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			var got string
+			proxies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+
+			// Without trusted proxies the headers are ignored
+			if got, want := ClientIP(req), strings.Split(tt.remoteAddr, ":")[0]; got != want {
+				t.Errorf("ClientIP() without the middleware = %q, want %q", got, want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("ParseTrustedProxies() error = %v, want an error", err)
+	}
+}
@@ -4,17 +4,129 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+
+	"denisgodoroja/retask/internal/tenant"
 )
 
+// routerConfig holds the optional router settings.
+type routerConfig struct {
+	rateLimiter        *RateLimiter
+	tenantRateLimiter  *RateLimiter
+	concurrencyLimiter *ConcurrencyLimiter
+	tenantResolver     *TenantResolver
+	tenantMetrics      *TenantMetrics
+	trustedProxies     *TrustedProxies
+}
+
+// RouterOption configures optional router settings.
+type RouterOption func(*routerConfig)
+
+// WithRateLimit enables per-client rate limiting on all routes.
+func WithRateLimit(rps float64, burst int) RouterOption {
+	return func(c *routerConfig) {
+		c.rateLimiter = NewRateLimiter(rps, burst)
+	}
+}
+
+// WithTenantRateLimit enables per-tenant rate limiting on all routes,
+// on top of the per-client rate limit.
+func WithTenantRateLimit(rps float64, burst int) RouterOption {
+	return WithTenantRateLimiter(NewRateLimiter(rps, burst))
+}
+
+// WithTenantRateLimiter limits the requests of every tenant with l, which may be
+// shared with the gRPC server so a tenant cannot exceed its rate over either API.
+func WithTenantRateLimiter(l *RateLimiter) RouterOption {
+	return func(c *routerConfig) {
+		c.tenantRateLimiter = l
+	}
+}
+
+// WithTenantResolver identifies the tenant of every request with the resolver,
+// instead of trusting the X-Tenant-ID header.
+func WithTenantResolver(r *tenant.Resolver) RouterOption {
+	return func(c *routerConfig) {
+		c.tenantResolver = NewTenantResolver(r)
+	}
+}
+
+// WithTenantMetrics counts the requests of every tenant in m.
+func WithTenantMetrics(m *TenantMetrics) RouterOption {
+	return func(c *routerConfig) {
+		c.tenantMetrics = m
+	}
+}
+
+// WithTrustedProxies reads the client address of the requests forwarded by the
+// proxies from their forwarding headers, see TrustedProxies.ClientIP.
+// By default the client is the peer address.
+func WithTrustedProxies(p *TrustedProxies) RouterOption {
+	return func(c *routerConfig) {
+		c.trustedProxies = p
+	}
+}
+
+// WithConcurrencyLimit bounds the number of calculations processed at the same time.
+func WithConcurrencyLimit(n int) RouterOption {
+	return func(c *routerConfig) {
+		c.concurrencyLimiter = NewConcurrencyLimiter(n)
+	}
+}
+
 // NewRouter creates and configures a new router.
 // It wires all application routes to their corresponding handler methods.
-func NewRouter(h *Handler) http.Handler {
+func NewRouter(h *Handler, opts ...RouterOption) http.Handler {
+	cfg := routerConfig{
+		tenantResolver: NewTenantResolver(tenant.NewResolver()),
+		tenantMetrics:  NewTenantMetrics(),
+		trustedProxies: &TrustedProxies{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	// Create a new router from gorilla/mux
 	router := mux.NewRouter()
 
+	// Every request belongs to a client and a tenant, counted before being rate limited
+	router.Use(cfg.trustedProxies.Middleware, cfg.tenantResolver.Middleware, cfg.tenantMetrics.Middleware)
+	if cfg.rateLimiter != nil {
+		router.Use(cfg.rateLimiter.Middleware)
+	}
+	if cfg.tenantRateLimiter != nil {
+		router.Use(cfg.tenantRateLimiter.TenantMiddleware)
+	}
+
+	// limit applies the concurrency limit to the routes running calculations
+	limit := func(f http.HandlerFunc) http.Handler {
+		if cfg.concurrencyLimiter == nil {
+			return f
+		}
+		return cfg.concurrencyLimiter.Middleware(f)
+	}
+
 	router.HandleFunc("/pack/sizes", h.HandleGetPackSizes).Methods(http.MethodGet)
 	router.HandleFunc("/pack/sizes", h.HandleSetPackSizes).Methods(http.MethodPost)
-	router.HandleFunc("/calculate", h.HandleCalculate).Methods(http.MethodPost)
+	router.HandleFunc("/pack/sizes/events", h.HandlePackSizesEvents).Methods(http.MethodGet)
+	router.HandleFunc("/pack/sizes/export", h.HandleExportPackSizes).Methods(http.MethodGet)
+	router.HandleFunc("/pack/sizes/import", h.HandleImportPackSizes).Methods(http.MethodPost)
+	router.HandleFunc("/pack/schedule", h.HandleListScheduledChanges).Methods(http.MethodGet)
+	router.HandleFunc("/pack/schedule", h.HandleScheduleChange).Methods(http.MethodPost)
+	router.HandleFunc("/pack/schedule/{id}", h.HandleCancelScheduledChange).Methods(http.MethodDelete)
+	router.HandleFunc("/webhooks", h.HandleListWebhooks).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks", h.HandleAddWebhook).Methods(http.MethodPost)
+	router.HandleFunc("/webhooks/dead-letters", h.HandleListDeadLetters).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/{id}", h.HandleDeleteWebhook).Methods(http.MethodDelete)
+	router.HandleFunc("/pack/rules", h.HandleGetRules).Methods(http.MethodGet)
+	router.HandleFunc("/pack/rules", h.HandleSetRules).Methods(http.MethodPost)
+	router.Handle("/pack/sizes/analyze", limit(h.HandleAnalyzePackSizes)).Methods(http.MethodPost)
+	router.Handle("/pack/sizes/compare", limit(h.HandleComparePackSizes)).Methods(http.MethodPost)
+	router.Handle("/pack/sizes/recommend", limit(h.HandleRecommendPackSizes)).Methods(http.MethodPost)
+	router.Handle("/calculate", limit(h.HandleCalculate)).Methods(http.MethodPost)
+	router.Handle("/shipments/plan", limit(h.HandlePlanShipment)).Methods(http.MethodPost)
+	router.HandleFunc("/calculate/cache-stats", h.HandleCacheStats).Methods(http.MethodGet)
+	router.HandleFunc("/calculations", h.HandleListCalculations).Methods(http.MethodGet)
+	router.HandleFunc("/tenant/stats", cfg.tenantMetrics.HandleStats).Methods(http.MethodGet)
 
 	return router
 }
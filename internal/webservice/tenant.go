@@ -0,0 +1,196 @@
+package webservice
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// TenantHeader is the request header identifying the tenant.
+const TenantHeader = "X-Tenant-ID"
+
+// TenantResolver identifies the tenant of every request with a tenant.Resolver
+// and stores it in the request context. The tenant is read from the X-Tenant-ID
+// header, or from the bearer token of the Authorization header.
+type TenantResolver struct {
+	resolver *tenant.Resolver
+}
+
+// NewTenantResolver creates the HTTP middleware of the resolver.
+func NewTenantResolver(r *tenant.Resolver) *TenantResolver {
+	return &TenantResolver{resolver: r}
+}
+
+// Middleware resolves the tenant of the request. It responds with 400 Bad Request
+// for an invalid tenant ID, 401 Unauthorized for a missing or invalid token and
+// 403 Forbidden for a tenant that is not allowed.
+func (t *TenantResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := t.resolver.Resolve(r.Header.Get(TenantHeader), r.Header.Get("Authorization"))
+		switch {
+		case errors.Is(err, tenant.ErrInvalidToken):
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		case errors.Is(err, tenant.ErrUnknown):
+			respondWithError(w, http.StatusForbidden, "Unknown tenant")
+			return
+		case err != nil:
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), id)))
+	})
+}
+
+// TenantStats holds the request counters of a tenant.
+type TenantStats struct {
+	Tenant       string `json:"tenant"`
+	Requests     int64  `json:"requests"`
+	ClientErrors int64  `json:"clientErrors"`
+	ServerErrors int64  `json:"serverErrors"`
+	RateLimited  int64  `json:"rateLimited"`
+}
+
+// Without a token secret the tenant IDs are chosen by the clients, so the
+// metrics drop the tenants idle for tenantStatsIdleTTL and track at most
+// maxTrackedTenants, dropping the least recently seen one for a new tenant.
+const (
+	tenantStatsIdleTTL = 24 * time.Hour
+	maxTrackedTenants  = 10_000
+)
+
+// TenantMetrics counts the requests of every tenant by outcome.
+type TenantMetrics struct {
+	mu         sync.Mutex
+	stats      map[string]*tenantCounters
+	maxTenants int
+	lastSweep  time.Time
+
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// tenantCounters are the counters of a tenant and the time of its last request.
+type tenantCounters struct {
+	TenantStats
+	lastSeen time.Time
+}
+
+// NewTenantMetrics creates empty tenant metrics.
+func NewTenantMetrics() *TenantMetrics {
+	return &TenantMetrics{
+		stats:      make(map[string]*tenantCounters),
+		maxTenants: maxTrackedTenants,
+		now:        time.Now,
+	}
+}
+
+// Stats returns the counters of the tenant, zero once the tenant was dropped.
+func (m *TenantMetrics) Stats(id string) TenantStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.stats[id]; ok {
+		return s.TenantStats
+	}
+
+	return TenantStats{Tenant: id}
+}
+
+// record counts a request of the tenant answered with the status code.
+func (m *TenantMetrics) record(id string, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	s, ok := m.stats[id]
+	if !ok {
+		if len(m.stats) >= m.maxTenants {
+			m.evictOldest()
+		}
+		s = &tenantCounters{TenantStats: TenantStats{Tenant: id}}
+		m.stats[id] = s
+	}
+	s.lastSeen = now
+
+	s.Requests++
+	switch {
+	case code == http.StatusTooManyRequests:
+		s.RateLimited++
+	case code >= 500:
+		s.ServerErrors++
+	case code >= 400:
+		s.ClientErrors++
+	}
+}
+
+// sweep drops the tenants idle for a while. The caller holds mu.
+func (m *TenantMetrics) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < limiterIdleTTL {
+		return
+	}
+	m.lastSweep = now
+
+	for id, s := range m.stats {
+		if now.Sub(s.lastSeen) >= tenantStatsIdleTTL {
+			delete(m.stats, id)
+		}
+	}
+}
+
+// evictOldest drops the least recently seen tenant. The caller holds mu.
+func (m *TenantMetrics) evictOldest() {
+	oldest := ""
+	for id, s := range m.stats {
+		if oldest == "" || s.lastSeen.Before(m.stats[oldest].lastSeen) {
+			oldest = id
+		}
+	}
+	delete(m.stats, oldest)
+}
+
+// Middleware counts the requests of the tenant of the request context.
+func (m *TenantMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		m.record(tenant.FromContext(r.Context()), sw.code)
+	})
+}
+
+// HandleStats handles GET /tenant/stats, the counters of the caller's tenant.
+func (m *TenantMetrics) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Invalid method")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, m.Stats(tenant.FromContext(r.Context())))
+}
+
+// statusWriter records the status code written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
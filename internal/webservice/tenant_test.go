@@ -0,0 +1,191 @@
+package webservice
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"denisgodoroja/retask/internal/service"
+	"denisgodoroja/retask/internal/storage"
+	"denisgodoroja/retask/internal/storage/inmemory"
+	"denisgodoroja/retask/internal/tenant"
+)
+
+// signToken returns an HS256 token with the claims signed with the secret.
+func signToken(secret, claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + payload))
+
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestTenantResolver_Middleware(t *testing.T) {
+	testCases := []struct {
+		name       string
+		opts       []tenant.ResolverOption
+		header     string
+		token      string
+		wantStatus int
+		wantTenant string
+	}{
+		{name: "Header", header: "north", wantStatus: http.StatusOK, wantTenant: "north"},
+		{name: "No header", wantStatus: http.StatusOK, wantTenant: tenant.DefaultID},
+		{name: "Invalid header", header: "north/south", wantStatus: http.StatusBadRequest},
+		{name: "Allowed", opts: []tenant.ResolverOption{tenant.WithAllowed("north")}, header: "north", wantStatus: http.StatusOK, wantTenant: "north"},
+		{name: "Not allowed", opts: []tenant.ResolverOption{tenant.WithAllowed("north")}, header: "south", wantStatus: http.StatusForbidden},
+		{
+			name: "Token", opts: []tenant.ResolverOption{tenant.WithTokenSecret([]byte("s3cret"))}, header: "south",
+			token:      signToken("s3cret", `{"tenant":"north"}`),
+			wantStatus: http.StatusOK, wantTenant: "north",
+		},
+		{name: "Missing token", opts: []tenant.ResolverOption{tenant.WithTokenSecret([]byte("s3cret"))}, header: "north", wantStatus: http.StatusUnauthorized},
+		{
+			name: "Expired token", opts: []tenant.ResolverOption{tenant.WithTokenSecret([]byte("s3cret"))},
+			token:      signToken("s3cret", `{"tenant":"north","exp":1735686000}`),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotTenant string
+			handler := NewTenantResolver(tenant.NewResolver(tc.opts...)).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotTenant = tenant.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/pack/sizes", nil)
+			if tc.header != "" {
+				req.Header.Set(TenantHeader, tc.header)
+			}
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Errorf("wrong status. got %d, want %d", rr.Code, tc.wantStatus)
+			}
+			if gotTenant != tc.wantTenant {
+				t.Errorf("wrong tenant. got %q, want %q", gotTenant, tc.wantTenant)
+			}
+		})
+	}
+}
+
+func TestTenantMetrics(t *testing.T) {
+	metrics := NewTenantMetrics()
+	router := NewRouter(&Handler{}, WithTenantMetrics(metrics), WithTenantRateLimit(1, 1))
+
+	// The second request of north is rate limited, south has its own bucket
+	for _, id := range []string{"north", "north", "south"} {
+		req := httptest.NewRequest(http.MethodGet, "/tenant/stats", nil)
+		req.Header.Set(TenantHeader, id)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := TenantStats{Tenant: "north", Requests: 2, RateLimited: 1}
+	if got := metrics.Stats("north"); got != want {
+		t.Errorf("Stats() got = %+v, want %+v", got, want)
+	}
+	want = TenantStats{Tenant: "south", Requests: 1}
+	if got := metrics.Stats("south"); got != want {
+		t.Errorf("Stats() got = %+v, want %+v", got, want)
+	}
+}
+
+// TestTenantMetrics_Eviction tests that the metrics do not grow with every tenant ID ever seen.
+func TestTenantMetrics_Eviction(t *testing.T) {
+	metrics := NewTenantMetrics()
+	metrics.maxTenants = 2
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	metrics.now = func() time.Time { return now }
+
+	record := func(ids ...string) {
+		for _, id := range ids {
+			metrics.record(id, http.StatusOK)
+			now = now.Add(time.Second)
+		}
+	}
+
+	// A new tenant drops the least recently seen one
+	record("north", "south", "north", "east")
+	if got := metrics.Stats("south"); got.Requests != 0 {
+		t.Errorf("Stats(south) got = %+v, want it dropped", got)
+	}
+	if got := metrics.Stats("north"); got.Requests != 2 {
+		t.Errorf("Stats(north) got = %+v, want 2 requests", got)
+	}
+
+	// Idle tenants are dropped
+	now = now.Add(tenantStatsIdleTTL)
+	record("west")
+	if len(metrics.stats) != 1 {
+		t.Errorf("got %d tracked tenants, want 1", len(metrics.stats))
+	}
+	if got := metrics.Stats("west"); got.Requests != 1 {
+		t.Errorf("Stats(west) got = %+v, want 1 request", got)
+	}
+}
+
+// TestRouter_TenantIsolation tests that setting the pack sizes of a tenant
+// never affects the calculations of another one.
+func TestRouter_TenantIsolation(t *testing.T) {
+	repo := storage.NewTenantPackRepo(func(string) storage.PackRepository {
+		return inmemory.NewInMemoryPackRepo()
+	})
+	router := NewRouter(NewHandler(service.NewPackService(repo, service.WithResultCache(10, time.Minute))))
+
+	do := func(id, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set(TenantHeader, id)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Both tenants start from the default sizes and share cached results
+	for _, id := range []string{"north", "south"} {
+		rr := do(id, http.MethodPost, "/calculate", `{"amount": 263}`)
+		if want := `{"packs":{"500":1},"unit":"pcs"}`; rr.Body.String() != want {
+			t.Fatalf("wrong body for %s. got %q, want %q", id, rr.Body.String(), want)
+		}
+	}
+
+	if rr := do("north", http.MethodPost, "/pack/sizes", `{"sizes": [23, 31, 53]}`); rr.Code != http.StatusOK {
+		t.Fatalf("wrong status. got %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	testCases := []struct {
+		tenant   string
+		wantBody string
+	}{
+		{tenant: "north", wantBody: `{"packs":{"23":2,"31":7},"unit":"pcs"}`},
+		{tenant: "south", wantBody: `{"packs":{"500":1},"unit":"pcs"}`},
+		{tenant: tenant.DefaultID, wantBody: `{"packs":{"500":1},"unit":"pcs"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tenant, func(t *testing.T) {
+			rr := do(tc.tenant, http.MethodPost, "/calculate", `{"amount": 263}`)
+			if rr.Body.String() != tc.wantBody {
+				t.Errorf("wrong body. got %q, want %q", rr.Body.String(), tc.wantBody)
+			}
+		})
+	}
+
+	rr := do("south", http.MethodGet, "/pack/sizes", "")
+	if !strings.HasPrefix(rr.Body.String(), `{"sizes":[250,500,1000,2000,5000]`) {
+		t.Errorf("wrong body. got %q", rr.Body.String())
+	}
+}